@@ -1,42 +1,443 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
 )
 
 type Config struct {
-	Telegram TelegramConfig `toml:"telegram,omitempty"`
-	Logging  LoggingConfig  `toml:"logging,omitempty"`
+	// UserAgent is sent with all requests to Telegram and GitHub. Defaults to daily-reporter/<version>.
+	UserAgent string         `toml:"user_agent,omitempty"`
+	Telegram  TelegramConfig `toml:"telegram,omitempty"`
+	Github    GithubConfig   `toml:"github,omitempty"`
+	Logging   LoggingConfig  `toml:"logging,omitempty"`
+
+	// sources are where the settings that aren't default came from, see Source
+	sources map[string]string
 }
 
 type TelegramConfig struct {
-	Token    string `toml:"token,omitempty"`
-	Threads  uint   `toml:"threads,omitempty"`
-	Template string `toml:"template,omitempty"`
+	Token         string              `toml:"token,omitempty"`
+	Threads       uint                `toml:"threads,omitempty"`
+	Template      string              `toml:"template,omitempty"`
+	ReportHistory ReportHistoryConfig `toml:"report_history,omitempty"`
+	// ParseMode is how Telegram reads the formatting of messages: "html" or "markdownv2", the Template must match
+	ParseMode string `toml:"parse_mode,omitempty"`
+	// InlineProcessing processes updates one by one in the same goroutine. Debug only, there is no parallelism.
+	InlineProcessing bool `toml:"inline_processing,omitempty"`
+	// SeenUpdates is how many update IDs are remembered to drop updates that were received twice. 0 turns it off.
+	SeenUpdates uint `toml:"seen_updates,omitempty"`
+	// ReplayFile has recorded updates to process instead of asking Telegram. Actions are only logged. Debug only.
+	ReplayFile string `toml:"replay_file,omitempty"`
+	// RecordFile is where each update and the bot's actions are appended, to replay them later. Secrets are redacted.
+	RecordFile string `toml:"record_file,omitempty"`
+	// ResetOffset is an update ID to start from, or "latest" to skip the updates sent while the bot was offline.
+	// Skipped updates are deleted by Telegram and never processed.
+	ResetOffset string `toml:"reset_offset,omitempty"`
+	// ShowProjectCursors shows the pagination cursor of each project in /listProjects
+	ShowProjectCursors bool `toml:"show_project_cursors,omitempty"`
+	// SendDelayMs is the pause between messages to the same chat in response to one update. 0 turns it off.
+	SendDelayMs uint `toml:"send_delay_ms,omitempty"`
+	// MaxConversations is how many updates can be queued or processed at once, others get a busy reply. 0 is no limit.
+	MaxConversations uint `toml:"max_conversations,omitempty"`
+	// Aliases are other names of commands, e.g. {ds = "dailyStatus"}
+	Aliases map[string]string `toml:"aliases,omitempty"`
+	// StoreFile keeps API keys, settings and conversation states across restarts. Empty keeps them in memory only.
+	StoreFile string `toml:"store_file,omitempty"`
+	// SecretKey encrypts the GitHub API keys in StoreFile. Without it the keys are not saved.
+	SecretKey string `toml:"secret_key,omitempty"`
+	// DailyStatus configures the reports of /dailyStatus
+	DailyStatus DailyStatusConfig `toml:"daily_status,omitempty"`
+	// Webhook makes Telegram send updates to an HTTP server instead of the bot asking for them
+	Webhook WebhookConfig `toml:"webhook,omitempty"`
+	// AdminChatID is the chat that gets the results of the startup self-test. Empty only logs them.
+	AdminChatID string `toml:"admin_chat_id,omitempty"`
+	// AllowedUsers and AllowedChats are the only users and chats the bot serves. Both empty serves everyone.
+	AllowedUsers []int64 `toml:"allowed_users,omitempty"`
+	AllowedChats []int64 `toml:"allowed_chats,omitempty"`
+}
+
+// Allowlist is telegram.allowed_users and telegram.allowed_chats for the client.
+func (c TelegramConfig) Allowlist() state.Allowlist {
+	allowlist := state.Allowlist{
+		Users: make([]update.UserID, 0, len(c.AllowedUsers)),
+		Chats: make([]update.ChatID, 0, len(c.AllowedChats)),
+	}
+
+	for _, id := range c.AllowedUsers {
+		allowlist.Users = append(allowlist.Users, update.UserID(id))
+	}
+
+	for _, id := range c.AllowedChats {
+		allowlist.Chats = append(allowlist.Chats, update.ChatID(id))
+	}
+
+	return allowlist
+}
+
+// SendDelay is telegram.send_delay_ms as a duration.
+func (c TelegramConfig) SendDelay() time.Duration {
+	return time.Duration(c.SendDelayMs) * time.Millisecond
+}
+
+// WebhookConfig turns on webhook mode if URL is set. Telegram sends the updates to URL + Path.
+type WebhookConfig struct {
+	// URL is the public HTTPS address of the bot without the path, e.g. "https://bot.example.com"
+	URL string `toml:"url,omitempty"`
+	// Listen is the address the webhook server listens on, e.g. ":8080"
+	Listen string `toml:"listen,omitempty"`
+	// Path is where the updates are sent to, e.g. "/telegram"
+	Path string `toml:"path,omitempty"`
+}
+
+/*
+DailyStatusConfig sets the project columns of each report section for chats that haven't changed them with
+/reportConfig.
+*/
+type DailyStatusConfig struct {
+	Today    string `toml:"today,omitempty"`
+	Tomorrow string `toml:"tomorrow,omitempty"`
+	Review   string `toml:"review,omitempty"`
+	// ShowOtherColumns lists the items from all other columns in an "Other" section
+	ShowOtherColumns bool `toml:"show_other_columns,omitempty"`
+}
+
+// Config returns the config for the client. Empty columns are the state.DefaultReportColumns.
+func (c DailyStatusConfig) Config() state.DailyStatusConfig {
+	columns := state.ReportColumns{Today: c.Today, Tomorrow: c.Tomorrow, InReview: c.Review}
+
+	return state.DailyStatusConfig{
+		Columns:          columns.Or(state.DefaultReportColumns()),
+		ShowOtherColumns: c.ShowOtherColumns,
+	}
+}
+
+// ReportHistoryConfig limits how many sent reports are kept per user. 0 means no limit.
+type ReportHistoryConfig struct {
+	Keep       uint `toml:"keep,omitempty"`
+	MaxAgeDays uint `toml:"max_age_days,omitempty"`
+}
+
+func (c ReportHistoryConfig) Retention() state.ReportRetention {
+	const day = 24 * time.Hour
+
+	return state.ReportRetention{
+		Keep:   c.Keep,
+		MaxAge: time.Duration(c.MaxAgeDays) * day,
+	}
+}
+
+type GithubConfig struct {
+	// Endpoint is the GraphQL API of a GitHub Enterprise Server, e.g. https://github.example.com/api/graphql. Empty is
+	// the public GitHub API.
+	Endpoint string `toml:"endpoint,omitempty"`
+	// ReportConcurrency is how many projects are requested at the same time for one report
+	ReportConcurrency uint `toml:"report_concurrency,omitempty"`
 }
 
 type LoggingConfig struct {
 	Level string `toml:"level,omitempty"`
+	// File is where the logs are appended to. Empty logs to stderr.
+	File string `toml:"file,omitempty"`
 }
 
-// Reads the config file from config.toml and returns it. Panics if there are any errors.
-func mustNewConfig() Config {
-	conf := Config{
+const (
+	// defaultConfigFile is read if -config or DAILY_REPORTER_CONFIG don't choose a different file
+	defaultConfigFile = "config.toml"
+	// configEnvPrefix is followed by the key of a setting in uppercase with "_" instead of ".", e.g.
+	// DAILY_REPORTER_TELEGRAM_TOKEN sets telegram.token
+	configEnvPrefix = "DAILY_REPORTER_"
+	// configFileFlag is the flag (and the env var after configEnvPrefix) that sets which config file to read
+	configFileFlag = "config"
+
+	sourceDefault    = "default"
+	sourceConfigFile = "config file "
+	sourceEnv        = "env "
+	sourceFlag       = "flag -"
+)
+
+func defaultConfig() Config {
+	return Config{
+		UserAgent: "daily-reporter/" + version,
 		Telegram: TelegramConfig{
 			Token:    "",
 			Threads:  1,
 			Template: "assets/telegram/strings.yaml",
+			ReportHistory: ReportHistoryConfig{
+				Keep:       10, //nolint:gomnd // Default config
+				MaxAgeDays: 30, //nolint:gomnd // Default config
+			},
+			ParseMode:          string(response.ParseModeHTML),
+			InlineProcessing:   false,
+			SeenUpdates:        100, //nolint:gomnd // Default config
+			ReplayFile:         "",
+			RecordFile:         "",
+			ResetOffset:        "",
+			Aliases:            map[string]string{},
+			ShowProjectCursors: false,
+			SendDelayMs:        1000, //nolint:gomnd // Default config
+			MaxConversations:   0,
+			StoreFile:          "",
+			SecretKey:          "",
+			DailyStatus: DailyStatusConfig{
+				Today:            state.DefaultReportColumns().Today,
+				Tomorrow:         state.DefaultReportColumns().Tomorrow,
+				Review:           state.DefaultReportColumns().InReview,
+				ShowOtherColumns: false,
+			},
+			Webhook: WebhookConfig{
+				URL:    "",
+				Listen: ":8080",
+				Path:   "/telegram",
+			},
+			AdminChatID:  "",
+			AllowedUsers: []int64{},
+			AllowedChats: []int64{},
+		},
+		Github: GithubConfig{
+			Endpoint:          "",
+			ReportConcurrency: 4, //nolint:gomnd // Default config
 		},
 		Logging: LoggingConfig{
 			Level: "info",
+			File:  "",
 		},
+		sources: map[string]string{},
+	}
+}
+
+/*
+LoadConfig reads the config from all of its sources. Each source overrides the ones before it:
+
+ 1. The defaults
+ 2. The config file: config.toml, or the file set with -config or DAILY_REPORTER_CONFIG
+ 3. Environment variables, e.g. DAILY_REPORTER_TELEGRAM_TOKEN for telegram.token
+ 4. Command line flags in `args`, e.g. -telegram.token=...
+
+Tables and lists like telegram.aliases and telegram.allowed_users can only be set in the config file. If the default
+config file doesn't exist the rest of the sources are still used, a file that was chosen explicitly must exist.
+*/
+func LoadConfig(args []string, env map[string]string) (Config, error) {
+	conf := defaultConfig()
+	settings := conf.settings()
+
+	flags, fileFlag, err := parseConfigFlags(args, settings)
+	if err != nil {
+		return Config{}, err
+	}
+
+	configFile, explicitFile := configFileFrom(fileFlag, env)
+
+	if err = conf.loadFile(configFile, explicitFile, settings); err != nil {
+		return Config{}, err
+	}
+
+	for _, setting := range settings {
+		envVar := setting.envVar()
+
+		value, isSet := env[envVar]
+		if !isSet {
+			continue
+		}
+
+		if err = setting.set(value); err != nil {
+			return Config{}, fmt.Errorf("in %s: %w", envVar, err)
+		}
+
+		conf.sources[setting.key] = sourceEnv + envVar
+	}
+
+	for _, cmdFlag := range flags {
+		if err = cmdFlag.setting.set(cmdFlag.value); err != nil {
+			return Config{}, fmt.Errorf("in -%s: %w", cmdFlag.setting.key, err)
+		}
+
+		conf.sources[cmdFlag.setting.key] = sourceFlag + cmdFlag.setting.key
+	}
+
+	if err = validateEndpoint(conf.Github.Endpoint); err != nil {
+		return Config{}, fmt.Errorf("in %s: %w", conf.Source("github.endpoint"), err)
+	}
+
+	return conf, nil
+}
+
+// validateEndpoint fails if github.endpoint is set but is not an absolute URL, i.e. with a scheme and a host.
+func validateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(endpoint)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return fmt.Errorf("github.endpoint should be an absolute URL (e.g. https://github.example.com/api/graphql), "+
+			"not %q", endpoint)
+	}
+
+	return nil
+}
+
+/*
+Source returns where the value of a setting came from: "default", "config file <path>", "env <VAR>" or "flag -<key>".
+`key` is the same as in the config file, e.g. "telegram.token".
+*/
+func (c Config) Source(key string) string {
+	if source, isSet := c.sources[key]; isSet {
+		return source
+	}
+
+	return sourceDefault
+}
+
+// setting is a value in Config that can be set from a string, e.g. from an env var.
+type setting struct {
+	// key is the path to the setting in the config file, e.g. "telegram.token"
+	key   string
+	value reflect.Value
+}
+
+// settings lists the settings in the config. The values point into `c`, so setting them changes `c`.
+func (c *Config) settings() []setting {
+	return collectSettings(reflect.ValueOf(c).Elem(), "")
+}
+
+func collectSettings(structValue reflect.Value, prefix string) []setting {
+	var settings []setting
+
+	for i := 0; i < structValue.NumField(); i++ {
+		name, _, _ := strings.Cut(structValue.Type().Field(i).Tag.Get("toml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		field := structValue.Field(i)
+
+		switch field.Kind() { //nolint:exhaustive // Only these kinds are used in Config
+		case reflect.Struct:
+			settings = append(settings, collectSettings(field, prefix+name+".")...)
+		case reflect.String, reflect.Bool, reflect.Uint:
+			settings = append(settings, setting{key: prefix + name, value: field})
+		}
+	}
+
+	return settings
+}
+
+// envVar is the environment variable that sets the setting.
+func (s setting) envVar() string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+func (s setting) set(value string) error {
+	switch s.value.Kind() { //nolint:exhaustive // Only these kinds are collected by collectSettings
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s should be true or false, not %q", s.key, value)
+		}
+
+		s.value.SetBool(parsed)
+	case reflect.Uint:
+		parsed, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return fmt.Errorf("%s should be a positive number, not %q", s.key, value)
+		}
+
+		s.value.SetUint(parsed)
+	default:
+		s.value.SetString(value)
+	}
+
+	return nil
+}
+
+// configFlag is a flag from the command line that is applied after the config file and the env.
+type configFlag struct {
+	setting setting
+	value   string
+}
+
+// flagValue collects the flag's values instead of setting them right away.
+type flagValue struct {
+	setting setting
+	flags   *[]configFlag
+}
+
+func (v flagValue) String() string { return "" }
+
+func (v flagValue) Set(value string) error {
+	*v.flags = append(*v.flags, configFlag{setting: v.setting, value: value})
+
+	return nil
+}
+
+// IsBoolFlag allows "-telegram.inline_processing" without "=true".
+func (v flagValue) IsBoolFlag() bool { return v.setting.value.Kind() == reflect.Bool }
+
+// parseConfigFlags returns the settings from the command line in order, and the value of -config if it was used.
+func parseConfigFlags(args []string, settings []setting) ([]configFlag, option.Option[string], error) {
+	flagSet := flag.NewFlagSet("daily-reporter", flag.ContinueOnError)
+	flags := []configFlag{}
+
+	configFile := flagSet.String(configFileFlag, "", "The config file, "+defaultConfigFile+" by default")
+
+	for _, setting := range settings {
+		flagSet.Var(flagValue{setting: setting, flags: &flags}, setting.key, "Sets "+setting.key+" from the config file")
+	}
+
+	if err := flagSet.Parse(args); err != nil {
+		return nil, option.None[string](), fmt.Errorf("while parsing the command line: %w", err)
+	}
+
+	if *configFile == "" {
+		return flags, option.None[string](), nil
+	}
+
+	return flags, option.Some(*configFile), nil
+}
+
+// configFileFrom returns which config file to read and if it was chosen explicitly by a flag or env var.
+func configFileFrom(flagValue option.Option[string], env map[string]string) (string, bool) {
+	if file, isSome := flagValue.Unwrap(); isSome {
+		return file, true
+	}
+
+	if file := env[configEnvPrefix+strings.ToUpper(configFileFlag)]; file != "" {
+		return file, true
+	}
+
+	return defaultConfigFile, false
+}
+
+// loadFile overrides the settings with the ones in the file.
+func (c *Config) loadFile(path string, explicit bool, settings []setting) error {
+	metadata, err := toml.DecodeFile(path, c)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("while reading the config file %s: %w", path, err)
 	}
 
-	if _, err := toml.DecodeFile("config.toml", &conf); err != nil {
-		log.Fatal(err) //nolint:forbidigo // package logging hasn't been initialized yet
+	for _, setting := range settings {
+		if metadata.IsDefined(strings.Split(setting.key, ".")...) {
+			c.sources[setting.key] = sourceConfigFile + path
+		}
 	}
 
-	return conf
+	return nil
 }
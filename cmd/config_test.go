@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("While writing the config file: %s", err)
+	}
+
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfigFile(t, `
+[telegram]
+token = "from file"
+threads = 2
+seen_updates = 5
+allowed_users = [1, 2]
+
+[telegram.aliases]
+ds = "dailyStatus"
+
+[logging]
+level = "debug"
+`)
+
+	conf, err := LoadConfig(
+		[]string{"-config", path, "-telegram.token=from flag", "-telegram.inline_processing"},
+		map[string]string{
+			"DAILY_REPORTER_TELEGRAM_TOKEN":   "from env",
+			"DAILY_REPORTER_TELEGRAM_THREADS": "3",
+		},
+	)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %s", err)
+	}
+
+	cases := []struct {
+		key, source     string
+		value, expected interface{}
+	}{
+		{"telegram.token", "flag -telegram.token", conf.Telegram.Token, "from flag"},
+		{"telegram.threads", "env DAILY_REPORTER_TELEGRAM_THREADS", conf.Telegram.Threads, uint(3)},
+		{"telegram.seen_updates", "config file " + path, conf.Telegram.SeenUpdates, uint(5)},
+		{"logging.level", "config file " + path, conf.Logging.Level, "debug"},
+		{"telegram.inline_processing", "flag -telegram.inline_processing", conf.Telegram.InlineProcessing, true},
+		{"github.report_concurrency", "default", conf.Github.ReportConcurrency, uint(4)},
+		{"github.endpoint", "default", conf.Github.Endpoint, ""},
+	}
+
+	for _, c := range cases {
+		if c.value != c.expected {
+			t.Errorf("%s is %v, expected %v", c.key, c.value, c.expected)
+		}
+
+		if source := conf.Source(c.key); source != c.source {
+			t.Errorf("%s comes from %q, expected %q", c.key, source, c.source)
+		}
+	}
+
+	if conf.Telegram.Aliases["ds"] != "dailyStatus" {
+		t.Errorf("Aliases from the file were not loaded: %v", conf.Telegram.Aliases)
+	}
+
+	if allowlist := conf.Telegram.Allowlist(); len(allowlist.Users) != 2 || allowlist.Users[1] != 2 ||
+		len(allowlist.Chats) != 0 {
+		t.Errorf("Allowlist from the file was not loaded: %+v", allowlist)
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfigFile(t, "[telegram]\ntoken = \"from file\"\n")
+
+	conf, err := LoadConfig([]string{}, map[string]string{"DAILY_REPORTER_CONFIG": path})
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %s", err)
+	}
+
+	if conf.Telegram.Token != "from file" {
+		t.Fatalf("The file from DAILY_REPORTER_CONFIG was not read, token is %q", conf.Telegram.Token)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		args []string
+		env  map[string]string
+	}{
+		"missing explicit file": {[]string{"-config", filepath.Join(t.TempDir(), "missing.toml")}, nil},
+		"unknown flag":          {[]string{"-telegram.tokn=x"}, nil},
+		"invalid number":        {[]string{}, map[string]string{"DAILY_REPORTER_TELEGRAM_THREADS": "many"}},
+		"invalid bool":          {[]string{"-telegram.inline_processing=maybe"}, nil},
+		"relative endpoint":     {[]string{"-github.endpoint=/api/graphql"}, nil},
+		"endpoint without host": {[]string{}, map[string]string{"DAILY_REPORTER_GITHUB_ENDPOINT": "https:api/graphql"}},
+	}
+
+	for name, c := range cases {
+		if _, err := LoadConfig(c.args, c.env); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -1,38 +1,137 @@
 package main
 
 import (
+	"context"
+	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
 	"github.com/m-kuzmin/daily-reporter/internal/template"
 	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
 )
 
+// version is set when building with -ldflags "-X main.version=...", see the Makefile.
+var version = "dev"
+
 func main() {
-	conf := mustNewConfig()
+	if len(os.Args) > 1 && os.Args[1] == renderCommand {
+		if err := render(os.Args[2:], environ(), os.Stdout); err != nil {
+			log.Fatal(err) //nolint:forbidigo // render doesn't set up package logging
+		}
+
+		return
+	}
+
+	conf, err := LoadConfig(os.Args[1:], environ())
+	if err != nil {
+		log.Fatal(err) //nolint:forbidigo // package logging hasn't been initialized yet
+	}
+
+	setupLogger(conf.Logging.Level, conf.Logging.File)
+	logConfigSources(conf)
 
-	setupLogger(conf.Logging.Level)
+	setupParseMode(conf.Telegram.ParseMode)
 
 	client := setupTgClient(conf.Telegram.Token, conf.Telegram.Template)
-	fail := client.Start(conf.Telegram.Threads)
+	client.SetReportRetention(conf.Telegram.ReportHistory.Retention())
+	client.SetInlineProcessing(conf.Telegram.InlineProcessing)
+	client.SetSeenUpdatesSize(conf.Telegram.SeenUpdates)
+	client.SetReportConcurrency(conf.Github.ReportConcurrency)
+	client.SetUserAgent(conf.UserAgent)
+	client.SetGithubEndpoint(conf.Github.Endpoint)
+	client.SetShowProjectCursors(conf.Telegram.ShowProjectCursors)
+	client.SetSendDelay(conf.Telegram.SendDelay())
+	client.SetMaxConversations(conf.Telegram.MaxConversations)
+	client.SetDailyStatusConfig(conf.Telegram.DailyStatus.Config())
+
+	if conf.Telegram.ReplayFile != "" {
+		client.SetReplayFile(conf.Telegram.ReplayFile)
+	}
+
+	if conf.Telegram.RecordFile != "" {
+		client.SetRecordFile(conf.Telegram.RecordFile)
+	}
+
+	setupResetOffset(&client, conf.Telegram.ResetOffset)
+
+	closeStore := func() error { return nil }
+
+	if conf.Telegram.StoreFile != "" {
+		store, err := state.OpenFileStore(conf.Telegram.StoreFile)
+		if err != nil {
+			logging.Fatalf("In telegram.store_file: %s", err)
+		}
+
+		setupEncrypter(store, conf.Telegram.SecretKey)
+		client.SetStore(store)
+		closeStore = store.Close
+	}
+
+	aliases, err := state.NewCommandAliases(conf.Telegram.Aliases)
+	if err != nil {
+		logging.Fatalf("In telegram.aliases: %s", err)
+	}
+
+	client.SetCommandAliases(aliases)
+	client.SetAllowlist(conf.Telegram.Allowlist())
 
-	ctrlC := make(chan os.Signal, 1)
-	signal.Notify(ctrlC, os.Interrupt, syscall.SIGTERM)
+	// Done on ^C (SIGTERM), the bot starts shutting down right away
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	if conf.Telegram.ReplayFile == "" { // A replay doesn't talk to Telegram
+		selfTest(ctx, &client, selfTestChecks(&client, conf.Telegram.Template, conf.Github.Endpoint, conf.UserAgent),
+			parseAdminChatID(conf.Telegram.AdminChatID))
+	}
+
+	var fail <-chan error
+
+	if webhook := conf.Telegram.Webhook; webhook.URL != "" {
+		client.SetWebhookURL(webhook.URL)
+		fail = client.StartWebhookContext(ctx, webhook.Listen, webhook.Path, conf.Telegram.Threads)
+	} else {
+		fail = client.StartContext(ctx, conf.Telegram.Threads)
+	}
 
 	select {
 	case err := <-fail:
-		logging.Fatalf("Bot crashed with error: %s", err)
-	case <-ctrlC:
+		logging.Errorf("Bot crashed with error: %s", err)
+		shutdown(func() {}, closeStore, logging.Close) // The client has already stopped itself
+		os.Exit(1)
+	case <-ctx.Done():
 		logging.Infof("Received ^C (SIGTERM), stopping the bot (Graceful shutdown).")
-		client.Stop()
+		shutdown(client.Stop, closeStore, logging.Close)
 	}
 }
 
-func setupLogger(level string) {
+/*
+shutdown stops the bot and then closes what it writes to. The order matters: the store is closed after the last update
+was processed and saved, and the logs are closed last, so that errors from closing the store are still written.
+*/
+func shutdown(stop func(), closeStore, closeLogs func() error) {
+	stop()
+
+	logging.Infof("GitHub queries have used %d rate limit points since the start", github.TotalQueryCost())
+
+	if err := closeStore(); err != nil {
+		logging.Errorf("While closing the store: %s", err)
+	}
+
+	if err := closeLogs(); err != nil {
+		logging.Errorf("While closing the log file: %s", err) // Goes to stderr after closeLogs
+	}
+}
+
+func setupLogger(level, file string) {
 	switch strings.ToLower(level) {
 	case "trace":
 		logging.LogLevel = logging.LogLevelTrace
@@ -40,16 +139,115 @@ func setupLogger(level string) {
 		logging.LogLevel = logging.LogLevelDebug
 	case "info":
 		logging.LogLevel = logging.LogLevelInfo
+	case "warn":
+		logging.LogLevel = logging.LogLevelWarn
 	case "error":
 		logging.LogLevel = logging.LogLevelError
 	case "fatal":
 		logging.LogLevel = logging.LogLevelFatal
 	}
+
+	if file == "" {
+		return
+	}
+
+	const readableByAll = 0o644
+
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, readableByAll)
+	if err != nil {
+		logging.Fatalf("While opening logging.file: %s", err)
+	}
+
+	if err = logging.SetOutput(out); err != nil {
+		logging.Errorf("%s", err)
+	}
+}
+
+// environ returns the environment variables by name.
+func environ() map[string]string {
+	env := make(map[string]string)
+
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		env[name] = value
+	}
+
+	return env
+}
+
+// logConfigSources logs where each setting that isn't default came from, but not the values (e.g. the token).
+func logConfigSources(conf Config) {
+	for _, setting := range conf.settings() {
+		if source := conf.Source(setting.key); source != sourceDefault {
+			logging.Debugf("Config: %s is set by %s", setting.key, source)
+		}
+	}
+}
+
+// setupResetOffset applies telegram.reset_offset from the config: "" does nothing, "latest" skips the backlog.
+func setupResetOffset(client *telegram.Client, resetOffset string) {
+	switch resetOffset {
+	case "":
+		return
+	case "latest":
+		logging.Infof("Skipping all updates that were sent while the bot was offline (telegram.reset_offset)")
+		client.SkipBacklog()
+
+		return
+	}
+
+	offset, err := strconv.ParseInt(resetOffset, 10, 64)
+	if err != nil {
+		logging.Fatalf("telegram.reset_offset should be an update ID or \"latest\", not %q", resetOffset)
+	}
+
+	logging.Infof("Skipping all updates before (UpdateID %d) (telegram.reset_offset)", offset)
+	client.SetStartOffset(update.UpdateID(offset))
+}
+
+// parseAdminChatID reads telegram.admin_chat_id from the config, "" is no admin chat.
+func parseAdminChatID(chatID string) option.Option[update.ChatID] {
+	if chatID == "" {
+		return option.None[update.ChatID]()
+	}
+
+	parsed, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		logging.Fatalf("telegram.admin_chat_id should be a chat ID, not %q", chatID)
+	}
+
+	return option.Some(update.ChatID(parsed))
+}
+
+// setupParseMode sets the parse mode of all messages to telegram.parse_mode.
+func setupParseMode(mode string) {
+	parseMode, isValid := response.ParseParseMode(mode)
+	if !isValid {
+		logging.Fatalf("telegram.parse_mode should be \"html\" or \"markdownv2\", not %q", mode)
+	}
+
+	response.SetDefaultParseMode(parseMode)
+}
+
+// setupEncrypter makes the store encrypt API keys with telegram.secret_key. Without a secret the keys are not saved.
+func setupEncrypter(store *state.FileStore, secret string) {
+	if secret == "" {
+		logging.Infof("No telegram.secret_key, GitHub API keys will not be saved in telegram.store_file")
+
+		return
+	}
+
+	encrypter, err := state.NewAESEncrypter(secret)
+	if err != nil {
+		logging.Fatalf("In telegram.secret_key: %s", err)
+	}
+
+	store.SetEncrypter(encrypter)
 }
 
 func setupTgClient(token, templateFile string) telegram.Client {
 	if token == "" {
-		logging.Fatalf("No telegram token in config.toml, exiting.")
+		logging.Fatalf("No telegram.token in the config, exiting.")
 	}
 
 	templ, err := template.LoadYAMLTemplate(templateFile)
@@ -62,5 +260,11 @@ func setupTgClient(token, templateFile string) telegram.Client {
 		logging.Fatalf("While populating state.Responses: %s", err)
 	}
 
+	if err = responses.LoadReportTemplates(templ); err != nil {
+		logging.Fatalf("While loading report templates from %s: %s", templateFile, err)
+	}
+
+	responses.LoadCommandDescriptions(templ)
+
 	return telegram.NewClient("api.telegram.org", token, responses)
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	t.Parallel()
+
+	calls := []string{}
+
+	shutdown(
+		func() { calls = append(calls, "stop") },
+		func() error {
+			calls = append(calls, "store")
+
+			return errors.New("disk is full") //nolint:goerr113 // Only checks that closing continues
+		},
+		func() error {
+			calls = append(calls, "logs")
+
+			return nil
+		},
+	)
+
+	if expected := []string{"stop", "store", "logs"}; !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("Expected %v, got %v", expected, calls)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/m-kuzmin/daily-reporter/internal/template"
+)
+
+// renderCommand is the first argument that runs render instead of the bot
+const renderCommand = "render"
+
+/*
+render prints a string from the template the way the bot would send it:
+
+	daily-reporter render [-template strings.yaml] <group> <key> [args...]
+
+The vars of the key are substituted like in Group.Get, then `args` fill in what the bot passes at runtime (e.g. the
+project ID in root.fieldsHeader). The template is telegram.template from the config unless -template is used.
+*/
+func render(args []string, env map[string]string, out io.Writer) error {
+	conf, err := LoadConfig(nil, env)
+	if err != nil {
+		return err
+	}
+
+	flagSet := flag.NewFlagSet("daily-reporter "+renderCommand, flag.ContinueOnError)
+	flagSet.SetOutput(out)
+
+	templateFile := flagSet.String("template", conf.Telegram.Template, "The template file to render from")
+
+	if err = flagSet.Parse(args); err != nil {
+		return fmt.Errorf("while parsing the command line: %w", err)
+	}
+
+	const groupAndKey = 2
+
+	if flagSet.NArg() < groupAndKey {
+		return RenderUsageError{}
+	}
+
+	templ, err := template.LoadYAMLTemplate(*templateFile)
+	if err != nil {
+		return fmt.Errorf("while loading yaml template from %s: %w", *templateFile, err)
+	}
+
+	group, err := templ.Get(flagSet.Arg(0))
+	if err != nil {
+		return fmt.Errorf("in %s: %w", *templateFile, err)
+	}
+
+	rendered, err := group.Get(flagSet.Arg(1))
+	if err != nil {
+		return fmt.Errorf("in %s: %w", *templateFile, err)
+	}
+
+	if runtimeArgs := flagSet.Args()[groupAndKey:]; len(runtimeArgs) != 0 {
+		values := make([]any, len(runtimeArgs))
+		for i, arg := range runtimeArgs {
+			values[i] = arg
+		}
+
+		rendered = fmt.Sprintf(rendered, values...)
+	}
+
+	_, err = fmt.Fprintln(out, rendered)
+
+	return err //nolint:wrapcheck // Only fails if stdout is closed
+}
+
+// RenderUsageError is returned by render if the group or the key is missing.
+type RenderUsageError struct{}
+
+func (RenderUsageError) Error() string {
+	return "usage: daily-reporter " + renderCommand + " [-template strings.yaml] <group> <key> [args...]"
+}
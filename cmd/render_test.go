@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/template"
+)
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "strings.yaml")
+	if err := os.WriteFile(path, []byte(`---
+vars:
+  botName: "Reporter"
+templates:
+  root:
+    greeting: ["Hi, I am %s! Your project is <code>%%s</code>.", botName]
+    plain: ["Nothing to fill in"]
+...`), 0o600); err != nil {
+		t.Fatalf("While writing the template: %s", err)
+	}
+
+	tests := map[string]struct {
+		args     []string
+		expected string
+	}{
+		"vars and args": {
+			args:     []string{"-template", path, "root", "greeting", "PVT_1"},
+			expected: "Hi, I am Reporter! Your project is <code>PVT_1</code>.\n",
+		},
+		"without args": {
+			args:     []string{"-template", path, "root", "plain"},
+			expected: "Nothing to fill in\n",
+		},
+	}
+
+	for name, test := range tests {
+		var out bytes.Buffer
+
+		if err := render(test.args, map[string]string{}, &out); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if out.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, out.String())
+		}
+	}
+
+	var keyErr template.KeyNotFoundError
+
+	err := render([]string{"-template", path, "root", "missing"}, map[string]string{}, &bytes.Buffer{})
+	if !errors.As(err, &keyErr) {
+		t.Errorf("Expected KeyNotFoundError, got %v", err)
+	}
+
+	var usageErr RenderUsageError
+
+	err = render([]string{"-template", path, "root"}, map[string]string{}, &bytes.Buffer{})
+	if !errors.As(err, &usageErr) {
+		t.Errorf("Expected RenderUsageError without a key, got %v", err)
+	}
+}
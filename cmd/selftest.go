@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/template"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// selfTestCheckTimeout is how long each check of the startup self-test can take.
+const selfTestCheckTimeout = 10 * time.Second
+
+// selfTestCheck is one check of the startup self-test. `run` returns what it found, or why the check has failed.
+type selfTestCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// selfTestResult is the outcome of a selfTestCheck.
+type selfTestResult struct {
+	name   string
+	passed bool
+	detail string
+}
+
+/*
+runSelfTest runs the checks one by one, each with selfTestCheckTimeout. A failed check doesn't stop the others, so that
+the operator sees everything that is wrong at once.
+*/
+func runSelfTest(ctx context.Context, checks []selfTestCheck) []selfTestResult {
+	results := make([]selfTestResult, 0, len(checks))
+
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, selfTestCheckTimeout)
+		detail, err := check.run(checkCtx)
+
+		cancel()
+
+		if err != nil {
+			detail = err.Error()
+		}
+
+		results = append(results, selfTestResult{name: check.name, passed: err == nil, detail: detail})
+	}
+
+	return results
+}
+
+// selfTestPassed is true if every check has passed.
+func selfTestPassed(results []selfTestResult) bool {
+	for _, result := range results {
+		if !result.passed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// selfTestReport is the results as plain text with a line for each check, for the logs and the admin chat.
+func selfTestReport(results []selfTestResult) string {
+	passed := 0
+
+	for _, result := range results {
+		if result.passed {
+			passed++
+		}
+	}
+
+	outcome := "passed"
+	if passed != len(results) {
+		outcome = "failed"
+	}
+
+	report := []string{fmt.Sprintf("Startup self-test %s: %d of %d checks passed", outcome, passed, len(results))}
+
+	for _, result := range results {
+		mark := "FAIL"
+		if result.passed {
+			mark = "OK"
+		}
+
+		report = append(report, fmt.Sprintf("[%s] %s: %s", mark, result.name, result.detail))
+	}
+
+	return strings.Join(report, "\n")
+}
+
+// selfTestChecks are the checks of the startup self-test: the token, the template and that GitHub can be reached.
+func selfTestChecks(client *telegram.Client, templateFile, githubEndpoint, userAgent string) []selfTestCheck {
+	return []selfTestCheck{
+		{name: "Telegram token", run: func(ctx context.Context) (string, error) {
+			bot, err := client.GetMe(ctx)
+			if err != nil {
+				return "", err
+			}
+
+			name := bot.Username.Map(func(username string) string { return "@" + username }).UnwrapOr(bot.FirstName)
+
+			return "the bot is " + name, nil
+		}},
+		{name: "Template", run: func(context.Context) (string, error) {
+			return checkTemplate(templateFile)
+		}},
+		{name: "GitHub API", run: func(ctx context.Context) (string, error) {
+			if err := github.Ping(ctx, githubEndpoint, userAgent); err != nil {
+				return "", err
+			}
+
+			return "reachable", nil
+		}},
+	}
+}
+
+/*
+checkTemplate fails if the template doesn't have all strings of the bot. The bot starts without the optional ones, but
+they are left empty.
+*/
+func checkTemplate(templateFile string) (string, error) {
+	templ, err := template.LoadYAMLTemplate(templateFile)
+	if err != nil {
+		return "", err
+	}
+
+	var responses state.Responses
+
+	missing, err := templ.PopulateMissing(&responses)
+	if err != nil {
+		return "", err
+	}
+
+	if len(missing) != 0 {
+		return "", MissingTemplateKeysError{Keys: missing}
+	}
+
+	return "all strings are in " + templateFile, nil
+}
+
+// MissingTemplateKeysError lists the optional keys that are not in the template as "group.key".
+type MissingTemplateKeysError struct {
+	Keys []string
+}
+
+func (e MissingTemplateKeysError) Error() string {
+	return "missing optional keys: " + strings.Join(e.Keys, ", ")
+}
+
+/*
+selfTest runs the startup self-test and logs the results. If `adminChat` is set the results are also sent there, failed
+or not, so that the operator knows that the deploy has started.
+*/
+func selfTest(ctx context.Context, client *telegram.Client, checks []selfTestCheck,
+	adminChat option.Option[update.ChatID],
+) {
+	results := runSelfTest(ctx, checks)
+	report := selfTestReport(results)
+
+	if selfTestPassed(results) {
+		logging.Infof("%s", report)
+	} else {
+		logging.Errorf("%s", report)
+	}
+
+	chatID, hasAdmin := adminChat.Unwrap()
+	if !hasAdmin {
+		return
+	}
+
+	message := response.NewSendMessage(chatID, report)
+	message.ParseMode = option.None[string]() // The details are errors with any characters in them
+
+	if err := client.Send(ctx, message); err != nil {
+		logging.Errorf("While sending the self-test results to telegram.admin_chat_id: %s", err)
+	}
+}
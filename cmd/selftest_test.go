@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunSelfTestRunsAllChecks(t *testing.T) {
+	t.Parallel()
+
+	ran := []string{}
+	check := func(name, detail string, err error) selfTestCheck {
+		return selfTestCheck{name: name, run: func(context.Context) (string, error) {
+			ran = append(ran, name)
+
+			return detail, err
+		}}
+	}
+
+	results := runSelfTest(context.Background(), []selfTestCheck{
+		check("token", "the bot is @test_bot", nil),
+		check("template", "", errors.New("missing optional keys: root.x")), //nolint:goerr113 // Mocked check
+		check("github", "reachable", nil),
+	})
+
+	if expected := []string{"token", "template", "github"}; !reflect.DeepEqual(ran, expected) {
+		t.Fatalf("Expected the checks %v to run after a failure, got %v", expected, ran)
+	}
+
+	expected := []selfTestResult{
+		{name: "token", passed: true, detail: "the bot is @test_bot"},
+		{name: "template", passed: false, detail: "missing optional keys: root.x"},
+		{name: "github", passed: true, detail: "reachable"},
+	}
+
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Expected %#v, got %#v", expected, results)
+	}
+
+	if selfTestPassed(results) {
+		t.Errorf("Self-test with a failed check has passed")
+	}
+
+	report := selfTestReport(results)
+	for _, line := range []string{
+		"Startup self-test failed: 2 of 3 checks passed",
+		"[OK] token: the bot is @test_bot",
+		"[FAIL] template: missing optional keys: root.x",
+	} {
+		if !strings.Contains(report, line) {
+			t.Errorf("Report doesn't have %q:\n%s", line, report)
+		}
+	}
+}
+
+func TestRunSelfTestPassed(t *testing.T) {
+	t.Parallel()
+
+	results := runSelfTest(context.Background(), []selfTestCheck{
+		{name: "token", run: func(context.Context) (string, error) { return "ok", nil }},
+	})
+
+	if !selfTestPassed(results) {
+		t.Fatalf("Self-test has failed: %#v", results)
+	}
+
+	if report := selfTestReport(results); !strings.HasPrefix(report, "Startup self-test passed: 1 of 1") {
+		t.Errorf("Unexpected report:\n%s", report)
+	}
+}
+
+func TestRunSelfTestCheckHasDeadline(t *testing.T) {
+	t.Parallel()
+
+	results := runSelfTest(context.Background(), []selfTestCheck{
+		{name: "github", run: func(ctx context.Context) (string, error) {
+			if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+				return "", errors.New("no deadline") //nolint:goerr113 // Mocked check
+			}
+
+			return "reachable", nil
+		}},
+	})
+
+	if !selfTestPassed(results) {
+		t.Fatalf("A check can hang forever: %#v", results)
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	t.Parallel()
+
+	if _, err := checkTemplate("../assets/telegram/strings.yaml"); err != nil {
+		t.Errorf("The template of the repo is incomplete: %s", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "strings.yaml")
+	if err := os.WriteFile(file, []byte("templates: {}"), 0o600); err != nil {
+		t.Fatalf("While writing the template: %s", err)
+	}
+
+	if _, err := checkTemplate(file); err == nil {
+		t.Errorf("An empty template has passed the check")
+	}
+}
@@ -1,7 +1,10 @@
 package github
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strings"
 
 	genqlient "github.com/Khan/genqlient/graphql"
 )
@@ -12,13 +15,82 @@ type Client struct {
 	client genqlient.Client
 }
 
+// NewClient creates a client for the GitHub API that authenticates with `token`.
 func NewClient(token string) Client {
-	return Client{client: genqlient.NewClient(githubGraphQLEndpoit,
+	return NewClientWithOptions(token, ClientOptions{Endpoint: "", UserAgent: ""})
+}
+
+// NewClientWithEndpoint creates a client that sends GraphQL queries to `endpoint` instead of GitHub (e.g. a mock).
+func NewClientWithEndpoint(endpoint, token string) Client {
+	return NewClientWithOptions(token, ClientOptions{Endpoint: endpoint, UserAgent: ""})
+}
+
+// ClientOptions change how a Client talks to GitHub. Empty fields are left as defaults.
+type ClientOptions struct {
+	// Endpoint is where GraphQL queries are sent instead of the public GitHub API
+	Endpoint string
+	// UserAgent is sent in the User-Agent header instead of Go's default
+	UserAgent string
+}
+
+// NewClientWithOptions creates a client that authenticates with `token`.
+func NewClientWithOptions(token string, options ClientOptions) Client {
+	endpoint := options.Endpoint
+	if endpoint == "" {
+		endpoint = githubGraphQLEndpoit
+	}
+
+	return Client{client: genqlient.NewClient(endpoint,
 		&http.Client{
-			Transport: &authedTransport{token: token, wrapped: http.DefaultTransport},
+			Transport: &authedTransport{token: token, userAgent: options.UserAgent, wrapped: http.DefaultTransport},
 		})}
 }
 
+/*
+Ping checks that the GraphQL API at `endpoint` (the public GitHub API if "") answers, without a token. Any answer
+counts, GitHub sends 401 to requests without a token. Returns UnavailableError for server errors (5xx).
+*/
+func Ping(ctx context.Context, endpoint, userAgent string) error {
+	if endpoint == "" {
+		endpoint = githubGraphQLEndpoit
+	}
+
+	query := strings.NewReader(`{"query":"{__typename}"}`)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, query)
+	if err != nil {
+		return fmt.Errorf("while creating a request to %s: %w", endpoint, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("while sending a request to GitHub: %w", err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return UnavailableError{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// UnavailableError is returned by Ping and all queries if GitHub answers with a server error (5xx).
+type UnavailableError struct {
+	StatusCode int
+}
+
+func (e UnavailableError) Error() string {
+	return fmt.Sprintf("GitHub answered with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
 type ProjectV2 struct {
 	Cursor       ProjectCursor
 	Title        string
@@ -27,11 +99,103 @@ type ProjectV2 struct {
 	CreatorLogin string
 	CreatorURL   string
 	Number       int
+	// Closed projects are archived, they can still be read but are not worked on anymore.
+	Closed bool
 }
 
 type ProjectCursor string
 
+// ProjectsPage is a page of projects and where it is in the list of all projects.
+type ProjectsPage struct {
+	Projects []ProjectV2
+	// StartCursor and EndCursor are the cursors of the first and the last project on the page.
+	StartCursor ProjectCursor
+	EndCursor   ProjectCursor
+	// HasNextPage and HasPreviousPage are true if there are projects after or before this page.
+	HasNextPage     bool
+	HasPreviousPage bool
+}
+
 type ProjectID string
 
-// ProjectV2ItemsByStatus maps status names to a list of titles of items with that status.
-type ProjectV2ItemsByStatus map[string][]string
+/*
+IsValid reports whether the ID looks like a GitHub node ID: "PVT_" followed by base64, or just base64 for IDs in the
+legacy format. It doesn't check that the project exists.
+*/
+func (id ProjectID) IsValid() bool {
+	const maxLength = 100
+
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for _, r := range id {
+		isAlphanumeric := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+		if !isAlphanumeric && !strings.ContainsRune("+/=-_", r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ProjectV2ItemsByStatus maps status names to a list of items with that status.
+type ProjectV2ItemsByStatus map[string][]ProjectV2Item
+
+// ProjectItemID is the node ID of an item in a project (not of its issue or PR). Mutations of the item need it.
+type ProjectItemID string
+
+// ProjectV2Item is an item (draft, issue or PR) in a project.
+type ProjectV2Item struct {
+	ID ProjectItemID
+	// Title is HTML formatted and has a link to the issue or PR. The text from GitHub is escaped.
+	Title string
+	// Content is what Title is made from, to format it another way
+	Content ItemContent
+	// Status is the name of the column the item is in.
+	Status string
+	// Reviewers are the logins of users that were asked to review a PR. Empty for drafts and issues.
+	Reviewers []string
+}
+
+// ItemKind is the type of the content of a project item.
+type ItemKind string
+
+const (
+	ItemKindDraft       ItemKind = "Draft"
+	ItemKindIssue       ItemKind = "Issue"
+	ItemKindPullRequest ItemKind = "PR"
+)
+
+// ItemContent is the draft, issue or PR of a project item. Drafts have no number or URL.
+type ItemContent struct {
+	Kind ItemKind
+	// Title is plain text
+	Title  string
+	Number int
+	URL    string
+}
+
+/*
+Merge adds items from `other` to `i`. Items are compared by their titles (which include the URL for issues and PRs), so
+an item that is in both is only listed once.
+*/
+func (i ProjectV2ItemsByStatus) Merge(other ProjectV2ItemsByStatus) {
+	for status, items := range other {
+		for _, item := range items {
+			if !i.hasTitle(status, item.Title) {
+				i[status] = append(i[status], item)
+			}
+		}
+	}
+}
+
+func (i ProjectV2ItemsByStatus) hasTitle(status, title string) bool {
+	for _, item := range i[status] {
+		if item.Title == title {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,267 @@
+package github_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestMergeTwoProjectsWithOverlappingItems(t *testing.T) {
+	t.Parallel()
+
+	items := github.ProjectV2ItemsByStatus{
+		"Done":        {{Title: "Shared"}, {Title: "First only"}},
+		"In Progress": {{Title: "Doing in first"}},
+	}
+
+	items.Merge(github.ProjectV2ItemsByStatus{
+		"Done":      {{Title: "Second only"}, {Title: "Shared"}},
+		"In Review": {{Title: "Reviewing in second", Reviewers: []string{"octocat"}}},
+	})
+
+	expected := github.ProjectV2ItemsByStatus{
+		"Done":        {{Title: "Shared"}, {Title: "First only"}, {Title: "Second only"}},
+		"In Progress": {{Title: "Doing in first"}},
+		"In Review":   {{Title: "Reviewing in second", Reviewers: []string{"octocat"}}},
+	}
+
+	if !reflect.DeepEqual(items, expected) {
+		t.Fatalf("Merged items are %#v, expected %#v", items, expected)
+	}
+}
+
+func TestProjectIDIsValid(t *testing.T) {
+	t.Parallel()
+
+	cases := map[github.ProjectID]bool{
+		"PVT_kwDOBQfyNM4AF2Yh": true,
+		"MDExOlByb2plY3RWMg==": true,
+		"":                     false,
+		"PVT_1 PVT_2":          false,
+		"<b>PVT_1</b>":         false,
+		"PVT_é":                false,
+	}
+
+	for id, expected := range cases {
+		if isValid := id.IsValid(); isValid != expected {
+			t.Errorf("(ProjectID %q).IsValid() is %t, expected %t", id, isValid, expected)
+		}
+	}
+}
+
+func TestClientSendsUserAgent(t *testing.T) {
+	t.Parallel()
+
+	var userAgent string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data": {"viewer": {"login": "octocat"}}}`)
+	}))
+	defer server.Close()
+
+	client := github.NewClientWithOptions("token",
+		github.ClientOptions{Endpoint: server.URL, UserAgent: "daily-reporter/test"})
+
+	if _, err := client.Login(context.Background()); err != nil {
+		t.Fatalf("Login failed: %s", err)
+	}
+
+	if userAgent != "daily-reporter/test" {
+		t.Fatalf("Expected User-Agent daily-reporter/test, got %q", userAgent)
+	}
+}
+
+// abuseDetectionResponse is what GitHub answers when content is created too quickly.
+const abuseDetectionResponse = `{"documentation_url": "https://docs.github.com/graphql/overview/resource-limitations",
+"message": "You have exceeded a secondary rate limit. Please wait a few minutes before you try again. Content was
+submitted too quickly."}`
+
+/*
+abuseDetectionServer rejects the first `rejected` requests like the abuse detection of GitHub and creates a draft
+afterwards. Returns how many requests it got.
+*/
+func abuseDetectionServer(t *testing.T, rejected int32, retryAfter string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if requests.Add(1) <= rejected {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, strings.ReplaceAll(abuseDetectionResponse, "\n", " "))
+
+			return
+		}
+
+		fmt.Fprint(w, `{"data": {"addProjectV2DraftIssue": {"projectItem": {"id": "PVTI_draft",
+"content": {"__typename": "DraftIssue", "title": "Write docs"}}}}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestCreateDraftIsRetriedAfterAbuseDetection(t *testing.T) {
+	t.Parallel()
+
+	server, requests := abuseDetectionServer(t, 1, "0")
+
+	item, err := github.NewClientWithEndpoint(server.URL, "token").
+		CreateDraftIssue(context.Background(), "PVT_1", "Write docs", "")
+	if err != nil {
+		t.Fatalf("Expected the draft to be created on the retry, got %s", err)
+	}
+
+	if item.ID != "PVTI_draft" || requests.Load() != 2 {
+		t.Errorf("Expected the draft after 2 requests, got %+v after %d", item, requests.Load())
+	}
+}
+
+func TestAbuseDetectionWithLongRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	server, requests := abuseDetectionServer(t, 1, "3600")
+
+	_, err := github.NewClientWithEndpoint(server.URL, "token").
+		CreateDraftIssue(context.Background(), "PVT_1", "Write docs", "")
+
+	var abuse github.AbuseDetectionError
+	if !errors.As(err, &abuse) || abuse.RetryAfter != time.Hour {
+		t.Fatalf("Expected AbuseDetectionError with an hour to wait, got %v", err)
+	}
+
+	if requests.Load() != 1 {
+		t.Errorf("An hour is too long for a user to wait, expected no retry, got %d requests", requests.Load())
+	}
+}
+
+func TestForbiddenIsNotAbuseDetection(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "Resource not accessible by personal access token"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := github.NewClientWithEndpoint(server.URL, "token").
+		CreateDraftIssue(context.Background(), "PVT_1", "Write docs", "")
+
+	var abuse github.AbuseDetectionError
+	if err == nil || errors.As(err, &abuse) || !strings.Contains(err.Error(), "Resource not accessible") {
+		t.Errorf("Expected the 403 to be reported as it is, got %v", err)
+	}
+}
+
+func TestRevokedTokenIsUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	client := github.NewClientWithEndpoint(server.URL, "revoked")
+
+	queries := map[string]func() error{
+		"Login": func() error {
+			_, err := client.Login(ctx)
+
+			return err
+		},
+		"ListViewerProjects": func() error {
+			_, err := client.ListViewerProjects(ctx, 10, option.None[github.ProjectCursor]())
+
+			return err
+		},
+		"ListViewerProjectV2Items": func() error {
+			_, err := client.ListViewerProjectV2Items(ctx, "PVT_1", 10, option.None[github.ProjectCursor]())
+
+			return err
+		},
+		"ProjectV2ByID": func() error {
+			_, err := client.ProjectV2ByID(ctx, "PVT_1")
+
+			return err
+		},
+	}
+
+	for name, query := range queries {
+		var unauthorized github.UnauthorizedError
+		if err := query(); !errors.As(err, &unauthorized) {
+			t.Errorf("%s: expected UnauthorizedError, got %v", name, err)
+		}
+	}
+}
+
+func TestQueryWhenGithubIsDown(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "", http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+
+	client := github.NewClientWithEndpoint(server.URL, "key")
+	_, err := client.Login(context.Background())
+
+	var unavailable github.UnavailableError
+	if !errors.As(err, &unavailable) || unavailable.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Expected UnavailableError with 502, got %v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	t.Parallel()
+
+	for status, expectUnavailable := range map[int]bool{
+		http.StatusUnauthorized: false, // GitHub's answer to a request without a token
+		http.StatusOK:           false,
+		http.StatusBadGateway:   true,
+	} {
+		status := status
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "" {
+				t.Errorf("Ping has sent a token")
+			}
+
+			w.WriteHeader(status)
+		}))
+
+		var unavailable github.UnavailableError
+
+		err := github.Ping(context.Background(), server.URL, "daily-reporter/test")
+
+		isUnavailable := errors.As(err, &unavailable)
+		if isUnavailable != expectUnavailable || (!isUnavailable && err != nil) {
+			t.Errorf("%d: expected UnavailableError %t, got %v", status, expectUnavailable, err)
+		}
+
+		server.Close()
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	if err := github.Ping(context.Background(), server.URL, ""); err == nil {
+		t.Errorf("Ping of a server that is down has succeeded")
+	}
+}
@@ -0,0 +1,8 @@
+package github
+
+import genqlient "github.com/Khan/genqlient/graphql"
+
+// NewClientFrom lets tests replace the GraphQL client with a fake.
+func NewClientFrom(client genqlient.Client) Client {
+	return Client{client: client}
+}
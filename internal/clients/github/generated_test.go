@@ -0,0 +1,131 @@
+package github_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	graphql "github.com/m-kuzmin/daily-reporter/api/github"
+)
+
+var (
+	graphqlComment   = regexp.MustCompile(`#[^\n]*`)
+	graphqlToken     = regexp.MustCompile(`[A-Za-z0-9_$]+|"[^"]*"|\S`)
+	graphqlOperation = regexp.MustCompile(`(?:query|mutation)\s+([A-Za-z0-9_]+)`)
+	graphqlFragment  = regexp.MustCompile(`^# @genqlient\s+fragment\s+([A-Za-z0-9_]+)`)
+	graphqlSpread    = regexp.MustCompile(`\.\.\.\s*([A-Za-z0-9_]+)`)
+)
+
+/*
+normalizeQuery splits a GraphQL document into tokens without comments and `__typename`, because genqlient reformats
+the queries and adds `__typename` to abstract types.
+*/
+func normalizeQuery(query string) string {
+	tokens := graphqlToken.FindAllString(graphqlComment.ReplaceAllString(query, ""), -1)
+	kept := make([]string, 0, len(tokens))
+
+	for _, tok := range tokens {
+		if tok != "__typename" {
+			kept = append(kept, tok)
+		}
+	}
+
+	return strings.Join(kept, " ")
+}
+
+/*
+embeddedQueries finds `# @genqlient` queries in a Go file and returns them by operation name. Fragments that a query
+uses are added after it, like genqlient does.
+*/
+func embeddedQueries(t *testing.T, filename string) map[string]string {
+	t.Helper()
+
+	file, err := parser.ParseFile(token.NewFileSet(), filename, nil, 0)
+	if err != nil {
+		t.Fatalf("While parsing %s: %s", filename, err)
+	}
+
+	queries := make(map[string]string)
+	fragments := make(map[string]string)
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		literal, isLiteral := node.(*ast.BasicLit)
+		if !isLiteral || literal.Kind != token.STRING {
+			return true
+		}
+
+		query, err := strconv.Unquote(literal.Value)
+		if err != nil || !strings.HasPrefix(query, "# @genqlient") {
+			return true
+		}
+
+		if fragment := graphqlFragment.FindStringSubmatch(query); fragment != nil {
+			fragments[fragment[1]] = query
+
+			return true
+		}
+
+		name := graphqlOperation.FindStringSubmatch(query)
+		if name == nil {
+			t.Errorf("Query without an operation name in %s:\n%s", filename, query)
+
+			return true
+		}
+
+		queries[name[1]] = query
+
+		return true
+	})
+
+	for name, query := range queries {
+		for _, spread := range graphqlSpread.FindAllStringSubmatch(query, -1) {
+			if fragment, isFragment := fragments[spread[1]]; isFragment {
+				queries[name] += "\n" + fragment
+			}
+		}
+	}
+
+	return queries
+}
+
+// TestGeneratedMatchesQueries fails if a query was changed without running genqlient.
+func TestGeneratedMatchesQueries(t *testing.T) {
+	t.Parallel()
+
+	generated := map[string]string{
+		"Login":                  graphql.Login_Operation,
+		"ViewerProjectsV2":       graphql.ViewerProjectsV2_Operation,
+		"ViewerProjectsV2Before": graphql.ViewerProjectsV2Before_Operation,
+		"OrganizationProjectsV2": graphql.OrganizationProjectsV2_Operation,
+		"GetProjectItems":        graphql.GetProjectItems_Operation,
+		"ProjectV2ByID":          graphql.ProjectV2ByID_Operation,
+		"ProjectFields":          graphql.ProjectFields_Operation,
+		"AddProjectV2DraftIssue": graphql.AddProjectV2DraftIssue_Operation,
+	}
+
+	embedded := embeddedQueries(t, "queries.go")
+
+	for name, query := range embedded {
+		operation, isKnown := generated[name]
+		if !isKnown {
+			t.Errorf("Query %s is not checked by this test, add its generated operation", name)
+
+			continue
+		}
+
+		if normalizeQuery(query) != normalizeQuery(operation) {
+			t.Errorf("Query %s doesn't match api/github/generated.go, run genqlient:\n%s\n\ngenerated:\n%s",
+				name, query, operation)
+		}
+	}
+
+	for name := range generated {
+		if _, isEmbedded := embedded[name]; !isEmbedded {
+			t.Errorf("Generated operation %s has no query in queries.go", name)
+		}
+	}
+}
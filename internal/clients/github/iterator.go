@@ -0,0 +1,193 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+/*
+ProjectItemsIterator goes through all items assigned to the viewer in a project, requesting new pages when needed. Use
+it like bufio.Scanner:
+
+	items := client.IterateProjectItems(projectID, 50)
+	for items.Next(ctx) {
+		item := items.Item()
+	}
+
+	if err := items.Err(); err != nil {
+		...
+	}
+*/
+type ProjectItemsIterator struct {
+	client    Client
+	projectID ProjectID
+	pageSize  uint
+
+	page    []ProjectV2Item
+	current ProjectV2Item
+	after   option.Option[ProjectCursor]
+	isLast  bool
+	err     error
+}
+
+// IterateProjectItems returns an iterator that requests `pageSize` items at a time.
+func (c Client) IterateProjectItems(projectID ProjectID, pageSize uint) *ProjectItemsIterator {
+	return &ProjectItemsIterator{
+		client:    c,
+		projectID: projectID,
+		pageSize:  pageSize,
+		after:     option.None[ProjectCursor](),
+	}
+}
+
+/*
+Next advances to the next item and reports whether there is one. New pages are only requested if the context is not
+done. Once Next returns false it will keep returning false, check Err() to see why the iteration has stopped.
+*/
+func (it *ProjectItemsIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.isLast || it.err != nil {
+			return false
+		}
+
+		if err := ctx.Err(); err != nil {
+			it.err = fmt.Errorf("while iterating over project (ProjectID %s) items: %w", it.projectID, err)
+
+			return false
+		}
+
+		page, err := it.client.projectItemsPage(ctx, it.projectID, it.pageSize, it.after)
+		if err != nil {
+			it.err = err
+
+			return false
+		}
+
+		it.page = page.items
+		it.after = option.Some(page.endCursor)
+		it.isLast = !page.hasNextPage
+	}
+
+	it.current, it.page = it.page[0], it.page[1:]
+
+	return true
+}
+
+// Item returns the item that the last call to Next() has advanced to.
+func (it *ProjectItemsIterator) Item() ProjectV2Item {
+	return it.current
+}
+
+// Err returns the error that has stopped the iteration or nil if all items were returned.
+func (it *ProjectItemsIterator) Err() error {
+	return it.err
+}
+
+/*
+ViewerItemsInProjects gets all items assigned to the viewer from all projects. Up to `concurrency` projects are
+requested at the same time, but the result doesn't depend on which one finishes first: items are merged in the order of
+`projectIDs`. If any project fails the rest are canceled and its error is returned.
+*/
+func (c Client) ViewerItemsInProjects(ctx context.Context, projectIDs []ProjectID, pageSize, concurrency uint,
+) (ProjectV2ItemsByStatus, error) {
+	projects, err := c.ViewerItemsByProject(ctx, projectIDs, pageSize, 0, concurrency)
+	if err != nil {
+		return ProjectV2ItemsByStatus{}, err
+	}
+
+	items := make(ProjectV2ItemsByStatus)
+
+	for _, project := range projects {
+		items.Merge(project.Items)
+	}
+
+	return items, nil
+}
+
+// ProjectItems are the items assigned to the viewer in one project.
+type ProjectItems struct {
+	Items ProjectV2ItemsByStatus
+	// Truncated is true if the project has more items than were requested
+	Truncated bool
+}
+
+/*
+ViewerItemsByProject is like ViewerItemsInProjects, but the items of each project are kept separately, in the order of
+`projectIDs`. At most `maxItems` items are taken from each project, 0 means all of them.
+*/
+func (c Client) ViewerItemsByProject(ctx context.Context, projectIDs []ProjectID, pageSize, maxItems, concurrency uint,
+) ([]ProjectItems, error) {
+	if concurrency == 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		results   = make([]ProjectItems, len(projectIDs))
+		errs      = make([]error, len(projectIDs))
+		semaphore = make(chan struct{}, concurrency)
+		wg        sync.WaitGroup
+	)
+
+	for i, projectID := range projectIDs {
+		wg.Add(1)
+
+		go func(i int, projectID ProjectID) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			results[i], errs[i] = c.viewerItemsInProject(ctx, projectID, pageSize, maxItems)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, projectID)
+	}
+
+	wg.Wait()
+
+	for i := range projectIDs {
+		if errs[i] != nil && !errors.Is(errs[i], context.Canceled) {
+			return []ProjectItems{}, errs[i]
+		}
+	}
+
+	for i := range projectIDs {
+		if errs[i] != nil {
+			return []ProjectItems{}, errs[i] // Only canceled errors are left, the parent context was canceled
+		}
+	}
+
+	return results, nil
+}
+
+// viewerItemsInProject gets up to `maxItems` items from the project, or all of them if `maxItems` is 0.
+func (c Client) viewerItemsInProject(ctx context.Context, projectID ProjectID, pageSize, maxItems uint,
+) (ProjectItems, error) {
+	var (
+		project = ProjectItems{Items: make(ProjectV2ItemsByStatus), Truncated: false}
+		count   uint
+	)
+
+	iter := c.IterateProjectItems(projectID, pageSize)
+	for iter.Next(ctx) {
+		if maxItems != 0 && count == maxItems {
+			project.Truncated = true
+
+			break
+		}
+
+		item := iter.Item()
+		project.Items[item.Status] = append(project.Items[item.Status], item)
+		count++
+	}
+
+	return project, iter.Err()
+}
@@ -0,0 +1,146 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	genqlient "github.com/Khan/genqlient/graphql"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+)
+
+var errFakeServer = errors.New("fake server error")
+
+// fakeItemsServer serves one page of GetProjectItems per request. A nil page is returned as an error.
+type fakeItemsServer struct {
+	pages   [][]string
+	afters  []string
+	onFetch func()
+}
+
+func (s *fakeItemsServer) MakeRequest(_ context.Context, req *genqlient.Request, resp *genqlient.Response) error {
+	var variables struct {
+		After string `json:"after"`
+	}
+
+	vars, err := json.Marshal(req.Variables)
+	if err != nil {
+		return fmt.Errorf("marshaling variables: %w", err)
+	}
+
+	if err = json.Unmarshal(vars, &variables); err != nil {
+		return fmt.Errorf("unmarshaling variables: %w", err)
+	}
+
+	page := len(s.afters)
+	s.afters = append(s.afters, variables.After)
+
+	if s.onFetch != nil {
+		s.onFetch()
+	}
+
+	if s.pages[page] == nil {
+		return errFakeServer
+	}
+
+	nodes := make([]json.RawMessage, len(s.pages[page]))
+	for i, title := range s.pages[page] {
+		nodes[i] = json.RawMessage(fmt.Sprintf(`{
+"status": {"__typename": "ProjectV2ItemFieldSingleSelectValue", "name": "Done"},
+"assignedTo": {"__typename": "ProjectV2ItemFieldUserValue", "users": {"nodes": [{"isViewer": true}]}},
+"content": {"__typename": "DraftIssue", "title": %q}
+}`, title))
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"node": map[string]any{
+			"__typename": "ProjectV2",
+			"items": map[string]any{
+				"nodes": nodes,
+				"pageInfo": map[string]any{
+					"endCursor":   fmt.Sprintf("cursor%d", page+1),
+					"hasNextPage": page+1 < len(s.pages),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	return json.Unmarshal(data, resp.Data) //nolint:wrapcheck // Its a test
+}
+
+func collectTitles(ctx context.Context, iter *github.ProjectItemsIterator) []string {
+	titles := []string{}
+	for iter.Next(ctx) {
+		titles = append(titles, iter.Item().Title)
+	}
+
+	return titles
+}
+
+func TestIterateProjectItemsGoesThroughAllPages(t *testing.T) {
+	t.Parallel()
+
+	server := &fakeItemsServer{pages: [][]string{{"a", "b"}, {}, {"c"}}}
+	iter := github.NewClientFrom(server).IterateProjectItems("PVT_1", 2)
+
+	titles := collectTitles(context.Background(), iter)
+	if err := iter.Err(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if fmt.Sprint(titles) != "[a b c]" {
+		t.Fatalf("Expected [a b c], got %v", titles)
+	}
+
+	if fmt.Sprint(server.afters) != "[ cursor1 cursor2]" {
+		t.Fatalf("Pages were requested with wrong cursors: %q", server.afters)
+	}
+
+	if iter.Next(context.Background()) {
+		t.Fatal("Next() returned true after the last item")
+	}
+}
+
+func TestIterateProjectItemsStopsOnError(t *testing.T) {
+	t.Parallel()
+
+	server := &fakeItemsServer{pages: [][]string{{"a"}, nil, {"c"}}}
+	iter := github.NewClientFrom(server).IterateProjectItems("PVT_1", 1)
+
+	titles := collectTitles(context.Background(), iter)
+	if !errors.Is(iter.Err(), errFakeServer) {
+		t.Fatalf("Expected the server error, got %v", iter.Err())
+	}
+
+	if fmt.Sprint(titles) != "[a]" {
+		t.Fatalf("Expected only the items before the error, got %v", titles)
+	}
+
+	if len(server.afters) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(server.afters))
+	}
+}
+
+func TestIterateProjectItemsStopsOnCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := &fakeItemsServer{pages: [][]string{{"a"}, {"b"}, {"c"}}, onFetch: cancel}
+	iter := github.NewClientFrom(server).IterateProjectItems("PVT_1", 1)
+
+	titles := collectTitles(ctx, iter)
+	if !errors.Is(iter.Err(), context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", iter.Err())
+	}
+
+	if fmt.Sprint(titles) != "[a]" || len(server.afters) != 1 {
+		t.Fatalf("Iteration continued after cancel: items %v, %d requests", titles, len(server.afters))
+	}
+}
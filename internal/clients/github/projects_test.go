@@ -0,0 +1,145 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	genqlient "github.com/Khan/genqlient/graphql"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+)
+
+/*
+slowProjectsServer serves one item per project. Projects listed earlier take longer, so they finish last. It counts how
+many requests are handled at the same time.
+*/
+type slowProjectsServer struct {
+	delays  map[string]time.Duration
+	failing string
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *slowProjectsServer) MakeRequest(ctx context.Context, req *genqlient.Request, resp *genqlient.Response) error {
+	var variables struct {
+		ID string `json:"id"`
+	}
+
+	vars, _ := json.Marshal(req.Variables)
+	_ = json.Unmarshal(vars, &variables)
+
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(s.delays[variables.ID]):
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck // Its a test
+	}
+
+	if variables.ID == s.failing {
+		return errFakeServer
+	}
+
+	data := fmt.Sprintf(`{"node": {"__typename": "ProjectV2", "items": {"nodes": [{
+"status": {"__typename": "ProjectV2ItemFieldSingleSelectValue", "name": "Done"},
+"assignedTo": {"__typename": "ProjectV2ItemFieldUserValue", "users": {"nodes": [{"isViewer": true}]}},
+"content": {"__typename": "DraftIssue", "title": %q}
+}], "pageInfo": {"endCursor": "", "hasNextPage": false}}}}`, variables.ID)
+
+	return json.Unmarshal([]byte(data), resp.Data) //nolint:wrapcheck // Its a test
+}
+
+func newSlowProjectsServer(projects []github.ProjectID) *slowProjectsServer {
+	delays := make(map[string]time.Duration, len(projects))
+	for i, id := range projects {
+		delays[string(id)] = time.Duration(len(projects)-i) * 5 * time.Millisecond
+	}
+
+	return &slowProjectsServer{delays: delays}
+}
+
+func TestViewerItemsInProjectsMergesInOrder(t *testing.T) {
+	t.Parallel()
+
+	projects := []github.ProjectID{"PVT_1", "PVT_2", "PVT_3", "PVT_4", "PVT_5", "PVT_6"}
+	server := newSlowProjectsServer(projects)
+
+	items, err := github.NewClientFrom(server).ViewerItemsInProjects(context.Background(), projects, 10, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	titles := make([]string, len(items["Done"]))
+	for i, item := range items["Done"] {
+		titles[i] = item.Title
+	}
+
+	if fmt.Sprint(titles) != "[PVT_1 PVT_2 PVT_3 PVT_4 PVT_5 PVT_6]" {
+		t.Errorf("Items are not in the order of projects: %v", titles)
+	}
+
+	if server.maxInFlight > 2 {
+		t.Errorf("Expected at most 2 requests at once, got %d", server.maxInFlight)
+	}
+}
+
+func TestViewerItemsInProjectsFails(t *testing.T) {
+	t.Parallel()
+
+	projects := []github.ProjectID{"PVT_1", "PVT_2", "PVT_3"}
+	server := newSlowProjectsServer(projects)
+	server.failing = "PVT_3"
+
+	_, err := github.NewClientFrom(server).ViewerItemsInProjects(context.Background(), projects, 10, 3)
+	if !errors.Is(err, errFakeServer) {
+		t.Fatalf("Expected the server error, got %v", err)
+	}
+}
+
+func TestViewerItemsByProjectTruncates(t *testing.T) {
+	t.Parallel()
+
+	for maxItems, expected := range map[uint]struct {
+		titles    string
+		truncated bool
+	}{
+		0: {"[a b c]", false},
+		2: {"[a b]", true},
+		3: {"[a b c]", false},
+	} {
+		server := &fakeItemsServer{pages: [][]string{{"a", "b"}, {"c"}}}
+
+		projects, err := github.NewClientFrom(server).
+			ViewerItemsByProject(context.Background(), []github.ProjectID{"PVT_1"}, 2, maxItems, 1)
+		if err != nil {
+			t.Fatalf("maxItems=%d: unexpected error: %s", maxItems, err)
+		}
+
+		titles := []string{}
+		for _, item := range projects[0].Items["Done"] {
+			titles = append(titles, item.Title)
+		}
+
+		if fmt.Sprint(titles) != expected.titles || projects[0].Truncated != expected.truncated {
+			t.Errorf("maxItems=%d: expected %s (truncated=%t), got %v (truncated=%t)",
+				maxItems, expected.titles, expected.truncated, titles, projects[0].Truncated)
+		}
+	}
+}
@@ -2,9 +2,12 @@ package github
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"html"
 
 	graphql "github.com/m-kuzmin/daily-reporter/api/github"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
 	"github.com/m-kuzmin/daily-reporter/internal/util/option"
 	"github.com/pkg/errors"
 )
@@ -25,38 +28,118 @@ query Login {
 	return resp.Viewer.Login, nil
 }
 
+/*
+ListViewerProjects returns the first `first` projects of the user after the cursor. Without a cursor the page starts
+with the first project.
+*/
 func (c Client) ListViewerProjects(ctx context.Context, first uint, after option.Option[ProjectCursor],
-) ([]ProjectV2, error) {
+) (ProjectsPage, error) {
 	_ = `# @genqlient
 query ViewerProjectsV2($first: Int!, $after: String) {
   viewer {
     projectsV2(first: $first, after: $after) {
-      edges {
-        cursor
-        node {
-          id
-          title
-          number
-          url
-          creator {
-            login
-            url
-          }
-        }
+      ...ProjectsPageFields
+    }
+  }
+}`
+
+	_ = `# @genqlient
+fragment ProjectsPageFields on ProjectV2Connection {
+  edges {
+    cursor
+    node {
+      id
+      title
+      number
+      url
+      closed
+      creator {
+        login
+        url
       }
     }
   }
+  pageInfo {
+    startCursor
+    endCursor
+    hasNextPage
+    hasPreviousPage
+  }
 }`
 
 	graphql, err := graphql.ViewerProjectsV2(ctx, c.client, int(first),
 		string(after.UnwrapOr("")))
 	if err != nil {
-		return []ProjectV2{}, fmt.Errorf("while requesting user's projects over GitHub GraphQL: %w", err)
+		return ProjectsPage{}, fmt.Errorf("while requesting user's projects over GitHub GraphQL: %w", err)
 	}
 
-	projects := make([]ProjectV2, len(graphql.Viewer.ProjectsV2.Edges))
+	page := newProjectsPage(graphql.Viewer.ProjectsV2.ProjectsPageFields)
+	// GitHub may not report the previous page when paging forward, but the project at `after` is on it
+	page.HasPreviousPage = page.HasPreviousPage || after.IsSome()
+
+	return page, nil
+}
+
+// ListViewerProjectsBefore returns the last `last` projects of the user before the cursor, to go a page back.
+func (c Client) ListViewerProjectsBefore(ctx context.Context, last uint, before ProjectCursor) (ProjectsPage, error) {
+	_ = `# @genqlient
+query ViewerProjectsV2Before($last: Int!, $before: String!) {
+  viewer {
+    projectsV2(last: $last, before: $before) {
+      ...ProjectsPageFields
+    }
+  }
+}`
+
+	graphql, err := graphql.ViewerProjectsV2Before(ctx, c.client, int(last), string(before))
+	if err != nil {
+		return ProjectsPage{}, fmt.Errorf("while requesting user's projects over GitHub GraphQL: %w", err)
+	}
+
+	page := newProjectsPage(graphql.Viewer.ProjectsV2.ProjectsPageFields)
+	// Same as in ListViewerProjects: the project at `before` is on the next page
+	page.HasNextPage = true
+
+	return page, nil
+}
+
+/*
+ListOrganizationProjects returns the first `first` projects of the organization `org` after the cursor. Returns
+OrganizationNotFoundError if GitHub has no organization with this login.
+*/
+func (c Client) ListOrganizationProjects(ctx context.Context, org string, first uint,
+	after option.Option[ProjectCursor],
+) (ProjectsPage, error) {
+	_ = `# @genqlient
+query OrganizationProjectsV2($org: String!, $first: Int!, $after: String) {
+  # @genqlient(pointer: true)
+  organization(login: $org) {
+    projectsV2(first: $first, after: $after) {
+      ...ProjectsPageFields
+    }
+  }
+}`
+
+	graphql, err := graphql.OrganizationProjectsV2(ctx, c.client, org, int(first), string(after.UnwrapOr("")))
+	if err != nil {
+		return ProjectsPage{}, fmt.Errorf("while requesting the projects of organization %s over GitHub GraphQL: %w",
+			org, err)
+	}
 
-	for i, project := range graphql.Viewer.ProjectsV2.Edges {
+	if graphql.Organization == nil {
+		return ProjectsPage{}, OrganizationNotFoundError{Login: org}
+	}
+
+	page := newProjectsPage(graphql.Organization.ProjectsV2.ProjectsPageFields)
+	page.HasPreviousPage = page.HasPreviousPage || after.IsSome()
+
+	return page, nil
+}
+
+func newProjectsPage(graphql graphql.ProjectsPageFields) ProjectsPage {
+	projects := make([]ProjectV2, len(graphql.Edges))
+
+	for i, project := range graphql.Edges {
 		projects[i] = ProjectV2{
 			Cursor:       ProjectCursor(project.Cursor),
 			Title:        project.Node.Title,
@@ -65,13 +148,20 @@ query ViewerProjectsV2($first: Int!, $after: String) {
 			CreatorLogin: project.Node.Creator.GetLogin(),
 			CreatorURL:   project.Node.Creator.GetUrl(),
 			Number:       project.Node.Number,
+			Closed:       project.Node.Closed,
 		}
 	}
 
-	return projects, nil
+	return ProjectsPage{
+		Projects:        projects,
+		StartCursor:     ProjectCursor(graphql.PageInfo.StartCursor),
+		EndCursor:       ProjectCursor(graphql.PageInfo.EndCursor),
+		HasNextPage:     graphql.PageInfo.HasNextPage,
+		HasPreviousPage: graphql.PageInfo.HasPreviousPage,
+	}
 }
 
-//nolint:funlen, cyclop // Yeah the filter is a bit complicated...
+//nolint:funlen // The query is long
 func (c Client) ListViewerProjectV2Items(
 	ctx context.Context,
 	projectID ProjectID,
@@ -84,6 +174,7 @@ query GetProjectItems($id: ID!, $first: Int!, $after: String) {
     ... on ProjectV2 {
       items(first: $first, after: $after) {
         nodes {
+          id
           status: fieldValueByName(name: "Status") {
             ... on ProjectV2ItemFieldSingleSelectValue {
               name
@@ -98,7 +189,9 @@ query GetProjectItems($id: ID!, $first: Int!, $after: String) {
               }
             }
           }
+          # @genqlient(bind: "encoding/json.RawMessage")
           content {
+            __typename
             ... on DraftIssue {
               title
             }
@@ -111,6 +204,16 @@ query GetProjectItems($id: ID!, $first: Int!, $after: String) {
               title
               url
               number
+              reviewRequests(first: 10) {
+                nodes {
+                  requestedReviewer {
+                    __typename
+                    ... on User {
+                      login
+                    }
+                  }
+                }
+              }
             }
           }
         }
@@ -122,44 +225,95 @@ query GetProjectItems($id: ID!, $first: Int!, $after: String) {
       }
     }
   }
+  rateLimit {
+    cost
+    remaining
+  }
 }
 `
 
+	page, err := c.projectItemsPage(ctx, projectID, first, after)
+	if err != nil {
+		return ProjectV2ItemsByStatus{}, err
+	}
+
+	itemsByStatus := make(ProjectV2ItemsByStatus)
+	for _, item := range page.items {
+		itemsByStatus[item.Status] = append(itemsByStatus[item.Status], item)
+	}
+
+	return itemsByStatus, nil
+}
+
+// projectItemsPage is one page of the items assigned to the viewer and where to continue from.
+type projectItemsPage struct {
+	items       []ProjectV2Item
+	endCursor   ProjectCursor
+	hasNextPage bool
+}
+
+// projectItemsPage requests one page of project items and keeps only those that are assigned to the viewer.
+//
+//nolint:funlen, cyclop // Yeah the filter is a bit complicated...
+func (c Client) projectItemsPage(
+	ctx context.Context,
+	projectID ProjectID,
+	first uint,
+	after option.Option[ProjectCursor],
+) (projectItemsPage, error) {
 	data, err := graphql.GetProjectItems(ctx, c.client, string(projectID), int(first),
 		string(after.UnwrapOr("")))
 	if err != nil {
-		return ProjectV2ItemsByStatus{}, fmt.Errorf(
+		return projectItemsPage{}, fmt.Errorf(
 			"while requesting user's project (ProjectID %s) items over GitHub GraphQL: %w", projectID, err)
 	}
 
-	itemsByStatus := make(ProjectV2ItemsByStatus)
-	//nolint:forcetypeassert // Schema says its only nil or a project.
-	proj := data.Node.(*graphql.GetProjectItemsNodeProjectV2).Items.Nodes
+	queryCost.Add(int64(data.RateLimit.Cost))
+	logging.Debugf("Items of (ProjectID %s) cost %d GitHub rate limit points, %d remaining", projectID,
+		data.RateLimit.Cost, data.RateLimit.Remaining)
+
+	project, is := data.Node.(*graphql.GetProjectItemsNodeProjectV2)
+	if !is {
+		return projectItemsPage{}, fmt.Errorf("while requesting project items: %w", checkProjectNode(projectID, data.Node))
+	}
+
+	connection := project.Items
+
+	page := projectItemsPage{
+		items:       []ProjectV2Item{},
+		endCursor:   ProjectCursor(connection.PageInfo.EndCursor),
+		hasNextPage: connection.PageInfo.HasNextPage,
+	}
 
 	//nolint:lll // Has a lot of autogenerated types
-	for _, node := range proj {
-		if node.AssignedTo == nil || node.Content == nil || node.Status == nil {
+	for _, node := range connection.Nodes {
+		if node.AssignedTo == nil || len(node.Content) == 0 || string(node.Content) == "null" || node.Status == nil {
 			continue // Doesnt have all required fields
 		}
 
-		// The title of the issue
-		var title string
+		var content projectItemContent
+		if err = json.Unmarshal(node.Content, &content); err != nil {
+			return projectItemsPage{}, fmt.Errorf("while decoding an item of (ProjectID %s): %w", projectID, err)
+		}
 
-		// Depending on the type of item in the board the type will be different but the title will be present.
-		//nolint:forcetypeassert // Schema guarantees the types in this block
-		switch node.Content.GetTypename() {
-		case "DraftIssue":
-			title = node.Content.(*graphql.GetProjectItemsNodeProjectV2ItemsProjectV2ItemConnectionNodesProjectV2ItemContentDraftIssue).Title
+		if content.Kind == "" {
+			logging.Warnf("Skipping a (ProjectID %s) item with unknown content type %q", projectID, content.UnknownType)
 
-		case "Issue":
-			issue := node.Content.(*graphql.GetProjectItemsNodeProjectV2ItemsProjectV2ItemConnectionNodesProjectV2ItemContentIssue)
-			title = fmt.Sprintf("<a href=%q>Issue #%d 🔗</a> %s", issue.Url, issue.Number, issue.Title)
+			continue
+		}
 
-		case "PullRequest":
-			pr := node.Content.(*graphql.GetProjectItemsNodeProjectV2ItemsProjectV2ItemConnectionNodesProjectV2ItemContentPullRequest)
-			title = fmt.Sprintf("<a href=%q>PR #%d 🔗</a> %s", pr.Url, pr.Number, pr.Title)
-		default:
-			continue // Something else which we dont care about.
+		// The title of the issue
+		var title string
+
+		switch content.Kind {
+		case ItemKindDraft:
+			title = html.EscapeString(content.Title)
+		case ItemKindIssue:
+			title = fmt.Sprintf("<a href=%q>Issue #%d 🔗</a> %s",
+				html.EscapeString(content.URL), content.Number, html.EscapeString(content.Title))
+		case ItemKindPullRequest:
+			title = fmt.Sprintf("<a href=%q>PR #%d 🔗</a> %s",
+				html.EscapeString(content.URL), content.Number, html.EscapeString(content.Title))
 		}
 
 		// The name of the column in table view. It is stored as a single select value.
@@ -168,8 +322,6 @@ query GetProjectItems($id: ID!, $first: Int!, $after: String) {
 			continue // Dont know which column the item is in
 		}
 
-		status := statusGql.Name
-
 		assignedTo, is := node.AssignedTo.(*graphql.GetProjectItemsNodeProjectV2ItemsProjectV2ItemConnectionNodesProjectV2ItemAssignedToProjectV2ItemFieldUserValue)
 		if !is {
 			continue // Noone is assigned or its a different type. We only need the ones with isViewer==true
@@ -177,14 +329,78 @@ query GetProjectItems($id: ID!, $first: Int!, $after: String) {
 
 		for _, user := range assignedTo.Users.Nodes {
 			if user.IsViewer {
-				itemsByStatus[status] = append(itemsByStatus[status], title)
+				page.items = append(page.items, ProjectV2Item{
+					ID: ProjectItemID(node.Id), Title: title, Content: content.ItemContent, Status: statusGql.Name,
+					Reviewers: content.Reviewers,
+				})
 
 				break
 			}
 		}
 	}
 
-	return itemsByStatus, nil
+	return page, nil
+}
+
+/*
+projectItemContent is the content of a project item. genqlient fails the whole query if the content is of a type that
+is not in its copy of the schema, so the query binds it to json.RawMessage and it is decoded here instead. Content of
+another type (e.g. one that GitHub has added since) has no Kind, only UnknownType is set.
+*/
+type projectItemContent struct {
+	ItemContent
+	// Reviewers are the logins of the users whose review was requested, only for PRs
+	Reviewers []string
+	// UnknownType is the GraphQL type of content that is none of the ItemKinds
+	UnknownType string
+}
+
+func (c *projectItemContent) UnmarshalJSON(b []byte) error {
+	var content struct {
+		TypeName       string `json:"__typename"`
+		Title          string `json:"title"`
+		URL            string `json:"url"`
+		Number         int    `json:"number"`
+		ReviewRequests struct {
+			Nodes []struct {
+				RequestedReviewer *struct {
+					TypeName string `json:"__typename"`
+					Login    string `json:"login"`
+				} `json:"requestedReviewer"`
+			} `json:"nodes"`
+		} `json:"reviewRequests"`
+	}
+
+	if err := json.Unmarshal(b, &content); err != nil {
+		return fmt.Errorf("while decoding the content of a project item: %w", err)
+	}
+
+	*c = projectItemContent{
+		ItemContent: ItemContent{Kind: "", Title: content.Title, Number: content.Number, URL: content.URL},
+		Reviewers:   nil,
+		UnknownType: "",
+	}
+
+	switch content.TypeName {
+	case "DraftIssue":
+		c.Kind, c.Number, c.URL = ItemKindDraft, 0, ""
+	case "Issue":
+		c.Kind = ItemKindIssue
+	case "PullRequest":
+		c.Kind = ItemKindPullRequest
+
+		for _, request := range content.ReviewRequests.Nodes {
+			// Teams and bots can be requested too
+			if reviewer := request.RequestedReviewer; reviewer != nil && reviewer.TypeName == "User" {
+				c.Reviewers = append(c.Reviewers, reviewer.Login)
+			}
+		}
+	default:
+		*c = projectItemContent{ItemContent: ItemContent{Kind: "", Title: "", Number: 0, URL: ""}, Reviewers: nil,
+			UnknownType: content.TypeName}
+	}
+
+	return nil
 }
 
 func (c Client) ProjectV2ByID(ctx context.Context, id ProjectID) (ProjectV2, error) {
@@ -196,6 +412,7 @@ query ProjectV2ByID($id: ID!) {
       title
       number
       url
+      closed
       creator {
         login
         url
@@ -211,9 +428,7 @@ query ProjectV2ByID($id: ID!) {
 
 	project, is := resp.Node.(*graphql.ProjectV2ByIDNodeProjectV2)
 	if !is {
-		return ProjectV2{}, EmptyResponseError{
-			Message: "while requesting projectv2 by ID the `node ... on TYPE` returned nil",
-		}
+		return ProjectV2{}, fmt.Errorf("while requesting ProjectV2 by ID: %w", checkProjectNode(id, resp.Node))
 	}
 
 	return ProjectV2{
@@ -224,5 +439,129 @@ query ProjectV2ByID($id: ID!) {
 		CreatorLogin: project.Creator.GetLogin(),
 		CreatorURL:   project.GetCreator().GetUrl(),
 		Number:       project.Number,
+		Closed:       project.Closed,
+	}, nil
+}
+
+// ProjectField is a field of a project, like Status or Assignees.
+type ProjectField struct {
+	Name string
+	// DataType is the kind of values the field holds, e.g. "SINGLE_SELECT" or "DATE".
+	DataType string
+	// Options are the values a single select field can have, in the order they are shown in the project.
+	Options []string
+}
+
+// ProjectFieldsLimit is how many fields ProjectFields returns at most.
+const ProjectFieldsLimit = 50
+
+// ProjectFields returns the first ProjectFieldsLimit fields of a project in the order they are shown in the project.
+func (c Client) ProjectFields(ctx context.Context, id ProjectID) ([]ProjectField, error) {
+	_ = `# @genqlient
+query ProjectFields($id: ID!) {
+  node(id: $id) {
+    ... on ProjectV2 {
+      fields(first: 50) {
+        nodes {
+          ... on ProjectV2Field {
+            name
+            dataType
+          }
+          ... on ProjectV2IterationField {
+            name
+            dataType
+          }
+          ... on ProjectV2SingleSelectField {
+            name
+            dataType
+            options {
+              name
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+	resp, err := graphql.ProjectFields(ctx, c.client, string(id))
+	if err != nil {
+		return nil, fmt.Errorf("while requesting (ProjectID %s) fields over GitHub GraphQL: %w", id, err)
+	}
+
+	project, is := resp.Node.(*graphql.ProjectFieldsNodeProjectV2)
+	if !is {
+		return nil, fmt.Errorf("while requesting project fields: %w", checkProjectNode(id, resp.Node))
+	}
+
+	fields := make([]ProjectField, 0, len(project.Fields.Nodes))
+
+	//nolint:lll // Has a lot of autogenerated types
+	for _, node := range project.Fields.Nodes {
+		switch field := node.(type) {
+		case *graphql.ProjectFieldsNodeProjectV2FieldsProjectV2FieldConfigurationConnectionNodesProjectV2Field:
+			fields = append(fields, ProjectField{Name: field.Name, DataType: string(field.DataType), Options: nil})
+
+		case *graphql.ProjectFieldsNodeProjectV2FieldsProjectV2FieldConfigurationConnectionNodesProjectV2IterationField:
+			fields = append(fields, ProjectField{Name: field.Name, DataType: string(field.DataType), Options: nil})
+
+		case *graphql.ProjectFieldsNodeProjectV2FieldsProjectV2FieldConfigurationConnectionNodesProjectV2SingleSelectField:
+			options := make([]string, len(field.Options))
+			for i, selectOption := range field.Options {
+				options[i] = selectOption.Name
+			}
+
+			fields = append(fields, ProjectField{Name: field.Name, DataType: string(field.DataType), Options: options})
+
+		default:
+			logging.Debugf("Skipping a (ProjectID %s) field with unexpected type %s", id, typename(node))
+		}
+	}
+
+	return fields, nil
+}
+
+// CreateDraftIssue adds a draft issue to a project. The body can be empty. Returns the item of the draft.
+func (c Client) CreateDraftIssue(ctx context.Context, projectID ProjectID, title, body string) (ProjectV2Item, error) {
+	_ = `# @genqlient
+mutation AddProjectV2DraftIssue($projectId: ID!, $title: String!, $body: String) {
+  addProjectV2DraftIssue(input: {projectId: $projectId, title: $title, body: $body}) {
+    projectItem {
+      id
+      content {
+        ... on DraftIssue {
+          title
+        }
+      }
+    }
+  }
+}`
+
+	var resp *graphql.AddProjectV2DraftIssueResponse
+
+	err := retryAfterAbuse(ctx, func() (err error) {
+		resp, err = graphql.AddProjectV2DraftIssue(ctx, c.client, string(projectID), title, body)
+
+		return err //nolint:wrapcheck // Wrapped below
+	})
+	if err != nil {
+		return ProjectV2Item{}, fmt.Errorf("while creating a draft issue in (ProjectID %s) over GitHub GraphQL: %w",
+			projectID, err)
+	}
+
+	//nolint:lll // Autogenerated type
+	draft, is := resp.AddProjectV2DraftIssue.ProjectItem.Content.(*graphql.AddProjectV2DraftIssueAddProjectV2DraftIssueAddProjectV2DraftIssuePayloadProjectItemProjectV2ItemContentDraftIssue)
+	if !is {
+		return ProjectV2Item{}, EmptyResponseError{
+			Message: fmt.Sprintf("(ProjectID %s) didn't return the draft issue it created", projectID),
+		}
+	}
+
+	return ProjectV2Item{
+		ID:        ProjectItemID(resp.AddProjectV2DraftIssue.ProjectItem.Id),
+		Title:     html.EscapeString(draft.Title),
+		Content:   ItemContent{Kind: ItemKindDraft, Title: draft.Title, Number: 0, URL: ""},
+		Status:    "",
+		Reviewers: nil,
 	}, nil
 }
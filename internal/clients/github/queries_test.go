@@ -0,0 +1,399 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	genqlient "github.com/Khan/genqlient/graphql"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+const twoProjectsResponse = `{"data": {"viewer": {"projectsV2": {"edges": [
+	{"cursor": "MQ", "node": {"id": "PVT_1", "title": "First", "number": 1,
+		"url": "https://github.com/users/octocat/projects/1",
+		"creator": {"__typename": "User", "login": "octocat", "url": "https://github.com/octocat"}}},
+	{"cursor": "Mg", "node": {"id": "PVT_2", "title": "Second", "number": 2, "closed": true,
+		"url": "https://github.com/orgs/acme/projects/2",
+		"creator": {"__typename": "User", "login": "hubot", "url": "https://github.com/hubot"}}}
+], "pageInfo": {"startCursor": "MQ", "endCursor": "Mg", "hasNextPage": true, "hasPreviousPage": false}}}}}`
+
+func TestListViewerProjectsAgainstFakeServer(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer TOKEN" {
+			http.Error(w, fmt.Sprintf("bad Authorization header %q", auth), http.StatusUnauthorized)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, twoProjectsResponse)
+	}))
+	defer server.Close()
+
+	page, err := github.NewClientWithEndpoint(server.URL, "TOKEN").
+		ListViewerProjects(context.Background(), 2, option.None[github.ProjectCursor]())
+	if err != nil {
+		t.Fatalf("While listing projects: %s", err)
+	}
+
+	if page.StartCursor != "MQ" || page.EndCursor != "Mg" || !page.HasNextPage || page.HasPreviousPage {
+		t.Errorf("Wrong page info: %+v", page)
+	}
+
+	projects := page.Projects
+
+	expected := []github.ProjectV2{
+		{
+			Cursor: "MQ", Title: "First", ID: "PVT_1", URL: "https://github.com/users/octocat/projects/1",
+			CreatorLogin: "octocat", CreatorURL: "https://github.com/octocat", Number: 1,
+		},
+		{
+			Cursor: "Mg", Title: "Second", ID: "PVT_2", URL: "https://github.com/orgs/acme/projects/2",
+			CreatorLogin: "hubot", CreatorURL: "https://github.com/hubot", Number: 2, Closed: true,
+		},
+	}
+
+	if len(projects) != len(expected) {
+		t.Fatalf("Expected %d projects, got %#v", len(expected), projects)
+	}
+
+	for i := range expected {
+		if projects[i] != expected[i] {
+			t.Errorf("Project %d is %#v, expected %#v", i, projects[i], expected[i])
+		}
+	}
+}
+
+func TestProjectsPageAroundCursor(t *testing.T) {
+	t.Parallel()
+
+	// GitHub doesn't have to report pages in the other direction, but there is always one around the cursor
+	client := github.NewClientFrom(rawServer{data: `{"viewer": {"projectsV2": {"edges": [], "pageInfo": {
+		"startCursor": null, "endCursor": null, "hasNextPage": false, "hasPreviousPage": false}}}}`})
+
+	after, err := client.ListViewerProjects(context.Background(), 10, option.Some[github.ProjectCursor]("MQ"))
+	if err != nil {
+		t.Fatalf("While listing projects after a cursor: %s", err)
+	}
+
+	if !after.HasPreviousPage || after.HasNextPage {
+		t.Errorf("Expected only a previous page after a cursor, got %+v", after)
+	}
+
+	before, err := client.ListViewerProjectsBefore(context.Background(), 10, "MQ")
+	if err != nil {
+		t.Fatalf("While listing projects before a cursor: %s", err)
+	}
+
+	if !before.HasNextPage || before.HasPreviousPage {
+		t.Errorf("Expected only a next page before a cursor, got %+v", before)
+	}
+}
+
+// rawServer answers every request with `data`.
+type rawServer struct {
+	data string
+}
+
+func (s rawServer) MakeRequest(_ context.Context, _ *genqlient.Request, resp *genqlient.Response) error {
+	return json.Unmarshal([]byte(s.data), resp.Data) //nolint:wrapcheck // Its a test
+}
+
+func TestProjectItemsWithUnexpectedNodeType(t *testing.T) {
+	t.Parallel()
+
+	client := github.NewClientFrom(rawServer{data: `{"node": null}`})
+
+	_, err := client.ListViewerProjectV2Items(context.Background(), "U_1", 10, option.None[github.ProjectCursor]())
+
+	var emptyErr github.EmptyResponseError
+	if !errors.As(err, &emptyErr) {
+		t.Errorf("Expected EmptyResponseError for a null node, got %v", err)
+	}
+
+	client = github.NewClientFrom(rawServer{data: `{"node": {"__typename": "User"}}`})
+
+	_, err = client.ListViewerProjectV2Items(context.Background(), "U_1", 10, option.None[github.ProjectCursor]())
+
+	var notAProject github.NotAProjectError
+	if !errors.As(err, &notAProject) || notAProject.GotType != "User" || notAProject.ID != "U_1" {
+		t.Errorf("Expected NotAProjectError for a User node, got %v", err)
+	}
+}
+
+func TestProjectV2ByIDWithIssueNode(t *testing.T) {
+	t.Parallel()
+
+	client := github.NewClientFrom(rawServer{data: `{"node": {"__typename": "Issue"}}`})
+
+	_, err := client.ProjectV2ByID(context.Background(), "I_1")
+
+	var notAProject github.NotAProjectError
+	if !errors.As(err, &notAProject) || notAProject.GotType != "Issue" {
+		t.Fatalf("Expected NotAProjectError for an Issue node, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "(ProjectID I_1) is a node of type Issue, not a ProjectV2") {
+		t.Errorf("Error doesn't say what the ID is: %s", err)
+	}
+}
+
+func TestProjectItemsSkipsIncompleteItems(t *testing.T) {
+	t.Parallel()
+
+	const (
+		status   = `"status": {"__typename": "ProjectV2ItemFieldSingleSelectValue", "name": "Done"}`
+		assigned = `"assignedTo": {"__typename": "ProjectV2ItemFieldUserValue", "users": {"nodes": [{"isViewer": true}]}}`
+		draft    = `"content": {"__typename": "DraftIssue", "title": "Kept"}`
+	)
+
+	nodes := []string{
+		`{` + status + `, ` + assigned + `, ` + draft + `}`,
+		`{` + status + `, ` + assigned + `, "content": null}`,
+		`{"status": {"__typename": "ProjectV2ItemFieldTextValue"}, ` + assigned + `, ` + draft + `}`,
+		`{` + status + `, "assignedTo": {"__typename": "ProjectV2ItemFieldTextValue"}, ` + draft + `}`,
+	}
+
+	client := github.NewClientFrom(rawServer{data: `{"node": {"__typename": "ProjectV2", "items": {"nodes": [` +
+		strings.Join(nodes, ",") + `], "pageInfo": {"endCursor": "", "hasNextPage": false}}}}`})
+
+	items, err := client.ListViewerProjectV2Items(context.Background(), "PVT_1", 10, option.None[github.ProjectCursor]())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(items) != 1 || len(items["Done"]) != 1 || items["Done"][0].Title != "Kept" {
+		t.Fatalf("Expected only the complete item, got %#v", items)
+	}
+}
+
+func TestProjectItemsWithUnknownContentType(t *testing.T) {
+	t.Parallel()
+
+	const (
+		status   = `"status": {"__typename": "ProjectV2ItemFieldSingleSelectValue", "name": "Done"}`
+		assigned = `"assignedTo": {"__typename": "ProjectV2ItemFieldUserValue", "users": {"nodes": [{"isViewer": true}]}}`
+	)
+
+	nodes := []string{
+		`{"id": "PVTI_draft", ` + status + `, ` + assigned + `, "content": {"__typename": "DraftIssue", "title": "Draft"}}`,
+		`{"id": "PVTI_new", ` + status + `, ` + assigned + `, "content": {"__typename": "Discussion", "title": "New"}}`,
+		`{"id": "PVTI_pr", ` + status + `, ` + assigned + `, "content": {"__typename": "PullRequest", "title": "PR",
+"url": "https://github.com/o/r/pull/2", "number": 2, "reviewRequests": {"nodes": [
+	{"requestedReviewer": {"__typename": "User", "login": "octocat"}},
+	{"requestedReviewer": {"__typename": "Team"}}
+]}}}`,
+	}
+
+	client := github.NewClientFrom(rawServer{data: `{"node": {"__typename": "ProjectV2", "items": {"nodes": [` +
+		strings.Join(nodes, ",") + `], "pageInfo": {"endCursor": "", "hasNextPage": false}}}}`})
+
+	// A type that GitHub adds to the content union must not hide the rest of the board
+	items, err := client.ListViewerProjectV2Items(context.Background(), "PVT_1", 10, option.None[github.ProjectCursor]())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []github.ProjectV2Item{
+		{
+			ID: "PVTI_draft", Title: "Draft", Status: "Done", Reviewers: nil,
+			Content: github.ItemContent{Kind: github.ItemKindDraft, Title: "Draft", Number: 0, URL: ""},
+		},
+		{
+			ID: "PVTI_pr", Title: `<a href="https://github.com/o/r/pull/2">PR #2 🔗</a> PR`, Status: "Done",
+			Reviewers: []string{"octocat"},
+			Content: github.ItemContent{
+				Kind: github.ItemKindPullRequest, Title: "PR", Number: 2, URL: "https://github.com/o/r/pull/2",
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(items["Done"], expected) || len(items) != 1 {
+		t.Errorf("Expected only the draft and the PR, got %#v", items)
+	}
+}
+
+func TestProjectItemsHaveItemIDs(t *testing.T) {
+	t.Parallel()
+
+	const (
+		status   = `"status": {"__typename": "ProjectV2ItemFieldSingleSelectValue", "name": "Done"}`
+		assigned = `"assignedTo": {"__typename": "ProjectV2ItemFieldUserValue", "users": {"nodes": [{"isViewer": true}]}}`
+	)
+
+	nodes := []string{
+		`{"id": "PVTI_draft", ` + status + `, ` + assigned + `, "content": {"__typename": "DraftIssue", "title": "Draft"}}`,
+		`{"id": "PVTI_issue", ` + status + `, ` + assigned + `, "content": {"__typename": "Issue", "title": "Issue",
+"url": "https://github.com/o/r/issues/1", "number": 1}}`,
+		`{"id": "PVTI_pr", ` + status + `, ` + assigned + `, "content": {"__typename": "PullRequest", "title": "PR",
+"url": "https://github.com/o/r/pull/2", "number": 2, "reviewRequests": {"nodes": []}}}`,
+	}
+
+	client := github.NewClientFrom(rawServer{data: `{"node": {"__typename": "ProjectV2", "items": {"nodes": [` +
+		strings.Join(nodes, ",") + `], "pageInfo": {"endCursor": "", "hasNextPage": false}}}}`})
+
+	items, err := client.ListViewerProjectV2Items(context.Background(), "PVT_1", 10, option.None[github.ProjectCursor]())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	ids := []github.ProjectItemID{}
+	for _, item := range items["Done"] {
+		ids = append(ids, item.ID)
+	}
+
+	if expected := []github.ProjectItemID{"PVTI_draft", "PVTI_issue", "PVTI_pr"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected item IDs %v, got %v", expected, ids)
+	}
+}
+
+func TestProjectItemsQueryCost(t *testing.T) {
+	t.Parallel()
+
+	client := github.NewClientFrom(rawServer{data: `{"node": {"__typename": "ProjectV2", "items": {"nodes": [],
+"pageInfo": {"endCursor": "", "hasNextPage": false}}}, "rateLimit": {"cost": 7, "remaining": 4993}}`})
+
+	before := github.TotalQueryCost()
+
+	if _, err := client.ListViewerProjectV2Items(context.Background(), "PVT_1", 10,
+		option.None[github.ProjectCursor]()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Other tests run in parallel, but their responses don't have a cost
+	if cost := github.TotalQueryCost() - before; cost != 7 {
+		t.Errorf("Expected the query to cost 7 points, got %d", cost)
+	}
+}
+
+func TestProjectFieldsByType(t *testing.T) {
+	t.Parallel()
+
+	client := github.NewClientFrom(rawServer{data: `{"node": {"__typename": "ProjectV2", "fields": {"nodes": [
+		{"__typename": "ProjectV2Field", "name": "Title", "dataType": "TITLE"},
+		{"__typename": "ProjectV2SingleSelectField", "name": "Status", "dataType": "SINGLE_SELECT",
+			"options": [{"name": "Todo"}, {"name": "Done"}]},
+		{"__typename": "ProjectV2IterationField", "name": "Sprint", "dataType": "ITERATION"}
+	]}}}`})
+
+	fields, err := client.ProjectFields(context.Background(), "PVT_1")
+	if err != nil {
+		t.Fatalf("While getting project fields: %s", err)
+	}
+
+	expected := []github.ProjectField{
+		{Name: "Title", DataType: "TITLE", Options: nil},
+		{Name: "Status", DataType: "SINGLE_SELECT", Options: []string{"Todo", "Done"}},
+		{Name: "Sprint", DataType: "ITERATION", Options: nil},
+	}
+
+	if fmt.Sprint(fields) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+}
+
+func TestProjectFieldsOfNotAProject(t *testing.T) {
+	t.Parallel()
+
+	client := github.NewClientFrom(rawServer{data: `{"node": {"__typename": "Repository"}}`})
+
+	_, err := client.ProjectFields(context.Background(), "R_1")
+
+	var notAProject github.NotAProjectError
+	if !errors.As(err, &notAProject) || notAProject.GotType != "Repository" {
+		t.Fatalf("Expected NotAProjectError for a Repository node, got %v", err)
+	}
+}
+
+func TestCanceledContextAbortsRequests(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		// The server only notices that the client is gone after the body was read
+		_, _ = io.Copy(io.Discard, r.Body)
+
+		select { // GitHub is very slow today
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client := github.NewClientWithEndpoint(server.URL, "TOKEN")
+
+	for name, request := range map[string]func(ctx context.Context) error{
+		"Login": func(ctx context.Context) error {
+			_, err := client.Login(ctx)
+
+			return err //nolint:wrapcheck // Its a test
+		},
+		"ListViewerProjects": func(ctx context.Context) error {
+			_, err := client.ListViewerProjects(ctx, 1, option.None[github.ProjectCursor]())
+
+			return err //nolint:wrapcheck // Its a test
+		},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		started := time.Now()
+
+		err := request(ctx)
+
+		cancel()
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s: expected the deadline error, got %v", name, err)
+		}
+
+		if elapsed := time.Since(started); elapsed > time.Second {
+			t.Errorf("%s: returned %s after the context was done", name, elapsed)
+		}
+	}
+}
+
+func TestCreateDraftIssue(t *testing.T) {
+	t.Parallel()
+
+	client := github.NewClientFrom(rawServer{data: `{"addProjectV2DraftIssue": {"projectItem": {"id": "PVTI_draft",
+		"content": {"__typename": "DraftIssue", "title": "Write docs"}}}}`})
+
+	item, err := client.CreateDraftIssue(context.Background(), "PVT_1", "Write docs", "")
+	if err != nil {
+		t.Fatalf("While creating a draft: %s", err)
+	}
+
+	if item.Title != "Write docs" || item.ID != "PVTI_draft" {
+		t.Errorf("Expected the title and the item ID of the draft, got %+v", item)
+	}
+
+	client = github.NewClientFrom(rawServer{data: `{"addProjectV2DraftIssue": {"projectItem": {"content": null}}}`})
+
+	var emptyErr github.EmptyResponseError
+	if _, err = client.CreateDraftIssue(context.Background(), "PVT_1", "Write docs", ""); !errors.As(err, &emptyErr) {
+		t.Errorf("Expected EmptyResponseError without the draft, got %v", err)
+	}
+}
+
+func TestListProjectsOfMissingOrganization(t *testing.T) {
+	t.Parallel()
+
+	client := github.NewClientFrom(rawServer{data: `{"organization": null}`})
+
+	var notFound github.OrganizationNotFoundError
+
+	_, err := client.ListOrganizationProjects(context.Background(), "nobody", 10, option.None[github.ProjectCursor]())
+	if !errors.As(err, &notFound) || notFound.Login != "nobody" {
+		t.Errorf("Expected OrganizationNotFoundError, got %v", err)
+	}
+}
@@ -1,8 +1,17 @@
 package github
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/vektah/gqlparser/v2/gqlerror"
@@ -22,35 +31,177 @@ func GqlErrorStringOr(fmtStr string, err error, ifNotGqlError string) string {
 		panic("github.GqlErrorStringOr() expects an `error != nil`")
 	}
 
+	if message, isGqlError := GqlErrorString(err); isGqlError {
+		return fmt.Sprintf(fmtStr, message)
+	}
+
+	return ifNotGqlError
+}
+
+/*
+GqlErrorString returns the message of the GraphQL error in `err`, e.g. to escape it before it's put into a message.
+Returns false if the error cannot be classified, see GqlErrorStringOr.
+*/
+func GqlErrorString(err error) (string, bool) {
 	var gqlerr *gqlerror.Error
 	if errors.As(err, &gqlerr) {
-		return fmt.Sprintf(fmtStr, gqlerr.Error())
+		return gqlerr.Error(), true
 	}
 
 	var gqllist *gqlerror.List
 	if errors.As(err, &gqllist) {
-		return fmt.Sprintf(fmtStr, gqllist.Error())
+		return gqllist.Error(), true
 	}
 
-	return ifNotGqlError
+	return "", false
 }
 
 type authedTransport struct {
-	token   string
-	wrapped http.RoundTripper
+	token     string
+	userAgent string
+	wrapped   http.RoundTripper
 }
 
 func (t *authedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.Header.Set("Authorization", "Bearer "+t.token)
 
+	if t.userAgent != "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
 	resp, err := t.wrapped.RoundTrip(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to perform RoundTrip in authedTransport")
 	}
 
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		resp.Body.Close()
+
+		return nil, UnauthorizedError{}
+	case resp.StatusCode == http.StatusForbidden:
+		return classifyForbidden(resp)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		resp.Body.Close()
+
+		return nil, UnavailableError{StatusCode: resp.StatusCode}
+	default:
+		return resp, nil
+	}
+}
+
+// abuseDetectionMessages are parts of the messages GitHub sends when it thinks requests come too quickly.
+var abuseDetectionMessages = []string{ //nolint:gochecknoglobals // Constant
+	"submitted too quickly", "secondary rate limit", "abuse detection",
+}
+
+/*
+classifyForbidden returns AbuseDetectionError if a 403 response is from the abuse detection of GitHub. Other responses
+are returned as they are, so that the GraphQL client reports them like before.
+*/
+func classifyForbidden(resp *http.Response) (*http.Response, error) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "while reading a 403 response from GitHub")
+	}
+
+	var message struct {
+		Message string `json:"message"`
+	}
+
+	_ = json.Unmarshal(body, &message)
+
+	for _, abuse := range abuseDetectionMessages {
+		if strings.Contains(strings.ToLower(message.Message), abuse) {
+			return nil, AbuseDetectionError{Message: message.Message, RetryAfter: retryAfter(resp.Header)}
+		}
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
 	return resp, nil
 }
 
+/*
+abuseRetryAfterDefault is how long to wait if the abuse detection didn't send Retry-After. GitHub asks to wait at least
+a minute in that case.
+*/
+const abuseRetryAfterDefault = time.Minute
+
+// retryAfter reads the Retry-After header, which is either in seconds or a date.
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+
+		return 0
+	}
+
+	return abuseRetryAfterDefault
+}
+
+/*
+AbuseDetectionError is returned when GitHub's abuse detection (the "secondary rate limit") rejects a request, usually
+because content was created too quickly. Unlike the normal rate limit it is lifted after RetryAfter.
+*/
+type AbuseDetectionError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e AbuseDetectionError) Error() string {
+	return fmt.Sprintf("GitHub abuse detection asked to retry after %s: %s", e.RetryAfter, e.Message)
+}
+
+/*
+abuseRetryMaxWait is the longest that a mutation waits before it is retried after AbuseDetectionError. A user is
+waiting for the result, so longer waits are returned as errors instead.
+*/
+const abuseRetryMaxWait = time.Minute
+
+/*
+retryAfterAbuse calls `request` and retries it once if GitHub's abuse detection rejected it, after waiting as long as
+GitHub asked. Only for mutations, queries don't trigger the abuse detection.
+*/
+func retryAfterAbuse(ctx context.Context, request func() error) error {
+	err := request()
+
+	var abuse AbuseDetectionError
+	if !errors.As(err, &abuse) || abuse.RetryAfter > abuseRetryMaxWait {
+		return err
+	}
+
+	timer := time.NewTimer(abuse.RetryAfter)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return err
+	case <-timer.C:
+	}
+
+	return request()
+}
+
+/*
+UnauthorizedError is returned by all queries when GitHub rejects the token with 401, e.g. because it has expired or was
+revoked. The user has to add a new token.
+*/
+type UnauthorizedError struct{}
+
+func (e UnauthorizedError) Error() string {
+	return "GitHub has rejected the token (401 Unauthorized)"
+}
+
 type EmptyResponseError struct {
 	Message string
 }
@@ -58,3 +209,57 @@ type EmptyResponseError struct {
 func (e EmptyResponseError) Error() string {
 	return fmt.Sprintf("we expected something from GitHub, but it gave us nothing. details: %s", e.Message)
 }
+
+/*
+NotAProjectError is returned when a project ID points at a different kind of node, e.g. an issue or a repository.
+GotType is the GraphQL type of that node.
+*/
+type NotAProjectError struct {
+	ID      ProjectID
+	GotType string
+}
+
+func (e NotAProjectError) Error() string {
+	return fmt.Sprintf("(ProjectID %s) is a node of type %s, not a ProjectV2", e.ID, e.GotType)
+}
+
+// OrganizationNotFoundError is returned when there is no organization with this login, or the user can't see it.
+type OrganizationNotFoundError struct {
+	Login string
+}
+
+func (e OrganizationNotFoundError) Error() string {
+	return fmt.Sprintf("there is no organization %q", e.Login)
+}
+
+/*
+checkProjectNode returns NotAProjectError if the node exists, but isn't a project. Returns EmptyResponseError if there
+is no node with this ID.
+*/
+func checkProjectNode(id ProjectID, node interface{ GetTypename() string }) error {
+	if got := typename(node); got != "null" {
+		return NotAProjectError{ID: id, GotType: got}
+	}
+
+	return EmptyResponseError{Message: fmt.Sprintf("there is no node with (ProjectID %s)", id)}
+}
+
+// typename returns the GraphQL type of a genqlient interface value, or "null" if the value is nil.
+func typename(value interface{ GetTypename() string }) string {
+	if value == nil || reflect.ValueOf(value).IsNil() {
+		return "null"
+	}
+
+	return value.GetTypename()
+}
+
+// queryCost is the sum of the rate limit points of all queries that asked GitHub for their cost.
+var queryCost atomic.Int64 //nolint:gochecknoglobals // Clients are created per request, so the sum can't be in one
+
+/*
+TotalQueryCost returns how many GitHub rate limit points the queries that report their cost (e.g. the project items
+query) have used since the start.
+*/
+func TotalQueryCost() int64 {
+	return queryCost.Load()
+}
@@ -0,0 +1,313 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// memoryStore is a state.Store in memory, so that tests can give users data and see what the client saves.
+type memoryStore struct {
+	mu       sync.Mutex
+	userData map[update.UserID]state.UserSharedData
+	states   map[string]state.State
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		mu:       sync.Mutex{},
+		userData: make(map[update.UserID]state.UserSharedData),
+		states:   make(map[string]state.State),
+	}
+}
+
+func (s *memoryStore) LoadUserData(userID update.UserID) (state.UserSharedData, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userData, isSaved := s.userData[userID]
+
+	return userData, isSaved, nil
+}
+
+func (s *memoryStore) SaveUserData(userID update.UserID, userData state.UserSharedData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.userData[userID] = userData
+
+	return nil
+}
+
+func (s *memoryStore) LoadState(stateID string) (state.State, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conversation, isSaved := s.states[stateID]
+
+	return conversation, isSaved, nil
+}
+
+func (s *memoryStore) SaveState(stateID string, conversation state.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[stateID] = conversation
+
+	return nil
+}
+
+func (s *memoryStore) DeleteStates(userID update.UserID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for stateID := range s.states {
+		if _, stateUserID, isValid := update.ParseStateID(stateID); isValid && stateUserID == userID {
+			delete(s.states, stateID)
+		}
+	}
+
+	return nil
+}
+
+// callbackQueryUpdate is a press of a button on a message in `chatID`, which is a private chat if it's the user's ID.
+func callbackQueryUpdate(updateID, userID, chatID int, data string) string {
+	chatType := "group"
+	if chatID == userID {
+		chatType = "private"
+	}
+
+	return fmt.Sprintf(`{"update_id":%d,"callback_query":{"id":"cq%d","data":%q,"chat_instance":"1",
+"from":{"id":%d,"is_bot":false,"first_name":"User"},
+"message":{"message_id":1,"date":0,"text":"buttons","chat":{"id":%d,"type":%q}}}}`,
+		updateID, updateID, data, userID, chatID, chatType)
+}
+
+/*
+runUpdates processes `updates` one after another through the client's queue and processor goroutines, and stops the
+client once `isDone` is true.
+*/
+func runUpdates(t *testing.T, client *telegram.Client, updates []string, isDone func() bool) {
+	t.Helper()
+
+	fail := client.StartFetching(context.Background(), 2, func(ctx context.Context, updateCh chan<- update.Update) {
+		for _, encoded := range updates {
+			var upd update.Update
+			if err := json.Unmarshal([]byte(encoded), &upd); err != nil {
+				t.Errorf("While decoding an update: %s", err)
+
+				return
+			}
+
+			updateCh <- upd
+		}
+
+		<-ctx.Done()
+	})
+
+	deadline := time.After(5 * time.Second)
+
+	for !isDone() {
+		select {
+		case err := <-fail:
+			t.Fatalf("Bot crashed: %s", err)
+		case <-deadline:
+			t.Fatal("Timed out waiting for the updates to be processed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	client.Stop()
+}
+
+func TestClearButtonDeletesUserData(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(&fakeTelegram{expected: -1, allSent: make(chan struct{})})
+	t.Cleanup(server.Close)
+
+	store := newMemoryStore()
+
+	saved := state.NewUserSharedData()
+	saved.GithubAPIKey = option.Some("ghp_secret")
+	store.userData[7] = saved
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStore(store)
+
+	runUpdates(t, &client, []string{privateMessageUpdate(1, 7, "/clear"), callbackQueryUpdate(2, 7, 7, "clear:yes")},
+		func() bool {
+			userData, _, _ := store.LoadUserData(7)
+
+			return userData.GithubAPIKey.IsNone()
+		})
+}
+
+func TestClearResetsTheConversationsInOtherChats(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(&fakeTelegram{expected: -1, allSent: make(chan struct{})})
+	t.Cleanup(server.Close)
+
+	store := newMemoryStore()
+
+	withProject := state.NewRootState()
+	withProject.AddDefaultProject("PVT_1")
+
+	// -100:7 is loaded into memory by /help, -200:7 stays only in the store
+	for _, stateID := range []string{"-100:7", "-200:7", "-100:8"} {
+		store.states[stateID] = withProject
+	}
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStore(store)
+
+	runUpdates(t, &client, []string{
+		groupMessageUpdate(1, 7, -100, "/help"),
+		privateMessageUpdate(2, 7, "/clear"),
+		callbackQueryUpdate(3, 7, 7, "clear:yes"),
+	}, func() bool {
+		_, isSaved, _ := store.LoadState("-100:7")
+
+		return !isSaved
+	})
+
+	for stateID, shouldBeSaved := range map[string]bool{"-200:7": false, "-100:8": true} {
+		if _, isSaved, _ := store.LoadState(stateID); isSaved != shouldBeSaved {
+			t.Errorf("Expected the state of %s to be saved: %t, got %t", stateID, shouldBeSaved, isSaved)
+		}
+	}
+
+	if root, is := client.BorrowState("-100:7").Wait().(state.RootState); !is || len(root.DefaultProjects) != 0 {
+		t.Errorf("Expected the conversation in memory to be reset, got %#v", root)
+	}
+}
+
+// fakeGithubProjectPage answers every project list request with the same page, which has a next page.
+func fakeGithubProjectPage(t *testing.T) *statetest.GithubServer {
+	t.Helper()
+
+	return statetest.FakeGithub(t, map[string]string{
+		"ViewerProjectsV2": `{"data": {"viewer": {"projectsV2": {"edges": [{"cursor": "c0", "node": {"id": "PVT_0",
+"title": "Project 0", "number": 1, "url": "", "creator": {"__typename": "User", "login": "octocat", "url": ""}}}],
+"pageInfo": {"startCursor": "start", "endCursor": "end", "hasPreviousPage": false, "hasNextPage": true}}}}}`,
+	})
+}
+
+// sentEndpoints records the endpoints of the actions of a client in dry run mode.
+type sentEndpoints struct {
+	mu        sync.Mutex
+	endpoints []string
+}
+
+func (s *sentEndpoints) record(endpoint string, _ []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.endpoints = append(s.endpoints, endpoint)
+}
+
+func (s *sentEndpoints) has(endpoint string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sent := range s.endpoints {
+		if sent == endpoint {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestListProjectsNextPageButton(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(&fakeTelegram{expected: -1, allSent: make(chan struct{})})
+	t.Cleanup(server.Close)
+
+	store := newMemoryStore()
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+	store.userData[7] = userData
+
+	sent := &sentEndpoints{mu: sync.Mutex{}, endpoints: []string{}}
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStore(store)
+	client.SetGithubEndpoint(fakeGithubProjectPage(t).URL)
+	client.SetDryRun(sent.record)
+
+	runUpdates(t, &client,
+		[]string{privateMessageUpdate(1, 7, "/listProjects"), callbackQueryUpdate(2, 7, 7, "listprojects:0")},
+		func() bool { return sent.has("editMessageText") })
+}
+
+// fakeGithubPicker answers ViewerProjectsV2 with a full page of projects and ProjectV2ByID with the first of them.
+func fakeGithubPicker(t *testing.T) *statetest.GithubServer {
+	t.Helper()
+
+	edges := make([]string, 10)
+	for i := range edges {
+		edges[i] = fmt.Sprintf(`{"cursor": "c%d", "node": {"id": "PVT_%d", "title": "Project %d", "number": %d,
+"url": "", "creator": {"__typename": "User", "login": "octocat", "url": ""}}}`, i, i, i, i)
+	}
+
+	return statetest.FakeGithub(t, map[string]string{
+		"ViewerProjectsV2": fmt.Sprintf(`{"data": {"viewer": {"projectsV2": {"edges": [%s], "pageInfo": {
+"startCursor": "c0", "endCursor": "c9", "hasPreviousPage": false, "hasNextPage": true}}}}}`, strings.Join(edges, ",")),
+		"ProjectV2ByID": `{"data": {"node": {"__typename": "ProjectV2", "id": "PVT_0", "title": "Project 0",
+"number": 0, "url": "", "creator": {"__typename": "User", "login": "octocat", "url": ""}}}}`,
+	})
+}
+
+// hasDefaultProject reports whether a saved conversation has `projectID` as its only default project.
+func (s *memoryStore) hasDefaultProject(projectID github.ProjectID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, conversation := range s.states {
+		if root, isRoot := conversation.(state.RootState); isRoot &&
+			len(root.DefaultProjects) == 1 && root.DefaultProjects[0] == projectID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestPickDefaultProjectOnTheNextPage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(&fakeTelegram{expected: -1, allSent: make(chan struct{})})
+	t.Cleanup(server.Close)
+
+	store := newMemoryStore()
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+	store.userData[7] = userData
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStore(store)
+	client.SetGithubEndpoint(fakeGithubPicker(t).URL)
+	client.SetDryRun(func(string, []byte) {})
+
+	// The buttons of the second page have the tokens after the 10 of the first page
+	runUpdates(t, &client, []string{
+		groupMessageUpdate(1, 7, -100, "/pickDefaultProject"),
+		callbackQueryUpdate(2, 7, -100, "pickpage:0"),
+		callbackQueryUpdate(3, 7, -100, "pickproject:a"),
+	}, func() bool { return store.hasDefaultProject("PVT_0") })
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
@@ -24,6 +27,21 @@ const (
 	getUpdatesLimit              = 20 // How many updates should telegram API send to us
 	getUpdatesLongPollingTimeout = 5  // The server will wait this many sec before telling us there's nothing to process
 	getUpdatesRetries            = 10 // After this many failures stop trying again
+
+	// After a failed /getUpdates the next one waits getUpdatesBackoffBase, doubled with each failure in a row up to
+	// getUpdatesBackoffCap. A random part of the wait (up to half) is taken off so bots don't retry all at once.
+	getUpdatesBackoffBase = 500 * time.Millisecond
+	getUpdatesBackoffCap  = 30 * time.Second
+
+	callbackDedupTTL = 5 * time.Second // Taps on the same button within this time are a double tap
+	githubClientTTL  = time.Hour       // A user's GitHub client is kept for this long after their last command
+	pageTokensTTL    = 24 * time.Hour  // Pagination buttons of a chat expire this long after the last list was sent
+
+	reportPruneInterval = time.Hour // How often the reports of the users in memory are pruned, see SetReportRetention
+
+	busyRepliesBuffer = 16 // How many busy replies can wait to be sent, the ones over it are dropped, see shed
+
+	unwindTimeout = 10 * time.Second // How long Stop() can take to tell users that their commands were canceled
 )
 
 // Starter is a muiltithreaded client where the number of threads is passed into Start()
@@ -55,11 +73,63 @@ type Client struct {
 	// When the bot crashes instead of paniking and crashing the whole app it sends the error here
 	errCh          chan<- error
 	stopProcessing context.CancelFunc // Triggers the shutdown
+	// crash makes the processors give up waiting for a state that the panicked goroutine will never return. See fail.
+	crash context.CancelFunc
 
 	conversationStateStore borrowonce.Storage[string, state.State]
 	userSharedDataStore    borrowonce.Storage[update.UserID, state.UserSharedData]
-
-	responses state.Responses
+	// store keeps the states and user data across restarts, if it's set. See SetStore.
+	store state.Store
+
+	// responses are read by the processor goroutines while SetResponses can replace them
+	responses *atomic.Pointer[state.Responses]
+	// seenUpdatesSize is how many update IDs are remembered to drop duplicate updates
+	seenUpdatesSize uint
+	seenUpdates     *seenUpdates
+	// held are the updates that wait for the previous update of their conversation to be processed
+	held *heldUpdates
+	// reportConcurrency is how many GitHub projects are requested at once for one report
+	reportConcurrency uint
+	// showProjectCursors shows the cursors in /listProjects. See SetShowProjectCursors.
+	showProjectCursors bool
+	// dailyStatusConfig is the bot-wide config of reports. See SetDailyStatusConfig.
+	dailyStatusConfig state.DailyStatusConfig
+	// commandAliases are the aliases from the config, on top of the ones in the command registry
+	commandAliases state.CommandAliases
+	// allowlist are the only users and chats that are served. See SetAllowlist.
+	allowlist state.Allowlist
+	// githubUserAgent is sent to GitHub by the handlers. See SetUserAgent.
+	githubUserAgent string
+	// githubEndpoint is where the handlers send GitHub queries. See SetGithubEndpoint.
+	githubEndpoint string
+	// sendDelay is the pause between the actions of one transition to the same chat. See SetSendDelay.
+	sendDelay time.Duration
+	// inlineProcessing processes updates in the getUpdates goroutine. See SetInlineProcessing.
+	inlineProcessing bool
+	// maxConversations is how many updates can be queued or processed at once, 0 is no limit. See SetMaxConversations.
+	maxConversations uint
+	// inFlight is how many updates are queued or processed right now
+	inFlight atomic.Int64
+	// busyReplies are sent by sendBusyReplies, so that shed doesn't wait for Telegram
+	busyReplies chan response.BotAction
+	// reportRetention limits how many reports are kept in each user's UserSharedData
+	reportRetention state.ReportRetention
+	// replayFile has the updates to process instead of asking Telegram. See SetReplayFile.
+	replayFile string
+	// dryRun is called with each action instead of performing it, if it's set
+	dryRun func(endpoint string, body []byte)
+	// deps are passed to the handlers with each update. They are built by start, see handlerDeps.
+	deps state.Deps
+	// startOffset is where the first /getUpdates starts from, if it's set. See SetStartOffset.
+	startOffset option.Option[update.UpdateID]
+	// skipBacklog drops the updates sent before the client has started. See SkipBacklog.
+	skipBacklog bool
+	// recordFile is where updates and actions are recorded. See SetRecordFile.
+	recordFile string
+	recorder   *recorder
+	// webhook is set by StartWebhook, updates are sent to it by Telegram instead of being requested with /getUpdates
+	webhook    *webhook
+	webhookURL string
 
 	bot update.User
 }
@@ -74,17 +144,119 @@ Creates a new client.
 Creating the client is not enough, you have to `Start()` it.
 */
 func NewClient(host, token string, responses state.Responses) Client {
+	current := &atomic.Pointer[state.Responses]{}
+	current.Store(&responses)
+
 	return Client{
 		requester: response.APIRequester{
-			Client:   http.Client{},
-			Scheme:   "https",
-			Host:     host,
-			BasePath: "bot" + token,
+			Client:    http.Client{},
+			Scheme:    "https",
+			Host:      host,
+			BasePath:  "bot" + token,
+			UserAgent: "",
 		},
-		responses: responses,
+		responses:         current,
+		reportConcurrency: 1,
+		dailyStatusConfig: state.DefaultDailyStatusConfig(),
 	}
 }
 
+// SetReportRetention limits how many /dailyStatus reports are kept for each user. By default all are kept.
+func (c *Client) SetReportRetention(retention state.ReportRetention) {
+	c.reportRetention = retention
+}
+
+/*
+SetSeenUpdatesSize sets how many of the last update IDs are remembered. An update with a remembered ID is dropped
+because it was already processed. 0 turns this off.
+*/
+func (c *Client) SetSeenUpdatesSize(size uint) {
+	c.seenUpdatesSize = size
+}
+
+// SetShowProjectCursors shows the pagination cursor of each project in /listProjects. They are hidden by default.
+func (c *Client) SetShowProjectCursors(show bool) {
+	c.showProjectCursors = show
+}
+
+/*
+SetDailyStatusConfig sets which project columns fill the sections of /dailyStatus reports in chats that haven't
+changed them with /reportConfig, and if the other columns are listed too.
+*/
+func (c *Client) SetDailyStatusConfig(config state.DailyStatusConfig) {
+	c.dailyStatusConfig = config
+}
+
+// SetReportConcurrency sets how many GitHub projects are requested at the same time for one report. Default is 1.
+func (c *Client) SetReportConcurrency(concurrency uint) {
+	c.reportConcurrency = concurrency
+}
+
+// SetCommandAliases adds aliases of commands, checked with state.NewCommandAliases.
+func (c *Client) SetCommandAliases(aliases state.CommandAliases) {
+	c.commandAliases = aliases
+}
+
+/*
+SetAllowlist makes the bot serve only the users and chats in `allowlist`, everyone else gets a denial and nothing is
+requested from GitHub for them. An empty allowlist serves everyone, the default.
+*/
+func (c *Client) SetAllowlist(allowlist state.Allowlist) {
+	c.allowlist = allowlist
+}
+
+// SetUserAgent sets the User-Agent header of all requests to Telegram and GitHub.
+func (c *Client) SetUserAgent(userAgent string) {
+	c.requester.UserAgent = userAgent
+	c.githubUserAgent = userAgent
+}
+
+/*
+SetResponses replaces the texts of the bot, e.g. after the template was changed. It's safe to call while the bot is
+running: updates that are being processed finish with the old texts. The command menu and the answer to a double tap
+are set by Start and don't change.
+*/
+func (c *Client) SetResponses(responses state.Responses) {
+	c.responses.Store(&responses)
+}
+
+/*
+SetGithubEndpoint makes the handlers use the GraphQL API at `endpoint` (e.g. of a GitHub Enterprise Server). Empty is
+the public GitHub API, the default.
+*/
+func (c *Client) SetGithubEndpoint(endpoint string) {
+	c.githubEndpoint = endpoint
+}
+
+/*
+SetSendDelay sets the pause between the actions that are sent to the same chat in response to one update (e.g. the
+parts of a long message), so that Telegram's limit of about 1 message per second in a chat is not hit. The first action
+to a chat is sent right away. 0 turns it off, which is the default.
+*/
+func (c *Client) SetSendDelay(delay time.Duration) {
+	c.sendDelay = delay
+}
+
+/*
+SetMaxConversations limits how many updates can wait for a processor goroutine or be processed at once. When the limit
+is reached new updates are not queued, the user is told that the bot is busy instead. This way a flood of updates
+doesn't pile up behind slow GitHub requests. It should be more than `threads` in Start(). 0 is no limit, the default.
+*/
+func (c *Client) SetMaxConversations(max uint) {
+	c.maxConversations = max
+}
+
+/*
+SetInlineProcessing makes the client process each update in the goroutine that fetches them, before fetching the next
+ones. There is no parallelism and `threads` in Start() are ignored.
+
+This is for debugging only. Stepping through a handler is easier without the queue and processor goroutines, but one
+slow update blocks everyone else.
+*/
+func (c *Client) SetInlineProcessing(inline bool) {
+	c.inlineProcessing = inline
+}
+
 /*
 Start starts the client in the background. This function is non-blocking, meaning you dont have to
 execute it in a goroutine (also look into `Stop()`).
@@ -100,40 +272,106 @@ There are also `goroutines` amount (argument to this func) of processor goroutin
 to process multiple updates at the same time
 */
 func (c *Client) Start(threads uint) <-chan error {
+	return c.StartContext(context.Background(), threads)
+}
+
+/*
+StartContext is Start with a parent context for everything the client does. When `ctx` is done the client stops
+receiving updates and finishes the ones it has, like after Stop(). Stop() still has to be called to wait for that and
+to clean up.
+*/
+func (c *Client) StartContext(ctx context.Context, threads uint) <-chan error {
+	return c.start(ctx, threads, c.getUpdates)
+}
+
+/*
+start starts the client like Start(), with `fetch` feeding the updates into the queue instead of getUpdates. Like
+getUpdates, `fetch` must close the queue and call c.wg.Done() when it returns.
+
+The goroutines are added to c.wg before they are started, otherwise Stop() could return before they have added
+themselves.
+*/
+func (c *Client) start(parent context.Context, threads uint,
+	fetch func(ctx context.Context, updateCh chan<- update.Update),
+) <-chan error {
 	errCh := make(chan error, 1)
 	c.errCh = errCh
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parent)
 	c.stopProcessing = cancel
 
+	// Not derived from `ctx`: on Stop() the processors still have to wait for their turn to finish the queue
+	crashed, crash := context.WithCancel(context.Background())
+	c.crash = crash
+
 	if threads == 0 {
 		c.fail(ZeroThreadsError{})
 
 		return errCh
 	}
 
-	botUser, err := c.GetMe(ctx)
-	if err != nil {
-		c.fail(err)
+	if c.replayFile == "" {
+		botUser, err := c.GetMe(ctx)
+		if err != nil {
+			c.fail(err)
 
-		return errCh
+			return errCh
+		}
+
+		c.bot = botUser
+		c.registerCommands(ctx)
+	} else {
+		// A replay doesn't talk to Telegram, the bot has no username to strip from commands
+		c.bot = update.User{ID: 0, IsBot: true, FirstName: "Replay"} //nolint:exhaustruct // No optional fields
 	}
 
-	c.bot = botUser
+	if c.recordFile != "" {
+		recorder, err := newRecorder(c.recordFile, c.bot.Username.UnwrapOr(""))
+		if err != nil {
+			c.fail(err)
+
+			return errCh
+		}
+
+		c.recorder = recorder
+	}
 
 	var (
 		updateCh = make(chan update.Update, 1)
 		stateCh  = make(chan updateWithState, threads)
 	)
 
+	c.seenUpdates = newSeenUpdates(c.seenUpdatesSize)
+	c.held = newHeldUpdates()
+	c.deps = c.handlerDeps()
+	go c.deps.CallbackDedup.PruneEvery(ctx, time.Minute)
+	go c.deps.GithubClients.PruneEvery(ctx, time.Minute)
+	go c.deps.PageTokens.PruneEvery(ctx, time.Minute)
 	c.conversationStateStore = borrowonce.NewStorage[string, state.State]()
 	c.userSharedDataStore = borrowonce.NewStorage[update.UserID, state.UserSharedData]()
+	go c.pruneReportsEvery(ctx, reportPruneInterval)
+
+	c.wg.Add(1)
 
-	go c.getUpdates(ctx, updateCh)
-	go c.stateQueue(updateCh, stateCh)
+	go fetch(ctx, updateCh)
+
+	if c.inlineProcessing {
+		logging.Infof("Inline processing is on, updates are processed one by one (debug mode)")
+
+		return errCh
+	}
+
+	c.busyReplies = make(chan response.BotAction, busyRepliesBuffer)
+
+	c.wg.Add(2)
+
+	go c.stateQueue(crashed, updateCh, stateCh)
+	go c.sendBusyReplies(ctx)
 
 	for i := uint(0); i < threads; i++ {
-		go c.processUpdates(ctx, stateCh)
+		c.wg.Add(1)
+
+		go c.processUpdates(ctx, crashed, stateCh)
 	}
 
 	return errCh
@@ -156,6 +394,32 @@ func (c *Client) GetMe(ctx context.Context) (update.User, error) {
 	return botUser, err
 }
 
+// Send performs `action` outside of an update, e.g. to message the admin at startup. Works before Start.
+func (c *Client) Send(ctx context.Context, action response.BotAction) error {
+	return c.dispatchOne(ctx, action, make(map[response.ChatID]struct{}), make(map[response.ChatID]time.Time))
+}
+
+/*
+registerCommands fills the command menu of the bot with setMyCommands, see state.CommandDescriptions.Menus. The bot
+works without the menu, so errors are only logged.
+*/
+func (c *Client) registerCommands(ctx context.Context) {
+	for _, menu := range c.responses.Load().CommandMenu.Menus() {
+		endpoint, body, err := menu.JSONEncode()
+		if err == nil {
+			_, err = c.requester.DoJSONEncoded(ctx, endpoint, body)
+		}
+
+		if err != nil {
+			logging.Errorf("While registering the command menu for %s chats: %s", menu.Scope.Type, err)
+
+			continue
+		}
+
+		logging.Debugf("Registered %d commands in the menu for %s chats", len(menu.Commands), menu.Scope.Type)
+	}
+}
+
 // updateWithState is used to join an update with conversation state for that update.
 type updateWithState struct {
 	update   update.Update                            // The update itself
@@ -191,8 +455,113 @@ Instead you can create a channel for SIGTERM (`Ctrl+C`) and `<-` on that.
 	<-c // blocks until you do ^C in terminal
 */
 func (c *Client) Stop() {
+	c.stop(true)
+}
+
+/*
+stop is Stop(). The conversations are unwound only if `unwind` is set: after a crash a state can still be borrowed by
+a processor that gave up waiting for the user data (see processUpdates), and borrowing it again would never return.
+*/
+func (c *Client) stop(unwind bool) {
 	c.stopProcessing()
 	c.wg.Wait()
+
+	if unwind {
+		c.unwind()
+	}
+
+	if c.webhook != nil {
+		c.deleteWebhook()
+		c.webhook = nil
+	}
+
+	if c.recorder != nil {
+		if err := c.recorder.Close(); err != nil {
+			logging.Errorf("%s", err)
+		}
+
+		c.recorder = nil
+	}
+}
+
+/*
+unwind returns the conversations in memory to their default state with state.Handler.Unwind (e.g. /dailyStatus is
+canceled without a store), so that nobody is stuck in the middle of a command after the restart. It's called by Stop()
+after the last update was processed, so the states are not borrowed by anything else. Only changed states and user data
+are saved.
+*/
+func (c *Client) unwind() {
+	ctx, cancel := context.WithTimeout(context.Background(), unwindTimeout)
+	defer cancel()
+
+	for _, handle := range c.conversationStateStore.Keys() {
+		chatID, userID, isValid := update.ParseStateID(handle)
+		if !isValid {
+			continue
+		}
+
+		conversation := c.borrowState(handle).Wait()
+		userData := c.borrowUserData(userID).Wait()
+
+		transition := conversation.Handler(userData, c.responses.Load(), &c.deps).Unwind(ctx, chatID)
+		c.dispatch(ctx, transition.Actions)
+
+		if c.store != nil && !reflect.DeepEqual(transition.NewState, conversation) {
+			if err := c.store.SaveState(handle, transition.NewState); err != nil {
+				logging.Errorf("(ChatID %d) While saving the unwound state: %s", chatID, err)
+			}
+		}
+
+		if c.store != nil && !reflect.DeepEqual(transition.UserData, userData) {
+			if err := c.store.SaveUserData(userID, transition.UserData); err != nil {
+				logging.Errorf("(UserID %d) While saving user data after unwinding: %s", userID, err)
+			}
+		}
+
+		c.conversationStateStore.Return(handle, transition.NewState)
+		c.userSharedDataStore.Return(userID, transition.UserData)
+	}
+}
+
+// pruneReportsEvery calls pruneReports every `interval` until the context is done. Run it in a goroutine.
+func (c *Client) pruneReportsEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.pruneReports(ctx)
+		}
+	}
+}
+
+/*
+pruneReports deletes the reports of the users in memory that SetReportRetention doesn't keep anymore, so that a report
+older than MaxAge is deleted even if its user doesn't use the bot again. Users that are only in the store are pruned on
+their next update, the store can't list them.
+*/
+func (c *Client) pruneReports(ctx context.Context) {
+	for _, userID := range c.userSharedDataStore.Keys() {
+		userData, isBorrowed := c.borrowUserData(userID).WaitContext(ctx)
+		if !isBorrowed {
+			return
+		}
+
+		if pruned := userData.Reports.Prune(c.reportRetention, time.Now()); len(pruned) != len(userData.Reports) {
+			userData.Reports = pruned
+
+			if c.store != nil {
+				if err := c.store.SaveUserData(userID, userData); err != nil {
+					logging.Errorf("(UserID %d) While saving user data after pruning reports: %s", userID, err)
+				}
+			}
+		}
+
+		c.userSharedDataStore.Return(userID, userData)
+	}
 }
 
 /*
@@ -203,7 +572,8 @@ the time you receive the error value.
 */
 func (c *Client) fail(err error) {
 	logging.Errorf("Bot declared a fatal error: %s", err)
-	c.Stop()
+	c.crash()
+	c.stop(false)
 	c.errCh <- err
 }
 
@@ -218,8 +588,6 @@ on it.
 */
 //nolint:funlen,cyclop // After refactoring it's still 70-ish lines :sad_emoji:.
 func (c *Client) getUpdates(ctx context.Context, updateCh chan<- update.Update) {
-	c.wg.Add(1)
-
 	shutdown := func() {
 		close(updateCh)
 		c.wg.Done()
@@ -235,8 +603,29 @@ func (c *Client) getUpdates(ctx context.Context, updateCh chan<- update.Update)
 
 	logging.Infof("Telegram processor started")
 
+	if c.replayFile != "" {
+		if err := c.replay(ctx, updateCh); err != nil {
+			shutdown()
+			c.fail(err)
+
+			return
+		}
+
+		shutdown()
+
+		return
+	}
+
+	offset, err := c.firstOffset(ctx)
+	if err != nil {
+		shutdown()
+		c.fail(err)
+
+		return
+	}
+
 	getUpdates := getUpdatesRequest{
-		Offset:  update.UpdateID(0),
+		Offset:  offset,
 		Limit:   getUpdatesLimit,
 		Timeout: getUpdatesLongPollingTimeout,
 	}
@@ -258,7 +647,8 @@ func (c *Client) getUpdates(ctx context.Context, updateCh chan<- update.Update)
 
 					return
 				} else if wait, isSome := apiErr.Parameters.RertyAfter.Unwrap(); isSome {
-					time.Sleep(time.Duration(wait) * time.Second)
+					logging.Infof("/getUpdates is rate limited, retrying after %ds", wait)
+					sleepContext(ctx, time.Duration(wait)*time.Second)
 
 					continue
 				} else if apiErr.Parameters.MigrateToChatID.IsSome() {
@@ -268,6 +658,8 @@ func (c *Client) getUpdates(ctx context.Context, updateCh chan<- update.Update)
 				failures++
 				logging.Errorf("/getUpdates failure #%d: %s\n", failures, err)
 
+				sleepContext(ctx, getUpdatesBackoff(failures))
+
 				continue
 			}
 
@@ -277,10 +669,9 @@ func (c *Client) getUpdates(ctx context.Context, updateCh chan<- update.Update)
 				failures = 0
 			}
 
-			for i, upd := range updates {
-				logging.Tracef("%s Queued", upd.ID.Log())
-				updateCh <- (updates)[i]
+			c.feed(ctx, updates, updateCh)
 
+			for _, upd := range updates {
 				if getUpdates.Offset <= upd.ID {
 					getUpdates.Offset = upd.ID + 1
 				}
@@ -291,6 +682,64 @@ func (c *Client) getUpdates(ctx context.Context, updateCh chan<- update.Update)
 	panic(fmt.Sprintf("bot encountered too many errors (%d) while interacting with Telegram API", getUpdatesRetries))
 }
 
+// sleepContext waits for `duration` or until the context is done, so that waiting doesn't delay a shutdown.
+func sleepContext(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// getUpdatesBackoff is how long to wait before the next /getUpdates after `failures` failures in a row.
+func getUpdatesBackoff(failures int) time.Duration {
+	backoff := getUpdatesBackoffCap
+	if failures <= 0 {
+		failures = 1
+	}
+
+	// Past the cap the shift would overflow, so only shift while it's smaller
+	if exp := getUpdatesBackoffBase << (failures - 1); failures < 32 && exp < getUpdatesBackoffCap {
+		backoff = exp
+	}
+
+	half := backoff / 2 //nolint:gomnd // Half is jitter
+
+	return half + time.Duration(rand.Int63n(int64(half)+1)) //nolint:gosec // Jitter doesn't need a secure random
+}
+
+/*
+feed sends the updates to the queue in order. With inline processing they are processed right away instead. If the
+client is shutting down the rest of the updates are dropped and false is returned, Telegram sends them again after a
+restart.
+*/
+func (c *Client) feed(ctx context.Context, updates []update.Update, updateCh chan<- update.Update) bool {
+	for _, upd := range updates {
+		if !c.inlineProcessing {
+			select {
+			case <-ctx.Done():
+				return false
+			case updateCh <- upd:
+				logging.Tracef("%s Queued", upd.ID.Log())
+			}
+
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if !c.isDuplicate(upd) {
+			c.processInline(ctx, upd)
+		}
+	}
+
+	return true
+}
+
 /*
 stateQueue manages conversation state. It should be run in a goroutine. The job of this
 function is to take updates from `updateCh`, combine them with conversation state and send
@@ -299,10 +748,13 @@ that to `stateCh`.
 However it is not as simple as that. After an update is processed it could change the state
 of the conversation. If two updates try to use and change the same state they could create
 weird bugs. Refer to /docs/telegram-client/README.md for details.
-*/
-func (c *Client) stateQueue(updateCh <-chan update.Update, stateCh chan<- updateWithState) {
-	c.wg.Add(1)
 
+The guarantee is that the updates of one conversation (see update.StateID) are processed one at a time, in the order
+they were received. While one of them is processed the rest are held back (see heldUpdates), so they don't take up
+processor goroutines. The updates of one user in different chats are processed one at a time too, in the order they
+were sent to processing, which is not the order they were received if one of them was held back.
+*/
+func (c *Client) stateQueue(crashed context.Context, updateCh <-chan update.Update, stateCh chan<- updateWithState) {
 	shutdown := func() {
 		c.wg.Done()
 		close(stateCh)
@@ -316,46 +768,152 @@ func (c *Client) stateQueue(updateCh <-chan update.Update, stateCh chan<- update
 		}
 	}()
 
-	// TODO: Hold back updates that could cause race conditions in parallel processing
-	for upd := range updateCh {
-		upd := upd // creates a copy
+	crashedCh := crashed.Done()
 
-		futureState := borrowonce.NewImmediateFuture[state.State](&state.RootState{
-			DefaultProject: option.None[github.ProjectID](),
-		})
+	// After updateCh is closed the held updates are still sent on, unless the bot has crashed and they will never be
+	// released
+	for updateCh != nil || (crashedCh != nil && !c.held.IsIdle()) {
+		select {
+		case upd, isOpen := <-updateCh:
+			if !isOpen {
+				updateCh = nil
+
+				continue
+			}
 
-		if handle, ok := upd.StateID(); ok {
-			futureState = c.borrowState(handle)
+			c.queue(upd, stateCh)
+		case <-c.held.Signal:
+			for _, upd := range c.held.TakeReleased() {
+				c.send(upd, stateCh)
+			}
+		case <-crashedCh:
+			crashedCh = nil
 		}
+	}
 
-		futureUserData := borrowonce.NewImmediateFuture[state.UserSharedData](state.UserSharedData{
-			GithubAPIKey: option.None[string](),
-		})
+	shutdown()
+}
 
-		if handle, ok := upd.UserID(); ok {
-			futureUserData = c.borrowUserData(handle)
-		}
+/*
+queue sends the update to processing, unless it's a duplicate or the bot is too busy. If its conversation already has
+an update in processing it's held back until that one is done instead, see heldUpdates.
+*/
+func (c *Client) queue(upd update.Update, stateCh chan<- updateWithState) {
+	if c.isDuplicate(upd) {
+		return
+	}
+
+	if c.isSaturated() {
+		c.shed(upd)
+
+		return
+	}
+
+	c.inFlight.Add(1)
+
+	if stateID, ok := upd.StateID(); ok && c.held.Hold(stateID, upd) {
+		logging.Tracef("%s Held back until the previous update of the conversation is processed", upd.ID.Log())
+
+		return
+	}
+
+	c.send(upd, stateCh)
+}
+
+/*
+send borrows the conversation state and the user data of the update and sends it to a processor goroutine. The
+futures are resolved in the order they were borrowed, so a processor only waits for updates that were sent before its
+own.
+*/
+func (c *Client) send(upd update.Update, stateCh chan<- updateWithState) {
+	futureState := borrowonce.NewImmediateFuture[state.State](state.NewRootState())
+
+	if handle, ok := upd.StateID(); ok {
+		futureState = c.borrowState(handle)
+	}
+
+	futureUserData := borrowonce.NewImmediateFuture[state.UserSharedData](state.NewUserSharedData())
+
+	if handle, ok := upd.UserID(); ok {
+		futureUserData = c.borrowUserData(handle)
+	}
+
+	stateCh <- updateWithState{
+		update:   upd,
+		state:    futureState,
+		userData: futureUserData,
+	}
+}
+
+// isSaturated returns true if SetMaxConversations updates are already queued or being processed.
+func (c *Client) isSaturated() bool {
+	return c.maxConversations != 0 && c.inFlight.Load() >= int64(c.maxConversations)
+}
+
+/*
+shed drops the update and tells the user that the bot is busy. It is called from stateQueue, which would wait for a free
+processor goroutine otherwise. The reply is sent by sendBusyReplies: when the bot is flooded stateQueue has to keep up
+with the updates, a reply that doesn't fit in the buffer is dropped instead.
+*/
+func (c *Client) shed(upd update.Update) {
+	logging.Infof("%s Dropped because %d updates are already in flight", upd.ID.Log(), c.inFlight.Load())
+
+	var busy response.BotAction
+
+	if message, isSome := upd.Message.Unwrap(); isSome {
+		busy = response.NewSendMessage(message.Chat.ID, c.responses.Load().Root.Busy)
+	}
+
+	if callback, isSome := upd.CallbackQuery.Unwrap(); isSome {
+		busy = response.CallbackQueryAnswerNotification(callback.ID, c.responses.Load().Root.Busy)
+	}
+
+	if busy == nil {
+		return
+	}
+
+	select {
+	case c.busyReplies <- busy:
+	default:
+		logging.Debugf("%s No busy reply, %d are already waiting to be sent", upd.ID.Log(), len(c.busyReplies))
+	}
+}
+
+// sendBusyReplies sends the replies of shed until the context is done. Run it in a goroutine.
+func (c *Client) sendBusyReplies(ctx context.Context) {
+	defer c.wg.Done()
 
-		stateCh <- updateWithState{
-			update:   upd,
-			state:    futureState,
-			userData: futureUserData,
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case busy := <-c.busyReplies:
+			c.dispatch(ctx, []response.BotAction{busy})
 		}
 	}
+}
 
-	shutdown()
+// isDuplicate returns true if the update was already received. Only call from one goroutine.
+func (c *Client) isDuplicate(upd update.Update) bool {
+	if c.seenUpdates.Seen(upd.ID) {
+		logging.Infof("%s Dropped because it was already received", upd.ID.Log())
+
+		return true
+	}
+
+	return false
 }
 
 /*
-borrowState returns a Future to access the latest value of the state. If no state is in the storage then assigns it to
-Root.
+borrowState returns a Future to access the latest value of the state. If no state is in the storage then loads it from
+the Store, or assigns it to Root.
 */
 func (c *Client) borrowState(handle string) *borrowonce.Future[state.State] {
 	if future, exists := c.conversationStateStore.Borrow(handle); exists {
 		return future
 	}
 
-	c.conversationStateStore.Set(handle, &state.RootState{DefaultProject: option.None[github.ProjectID]()})
+	c.conversationStateStore.Set(handle, c.loadState(handle))
 
 	if future, exists := c.conversationStateStore.Borrow(handle); exists {
 		return future
@@ -366,17 +924,15 @@ func (c *Client) borrowState(handle string) *borrowonce.Future[state.State] {
 }
 
 /*
-takeState returns a Future to access the latest value of the state. If no state is in the storage then assigns it to
-Root.
+borrowUserData returns a Future to access the latest value of the user data. If it's not in the storage then loads it
+from the Store, or creates new user data.
 */
 func (c *Client) borrowUserData(handle update.UserID) *borrowonce.Future[state.UserSharedData] {
 	if future, exists := c.userSharedDataStore.Borrow(handle); exists {
 		return future
 	}
 
-	c.userSharedDataStore.Set(handle, state.UserSharedData{
-		GithubAPIKey: option.None[string](),
-	})
+	c.userSharedDataStore.Set(handle, c.loadUserData(handle))
 
 	if future, exists := c.userSharedDataStore.Borrow(handle); exists {
 		return future
@@ -389,11 +945,10 @@ func (c *Client) borrowUserData(handle update.UserID) *borrowonce.Future[state.U
 /*
 processUpdates method should be run in a goroutine and will process updates that come through the channel.
 
-Stop this goroutine by closing the channel.
+Stop this goroutine by closing the channel. Once `crashed` is done the updates whose state or user data is not available
+yet are dropped, because the goroutine that has it may have panicked without returning it.
 */
-func (c *Client) processUpdates(ctx context.Context, updateWithStateCh <-chan updateWithState) {
-	c.wg.Add(1)
-
+func (c *Client) processUpdates(ctx, crashed context.Context, updateWithStateCh <-chan updateWithState) {
 	shutdown := func() { c.wg.Done() }
 
 	defer func() {
@@ -404,35 +959,301 @@ func (c *Client) processUpdates(ctx context.Context, updateWithStateCh <-chan up
 	}()
 
 	for job := range updateWithStateCh {
-		handler := job.state.Wait().Handler(job.userData.Wait(), &c.responses)
+		conversation, hasState := job.state.WaitContext(crashed)
+		userData, hasUserData := job.userData.WaitContext(crashed)
+
+		if hasState && hasUserData {
+			c.processUpdate(ctx, job.update, conversation, userData)
+		} else {
+			// Whatever was borrowed is not returned: the bot has crashed and every other processor gives up as well
+			logging.Errorf("%s Dropped, the bot has crashed while the update was waiting for its state",
+				job.update.ID.Log())
+		}
 
-		transition := state.Handle(ctx, c.bot, job.update, handler)
-		for _, action := range transition.Actions {
-			endpoint, body, err := action.JSONEncode()
-			if err != nil {
-				logging.Errorf("While encoding an action to JSON: %s", err)
+		if stateID, ok := job.update.StateID(); ok {
+			c.held.Done(stateID)
+		}
 
-				continue
+		c.inFlight.Add(-1)
+	}
+
+	shutdown()
+}
+
+/*
+processUpdate handles the update and returns the new conversation state and user data to the storage. If it panics the
+borrowed values are returned unchanged before the panic goes on, otherwise every later update of the chat and the user
+would wait for them forever.
+*/
+func (c *Client) processUpdate(ctx context.Context, upd update.Update, conversation state.State,
+	userData state.UserSharedData,
+) {
+	// Set to false once the value is returned, so that it's not returned twice
+	stateID, holdsState := upd.StateID()
+	userID, holdsUserData := upd.UserID()
+
+	defer func() {
+		if err := recover(); err != nil {
+			if holdsState {
+				c.conversationStateStore.Return(stateID, conversation)
 			}
 
-			_, err = c.requester.DoJSONEncoded(ctx, endpoint, body)
-			if err != nil {
-				logging.Errorf("While performing /%s: %s\n  Details:\n    %s", endpoint, err, body)
+			if holdsUserData {
+				c.userSharedDataStore.Return(userID, userData)
 			}
+
+			panic(err)
 		}
+	}()
+
+	transition := state.Handle(ctx, c.deps, upd, conversation, userData, c.responses.Load())
+	dispatchErrs := c.dispatchWithErrors(ctx, transition.Actions)
+
+	if c.recorder != nil {
+		c.recorder.Record(upd, conversation, transition.Actions)
+	}
 
-		if id, ok := job.update.StateID(); ok {
-			c.conversationStateStore.Return(id, transition.NewState)
+	// Saved before returning, so that the next update of this chat or user can't be saved first and get overwritten
+	if holdsState {
+		c.saveState(upd.ID, stateID, transition.NewState)
+		holdsState = false
+		c.conversationStateStore.Return(stateID, transition.NewState)
+	}
+
+	if holdsUserData {
+		for _, err := range dispatchErrs {
+			transition.UserData.RecentErrors = transition.UserData.RecentErrors.Add(state.ErrorSourceTelegram, err,
+				time.Now())
 		}
 
-		if id, ok := job.update.UserID(); ok {
-			c.userSharedDataStore.Return(id, transition.UserData)
+		transition.UserData.Reports = transition.UserData.Reports.Prune(c.reportRetention, time.Now())
+
+		// The client of the old key would still work with it until it expires
+		oldKey, hadKey := userData.GithubAPIKey.Unwrap()
+		if newKey, _ := transition.UserData.GithubAPIKey.Unwrap(); hadKey && newKey != oldKey {
+			c.deps.GithubClients.Forget(oldKey)
 		}
+		c.saveUserData(upd.ID, userID, transition.UserData)
+		holdsUserData = false
+		c.userSharedDataStore.Return(userID, transition.UserData)
+	}
 
-		logging.Tracef("%s Processed", job.update.ID.Log())
+	// Set by /clear, the other conversations are reset after this one is returned
+	if transition.ForgetConversations {
+		if userID, isSome := upd.UserID(); isSome {
+			c.forgetConversations(ctx, upd.ID, userID)
+		}
 	}
 
-	shutdown()
+	logging.Tracef("%s Processed", upd.ID.Log())
+}
+
+/*
+forgetConversations resets the conversations of the user in every chat to RootState and deletes them from the store.
+It's called after the update has returned its own state, so borrowing the states only waits for the other updates of
+the user.
+*/
+func (c *Client) forgetConversations(ctx context.Context, updateID update.UpdateID, userID update.UserID) {
+	for _, handle := range c.conversationStateStore.Keys() {
+		if _, stateUserID, isValid := update.ParseStateID(handle); !isValid || stateUserID != userID {
+			continue
+		}
+
+		if _, isBorrowed := c.borrowState(handle).WaitContext(ctx); !isBorrowed {
+			logging.Errorf("%s Stopped before the conversation %s of (UserID %d) was reset", updateID.Log(), handle,
+				userID)
+
+			return
+		}
+
+		c.conversationStateStore.Return(handle, state.NewRootState())
+	}
+
+	if c.store == nil {
+		return
+	}
+
+	if err := c.store.DeleteStates(userID); err != nil {
+		logging.Errorf("%s While deleting the conversations of (UserID %d): %s", updateID.Log(), userID, err)
+	}
+}
+
+/*
+handlerDeps builds the settings and services that the handlers get with each update, see state.Deps. It's called by
+start once the bot user is known, the setters of the client don't change the handlers after that.
+*/
+func (c *Client) handlerDeps() state.Deps {
+	deps := state.NewDeps()
+	deps.Bot = c.bot
+	deps.Dispatch = c.dispatch
+	deps.ReportConcurrency = c.reportConcurrency
+	deps.CommandAliases = c.commandAliases
+	deps.Allowlist = c.allowlist
+	deps.ShowProjectCursors = c.showProjectCursors
+	deps.DailyStatusConfig = c.dailyStatusConfig
+	deps.KeepsStates = c.store != nil
+	deps.Github = github.ClientOptions{Endpoint: c.githubEndpoint, UserAgent: c.githubUserAgent}
+	deps.GithubClients = state.NewGithubClients(githubClientTTL)
+	deps.CallbackDedup = state.NewCallbackDedup(callbackDedupTTL, c.responses.Load().Root.AlreadyProcessing)
+	deps.PageTokens = state.NewChatPageTokens(pageTokensTTL)
+
+	return deps
+}
+
+/*
+processInline processes the update in the calling goroutine instead of sending it to the processor goroutines. Nothing
+else holds the state when this is called, so borrowing it returns immediately.
+*/
+func (c *Client) processInline(ctx context.Context, upd update.Update) {
+	conversation := state.State(state.NewRootState())
+	if handle, ok := upd.StateID(); ok {
+		conversation = c.borrowState(handle).Wait()
+	}
+
+	userData := state.NewUserSharedData()
+	if handle, ok := upd.UserID(); ok {
+		userData = c.borrowUserData(handle).Wait()
+	}
+
+	c.processUpdate(ctx, upd, conversation, userData)
+}
+
+/*
+dispatch performs the actions in order. Errors are logged and the next action is performed anyway, except in a
+response.Batch: if one of its actions fails the rest of the batch is dropped.
+
+If the bot was removed from a chat or blocked by the user, the rest of the actions for that chat are skipped instead of
+failing one by one. Actions to a chat that already got one are sent after the send delay, see SetSendDelay.
+*/
+func (c *Client) dispatch(ctx context.Context, actions []response.BotAction) {
+	_ = c.dispatchWithErrors(ctx, actions)
+}
+
+/*
+dispatchWithErrors is dispatch that returns the errors the user should know about, see state.RecentErrors. Errors of
+chats the bot can't send to and of messages that can't be deleted are left out.
+*/
+func (c *Client) dispatchWithErrors(ctx context.Context, actions []response.BotAction) []error {
+	removedFrom := make(map[response.ChatID]struct{})
+	sentAt := make(map[response.ChatID]time.Time)
+	errs := []error{}
+
+	for _, action := range actions {
+		batch, isBatch := action.(response.Batch)
+		if !isBatch {
+			if err := c.dispatchOne(ctx, action, removedFrom, sentAt); isUserFacing(err) {
+				errs = append(errs, err)
+			}
+
+			continue
+		}
+
+		parts := response.Flatten(batch.Expand())
+		for i, part := range parts {
+			if err := c.dispatchOne(ctx, part, removedFrom, sentAt); err != nil {
+				logging.Debugf("Dropping the last %d actions of a %T batch: %s", len(parts)-i-1, batch, err)
+
+				if isUserFacing(err) {
+					errs = append(errs, err)
+				}
+
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+// isUserFacing is true if `err` of an action is worth showing in /errors.
+func isUserFacing(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr response.APIError
+	if errors.As(err, &apiErr) && (apiErr.IsRemovedFromChat() || apiErr.IsMessageNotDeletable()) {
+		return false
+	}
+
+	var blocked response.BotBlockedError
+
+	return !errors.As(err, &blocked)
+}
+
+/*
+dispatchOne performs the action. Errors are logged and returned, so that the rest of a batch can be dropped. Chats the
+bot was removed from are added to `removedFrom` and actions sent to them are skipped. `sentAt` is when the last action
+was sent to each chat, to wait for the send delay.
+*/
+func (c *Client) dispatchOne(ctx context.Context, action response.BotAction,
+	removedFrom map[response.ChatID]struct{}, sentAt map[response.ChatID]time.Time,
+) error {
+	endpoint, body, err := action.JSONEncode()
+	if err != nil {
+		logging.Errorf("While encoding an action to JSON: %s", err)
+
+		return err
+	}
+
+	if c.dryRun != nil {
+		c.dryRun(endpoint, body)
+
+		return nil
+	}
+
+	chatID, hasChat := response.ChatIDOf(body)
+	if _, isRemoved := removedFrom[chatID]; hasChat && isRemoved {
+		logging.Tracef("Skipping /%s to (ChatID %s) because the bot was removed from it", endpoint, chatID)
+
+		return nil
+	}
+
+	if last, isSent := sentAt[chatID]; hasChat && isSent && c.sendDelay > 0 {
+		sleepContext(ctx, time.Until(last.Add(c.sendDelay))) // If ctx is done the request fails right away
+	}
+
+	if hasChat {
+		defer func() { sentAt[chatID] = time.Now() }()
+	}
+
+	if withFiles, hasFiles := action.(response.ActionWithFiles); hasFiles {
+		_, err = c.requester.DoMultipart(ctx, endpoint, body, withFiles.Files())
+	} else {
+		_, err = c.requester.DoJSONEncoded(ctx, endpoint, body)
+	}
+
+	var apiErr response.APIError
+	if hasChat && errors.As(err, &apiErr) && apiErr.IsRemovedFromChat() {
+		logging.Infof("Bot was removed from (ChatID %s): %s", chatID, apiErr.Description)
+
+		removedFrom[chatID] = struct{}{}
+
+		return err
+	}
+
+	var blocked response.BotBlockedError
+	if hasChat && errors.As(err, &blocked) {
+		// Nothing to do about it, the user will see the messages once they unblock the bot and send a command.
+		logging.Debugf("Bot is blocked by the user in (ChatID %s), dropping /%s", chatID, endpoint)
+
+		removedFrom[chatID] = struct{}{}
+
+		return err
+	}
+
+	if errors.As(err, &apiErr) && apiErr.IsMessageNotDeletable() {
+		// E.g. the message is older than 48 hours, there is nothing else to do with it
+		logging.Infof("Message in (ChatID %s) was not deleted: %s", chatID, apiErr.Description)
+
+		return err
+	}
+
+	if err != nil {
+		logging.Errorf("While performing /%s: %s\n  Details:\n    %s", endpoint, err, body)
+	}
+
+	return err
 }
 
 type getUpdatesRequest struct {
@@ -0,0 +1,649 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+)
+
+/*
+fakeTelegram serves `updates` once and records which chats the bot has sent messages to. `allSent` is closed after
+`expected` messages. Like Telegram, it only serves updates starting from the requested offset, and a negative offset
+returns the last updates without marking them as served.
+*/
+type fakeTelegram struct {
+	updates  []string
+	expected int
+
+	mu      sync.Mutex
+	served  bool
+	offsets []int64
+	sentTo  []string
+	allSent chan struct{}
+	// webhookURL and webhookSecret are from /setWebhook, they are cleared by /deleteWebhook
+	webhookURL, webhookSecret string
+	webhookDeleted            bool
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch endpoint {
+	case "getMe":
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`)
+
+	case "getUpdates":
+		offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+		f.offsets = append(f.offsets, offset)
+
+		if offset < 0 {
+			last := len(f.updates) + int(offset)
+			if last < 0 {
+				last = 0
+			}
+
+			fmt.Fprintf(w, `{"ok":true,"result":[%s]}`, strings.Join(f.updates[last:], ","))
+
+			return
+		}
+
+		if f.served {
+			time.Sleep(time.Millisecond) // No new updates
+			fmt.Fprint(w, `{"ok":true,"result":[]}`)
+
+			return
+		}
+
+		f.served = true
+		fmt.Fprintf(w, `{"ok":true,"result":[%s]}`, strings.Join(f.updatesFrom(offset), ","))
+
+	case "sendMessage":
+		var message struct {
+			ChatID string `json:"chat_id"`
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &message)
+
+		f.sentTo = append(f.sentTo, message.ChatID)
+		if len(f.sentTo) == f.expected {
+			close(f.allSent)
+		}
+
+		fmt.Fprint(w, `{"ok":true,"result":{}}`)
+
+	case "setWebhook":
+		var webhook struct {
+			URL         string `json:"url"`
+			SecretToken string `json:"secret_token"`
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&webhook)
+		f.webhookURL, f.webhookSecret = webhook.URL, webhook.SecretToken
+
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+
+	case "deleteWebhook":
+		f.webhookDeleted = true
+
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+
+	default:
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	}
+}
+
+// updatesFrom returns the updates with an ID of at least `offset`.
+func (f *fakeTelegram) updatesFrom(offset int64) []string {
+	updates := []string{}
+
+	for _, upd := range f.updates {
+		var decoded struct {
+			UpdateID int64 `json:"update_id"`
+		}
+
+		_ = json.Unmarshal([]byte(upd), &decoded)
+
+		if decoded.UpdateID >= offset {
+			updates = append(updates, upd)
+		}
+	}
+
+	return updates
+}
+
+func privateMessageUpdate(updateID, userID int, text string) string {
+	return fmt.Sprintf(`{"update_id":%d,"message":{"message_id":%d,"date":0,"text":%q,
+"from":{"id":%d,"is_bot":false,"first_name":"User"},"chat":{"id":%d,"type":"private"}}}`,
+		updateID, updateID, text, userID, userID)
+}
+
+func helpResponses() state.Responses {
+	var responses state.Responses
+	responses.Root.Help = "help"
+
+	return responses
+}
+
+// runUntilAllSent starts the client with 1 thread and stops it when the fake has received all expected messages.
+func runUntilAllSent(t *testing.T, client *telegram.Client, fake *fakeTelegram) {
+	t.Helper()
+
+	fail := client.Start(1)
+
+	select {
+	case <-fake.allSent:
+	case err := <-fail:
+		t.Fatalf("Bot crashed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for replies")
+	}
+
+	client.Stop()
+}
+
+func TestInlineProcessingKeepsOrder(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTelegram{expected: 20, allSent: make(chan struct{})}
+	for i := 1; i <= 20; i++ {
+		fake.updates = append(fake.updates, privateMessageUpdate(i, i, "/help"))
+	}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetInlineProcessing(true)
+
+	runUntilAllSent(t, &client, fake)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	for i, chatID := range fake.sentTo {
+		if chatID != fmt.Sprint(i+1) {
+			t.Fatalf("Updates were not processed in order: %v", fake.sentTo)
+		}
+	}
+}
+
+func TestDuplicateUpdateIsDropped(t *testing.T) {
+	t.Parallel()
+
+	for _, inline := range []bool{false, true} {
+		fake := &fakeTelegram{
+			updates: []string{
+				privateMessageUpdate(1, 1, "/help"),
+				privateMessageUpdate(1, 1, "/help"),
+				privateMessageUpdate(2, 2, "/help"),
+			},
+			expected: 2,
+			allSent:  make(chan struct{}),
+		}
+
+		server := httptest.NewServer(fake)
+
+		client := telegram.NewTestClient(server, helpResponses())
+		client.SetInlineProcessing(inline)
+		client.SetSeenUpdatesSize(10)
+
+		runUntilAllSent(t, &client, fake)
+		server.Close()
+
+		if fmt.Sprint(fake.sentTo) != "[1 2]" {
+			t.Errorf("Expected 1 message per update (inline %t), sent to %v", inline, fake.sentTo)
+		}
+	}
+}
+
+func TestStartOffsetSkipsUpdates(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTelegram{
+		updates: []string{
+			privateMessageUpdate(1, 1, "/help"),
+			privateMessageUpdate(2, 2, "/help"),
+			privateMessageUpdate(3, 3, "/help"),
+		},
+		expected: 1,
+		allSent:  make(chan struct{}),
+	}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStartOffset(3)
+
+	runUntilAllSent(t, &client, fake)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fmt.Sprint(fake.sentTo) != "[3]" || fake.offsets[0] != 3 {
+		t.Fatalf("Expected only update 3 to be processed, sent to %v with offsets %v", fake.sentTo, fake.offsets)
+	}
+}
+
+func TestSkipBacklog(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTelegram{
+		updates: []string{
+			privateMessageUpdate(1, 1, "/help"),
+			privateMessageUpdate(2, 2, "/help"),
+		},
+		expected: 0,
+		allSent:  make(chan struct{}),
+	}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SkipBacklog()
+
+	offset, err := client.FirstOffset(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if offset != 3 {
+		t.Fatalf("Expected to start after the last update (3), got %d", offset)
+	}
+
+	// An empty backlog starts from the beginning
+	fake.mu.Lock()
+	fake.updates = nil
+	fake.mu.Unlock()
+
+	if offset, err = client.FirstOffset(context.Background()); err != nil || offset != 0 {
+		t.Fatalf("Expected offset 0 without a backlog, got %d (%v)", offset, err)
+	}
+}
+
+func TestFailedMessageDropsTheRestOfTheBatch(t *testing.T) {
+	t.Parallel()
+
+	var sent []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct {
+			Text string `json:"text"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("While decoding a message: %s", err)
+		}
+
+		sent = append(sent, message.Text)
+
+		if message.Text == "2" {
+			fmt.Fprint(w, `{"ok":false,"error_code":400,"description":"Bad Request: message is too long"}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"ok":true,"result":{}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	client := telegram.NewTestClient(server, state.Responses{})
+	client.Dispatch(context.Background(), []response.BotAction{
+		response.SendMessages{
+			response.NewSendMessage(1, "1"),
+			response.NewSendMessage(1, "2"),
+			response.NewSendMessage(1, "3"),
+		},
+		response.NewSendMessage(1, "after the batch"),
+	})
+
+	if strings.Join(sent, ",") != "1,2,after the batch" {
+		t.Fatalf("Expected the batch to stop after the failed message, sent %q", sent)
+	}
+}
+
+func TestSendDelayBetweenMessagesToTheSameChat(t *testing.T) {
+	t.Parallel()
+
+	const delay = 300 * time.Millisecond
+
+	var (
+		mu     sync.Mutex
+		sentAt = map[string]time.Time{}
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct {
+			Text string `json:"text"`
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&message)
+
+		mu.Lock()
+		sentAt[message.Text] = time.Now()
+		mu.Unlock()
+
+		fmt.Fprint(w, `{"ok":true,"result":{}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	client := telegram.NewTestClient(server, state.Responses{})
+	client.SetSendDelay(delay)
+
+	start := time.Now()
+
+	client.Dispatch(context.Background(), []response.BotAction{
+		response.NewSendMessage(1, "first"),
+		response.NewSendMessage(2, "other chat"),
+		response.NewSendMessage(1, "second"),
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if sentAt["other chat"].Sub(start) >= delay {
+		t.Errorf("A message to a different chat waited for the delay: %s", sentAt["other chat"].Sub(start))
+	}
+
+	if between := sentAt["second"].Sub(sentAt["first"]); between < delay {
+		t.Errorf("Expected at least %s between messages to the same chat, got %s", delay, between)
+	}
+}
+
+func TestGetUpdatesBackoffDoublesUpToTheCap(t *testing.T) {
+	t.Parallel()
+
+	// The jitter takes up to half of the wait off
+	for _, tc := range []struct {
+		failures int
+		max      time.Duration
+	}{
+		{1, 500 * time.Millisecond},
+		{2, time.Second},
+		{4, 4 * time.Second},
+		{10, 30 * time.Second},
+		{100, 30 * time.Second},
+	} {
+		for i := 0; i < 20; i++ {
+			if backoff := telegram.GetUpdatesBackoff(tc.failures); backoff < tc.max/2 || backoff > tc.max {
+				t.Fatalf("Backoff after %d failures is %s, expected %s to %s", tc.failures, backoff, tc.max/2, tc.max)
+			}
+		}
+	}
+}
+
+func TestStopDuringRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	requested := make(chan struct{})
+
+	var once sync.Once
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/getUpdates") {
+			fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`)
+
+			return
+		}
+
+		once.Do(func() { close(requested) })
+
+		fmt.Fprint(w, `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 60",
+"parameters":{"retry_after":60}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	client := telegram.NewTestClient(server, state.Responses{})
+	fail := client.Start(1)
+
+	select {
+	case <-requested:
+	case err := <-fail:
+		t.Fatalf("Bot crashed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for /getUpdates")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		client.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() waited for retry_after")
+	}
+}
+
+// postToWebhook sends `body` to the webhook like Telegram does. Retries until the server is listening.
+func postToWebhook(t *testing.T, url, secret, body string) int {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("While creating a webhook request: %s", err)
+		}
+
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+
+			return resp.StatusCode
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("Webhook is not reachable: %s", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+/*
+startWebhook starts the client with a webhook on a free port and waits until it's registered with `fake`. Returns the
+URL of the webhook and its secret token.
+*/
+func startWebhook(t *testing.T, client *telegram.Client, fake *fakeTelegram) (string, string, <-chan error) {
+	t.Helper()
+
+	// A free port for the webhook server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("While looking for a free port: %s", err)
+	}
+
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client.SetWebhookURL("https://bot.example.com")
+	fail := client.StartWebhook(addr, "/telegram", 1)
+
+	var secret string
+
+	for deadline := time.Now().Add(5 * time.Second); secret == "" && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+
+		fake.mu.Lock()
+		secret = fake.webhookSecret
+		fake.mu.Unlock()
+	}
+
+	return "http://" + addr + "/telegram", secret, fail
+}
+
+func TestWebhookReceivesUpdates(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTelegram{expected: 1, allSent: make(chan struct{})}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := telegram.NewTestClient(server, helpResponses())
+	webhookURL, secret, fail := startWebhook(t, &client, fake)
+
+	status := postToWebhook(t, webhookURL, "wrong", privateMessageUpdate(1, 1, "/help"))
+	if status != http.StatusUnauthorized {
+		t.Errorf("A request without the secret was answered with %d", status)
+	}
+
+	if status = postToWebhook(t, webhookURL, secret, privateMessageUpdate(2, 1, "/help")); status != http.StatusOK {
+		t.Errorf("An update was answered with %d", status)
+	}
+
+	select {
+	case <-fake.allSent:
+	case err := <-fail:
+		t.Fatalf("Bot crashed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for replies")
+	}
+
+	client.Stop()
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.webhookURL != "https://bot.example.com/telegram" {
+		t.Errorf("Registered webhook URL is %q", fake.webhookURL)
+	}
+
+	if !fake.webhookDeleted {
+		t.Errorf("Stop() didn't delete the webhook")
+	}
+
+	if len(fake.sentTo) != 1 {
+		t.Errorf("Expected one reply to the update with the secret, got %v", fake.sentTo)
+	}
+}
+
+func TestStopRefusesUpdatesThatCantBeQueued(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTelegram{expected: -1, allSent: make(chan struct{})}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	// The replies hang, so the processor, the queues and then the webhook requests are stuck
+	release := make(chan struct{})
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetDryRun(func(string, []byte) { <-release })
+	webhookURL, secret, fail := startWebhook(t, &client, fake)
+
+	// The processor, the state queue and the 2 channels between them take 4 updates
+	for id := 1; id <= 4; id++ {
+		status := postToWebhook(t, webhookURL, secret, privateMessageUpdate(id, id, "/help"))
+		if status != http.StatusOK {
+			t.Fatalf("Update %d was answered with %d", id, status)
+		}
+	}
+
+	stuck := make(chan int, 1)
+	go func() { stuck <- postToWebhook(t, webhookURL, secret, privateMessageUpdate(5, 5, "/help")) }()
+
+	stopped := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond) // The last update is waiting for the queue
+		client.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case status := <-stuck:
+		// Telegram sends it again after a restart
+		if status != http.StatusServiceUnavailable {
+			t.Errorf("An update that wasn't queued was answered with %d", status)
+		}
+	case err := <-fail:
+		t.Fatalf("Bot crashed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("A webhook request was still waiting for the queue after Stop()")
+	}
+
+	close(release)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() didn't return")
+	}
+}
+
+func TestCanceledContextStopsGettingUpdates(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTelegram{
+		updates:  []string{privateMessageUpdate(1, 1, "/help")},
+		expected: 1,
+		allSent:  make(chan struct{}),
+	}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := telegram.NewTestClient(server, helpResponses())
+	fail := client.StartContext(ctx, 1)
+
+	select {
+	case <-fake.allSent:
+	case err := <-fail:
+		t.Fatalf("Bot crashed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for replies")
+	}
+
+	cancel()
+	time.Sleep(50 * time.Millisecond) // The request that was in flight returns
+
+	fake.mu.Lock()
+	requests := len(fake.offsets)
+	fake.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	fake.mu.Lock()
+	if len(fake.offsets) != requests {
+		t.Errorf("The client kept asking for updates after the context was canceled")
+	}
+	fake.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		client.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() didn't return after the context was canceled")
+	}
+}
@@ -0,0 +1,68 @@
+package telegram_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+)
+
+func TestStartRegistersTheCommandMenu(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTelegram{ //nolint:exhaustruct // Zero values are what a fresh fake starts with
+		updates:  []string{privateMessageUpdate(1, 7, "/help")},
+		expected: 1,
+		allSent:  make(chan struct{}),
+	}
+
+	var (
+		mu    sync.Mutex
+		menus []response.SetMyCommands
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/setMyCommands") {
+			fake.ServeHTTP(w, r)
+
+			return
+		}
+
+		var menu response.SetMyCommands
+		_ = json.NewDecoder(r.Body).Decode(&menu)
+
+		mu.Lock()
+		menus = append(menus, menu)
+		mu.Unlock()
+
+		// The menu is optional, the bot must keep working if Telegram rejects it
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"ok":false,"error_code":400,"description":"Bad Request: command description is too long"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	responses := helpResponses()
+	responses.CommandMenu = map[string]string{"help": "What I can do", "clear": "Delete your data"}
+
+	client := telegram.NewTestClient(server, responses)
+	runUntilAllSent(t, &client, fake)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(menus) != 2 {
+		t.Fatalf("Expected a menu for every chat and one for private chats, got %+v", menus)
+	}
+
+	for _, menu := range menus {
+		if menu.Scope.Type == response.CommandScopeAllPrivateChats && len(menu.Commands) != 2 {
+			t.Errorf("Private chats should have both commands, got %+v", menu.Commands)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package telegram
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/borrowonce"
+)
+
+// NewTestClient creates a client that talks to a fake Telegram API. The token in request paths is "TOKEN".
+func NewTestClient(server *httptest.Server, responses state.Responses) Client {
+	current := &atomic.Pointer[state.Responses]{}
+	current.Store(&responses)
+
+	return Client{
+		requester: response.APIRequester{
+			Client:   *server.Client(),
+			Scheme:   "http",
+			Host:     strings.TrimPrefix(server.URL, "http://"),
+			BasePath: "botTOKEN",
+		},
+		responses:              current,
+		dailyStatusConfig:      state.DefaultDailyStatusConfig(),
+		conversationStateStore: borrowonce.NewStorage[string, state.State](),
+		userSharedDataStore:    borrowonce.NewStorage[update.UserID, state.UserSharedData](),
+	}
+}
+
+// SetDryRun replaces the logging of actions in dry run mode. Call it after SetReplayFile.
+func (c *Client) SetDryRun(dryRun func(endpoint string, body []byte)) {
+	c.dryRun = dryRun
+}
+
+// ReadReplayFile reads the updates from a replay (or record) file.
+func ReadReplayFile(path string) ([]update.Update, error) {
+	return readReplayFile(path)
+}
+
+// FirstOffset is the offset of the first /getUpdates after Start().
+func (c *Client) FirstOffset(ctx context.Context) (update.UpdateID, error) {
+	return c.firstOffset(ctx)
+}
+
+// Dispatch performs the actions like they were returned by a handler.
+func (c *Client) Dispatch(ctx context.Context, actions []response.BotAction) {
+	c.dispatch(ctx, actions)
+}
+
+/*
+ProcessUpdate borrows the state and the user data of the update and processes it like a processor goroutine. The
+handlers get the deps that start would build.
+*/
+func (c *Client) ProcessUpdate(ctx context.Context, upd update.Update) {
+	c.deps = c.handlerDeps()
+	stateID, _ := upd.StateID()
+	userID, _ := upd.UserID()
+
+	c.processUpdate(ctx, upd, c.borrowState(stateID).Wait(), c.borrowUserData(userID).Wait())
+}
+
+// BorrowState is the next turn to use the state of the conversation `stateID`.
+func (c *Client) BorrowState(stateID string) *borrowonce.Future[state.State] {
+	return c.borrowState(stateID)
+}
+
+// BorrowUserData is the next turn to use the user data of `userID`.
+func (c *Client) BorrowUserData(userID update.UserID) *borrowonce.Future[state.UserSharedData] {
+	return c.borrowUserData(userID)
+}
+
+// GetUpdatesBackoff is how long the client waits after `failures` failed /getUpdates in a row.
+func GetUpdatesBackoff(failures int) time.Duration {
+	return getUpdatesBackoff(failures)
+}
+
+/*
+StartFetching starts the client with `fetch` feeding the queue instead of /getUpdates. The queue is closed when `fetch`
+returns, which it should do when the context is done.
+*/
+func (c *Client) StartFetching(ctx context.Context, threads uint,
+	fetch func(ctx context.Context, updateCh chan<- update.Update),
+) <-chan error {
+	return c.start(ctx, threads, func(ctx context.Context, updateCh chan<- update.Update) {
+		defer c.wg.Done()
+		defer close(updateCh)
+
+		fetch(ctx, updateCh)
+	})
+}
+
+// PruneReports prunes the reports of the users in memory like the goroutine started by Start does every hour.
+func (c *Client) PruneReports(ctx context.Context) {
+	c.pruneReports(ctx)
+}
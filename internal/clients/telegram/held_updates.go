@@ -0,0 +1,93 @@
+package telegram
+
+import (
+	"sync"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+/*
+heldUpdates keeps the updates of conversations that already have an update in processing, so that they don't take up
+a processor goroutine that would only wait for the state. stateQueue holds an update with Hold, and once the update
+before it is processed Done releases it. The held updates of a conversation are released one at a time in the order
+they were held.
+
+Done is called by the processor goroutines, the rest only by stateQueue.
+*/
+type heldUpdates struct {
+	mu sync.Mutex
+	// busy has the conversations with an update in processing, and the updates of them that were received after it
+	busy map[string][]update.Update
+	// released are the updates that are no longer held, in the order they were released
+	released []update.Update
+	// Signal has a value after Done was called, i.e. an update was released or a conversation is no longer busy
+	Signal chan struct{}
+}
+
+func newHeldUpdates() *heldUpdates {
+	return &heldUpdates{
+		mu:       sync.Mutex{},
+		busy:     make(map[string][]update.Update),
+		released: []update.Update{},
+		Signal:   make(chan struct{}, 1),
+	}
+}
+
+/*
+Hold returns true if the conversation `stateID` has an update in processing, `upd` is then kept until it's released.
+Otherwise the conversation is marked as busy until Done is called and `upd` can be processed right away.
+*/
+func (h *heldUpdates) Hold(stateID string, upd update.Update) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if held, isBusy := h.busy[stateID]; isBusy {
+		h.busy[stateID] = append(held, upd)
+
+		return true
+	}
+
+	h.busy[stateID] = []update.Update{}
+
+	return false
+}
+
+/*
+Done is called after an update of the conversation `stateID` is processed. The next held update of the conversation is
+released, or the conversation is no longer busy if it has none.
+*/
+func (h *heldUpdates) Done(stateID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if held := h.busy[stateID]; len(held) == 0 {
+		delete(h.busy, stateID)
+	} else {
+		h.busy[stateID] = held[1:]
+		h.released = append(h.released, held[0])
+	}
+
+	select {
+	case h.Signal <- struct{}{}:
+	default: // stateQueue has not received the last signal yet, it will see this change too
+	}
+}
+
+// TakeReleased returns the released updates in the order they were released and forgets them.
+func (h *heldUpdates) TakeReleased() []update.Update {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	released := h.released
+	h.released = []update.Update{}
+
+	return released
+}
+
+// IsIdle is true if no conversation has an update in processing or held.
+func (h *heldUpdates) IsIdle() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.busy) == 0
+}
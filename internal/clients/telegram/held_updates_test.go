@@ -0,0 +1,148 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+// orderLog records the updates in the order they were handled, and if two of them were handled at the same time.
+type orderLog struct {
+	mu         sync.Mutex
+	ids        []update.UpdateID
+	handling   int
+	overlapped bool
+}
+
+func (l *orderLog) handled() []update.UpdateID {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]update.UpdateID{}, l.ids...)
+}
+
+// orderState is a conversation that records its messages in the orderLog and handles them like RootState.
+type orderState struct {
+	log *orderLog
+}
+
+func (s orderState) Handler(userData state.UserSharedData, responses *state.Responses, deps *state.Deps,
+) state.Handler {
+	return orderHandler{Handler: state.NewRootState().Handler(userData, responses, deps), state: s}
+}
+
+type orderHandler struct {
+	state.Handler
+	state orderState
+}
+
+func (h orderHandler) PrivateTextMessage(ctx context.Context, msg update.PrivateTextMessage) state.Transition {
+	log := h.state.log
+
+	log.mu.Lock()
+	log.handling++
+	log.overlapped = log.overlapped || log.handling > 1
+	log.mu.Unlock()
+
+	time.Sleep(time.Millisecond) // Gives the other processors time to take an update of this conversation too
+
+	transition := h.Handler.PrivateTextMessage(ctx, msg)
+	transition.NewState = h.state
+
+	log.mu.Lock()
+	log.handling--
+	log.ids = append(log.ids, msg.UpdateID)
+	log.mu.Unlock()
+
+	return transition
+}
+
+// orderStore is a state.Store where every conversation is an orderState with the same log.
+type orderStore struct {
+	log *orderLog
+}
+
+func (s orderStore) LoadUserData(update.UserID) (state.UserSharedData, bool, error) {
+	return state.NewUserSharedData(), false, nil
+}
+
+func (s orderStore) SaveUserData(update.UserID, state.UserSharedData) error {
+	return nil
+}
+
+func (s orderStore) LoadState(string) (state.State, bool, error) {
+	return orderState{log: s.log}, true, nil
+}
+
+func (s orderStore) SaveState(string, state.State) error {
+	return nil
+}
+
+func (s orderStore) DeleteStates(update.UserID) error {
+	return nil
+}
+
+func TestUpdatesOfOneConversationAreProcessedInOrder(t *testing.T) {
+	t.Parallel()
+
+	const updates = 100
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	log := &orderLog{mu: sync.Mutex{}, ids: []update.UpdateID{}, handling: 0, overlapped: false}
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStore(orderStore{log: log})
+	client.SetDryRun(func(string, []byte) {})
+
+	fail := client.StartFetching(context.Background(), 8, func(ctx context.Context, updateCh chan<- update.Update) {
+		for id := 1; id <= updates; id++ {
+			var upd update.Update
+			if err := json.Unmarshal([]byte(privateMessageUpdate(id, 7, "/help")), &upd); err != nil {
+				t.Errorf("While decoding an update: %s", err)
+
+				return
+			}
+
+			updateCh <- upd
+		}
+
+		<-ctx.Done()
+	})
+
+	deadline := time.After(10 * time.Second)
+
+	for len(log.handled()) < updates {
+		select {
+		case err := <-fail:
+			t.Fatalf("Bot crashed: %s", err)
+		case <-deadline:
+			t.Fatalf("Only %d of %d updates were processed", len(log.handled()), updates)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	client.Stop()
+
+	for i, id := range log.handled() {
+		if id != update.UpdateID(i+1) {
+			t.Fatalf("Updates were processed out of order: %v", log.handled())
+		}
+	}
+
+	if log.overlapped {
+		t.Fatal("Two updates of the conversation were processed at the same time")
+	}
+}
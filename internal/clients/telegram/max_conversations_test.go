@@ -0,0 +1,156 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+func TestSaturatedClientRepliesBusy(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	responses := helpResponses()
+	responses.Root.Busy = "busy"
+
+	var (
+		mu      sync.Mutex
+		replies = make(map[string]string)
+		busy    = make(chan struct{}, 10)
+		// release unblocks the replies to /help, which stand in for slow GitHub requests
+		release = make(chan struct{})
+	)
+
+	client := telegram.NewTestClient(server, responses)
+	client.SetMaxConversations(2)
+	client.SetDryRun(func(_ string, body []byte) {
+		var message struct {
+			ChatID string `json:"chat_id"`
+			Text   string `json:"text"`
+		}
+
+		_ = json.Unmarshal(body, &message)
+
+		mu.Lock()
+		replies[message.ChatID] = message.Text
+		mu.Unlock()
+
+		if message.Text == "busy" {
+			busy <- struct{}{}
+
+			return
+		}
+
+		<-release
+	})
+
+	// 1 processor goroutine is stuck on the first update, the second waits in the queue. The others are over the limit.
+	fail := client.StartFetching(context.Background(), 1, func(ctx context.Context, updateCh chan<- update.Update) {
+		for id := 1; id <= 4; id++ {
+			var upd update.Update
+			if err := json.Unmarshal([]byte(privateMessageUpdate(id, id, "/help")), &upd); err != nil {
+				t.Errorf("While decoding an update: %s", err)
+
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case updateCh <- upd:
+			}
+		}
+
+		<-ctx.Done()
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-busy:
+		case err := <-fail:
+			t.Fatalf("Bot crashed: %s", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the busy replies")
+		}
+	}
+
+	close(release)
+	client.Stop()
+
+	expected := map[string]string{"1": "help", "2": "help", "3": "busy", "4": "busy"}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for chat, text := range expected {
+		if replies[chat] != text {
+			t.Errorf("Expected %q in chat %s, got %q (all replies: %v)", text, chat, replies[chat], replies)
+		}
+	}
+}
+
+func TestSlowBusyRepliesDontStopTheQueue(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	responses := helpResponses()
+	responses.Root.Busy = "busy"
+
+	// release unblocks all replies: the reply to /help keeps the bot saturated, the busy replies are slow to send
+	release := make(chan struct{})
+
+	client := telegram.NewTestClient(server, responses)
+	client.SetMaxConversations(1)
+	client.SetDryRun(func(string, []byte) { <-release })
+
+	const updates = 100
+
+	fed := make(chan struct{})
+
+	fail := client.StartFetching(context.Background(), 1, func(ctx context.Context, updateCh chan<- update.Update) {
+		for id := 1; id <= updates; id++ {
+			var upd update.Update
+			if err := json.Unmarshal([]byte(privateMessageUpdate(id, id, "/help")), &upd); err != nil {
+				t.Errorf("While decoding an update: %s", err)
+
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case updateCh <- upd:
+			}
+		}
+
+		close(fed)
+		<-ctx.Done()
+	})
+
+	select {
+	case <-fed:
+	case err := <-fail:
+		t.Fatalf("Bot crashed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("The updates stopped being taken from the queue while a busy reply was being sent")
+	}
+
+	close(release)
+	client.Stop()
+}
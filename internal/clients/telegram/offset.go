@@ -0,0 +1,55 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+/*
+SetStartOffset makes the client ask Telegram for updates starting from `offset` instead of the first one that wasn't
+processed yet.
+
+Telegram deletes the updates before `offset` as soon as they are requested, they are never processed and can't be
+recovered. Only use this to skip an update that crashes the bot every time it's processed.
+*/
+func (c *Client) SetStartOffset(offset update.UpdateID) {
+	c.startOffset = option.Some(offset)
+}
+
+/*
+SkipBacklog makes the client ignore all updates that were sent before it started. Like with SetStartOffset, Telegram
+deletes them and they are lost for good.
+*/
+func (c *Client) SkipBacklog() {
+	c.skipBacklog = true
+}
+
+/*
+firstOffset is the offset of the first /getUpdates. Without SetStartOffset or SkipBacklog it's 0, which means the first
+update that Telegram still has.
+*/
+func (c *Client) firstOffset(ctx context.Context) (update.UpdateID, error) {
+	if !c.skipBacklog {
+		return c.startOffset.UnwrapOr(0), nil
+	}
+
+	// A negative offset returns the last updates without deleting the older ones
+	latest, err := getUpdatesRequest{Offset: -1, Limit: 1, Timeout: 0}.Request(ctx, c.requester)
+	if err != nil {
+		return 0, fmt.Errorf("while looking for the latest update to skip the backlog: %w", err)
+	}
+
+	if len(latest) == 0 {
+		logging.Infof("There is no backlog to skip")
+
+		return 0, nil
+	}
+
+	logging.Infof("Skipping all updates up to and including %s", latest[0].ID.Log())
+
+	return latest[0].ID + 1, nil
+}
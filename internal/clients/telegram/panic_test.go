@@ -0,0 +1,123 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util"
+)
+
+// panickingState is a conversation whose handler panics on every update.
+type panickingState struct{}
+
+func (panickingState) Handler(state.UserSharedData, *state.Responses, *state.Deps) state.Handler {
+	panic("the handler has panicked")
+}
+
+// panickingStore is a state.Store where every conversation is a panickingState.
+type panickingStore struct{}
+
+func (panickingStore) LoadUserData(update.UserID) (state.UserSharedData, bool, error) {
+	return state.NewUserSharedData(), false, nil
+}
+
+func (panickingStore) SaveUserData(update.UserID, state.UserSharedData) error {
+	return nil
+}
+
+func (panickingStore) LoadState(string) (state.State, bool, error) {
+	return panickingState{}, true, nil
+}
+
+func (panickingStore) SaveState(string, state.State) error {
+	return nil
+}
+
+func (panickingStore) DeleteStates(update.UserID) error {
+	return nil
+}
+
+func TestPanicReturnsBorrowedValues(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Nothing should be sent to Telegram, got %s", r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStore(panickingStore{})
+
+	var upd update.Update
+	if err := json.Unmarshal([]byte(privateMessageUpdate(1, 7, "/help")), &upd); err != nil {
+		t.Fatalf("While decoding the update: %s", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("The panic of the handler was swallowed")
+			}
+		}()
+
+		client.ProcessUpdate(context.Background(), upd)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	stateID, _ := upd.StateID()
+	if conversation, ok := client.BorrowState(stateID).WaitContext(ctx); !ok {
+		t.Fatal("The state was not returned after the panic, the next update of the chat would wait forever")
+	} else if _, isOriginal := conversation.(panickingState); !isOriginal {
+		t.Fatalf("Expected the original state to be returned, got %T", conversation)
+	}
+
+	if _, ok := client.BorrowUserData(7).WaitContext(ctx); !ok {
+		t.Fatal("The user data was not returned after the panic, the next update of the user would wait forever")
+	}
+}
+
+func TestWebhookInlinePanicStopsTheBot(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeTelegram{expected: -1, allSent: make(chan struct{})}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStore(panickingStore{})
+	client.SetInlineProcessing(true)
+
+	webhookURL, secret, fail := startWebhook(t, &client, fake)
+
+	if status := postToWebhook(t, webhookURL, secret, privateMessageUpdate(1, 7, "/help")); status != http.StatusOK {
+		t.Errorf("The update that panicked was answered with %d", status)
+	}
+
+	select {
+	case err := <-fail:
+		var recovered util.RecoveredPanicError
+		if !errors.As(err, &recovered) {
+			t.Errorf("Expected the bot to fail with the panic, got %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The panic was swallowed by the webhook server and the bot kept running")
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if !fake.webhookDeleted {
+		t.Errorf("The webhook was not deleted after the bot failed")
+	}
+}
@@ -0,0 +1,55 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+func TestReportsArePrunedWithoutUpdates(t *testing.T) {
+	t.Parallel()
+
+	const maxAge = 200 * time.Millisecond
+
+	server := httptest.NewServer(&fakeTelegram{expected: -1, allSent: make(chan struct{})})
+	t.Cleanup(server.Close)
+
+	store := newMemoryStore()
+	userData := state.NewUserSharedData()
+	userData.Reports = state.ReportHistory{{Text: "report", CreatedAt: time.Now()}}
+	store.userData[7] = userData
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStore(store)
+	client.SetReportRetention(state.ReportRetention{Keep: 0, MaxAge: maxAge})
+	client.SetDryRun(func(string, []byte) {})
+
+	// The update loads the user data into memory while the report is still new enough to be kept
+	var upd update.Update
+	if err := json.Unmarshal([]byte(privateMessageUpdate(1, 7, "/help")), &upd); err != nil {
+		t.Fatalf("While decoding the update: %s", err)
+	}
+
+	client.ProcessUpdate(context.Background(), upd)
+
+	if saved, _, _ := store.LoadUserData(7); len(saved.Reports) != 1 {
+		t.Fatalf("The report was pruned before it got too old: %+v", saved.Reports)
+	}
+
+	time.Sleep(2 * maxAge)
+	client.PruneReports(context.Background())
+
+	if saved, _, _ := store.LoadUserData(7); len(saved.Reports) != 0 {
+		t.Errorf("Expected the old report to be deleted from the store, got %+v", saved.Reports)
+	}
+
+	if inMemory := client.BorrowUserData(7).Wait(); len(inMemory.Reports) != 0 {
+		t.Errorf("Expected the old report to be deleted from memory, got %+v", inMemory.Reports)
+	}
+}
@@ -0,0 +1,114 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// redactedText replaces the text of messages with secrets in recorded updates
+const redactedText = "[REDACTED]"
+
+// recordedAction is an action of a replay record, the same request that the bot has sent to Telegram.
+type recordedAction struct {
+	Endpoint string          `json:"endpoint"`
+	Body     json.RawMessage `json:"body"`
+}
+
+/*
+SetRecordFile makes the client append every processed update and the actions it has caused to a file. The file can be
+used with SetReplayFile. Messages with secrets (e.g. API keys) are redacted before they are written.
+
+The file is opened in Start(), if it can't be opened the client fails.
+*/
+func (c *Client) SetRecordFile(path string) {
+	c.recordFile = path
+}
+
+// recorder appends replay records to a file. Safe for concurrent use.
+type recorder struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	// botUsername is stripped from messages before looking for secrets, the same way handlers see them
+	botUsername string
+}
+
+// newRecorder opens `path` for appending, creating it if needed.
+func newRecorder(path, botUsername string) (*recorder, error) {
+	const ownerReadWrite = 0o600 // Recorded messages are private
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, ownerReadWrite)
+	if err != nil {
+		return nil, fmt.Errorf("while opening the record file: %w", err)
+	}
+
+	return &recorder{mu: sync.Mutex{}, file: file, encoder: json.NewEncoder(file), botUsername: botUsername}, nil
+}
+
+// Record writes the update and its actions as one line. `conversation` is the state the update was handled in.
+func (r *recorder) Record(upd update.Update, conversation state.State, actions []response.BotAction) {
+	record := replayRecord{Update: r.redact(upd, conversation), Actions: []recordedAction{}}
+
+	for _, action := range response.Flatten(actions) {
+		endpoint, body, err := action.JSONEncode()
+		if err != nil {
+			logging.Errorf("%s While encoding an action to record it: %s", upd.ID.Log(), err)
+
+			continue
+		}
+
+		record.Actions = append(record.Actions, recordedAction{Endpoint: endpoint, Body: body})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.encoder.Encode(record); err != nil {
+		logging.Errorf("%s While recording: %s", upd.ID.Log(), err)
+	}
+}
+
+// Close closes the file.
+func (r *recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("while closing the record file: %w", err)
+	}
+
+	return nil
+}
+
+// redact returns a copy of the update without the text of a message that has a secret.
+func (r *recorder) redact(upd update.Update, conversation state.State) update.Update {
+	message, isSome := upd.Message.Unwrap()
+	if !isSome {
+		return upd
+	}
+
+	text, isSome := message.Text.Unwrap()
+	if !isSome {
+		return upd
+	}
+
+	if r.botUsername != "" {
+		text = strings.TrimSpace(strings.TrimPrefix(text, "@"+r.botUsername))
+	}
+
+	if state.HasSecret(conversation, text) {
+		message.Text = option.Some(redactedText)
+		upd.Message = option.Some(message)
+	}
+
+	return upd
+}
@@ -0,0 +1,94 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+)
+
+/*
+replayRecord is one entry of a replay file. A replay file is a sequence of JSON objects (usually one per line):
+
+	{"update": {"update_id": 1, "message": {...}}}
+	{"update": {"update_id": 2, "callback_query": {...}}, "actions": [{"endpoint": "sendMessage", "body": {...}}]}
+
+Actions are written by the recorder (see SetRecordFile) and are ignored by the replay.
+*/
+type replayRecord struct {
+	Update  update.Update    `json:"update"`
+	Actions []recordedAction `json:"actions,omitempty"`
+}
+
+/*
+SetReplayFile makes the client process the updates from a file instead of asking Telegram for them. Every update is
+processed once, then the client waits for Stop(). The actions are logged instead of being performed, so a replay never
+sends anything to Telegram.
+
+This is for debugging only. It reproduces a sequence of updates that has caused a bug.
+*/
+func (c *Client) SetReplayFile(path string) {
+	c.replayFile = path
+	c.dryRun = logDryRun
+}
+
+// logDryRun logs an action that would have been performed.
+func logDryRun(endpoint string, body []byte) {
+	logging.Infof("Dry run: /%s %s", endpoint, body)
+}
+
+// replay feeds the updates from the replay file into the pipeline and blocks until the context is done.
+func (c *Client) replay(ctx context.Context, updateCh chan<- update.Update) error {
+	updates, err := readReplayFile(c.replayFile)
+	if err != nil {
+		return err
+	}
+
+	logging.Infof("Replaying %d updates from %s", len(updates), c.replayFile)
+
+	c.feed(ctx, updates, updateCh)
+
+	logging.Infof("All updates from %s were fed, waiting for shutdown", c.replayFile)
+	<-ctx.Done()
+
+	return nil
+}
+
+// readReplayFile reads all updates from a replay file in order.
+func readReplayFile(path string) ([]update.Update, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return []update.Update{}, fmt.Errorf("while opening the replay file: %w", err)
+	}
+	defer file.Close()
+
+	return readReplay(file)
+}
+
+// readReplay reads replay records until EOF and returns their updates.
+func readReplay(reader io.Reader) ([]update.Update, error) {
+	var (
+		decoder = json.NewDecoder(reader)
+		updates = []update.Update{}
+	)
+
+	for {
+		var record replayRecord
+
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return updates, nil
+		}
+
+		if err != nil {
+			return []update.Update{}, fmt.Errorf("while decoding replay record #%d: %w", len(updates)+1, err)
+		}
+
+		updates = append(updates, record.Update)
+	}
+}
@@ -0,0 +1,154 @@
+package telegram_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+)
+
+type dryRunAction struct {
+	endpoint string
+	body     []byte
+}
+
+func TestReplayFile(t *testing.T) {
+	t.Parallel()
+
+	replayFile := filepath.Join(t.TempDir(), "replay.jsonl")
+	records := `{"update": ` + privateMessageUpdate(1, 1, "/help") + "}\n" +
+		`{"update": ` + privateMessageUpdate(2, 2, "/help") + "}\n"
+
+	if err := os.WriteFile(replayFile, []byte(records), 0o600); err != nil {
+		t.Fatalf("While writing the replay file: %s", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Replay has sent a request to Telegram: %s", r.URL.Path)
+		http.Error(w, "unexpected request", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	actions := make(chan dryRunAction, 10)
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetInlineProcessing(true) // Keeps the order of actions
+	client.SetReplayFile(replayFile)
+	client.SetDryRun(func(endpoint string, body []byte) {
+		actions <- dryRunAction{endpoint: endpoint, body: body}
+	})
+
+	fail := client.Start(1)
+	defer client.Stop()
+
+	for _, expectedChat := range []string{"1", "2"} {
+		select {
+		case action := <-actions:
+			var message struct {
+				ChatID string `json:"chat_id"`
+				Text   string `json:"text"`
+			}
+
+			if err := json.Unmarshal(action.body, &message); err != nil {
+				t.Fatalf("While decoding /%s: %s", action.endpoint, err)
+			}
+
+			if action.endpoint != "sendMessage" || message.ChatID != expectedChat || message.Text != "help" {
+				t.Fatalf("Expected /help reply to (ChatID %s), got /%s %s", expectedChat, action.endpoint, action.body)
+			}
+		case err := <-fail:
+			t.Fatalf("Bot crashed: %s", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the replayed actions")
+		}
+	}
+}
+
+func groupMessageUpdate(updateID, userID, chatID int, text string) string {
+	return fmt.Sprintf(`{"update_id":%d,"message":{"message_id":%d,"date":0,"text":%q,
+"from":{"id":%d,"is_bot":false,"first_name":"User"},"chat":{"id":%d,"type":"group"}}}`,
+		updateID, updateID, text, userID, chatID)
+}
+
+func TestRecordedUpdatesCanBeReplayed(t *testing.T) {
+	t.Parallel()
+
+	var (
+		dir        = t.TempDir()
+		replayFile = filepath.Join(dir, "replay.jsonl")
+		recordFile = filepath.Join(dir, "record.jsonl")
+	)
+
+	records := `{"update": ` + privateMessageUpdate(1, 1, "/help") + "}\n" +
+		`{"update": ` + groupMessageUpdate(2, 1, -5, "/addApiKey ghp_secret") + "}\n"
+
+	if err := os.WriteFile(replayFile, []byte(records), 0o600); err != nil {
+		t.Fatalf("While writing the replay file: %s", err)
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	var responses state.Responses
+	responses.Root.Help = "help"
+	responses.Root.APIKeySentInPublicChat = "key leaked"
+
+	actions := make(chan dryRunAction, 10)
+
+	client := telegram.NewTestClient(server, responses)
+	client.SetInlineProcessing(true)
+	client.SetReplayFile(replayFile)
+	client.SetRecordFile(recordFile)
+	client.SetDryRun(func(endpoint string, body []byte) {
+		actions <- dryRunAction{endpoint: endpoint, body: body}
+	})
+
+	fail := client.Start(1)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-actions:
+		case err := <-fail:
+			t.Fatalf("Bot crashed: %s", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the replayed actions")
+		}
+	}
+
+	client.Stop()
+
+	recorded, err := os.ReadFile(recordFile)
+	if err != nil {
+		t.Fatalf("While reading the record file: %s", err)
+	}
+
+	if strings.Contains(string(recorded), "ghp_secret") {
+		t.Fatalf("The API key was recorded:\n%s", recorded)
+	}
+
+	if !strings.Contains(string(recorded), `"endpoint":"sendMessage"`) {
+		t.Errorf("Actions were not recorded:\n%s", recorded)
+	}
+
+	updates, err := telegram.ReadReplayFile(recordFile)
+	if err != nil {
+		t.Fatalf("While reading the recorded updates: %s", err)
+	}
+
+	if len(updates) != 2 || updates[0].ID != 1 || updates[1].ID != 2 {
+		t.Fatalf("Expected updates 1 and 2, got %#v", updates)
+	}
+
+	message, _ := updates[1].Message.Unwrap()
+	if text := message.Text.UnwrapOr(""); text != "[REDACTED]" {
+		t.Errorf("Expected the message with the API key to be redacted, got %q", text)
+	}
+}
@@ -0,0 +1,60 @@
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+/*
+Batch is an action made of several actions that are sent in order as one unit: if one of them fails, the rest are not
+sent, so the chat never sees the later parts without the earlier ones. Use Expand to get the actions, a Batch can't be
+encoded to JSON by itself.
+*/
+type Batch interface {
+	BotAction
+	Expand() []BotAction
+}
+
+// SendMessages sends the messages one after another as a Batch, e.g. the parts of a report that is too long.
+type SendMessages []SendMessage
+
+// Expand returns the messages as separate actions in the same order.
+func (m SendMessages) Expand() []BotAction {
+	actions := make([]BotAction, len(m))
+	for i, message := range m {
+		actions[i] = message
+	}
+
+	return actions
+}
+
+// JSONEncode always returns BatchNotExpandedError, each message is sent separately.
+func (m SendMessages) JSONEncode() (string, json.RawMessage, error) {
+	return "", nil, BatchNotExpandedError{Batch: fmt.Sprintf("%T", m)}
+}
+
+// Flatten replaces every Batch in `actions` with the actions it expands to.
+func Flatten(actions []BotAction) []BotAction {
+	flat := make([]BotAction, 0, len(actions))
+
+	for _, action := range actions {
+		if batch, isBatch := action.(Batch); isBatch {
+			flat = append(flat, Flatten(batch.Expand())...)
+
+			continue
+		}
+
+		flat = append(flat, action)
+	}
+
+	return flat
+}
+
+// BatchNotExpandedError is returned when a Batch is encoded to JSON instead of being expanded.
+type BatchNotExpandedError struct {
+	Batch string
+}
+
+func (e BatchNotExpandedError) Error() string {
+	return fmt.Sprintf("%s is a batch of actions, it has to be expanded before encoding", e.Batch)
+}
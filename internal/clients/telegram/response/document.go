@@ -0,0 +1,65 @@
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// MaxMessageLength is the longest text of a message that Telegram accepts, see MessageLength.
+const MaxMessageLength = 4096
+
+// InputFile is a file that is uploaded with an action.
+type InputFile struct {
+	// Field is the parameter of the API method the file is sent as, e.g. "document"
+	Field string
+	// Name is the file name shown to users
+	Name string
+	Data []byte
+}
+
+/*
+ActionWithFiles is a BotAction that uploads files. It's sent as multipart/form-data with APIRequester.DoMultipart. The
+JSON body has every other parameter, so it's still used for logs and ChatIDOf.
+*/
+type ActionWithFiles interface {
+	BotAction
+	Files() []InputFile
+}
+
+// SendDocument sends a file, e.g. a report that is too long for a message.
+type SendDocument struct {
+	ChatID ChatID `json:"chat_id"`
+	// Document is the file name in JSON. The contents are only sent by Files()
+	Document  InputFile             `json:"-"`
+	Caption   option.Option[string] `json:"caption,omitempty"`
+	ParseMode option.Option[string] `json:"parse_mode,omitempty"`
+}
+
+// NewSendDocument creates a SendDocument with `data` as a file called `name`. See SetDefaultParseMode for the caption.
+func NewSendDocument(chatID update.ChatID, name string, data []byte, caption string) SendDocument {
+	return SendDocument{
+		ChatID:    NewChatID(chatID),
+		Document:  InputFile{Field: "document", Name: name, Data: data},
+		Caption:   option.Some(caption),
+		ParseMode: defaultParseModeOption(),
+	}
+}
+
+func (d SendDocument) JSONEncode() (string, json.RawMessage, error) {
+	body, err := json.Marshal(struct {
+		SendDocument
+		Document string `json:"document"`
+	}{SendDocument: d, Document: d.Document.Name})
+	if err != nil {
+		err = fmt.Errorf("while JSON encoding SendDocument: %w", err)
+	}
+
+	return "sendDocument", body, err
+}
+
+func (d SendDocument) Files() []InputFile {
+	return []InputFile{d.Document}
+}
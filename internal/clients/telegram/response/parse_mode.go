@@ -0,0 +1,141 @@
+package response
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// ParseMode is how Telegram reads the formatting of a message.
+// See https://core.telegram.org/bots/api#formatting-options
+type ParseMode string
+
+const (
+	ParseModeHTML       ParseMode = "html"
+	ParseModeMarkdownV2 ParseMode = "MarkdownV2"
+)
+
+// defaultParseMode is the ParseMode of NewSendMessage and NewSendDocument. See SetDefaultParseMode.
+var defaultParseMode atomic.Value //nolint:gochecknoglobals // Set once from the config, like a constant
+
+/*
+SetDefaultParseMode sets the parse mode of the messages and captions created by this package. The default is HTML. The
+texts from the template must be written for the same parse mode.
+*/
+func SetDefaultParseMode(mode ParseMode) {
+	defaultParseMode.Store(mode)
+}
+
+// DefaultParseMode returns the parse mode set by SetDefaultParseMode, or HTML.
+func DefaultParseMode() ParseMode {
+	if mode, isSet := defaultParseMode.Load().(ParseMode); isSet {
+		return mode
+	}
+
+	return ParseModeHTML
+}
+
+// ParseParseMode reads a parse mode from the config: "html" or "markdownv2", in any case.
+func ParseParseMode(mode string) (ParseMode, bool) {
+	switch strings.ToLower(mode) {
+	case strings.ToLower(string(ParseModeHTML)):
+		return ParseModeHTML, true
+	case strings.ToLower(string(ParseModeMarkdownV2)):
+		return ParseModeMarkdownV2, true
+	}
+
+	return "", false
+}
+
+// defaultParseModeOption is DefaultParseMode for the parse_mode field of an action.
+func defaultParseModeOption() option.Option[string] {
+	return option.Some(string(DefaultParseMode()))
+}
+
+// htmlEscaper replaces the characters that Telegram's HTML needs escaped with the entities it supports.
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;") //nolint:gochecknoglobals
+
+/*
+EscapeHTML escapes `text` (e.g. a GitHub title) so that it is shown as it is in an HTML message, and can be used in an
+attribute like href. Tags of the bot around it are left alone.
+*/
+func EscapeHTML(text string) string {
+	return htmlEscaper.Replace(text)
+}
+
+// markdownV2Reserved are the characters that must be escaped with a backslash everywhere in MarkdownV2 text.
+const markdownV2Reserved = "_*[]()~`>#+-=|{}.!\\"
+
+/*
+EscapeMarkdownV2 escapes every character that has a meaning in MarkdownV2, so that `text` (e.g. a GitHub title) is
+shown as it is.
+*/
+func EscapeMarkdownV2(text string) string {
+	var escaped strings.Builder
+
+	for _, char := range text {
+		if strings.ContainsRune(markdownV2Reserved, char) {
+			escaped.WriteByte('\\')
+		}
+
+		escaped.WriteRune(char)
+	}
+
+	return escaped.String()
+}
+
+// EscapeMarkdownV2URL escapes a URL for the (...) part of a MarkdownV2 link, where only ")" and "\" are escaped.
+func EscapeMarkdownV2URL(url string) string {
+	return strings.NewReplacer(`\`, `\\`, `)`, `\)`).Replace(url)
+}
+
+/*
+The functions below format plain text (e.g. a project ID or a GitHub title) in the DefaultParseMode. The text is escaped
+by them, so it is shown as it is. They can't be nested, because the inner markup would be escaped by the outer one.
+*/
+
+// escape escapes `text` for the DefaultParseMode.
+func escape(text string) string {
+	if DefaultParseMode() == ParseModeMarkdownV2 {
+		return EscapeMarkdownV2(text)
+	}
+
+	return EscapeHTML(text)
+}
+
+// Code shows `text` in a monospace font that is copied with a tap, e.g. for IDs.
+func Code(text string) string {
+	if DefaultParseMode() == ParseModeMarkdownV2 {
+		return "`" + escape(text) + "`"
+	}
+
+	return "<code>" + escape(text) + "</code>"
+}
+
+// Bold makes `text` bold, e.g. for names.
+func Bold(text string) string {
+	if DefaultParseMode() == ParseModeMarkdownV2 {
+		return "*" + escape(text) + "*"
+	}
+
+	return "<b>" + escape(text) + "</b>"
+}
+
+// Link links `text` to `url`.
+func Link(text, url string) string {
+	if DefaultParseMode() == ParseModeMarkdownV2 {
+		return "[" + escape(text) + "](" + EscapeMarkdownV2URL(url) + ")"
+	}
+
+	return `<a href="` + EscapeHTML(url) + `">` + escape(text) + "</a>"
+}
+
+// Spoiler hides `text` until it's tapped.
+func Spoiler(text string) string {
+	if DefaultParseMode() == ParseModeMarkdownV2 {
+		return "||" + escape(text) + "||"
+	}
+
+	return "<tg-spoiler>" + escape(text) + "</tg-spoiler>"
+}
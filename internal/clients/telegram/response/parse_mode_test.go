@@ -0,0 +1,108 @@
+package response_test
+
+import (
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+)
+
+func TestEscapeMarkdownV2EveryReservedCharacter(t *testing.T) {
+	t.Parallel()
+
+	for _, char := range "_*[]()~`>#+-=|{}.!\\" {
+		if escaped := response.EscapeMarkdownV2(string(char)); escaped != `\`+string(char) {
+			t.Errorf("Expected %q to be escaped as %q, got %q", char, `\`+string(char), escaped)
+		}
+	}
+
+	if escaped := response.EscapeMarkdownV2("fix_parser: a*b [v1.2]"); escaped != `fix\_parser: a\*b \[v1\.2\]` {
+		t.Errorf("Wrong escaping of a title: %q", escaped)
+	}
+
+	if escaped := response.EscapeMarkdownV2("Ünïcode & <i 🔗"); escaped != "Ünïcode & <i 🔗" {
+		t.Errorf("Only reserved characters should be escaped, got %q", escaped)
+	}
+}
+
+func TestEscapeMarkdownV2URL(t *testing.T) {
+	t.Parallel()
+
+	if escaped := response.EscapeMarkdownV2URL(`https://example.com/a_(b)\c`); escaped != `https://example.com/a_(b\)\\c` {
+		t.Errorf("Only ) and \\ should be escaped in a URL, got %q", escaped)
+	}
+}
+
+func TestParseParseMode(t *testing.T) {
+	t.Parallel()
+
+	for text, expected := range map[string]response.ParseMode{
+		"html": response.ParseModeHTML, "HTML": response.ParseModeHTML,
+		"markdownv2": response.ParseModeMarkdownV2, "MarkdownV2": response.ParseModeMarkdownV2,
+	} {
+		if mode, isValid := response.ParseParseMode(text); !isValid || mode != expected {
+			t.Errorf("Expected %q to be %q, got %q %v", text, expected, mode, isValid)
+		}
+	}
+
+	if _, isValid := response.ParseParseMode("markdown"); isValid {
+		t.Error("The legacy Markdown mode is not supported")
+	}
+}
+
+// Not parallel: the parse mode is set for the whole package, the parallel tests only run after it's changed back.
+func TestDefaultParseMode(t *testing.T) {
+	response.SetDefaultParseMode(response.ParseModeMarkdownV2)
+	t.Cleanup(func() { response.SetDefaultParseMode(response.ParseModeHTML) })
+
+	assertEncodes(t, response.NewSendMessage(42, "*hi*"), "sendMessage",
+		`{"chat_id":"42","text":"*hi*","parse_mode":"MarkdownV2","disable_web_page_preview":true}`)
+	assertEncodes(t, response.NewSendDocument(42, "daily-report.md", []byte("*report*"), "caption"), "sendDocument",
+		`{"chat_id":"42","caption":"caption","parse_mode":"MarkdownV2","document":"daily-report.md"}`)
+}
+
+func TestEscapeHTML(t *testing.T) {
+	t.Parallel()
+
+	const expected = `A &lt; B &amp; &lt;script&gt;&quot;x&quot;&lt;/script&gt;`
+
+	if escaped := response.EscapeHTML(`A < B & <script>"x"</script>`); escaped != expected {
+		t.Errorf("Wrong escaping of a title: %q", escaped)
+	}
+}
+
+func TestFormatHelpersEscapeHTML(t *testing.T) {
+	t.Parallel()
+
+	const text = `a < b & "c"`
+
+	for name, test := range map[string]struct{ formatted, expected string }{
+		"Code":    {response.Code(text), `<code>a &lt; b &amp; &quot;c&quot;</code>`},
+		"Bold":    {response.Bold(text), `<b>a &lt; b &amp; &quot;c&quot;</b>`},
+		"Spoiler": {response.Spoiler(text), `<tg-spoiler>a &lt; b &amp; &quot;c&quot;</tg-spoiler>`},
+		"Link": {
+			response.Link(text, `https://example.com/?a=1&b="2"`),
+			`<a href="https://example.com/?a=1&amp;b=&quot;2&quot;">a &lt; b &amp; &quot;c&quot;</a>`,
+		},
+	} {
+		if test.formatted != test.expected {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, test.formatted)
+		}
+	}
+}
+
+// Not parallel: the parse mode is set for the whole package, the parallel tests only run after it's changed back.
+func TestFormatHelpersMarkdownV2(t *testing.T) {
+	response.SetDefaultParseMode(response.ParseModeMarkdownV2)
+	t.Cleanup(func() { response.SetDefaultParseMode(response.ParseModeHTML) })
+
+	for name, test := range map[string]struct{ formatted, expected string }{
+		"Code":    {response.Code("PVT_1.x"), "`PVT\\_1\\.x`"},
+		"Bold":    {response.Bold("a*b"), `*a\*b*`},
+		"Spoiler": {response.Spoiler("v1.2"), `||v1\.2||`},
+		"Link":    {response.Link("[x]", "https://example.com/(a)"), `[\[x\]](https://example.com/(a\))`},
+	} {
+		if test.formatted != test.expected {
+			t.Errorf("%s: expected %q, got %q", name, test.expected, test.formatted)
+		}
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 )
 
 type APIRequester struct {
@@ -16,6 +18,8 @@ type APIRequester struct {
 	Scheme   string
 	Host     string
 	BasePath string
+	// UserAgent is sent in the User-Agent header of all requests. Go's default is used if it's empty.
+	UserAgent string
 }
 
 func (r APIRequester) DoJSONEncoded(ctx context.Context, endpoint string, body json.RawMessage,
@@ -35,37 +39,7 @@ func (r APIRequester) DoJSONEncoded(ctx context.Context, endpoint string, body j
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := r.Client.Do(req)
-	if err != nil {
-		return json.RawMessage{}, fmt.Errorf("network error: %w", err)
-	}
-
-	body, err = io.ReadAll(resp.Body)
-	defer resp.Body.Close()
-
-	if err != nil {
-		return json.RawMessage{}, fmt.Errorf("could not read response body %w", err)
-	}
-
-	var data struct {
-		Ok bool `json:"ok"`
-		APIError
-		Result json.RawMessage `json:"result,omitempty"`
-	}
-
-	if err = json.Unmarshal(body, &data); err != nil {
-		return data.Result, fmt.Errorf("parsing json response error: %w", err)
-	}
-
-	if !data.Ok {
-		return json.RawMessage{}, APIError{
-			ErrorCode:   data.ErrorCode,
-			Description: data.Description,
-			Parameters:  data.Parameters,
-		}
-	}
-
-	return data.Result, nil
+	return r.do(req)
 }
 
 func (r APIRequester) DoURLEncoded(ctx context.Context, endpoint string, params url.Values) (json.RawMessage, error) {
@@ -83,6 +57,40 @@ func (r APIRequester) DoURLEncoded(ctx context.Context, endpoint string, params
 		return json.RawMessage{}, fmt.Errorf("while constructing URL encoded get request to /%s: %w", endpoint, err)
 	}
 
+	return r.do(req)
+}
+
+/*
+DoMultipart sends the fields of a JSON object `body` and the `files` as multipart/form-data. String fields are sent as
+they are and other values as JSON. A file replaces the field of the body with the same name.
+*/
+func (r APIRequester) DoMultipart(ctx context.Context, endpoint string, body json.RawMessage, files []InputFile,
+) (json.RawMessage, error) {
+	form, contentType, err := encodeMultipart(body, files)
+	if err != nil {
+		return json.RawMessage{}, fmt.Errorf("while encoding /%s as multipart/form-data: %w", endpoint, err)
+	}
+
+	url := url.URL{
+		Scheme: r.Scheme,
+		Host:   r.Host,
+		Path:   path.Join(r.BasePath, endpoint),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url.String(), form)
+	if err != nil {
+		return json.RawMessage{}, fmt.Errorf("while constructing multipart post request to /%s: %w", endpoint, err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	return r.do(req)
+}
+
+// do sends the request and returns the result from Telegram's response, or the APIError if the request failed.
+func (r APIRequester) do(req *http.Request) (json.RawMessage, error) {
+	r.setUserAgent(req)
+
 	resp, err := r.Client.Do(req)
 	if err != nil {
 		return json.RawMessage{}, fmt.Errorf("network error: %w", err)
@@ -112,8 +120,68 @@ func (r APIRequester) DoURLEncoded(ctx context.Context, endpoint string, params
 			ErrorCode:   data.ErrorCode,
 			Description: data.Description,
 			Parameters:  data.Parameters,
-		}
+		}.Classify()
 	}
 
 	return data.Result, nil
 }
+
+// encodeMultipart returns the form and its Content-Type with the boundary.
+func encodeMultipart(body json.RawMessage, files []InputFile) (*bytes.Buffer, string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, "", fmt.Errorf("the body is not a JSON object: %w", err)
+	}
+
+	for _, file := range files {
+		delete(fields, file.Field)
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	form := &bytes.Buffer{}
+	writer := multipart.NewWriter(form)
+
+	for _, name := range names {
+		value := string(fields[name])
+
+		var text string
+		if err := json.Unmarshal(fields[name], &text); err == nil {
+			value = text
+		} else if value == "null" {
+			continue
+		}
+
+		if err := writer.WriteField(name, value); err != nil {
+			return nil, "", fmt.Errorf("while writing field %s: %w", name, err)
+		}
+	}
+
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file.Field, file.Name)
+		if err != nil {
+			return nil, "", fmt.Errorf("while writing file %s: %w", file.Name, err)
+		}
+
+		if _, err = part.Write(file.Data); err != nil {
+			return nil, "", fmt.Errorf("while writing file %s: %w", file.Name, err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("while finishing the form: %w", err)
+	}
+
+	return form, writer.FormDataContentType(), nil
+}
+
+func (r APIRequester) setUserAgent(req *http.Request) {
+	if r.UserAgent != "" {
+		req.Header.Set("User-Agent", r.UserAgent)
+	}
+}
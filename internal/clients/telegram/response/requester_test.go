@@ -0,0 +1,108 @@
+package response_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+)
+
+func TestRequesterSendsUserAgent(t *testing.T) {
+	t.Parallel()
+
+	userAgents := make(chan string, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.Header.Get("User-Agent")
+
+		fmt.Fprint(w, `{"ok": true, "result": true}`)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("While parsing the server URL: %s", err)
+	}
+
+	requester := response.APIRequester{
+		Client:    http.Client{},
+		Scheme:    serverURL.Scheme,
+		Host:      serverURL.Host,
+		BasePath:  "bottoken",
+		UserAgent: "daily-reporter/test",
+	}
+
+	if _, err = requester.DoJSONEncoded(context.Background(), "getMe", json.RawMessage(`{}`)); err != nil {
+		t.Fatalf("DoJSONEncoded failed: %s", err)
+	}
+
+	if _, err = requester.DoURLEncoded(context.Background(), "getMe", url.Values{}); err != nil {
+		t.Fatalf("DoURLEncoded failed: %s", err)
+	}
+
+	for _, method := range []string{"DoJSONEncoded", "DoURLEncoded"} {
+		if userAgent := <-userAgents; userAgent != "daily-reporter/test" {
+			t.Errorf("%s sent User-Agent %q", method, userAgent)
+		}
+	}
+}
+
+func TestDoMultipart(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("While parsing the form: %s", err)
+		}
+
+		for field, expected := range map[string]string{"chat_id": "42", "caption": "<b>hi</b>", "disable": "true"} {
+			if value := r.FormValue(field); value != expected {
+				t.Errorf("Field %s is %q, expected %q", field, value, expected)
+			}
+		}
+
+		if _, isSent := r.MultipartForm.Value["document"]; isSent {
+			t.Errorf("The document was sent as a field too: %v", r.MultipartForm.Value["document"])
+		}
+
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			t.Fatalf("The document was not sent: %s", err)
+		}
+		defer file.Close()
+
+		data, _ := io.ReadAll(file)
+		if header.Filename != "report.html" || string(data) != "contents" {
+			t.Errorf("Got file %s with %q", header.Filename, data)
+		}
+
+		fmt.Fprint(w, `{"ok": true, "result": true}`)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("While parsing the server URL: %s", err)
+	}
+
+	requester := response.APIRequester{
+		Client:    http.Client{},
+		Scheme:    serverURL.Scheme,
+		Host:      serverURL.Host,
+		BasePath:  "bottoken",
+		UserAgent: "",
+	}
+
+	body := json.RawMessage(`{"chat_id":"42","caption":"<b>hi</b>","disable":true,"document":"report.html","x":null}`)
+	files := []response.InputFile{{Field: "document", Name: "report.html", Data: []byte("contents")}}
+
+	if _, err = requester.DoMultipart(context.Background(), "sendDocument", body, files); err != nil {
+		t.Fatalf("DoMultipart failed: %s", err)
+	}
+}
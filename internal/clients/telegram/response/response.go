@@ -3,6 +3,9 @@ package response
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
 	"github.com/m-kuzmin/daily-reporter/internal/util/option"
@@ -24,12 +27,12 @@ type SendMessage struct {
 	ReplyMarkup           ReplyMarkupper        `json:"reply_markup,omitempty"`
 }
 
-// NewSendMessage creates SendMessage and sets the default parse mode to "html" and disables web previews.
+// NewSendMessage creates SendMessage with the parse mode from SetDefaultParseMode and disables web previews.
 func NewSendMessage(chatID update.ChatID, text string) SendMessage {
 	return SendMessage{
-		ChatID:                ChatID(fmt.Sprint(chatID)),
+		ChatID:                NewChatID(chatID),
 		Text:                  text,
-		ParseMode:             option.Some("html"),
+		ParseMode:             defaultParseModeOption(),
 		DisableWebpagePreview: true,
 		ReplyMarkup:           nil,
 	}
@@ -44,8 +47,46 @@ func (m SendMessage) JSONEncode() (string, json.RawMessage, error) {
 	return "sendMessage", body, err
 }
 
+// ChatID is the chat_id of an action. Telegram accepts it as a number or a string, it's always sent as a string.
 type ChatID string
 
+/*
+NewChatID converts the ID of a chat in an update to the chat_id of an action. Actions must use it instead of converting
+the ID themselves.
+*/
+func NewChatID(id update.ChatID) ChatID {
+	return ChatID(strconv.FormatInt(int64(id), 10))
+}
+
+// ChatActionTyping shows "typing..." in the chat.
+const ChatActionTyping = "typing"
+
+/*
+SendChatAction shows the user that the bot is doing something, e.g. typing. The status goes away after 5 seconds or
+when the bot sends a message.
+*/
+type SendChatAction struct {
+	ChatID ChatID `json:"chat_id"`
+	Action string `json:"action"`
+}
+
+// Typing shows "typing..." in the chat.
+func Typing(chatID update.ChatID) SendChatAction {
+	return SendChatAction{
+		ChatID: NewChatID(chatID),
+		Action: ChatActionTyping,
+	}
+}
+
+func (a SendChatAction) JSONEncode() (string, json.RawMessage, error) {
+	body, err := json.Marshal(a)
+	if err != nil {
+		err = fmt.Errorf("while JSON encoding SendChatAction: %w", err)
+	}
+
+	return "sendChatAction", body, err
+}
+
 // SetParseMode allows you to set the `ParseMode` and return `self` which allows for method chaining.
 func (m SendMessage) SetParseMode(mode option.Option[string]) SendMessage {
 	m.ParseMode = mode
@@ -99,6 +140,8 @@ type InlineKeyboardButton struct {
 	SwitchInlineQueryCurrentChat option.Option[string] `json:"switch_inline_query_current_chat"`
 	// When pressed sends a CallbackQuery that is handled in state.CallbackQuery
 	CallbackData option.Option[string] `json:"callback_data"`
+	// Opens a link when pressed, including t.me links to chats
+	URL option.Option[string] `json:"url"`
 }
 
 func InlineButtonSwitchQueryCurrentChat(text, query string) InlineKeyboardButton {
@@ -108,6 +151,22 @@ func InlineButtonSwitchQueryCurrentChat(text, query string) InlineKeyboardButton
 	}
 }
 
+// InlineButtonCallback creates a button that sends a CallbackQuery with `data` when pressed.
+func InlineButtonCallback(text, data string) InlineKeyboardButton {
+	return InlineKeyboardButton{
+		Text:         text,
+		CallbackData: option.Some(data),
+	}
+}
+
+// InlineButtonURL creates a button that opens `url` when pressed.
+func InlineButtonURL(text, url string) InlineKeyboardButton {
+	return InlineKeyboardButton{
+		Text: text,
+		URL:  option.Some(url),
+	}
+}
+
 // APIError from the telegram API.
 type APIError struct {
 	ErrorCode   int                `json:"error_code,omitempty"`
@@ -124,6 +183,74 @@ func (e APIError) Error() string {
 	return fmt.Sprintf("telegram API error: %d: %q", e.ErrorCode, e.Description)
 }
 
+// IsRemovedFromChat is true if the bot can't send anything to the chat because it was kicked or is not a member.
+func (e APIError) IsRemovedFromChat() bool {
+	if e.ErrorCode != http.StatusForbidden {
+		return false
+	}
+
+	description := strings.ToLower(e.Description)
+
+	return strings.Contains(description, "bot was kicked") || strings.Contains(description, "bot is not a member")
+}
+
+/*
+IsMessageNotDeletable is true if a DeleteMessage failed because the message is too old, was already deleted, or the bot
+can't delete it in this chat.
+*/
+func (e APIError) IsMessageNotDeletable() bool {
+	if e.ErrorCode != http.StatusBadRequest {
+		return false
+	}
+
+	description := strings.ToLower(e.Description)
+
+	return strings.Contains(description, "message can't be deleted") ||
+		strings.Contains(description, "message to delete not found")
+}
+
+// BotBlockedError means that the user has blocked the bot. The bot can't send them messages until they unblock it.
+type BotBlockedError struct {
+	APIError
+}
+
+func (e BotBlockedError) Error() string {
+	return fmt.Sprintf("bot was blocked by the user: %s", e.APIError)
+}
+
+func (e BotBlockedError) Unwrap() error {
+	return e.APIError
+}
+
+/*
+Classify returns a more specific error type if there is one for this error, otherwise returns the APIError itself. The
+returned error always unwraps to the APIError.
+*/
+func (e APIError) Classify() error {
+	isBlocked := strings.Contains(strings.ToLower(e.Description), "bot was blocked by the user")
+	if e.ErrorCode == http.StatusForbidden && isBlocked {
+		return BotBlockedError{APIError: e}
+	}
+
+	return e
+}
+
+/*
+ChatIDOf returns the `chat_id` of an action's JSON body. Returns false if the action isn't sent to a chat (e.g.
+answering a callback query).
+*/
+func ChatIDOf(body json.RawMessage) (ChatID, bool) {
+	var action struct {
+		ChatID ChatID `json:"chat_id"`
+	}
+
+	if err := json.Unmarshal(body, &action); err != nil || action.ChatID == "" {
+		return "", false
+	}
+
+	return action.ChatID, true
+}
+
 type AnswerCallbackQuery struct {
 	ID        string                `json:"callback_query_id"`
 	Text      option.Option[string] `json:"text"`
@@ -146,8 +273,31 @@ func CallbackQueryAnswerAlert(id update.CallbackQueryID, text string) AnswerCall
 	}
 }
 
+/*
+CallbackQueryAck stops the loading animation of the pressed button without showing anything to the user, e.g. when the
+button has changed the message.
+*/
+func CallbackQueryAck(id update.CallbackQueryID) AnswerCallbackQuery {
+	return AnswerCallbackQuery{
+		ID:        string(id),
+		Text:      option.None[string](),
+		ShowAlert: false,
+	}
+}
+
 func (q AnswerCallbackQuery) JSONEncode() (string, json.RawMessage, error) {
-	body, err := json.Marshal(q)
+	// Option encodes None as null, but without a text there should be no "text" at all
+	encoded := struct {
+		ID        string  `json:"callback_query_id"`
+		Text      *string `json:"text,omitempty"`
+		ShowAlert bool    `json:"show_alert"`
+	}{ID: q.ID, Text: nil, ShowAlert: q.ShowAlert}
+
+	if text, isSome := q.Text.Unwrap(); isSome {
+		encoded.Text = &text
+	}
+
+	body, err := json.Marshal(encoded)
 	if err != nil {
 		err = fmt.Errorf("while JSON encoding AnswerCallbackQuery: %w", err)
 	}
@@ -155,20 +305,65 @@ func (q AnswerCallbackQuery) JSONEncode() (string, json.RawMessage, error) {
 	return "answerCallbackQuery", body, err
 }
 
+// EditMessageText replaces the text of a message the bot has sent, e.g. to show another page of a list.
+type EditMessageText struct {
+	ChatID                ChatID                `json:"chat_id"`
+	MessageID             update.MessageID      `json:"message_id"`
+	Text                  string                `json:"text"`
+	ParseMode             option.Option[string] `json:"parse_mode,omitempty"`
+	DisableWebpagePreview bool                  `json:"disable_web_page_preview"`
+	// ReplyMarkup is the new inline keyboard. Without it the keyboard is removed.
+	ReplyMarkup ReplyMarkupper `json:"reply_markup,omitempty"`
+}
+
+// NewEditMessageText creates EditMessageText like NewSendMessage: in the default parse mode, without web previews.
+func NewEditMessageText(chatID update.ChatID, messageID update.MessageID, text string) EditMessageText {
+	return EditMessageText{
+		ChatID:                NewChatID(chatID),
+		MessageID:             messageID,
+		Text:                  text,
+		ParseMode:             defaultParseModeOption(),
+		DisableWebpagePreview: true,
+		ReplyMarkup:           nil,
+	}
+}
+
+func (m EditMessageText) SetReplyMarkup(markup [][]InlineKeyboardButton) EditMessageText {
+	m.ReplyMarkup = InlineKeyboardMarkup{Keyboard: markup}
+
+	return m
+}
+
+func (m EditMessageText) JSONEncode() (string, json.RawMessage, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		err = fmt.Errorf("while JSON encoding EditMessageText: %w", err)
+	}
+
+	return "editMessageText", body, err
+}
+
 type EditMessageReplyMarkup struct {
-	ChatID      ChatID         `json:"chat_id"`
-	MessageID   int64          `json:"message_id"`
-	ReplyMarkup ReplyMarkupper `json:"reply_markup"`
+	ChatID      ChatID           `json:"chat_id"`
+	MessageID   update.MessageID `json:"message_id"`
+	ReplyMarkup ReplyMarkupper   `json:"reply_markup"`
 }
 
-func RemoveReplyMarkup(message update.Message) EditMessageReplyMarkup {
+// EditReplyMarkup replaces the inline keyboard of a message the bot has sent.
+func EditReplyMarkup(chatID update.ChatID, messageID update.MessageID, markup [][]InlineKeyboardButton,
+) EditMessageReplyMarkup {
 	return EditMessageReplyMarkup{
-		ChatID:      ChatID(fmt.Sprint(message.Chat.ID)),
-		MessageID:   int64(message.ID),
-		ReplyMarkup: InlineKeyboardMarkup{Keyboard: [][]InlineKeyboardButton{{}}},
+		ChatID:      NewChatID(chatID),
+		MessageID:   messageID,
+		ReplyMarkup: InlineKeyboardMarkup{Keyboard: markup},
 	}
 }
 
+// RemoveReplyMarkup removes the inline keyboard of the message.
+func RemoveReplyMarkup(message update.Message) EditMessageReplyMarkup {
+	return EditReplyMarkup(message.Chat.ID, message.ID, [][]InlineKeyboardButton{{}})
+}
+
 func (m EditMessageReplyMarkup) JSONEncode() (string, json.RawMessage, error) {
 	body, err := json.Marshal(m)
 	if err != nil {
@@ -177,3 +372,98 @@ func (m EditMessageReplyMarkup) JSONEncode() (string, json.RawMessage, error) {
 
 	return "editMessageReplyMarkup", body, err
 }
+
+// DeleteMessage deletes a message, e.g. one with a secret in it. Telegram only deletes messages younger than 48 hours.
+type DeleteMessage struct {
+	ChatID    ChatID           `json:"chat_id"`
+	MessageID update.MessageID `json:"message_id"`
+}
+
+// NewDeleteMessage deletes the message with `messageID` from a chat.
+func NewDeleteMessage(chatID update.ChatID, messageID update.MessageID) DeleteMessage {
+	return DeleteMessage{
+		ChatID:    NewChatID(chatID),
+		MessageID: messageID,
+	}
+}
+
+func (m DeleteMessage) JSONEncode() (string, json.RawMessage, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		err = fmt.Errorf("while JSON encoding DeleteMessage: %w", err)
+	}
+
+	return "deleteMessage", body, err
+}
+
+type UnpinChatMessage struct {
+	ChatID    ChatID           `json:"chat_id"`
+	MessageID update.MessageID `json:"message_id"`
+}
+
+// UnpinMessage removes one message from the list of pinned messages in a chat.
+func UnpinMessage(chatID update.ChatID, messageID update.MessageID) UnpinChatMessage {
+	return UnpinChatMessage{
+		ChatID:    NewChatID(chatID),
+		MessageID: messageID,
+	}
+}
+
+func (m UnpinChatMessage) JSONEncode() (string, json.RawMessage, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		err = fmt.Errorf("while JSON encoding UnpinChatMessage: %w", err)
+	}
+
+	return "unpinChatMessage", body, err
+}
+
+type UnpinAllChatMessages struct {
+	ChatID ChatID `json:"chat_id"`
+}
+
+// UnpinAllMessages clears the list of pinned messages in a chat.
+func UnpinAllMessages(chatID update.ChatID) UnpinAllChatMessages {
+	return UnpinAllChatMessages{ChatID: NewChatID(chatID)}
+}
+
+func (m UnpinAllChatMessages) JSONEncode() (string, json.RawMessage, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		err = fmt.Errorf("while JSON encoding UnpinAllChatMessages: %w", err)
+	}
+
+	return "unpinAllChatMessages", body, err
+}
+
+// BotCommand is a command in the menu that Telegram shows next to the message field.
+type BotCommand struct {
+	// Command is the name without the "/". Telegram only allows lowercase letters, digits and underscores.
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// Chats where the commands of SetMyCommands are shown.
+const (
+	CommandScopeDefault         = "default"
+	CommandScopeAllPrivateChats = "all_private_chats"
+)
+
+type BotCommandScope struct {
+	Type string `json:"type"`
+}
+
+// SetMyCommands replaces the command menu of the bot in the chats of the scope.
+type SetMyCommands struct {
+	Commands []BotCommand    `json:"commands"`
+	Scope    BotCommandScope `json:"scope"`
+}
+
+func (m SetMyCommands) JSONEncode() (string, json.RawMessage, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		err = fmt.Errorf("while JSON encoding SetMyCommands: %w", err)
+	}
+
+	return "setMyCommands", body, err
+}
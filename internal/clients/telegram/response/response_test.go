@@ -0,0 +1,240 @@
+package response_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+// assertEncodes checks that the action is sent to `endpoint` with exactly `body` as JSON.
+func assertEncodes(t *testing.T, action response.BotAction, endpoint, body string) {
+	t.Helper()
+
+	gotEndpoint, gotBody, err := action.JSONEncode()
+	if err != nil {
+		t.Fatalf("While encoding %T: %s", action, err)
+	}
+
+	if gotEndpoint != endpoint {
+		t.Errorf("%T is sent to /%s, expected /%s", action, gotEndpoint, endpoint)
+	}
+
+	if string(gotBody) != body {
+		t.Errorf("%T is encoded as %s, expected %s", action, gotBody, body)
+	}
+}
+
+func TestUnpinMessage(t *testing.T) {
+	t.Parallel()
+
+	assertEncodes(t, response.UnpinMessage(-100123, 5), "unpinChatMessage",
+		`{"chat_id":"-100123","message_id":5}`)
+}
+
+func TestDeleteMessage(t *testing.T) {
+	t.Parallel()
+
+	assertEncodes(t, response.NewDeleteMessage(42, 7), "deleteMessage", `{"chat_id":"42","message_id":7}`)
+}
+
+func TestEditMessageText(t *testing.T) {
+	t.Parallel()
+
+	assertEncodes(t, response.NewEditMessageText(42, 7, "page 2"), "editMessageText",
+		`{"chat_id":"42","message_id":7,"text":"page 2","parse_mode":"html","disable_web_page_preview":true}`)
+
+	assertEncodes(t,
+		response.NewEditMessageText(42, 7, "page 2").SetReplyMarkup([][]response.InlineKeyboardButton{{
+			response.InlineButtonCallback("Next page", "next"),
+		}}),
+		"editMessageText", `{"chat_id":"42","message_id":7,"text":"page 2","parse_mode":"html",`+
+			`"disable_web_page_preview":true,"reply_markup":{"inline_keyboard":[[{"text":"Next page",`+
+			`"switch_inline_query_current_chat":null,"callback_data":"next","url":null}]]}}`)
+}
+
+func TestEditReplyMarkup(t *testing.T) {
+	t.Parallel()
+
+	assertEncodes(t,
+		response.EditReplyMarkup(-100123, 5, [][]response.InlineKeyboardButton{{
+			response.InlineButtonURL("Open", "https://t.me/bot"),
+		}}),
+		"editMessageReplyMarkup",
+		`{"chat_id":"-100123","message_id":5,"reply_markup":{"inline_keyboard":[[{"text":"Open",`+
+			`"switch_inline_query_current_chat":null,"callback_data":null,"url":"https://t.me/bot"}]]}}`)
+}
+
+func TestRemoveReplyMarkup(t *testing.T) {
+	t.Parallel()
+
+	message := update.Message{ID: 5, Chat: update.Chat{ID: -100123, Type: update.ChatTypeGroup}}
+
+	assertEncodes(t, response.RemoveReplyMarkup(message), "editMessageReplyMarkup",
+		`{"chat_id":"-100123","message_id":5,"reply_markup":{"inline_keyboard":[[]]}}`)
+}
+
+func TestUnpinAllMessages(t *testing.T) {
+	t.Parallel()
+
+	assertEncodes(t, response.UnpinAllMessages(-100123), "unpinAllChatMessages", `{"chat_id":"-100123"}`)
+}
+
+func TestTyping(t *testing.T) {
+	t.Parallel()
+
+	assertEncodes(t, response.Typing(-100123), "sendChatAction", `{"chat_id":"-100123","action":"typing"}`)
+}
+
+func TestCallbackQueryAckHasNoText(t *testing.T) {
+	t.Parallel()
+
+	assertEncodes(t, response.CallbackQueryAck("42"), "answerCallbackQuery",
+		`{"callback_query_id":"42","show_alert":false}`)
+	assertEncodes(t, response.CallbackQueryAnswerAlert("42", "expired"), "answerCallbackQuery",
+		`{"callback_query_id":"42","text":"expired","show_alert":true}`)
+}
+
+func TestIsRemovedFromChat(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		err       response.APIError
+		isRemoved bool
+	}{
+		{response.APIError{ErrorCode: 403, Description: "Forbidden: bot was kicked from the group chat"}, true},
+		{response.APIError{ErrorCode: 403, Description: "Forbidden: bot was kicked from the supergroup chat"}, true},
+		{response.APIError{ErrorCode: 403, Description: "Forbidden: bot is not a member of the channel chat"}, true},
+		{response.APIError{ErrorCode: 403, Description: "Forbidden: bot was blocked by the user"}, false},
+		{response.APIError{ErrorCode: 400, Description: "Bad Request: bot was kicked"}, false},
+	}
+
+	for _, c := range cases {
+		if c.err.IsRemovedFromChat() != c.isRemoved {
+			t.Errorf("%q: IsRemovedFromChat() should be %t", c.err.Description, c.isRemoved)
+		}
+	}
+}
+
+func TestIsMessageNotDeletable(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		err          response.APIError
+		notDeletable bool
+	}{
+		{response.APIError{ErrorCode: 400, Description: "Bad Request: message can't be deleted"}, true},
+		{response.APIError{ErrorCode: 400, Description: "Bad Request: message can't be deleted for everyone"}, true},
+		{response.APIError{ErrorCode: 400, Description: "Bad Request: message to delete not found"}, true},
+		{response.APIError{ErrorCode: 400, Description: "Bad Request: chat not found"}, false},
+		{response.APIError{ErrorCode: 403, Description: "Forbidden: bot was blocked by the user"}, false},
+	}
+
+	for _, c := range cases {
+		if c.err.IsMessageNotDeletable() != c.notDeletable {
+			t.Errorf("%q: IsMessageNotDeletable() should be %t", c.err.Description, c.notDeletable)
+		}
+	}
+}
+
+func TestClassifyBotBlocked(t *testing.T) {
+	t.Parallel()
+
+	blockedErr := response.APIError{ErrorCode: 403, Description: "Forbidden: bot was blocked by the user"}.Classify()
+
+	var blocked response.BotBlockedError
+	if !errors.As(blockedErr, &blocked) {
+		t.Fatalf("Expected BotBlockedError, got %T: %s", blockedErr, blockedErr)
+	}
+
+	var apiErr response.APIError
+	if !errors.As(blockedErr, &apiErr) || apiErr.ErrorCode != 403 {
+		t.Fatalf("BotBlockedError does not unwrap to the APIError: %#v", apiErr)
+	}
+
+	for _, other := range []response.APIError{
+		{ErrorCode: 403, Description: "Forbidden: bot was kicked from the group chat"},
+		{ErrorCode: 400, Description: "Bad Request: bot was blocked by the user"},
+	} {
+		if errors.As(other.Classify(), &blocked) {
+			t.Errorf("%d %q is not a BotBlockedError", other.ErrorCode, other.Description)
+		}
+	}
+}
+
+func TestNewChatID(t *testing.T) {
+	t.Parallel()
+
+	for id, expected := range map[update.ChatID]response.ChatID{
+		42:             "42",
+		-42:            "-42",
+		-1001234567890: "-1001234567890", // Supergroups and channels
+		0:              "0",
+	} {
+		if chatID := response.NewChatID(id); chatID != expected {
+			t.Errorf("NewChatID(%d) = %q, expected %q", id, chatID, expected)
+		}
+	}
+
+	assertEncodes(t, response.NewSendMessage(-1001234567890, "hi"), "sendMessage",
+		`{"chat_id":"-1001234567890","text":"hi","parse_mode":"html","disable_web_page_preview":true}`)
+}
+
+func TestChatIDOf(t *testing.T) {
+	t.Parallel()
+
+	_, body, _ := response.UnpinAllMessages(-100123).JSONEncode()
+	if chatID, hasChat := response.ChatIDOf(body); !hasChat || chatID != "-100123" {
+		t.Errorf("ChatIDOf(%s) = %q, %t", body, chatID, hasChat)
+	}
+
+	_, body, _ = response.CallbackQueryAnswerNotification("id", "text").JSONEncode()
+	if chatID, hasChat := response.ChatIDOf(body); hasChat {
+		t.Errorf("Callback query answer has no chat, but ChatIDOf returned %q", chatID)
+	}
+}
+
+func TestSendMessagesExpandsInOrder(t *testing.T) {
+	t.Parallel()
+
+	batch := response.SendMessages{response.NewSendMessage(1, "first"), response.NewSendMessage(2, "second")}
+
+	flat := response.Flatten([]response.BotAction{
+		response.Typing(1),
+		batch,
+		response.SendMessages{response.NewSendMessage(3, "third")},
+	})
+
+	if len(flat) != 4 {
+		t.Fatalf("Expected 4 actions, got %d: %#v", len(flat), flat)
+	}
+
+	assertEncodes(t, flat[0], "sendChatAction", `{"chat_id":"1","action":"typing"}`)
+
+	for i, text := range []string{"first", "second", "third"} {
+		message, isMessage := flat[i+1].(response.SendMessage)
+		if !isMessage || message.Text != text {
+			t.Errorf("Action %d should be %q, got %#v", i+1, text, flat[i+1])
+		}
+	}
+
+	var notExpanded response.BatchNotExpandedError
+	if _, _, err := batch.JSONEncode(); !errors.As(err, &notExpanded) {
+		t.Errorf("Encoding a batch should fail with BatchNotExpandedError, got %v", err)
+	}
+}
+
+func TestSendDocument(t *testing.T) {
+	t.Parallel()
+
+	document := response.NewSendDocument(42, "daily-report.html", []byte("<b>report</b>"), "caption")
+
+	assertEncodes(t, document, "sendDocument",
+		`{"chat_id":"42","caption":"caption","parse_mode":"html","document":"daily-report.html"}`)
+
+	files := document.Files()
+	if len(files) != 1 || files[0].Field != "document" || string(files[0].Data) != "<b>report</b>" {
+		t.Errorf("Expected the report as the document, got %+v", files)
+	}
+}
@@ -0,0 +1,240 @@
+package response
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+/*
+MessageLength is the length of `text` the way Telegram counts it: in UTF-16 code units, so emoji and other characters
+outside of the BMP count as 2. HTML tags and entities are counted too, so a message with this length or less always
+fits, even though Telegram itself only counts the text that is left after parsing them.
+*/
+func MessageLength(text string) int {
+	const (
+		// firstSurrogatePair is the first character that takes 2 code units in UTF-16
+		firstSurrogatePair = 0x10000
+		surrogatePairUnits = 2
+	)
+
+	length := 0
+
+	for _, r := range text {
+		if r >= firstSurrogatePair {
+			length += surrogatePairUnits
+		} else {
+			length++
+		}
+	}
+
+	return length
+}
+
+/*
+SplitSendMessage sends `text` as one or more messages, each with at most MaxMessageLength characters (see
+MessageLength). Messages are split at line breaks if possible, then at spaces. The text is read in the parse mode of
+SetDefaultParseMode:
+  - With HTML a message never ends inside a tag or an entity. If a tag like <b> or <a href="..."> is open where a
+    message ends, it's closed at the end of that message and opened again at the start of the next one.
+  - With MarkdownV2 a message never ends between a backslash and the character it escapes. Formatting that spans the
+    split (e.g. *bold*) is not closed and reopened, so a long text should have its line breaks outside of it.
+*/
+func SplitSendMessage(chatID update.ChatID, text string) []BotAction {
+	var parts []string
+
+	if DefaultParseMode() == ParseModeMarkdownV2 {
+		parts = splitAtoms(markdownV2Atoms(text), MaxMessageLength, noTags)
+	} else {
+		parts = splitAtoms(htmlAtoms(text), MaxMessageLength, applyTag)
+	}
+
+	actions := make([]BotAction, len(parts))
+	for i, part := range parts {
+		actions[i] = NewSendMessage(chatID, part)
+	}
+
+	return actions
+}
+
+// htmlTag is an open tag, e.g. `<a href="...">` has the name "a".
+type htmlTag struct {
+	name    string
+	opening string
+}
+
+// splitPoint is where a message can end.
+type splitPoint struct {
+	// chunkLen is the length of the message in bytes if it ends here
+	chunkLen int
+	// atom is the index of the atom after which the message ends
+	atom int
+	open []htmlTag
+}
+
+/*
+splitAtoms joins `atoms` into parts that are `limit` or shorter. `applyTag` returns the tags that are open after an
+atom. See SplitSendMessage.
+*/
+func splitAtoms(atoms []string, limit int, applyTag func(open []htmlTag, atom string) []htmlTag) []string {
+	parts := []string{}
+
+	var (
+		chunk                  strings.Builder
+		chunkLen               int
+		open                   []htmlTag
+		lastNewline, lastSpace *splitPoint
+		chunkHasText           bool
+	)
+
+	startChunk := func(reopen []htmlTag) {
+		chunk.Reset()
+
+		for _, tag := range reopen {
+			chunk.WriteString(tag.opening)
+		}
+
+		chunkLen = MessageLength(chunk.String())
+		open = append([]htmlTag{}, reopen...)
+		lastNewline, lastSpace = nil, nil
+		chunkHasText = false
+	}
+
+	startChunk(nil)
+
+	for i := 0; i < len(atoms); i++ {
+		atom := atoms[i]
+		afterAtom := applyTag(open, atom)
+		atomLen := MessageLength(atom)
+
+		if !chunkHasText || chunkLen+atomLen+closingLength(afterAtom) <= limit {
+			chunk.WriteString(atom)
+			chunkLen += atomLen
+			open = afterAtom
+			chunkHasText = true
+
+			point := &splitPoint{chunkLen: chunk.Len(), atom: i, open: open}
+
+			switch atom {
+			case "\n":
+				lastNewline = point
+			case " ":
+				lastSpace = point
+			}
+
+			continue
+		}
+
+		split := &splitPoint{chunkLen: chunk.Len(), atom: i - 1, open: open}
+		if lastNewline != nil {
+			split = lastNewline
+		} else if lastSpace != nil {
+			split = lastSpace
+		}
+
+		parts = append(parts, chunk.String()[:split.chunkLen]+closingTags(split.open))
+		startChunk(split.open)
+
+		i = split.atom
+	}
+
+	if chunkHasText || len(parts) == 0 {
+		parts = append(parts, chunk.String()+closingTags(open))
+	}
+
+	return parts
+}
+
+// htmlAtoms splits the text into pieces that can't be split further: tags, entities like &amp; and single characters.
+func htmlAtoms(text string) []string {
+	const maxEntityLength = 10
+
+	atoms := []string{}
+
+	for len(text) != 0 {
+		end := 0
+
+		switch text[0] {
+		case '<':
+			end = strings.IndexByte(text, '>') + 1
+		case '&':
+			if semicolon := strings.IndexByte(text, ';'); semicolon != -1 && semicolon < maxEntityLength {
+				end = semicolon + 1
+			}
+		}
+
+		if end == 0 {
+			_, end = utf8.DecodeRuneInString(text)
+		}
+
+		atoms = append(atoms, text[:end])
+		text = text[end:]
+	}
+
+	return atoms
+}
+
+// markdownV2Atoms splits the text into single characters, except that an escaped character stays with its backslash.
+func markdownV2Atoms(text string) []string {
+	atoms := []string{}
+
+	for len(text) != 0 {
+		_, end := utf8.DecodeRuneInString(text)
+
+		if text[0] == '\\' && len(text) > 1 {
+			_, escapedLen := utf8.DecodeRuneInString(text[1:])
+			end += escapedLen
+		}
+
+		atoms = append(atoms, text[:end])
+		text = text[end:]
+	}
+
+	return atoms
+}
+
+// applyTag returns the open tags after `atom`. `open` is not changed.
+func applyTag(open []htmlTag, atom string) []htmlTag {
+	if !strings.HasPrefix(atom, "<") || !strings.HasSuffix(atom, ">") {
+		return open
+	}
+
+	if name, isClosing := strings.CutPrefix(atom, "</"); isClosing {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimSuffix(name, ">")))
+
+		for i := len(open) - 1; i >= 0; i-- {
+			if open[i].name == name {
+				return append(append([]htmlTag{}, open[:i]...), open[i+1:]...)
+			}
+		}
+
+		return open
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(atom, "<"), ">")
+	if space := strings.IndexAny(name, " \t\n"); space != -1 {
+		name = name[:space]
+	}
+
+	return append(append([]htmlTag{}, open...), htmlTag{name: strings.ToLower(name), opening: atom})
+}
+
+// noTags is applyTag for text without tags, nothing is ever open.
+func noTags(open []htmlTag, _ string) []htmlTag {
+	return open
+}
+
+// closingTags closes the tags in reverse order.
+func closingTags(open []htmlTag) string {
+	closing := ""
+	for i := len(open) - 1; i >= 0; i-- {
+		closing += "</" + open[i].name + ">"
+	}
+
+	return closing
+}
+
+func closingLength(open []htmlTag) int {
+	return MessageLength(closingTags(open))
+}
@@ -0,0 +1,154 @@
+package response_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+)
+
+// splitTexts returns the texts of the messages from SplitSendMessage and checks that all of them fit.
+func splitTexts(t *testing.T, text string) []string {
+	t.Helper()
+
+	actions := response.SplitSendMessage(42, text)
+	texts := make([]string, len(actions))
+
+	for i, action := range actions {
+		_, body, err := action.JSONEncode()
+		if err != nil {
+			t.Fatalf("While encoding message %d: %s", i, err)
+		}
+
+		var message struct {
+			Text string `json:"text"`
+		}
+
+		if err = json.Unmarshal(body, &message); err != nil {
+			t.Fatalf("While decoding message %d: %s", i, err)
+		}
+
+		if length := response.MessageLength(message.Text); length > response.MaxMessageLength {
+			t.Errorf("Message %d is %d characters long", i, length)
+		}
+
+		texts[i] = message.Text
+	}
+
+	return texts
+}
+
+func TestMessageLength(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]int{"": 0, "abc": 3, "привет": 6, "😀": 2, "<b>a</b>": 8}
+
+	for text, expected := range cases {
+		if length := response.MessageLength(text); length != expected {
+			t.Errorf("MessageLength(%q) is %d, expected %d", text, length, expected)
+		}
+	}
+}
+
+func TestSplitShortMessage(t *testing.T) {
+	t.Parallel()
+
+	for _, text := range []string{"", "<b>Hello</b>\nworld"} {
+		if texts := splitTexts(t, text); len(texts) != 1 || texts[0] != text {
+			t.Errorf("%q was changed to %q", text, texts)
+		}
+	}
+}
+
+func TestSplitAtLineBreaks(t *testing.T) {
+	t.Parallel()
+
+	first, second := strings.Repeat("a ", 1500)+"\n", strings.Repeat("b ", 1500)
+
+	texts := splitTexts(t, first+second)
+	if len(texts) != 2 || texts[0] != first || texts[1] != second {
+		t.Fatalf("Expected a split after the first line, got %d messages: %q", len(texts), texts)
+	}
+}
+
+func TestSplitCountsUTF16(t *testing.T) {
+	t.Parallel()
+
+	// 3000 characters, but 6000 UTF-16 code units
+	texts := splitTexts(t, strings.Repeat("😀", 3000))
+	if len(texts) != 2 || texts[0]+texts[1] != strings.Repeat("😀", 3000) {
+		t.Fatalf("Expected 2 messages with all emoji, got %d", len(texts))
+	}
+}
+
+func TestSplitReopensTags(t *testing.T) {
+	t.Parallel()
+
+	words := strings.Repeat("word ", 2000)
+	texts := splitTexts(t, `<a href="https://example.com">`+"<b>"+words+"</b></a> &amp; the end")
+
+	if len(texts) < 2 {
+		t.Fatalf("Expected the text to be split, got %d message", len(texts))
+	}
+
+	content := ""
+
+	for i, text := range texts {
+		if i != len(texts)-1 && (!strings.HasPrefix(text, `<a href="https://example.com"><b>`) ||
+			!strings.HasSuffix(text, "</b></a>")) {
+			t.Errorf("Message %d doesn't reopen and close the tags: %q...%q", i, text[:40], text[len(text)-40:])
+		}
+
+		text = strings.TrimPrefix(text, `<a href="https://example.com"><b>`)
+		content += strings.TrimSuffix(strings.TrimSuffix(text, " &amp; the end"), "</b></a>")
+	}
+
+	if content != words {
+		t.Errorf("Some text was lost or added while splitting")
+	}
+
+	if !strings.HasSuffix(texts[len(texts)-1], "</b></a> &amp; the end") {
+		t.Errorf("The last message is wrong: %q", texts[len(texts)-1])
+	}
+}
+
+func TestSplitNeverCutsTagsOrEntities(t *testing.T) {
+	t.Parallel()
+
+	// No spaces or line breaks, so the text can only be split between tags and entities
+	texts := splitTexts(t, strings.Repeat(`<a href="https://example.com/item">&lt;item&gt;</a>`, 200))
+
+	for i, text := range texts {
+		if strings.Count(text, "<a ") != strings.Count(text, "</a>") || strings.Count(text, "<") != strings.Count(text, ">") {
+			t.Errorf("Message %d has a cut tag: %q", i, text)
+		}
+
+		if strings.Count(text, "&") != strings.Count(text, "&lt;")+strings.Count(text, "&gt;") {
+			t.Errorf("Message %d has a cut entity: %q", i, text)
+		}
+	}
+}
+
+func TestSplitMarkdownV2NeverCutsEscapes(t *testing.T) {
+	response.SetDefaultParseMode(response.ParseModeMarkdownV2)
+	t.Cleanup(func() { response.SetDefaultParseMode(response.ParseModeHTML) })
+
+	// No spaces or line breaks, and "ab" makes the 4096th character a backslash. "<b>" is not a tag in MarkdownV2.
+	text := "ab" + strings.Repeat(`a\.`, 3000) + "<b>"
+
+	texts := splitTexts(t, text)
+	if len(texts) < 2 {
+		t.Fatalf("Expected the text to be split, got %d message", len(texts))
+	}
+
+	for i, text := range texts {
+		if trimmed := strings.TrimRight(text, `\`); (len(text)-len(trimmed))%2 != 0 {
+			t.Errorf("Message %d ends with a lone backslash: ...%q", i, text[len(text)-10:])
+		}
+	}
+
+	if strings.Join(texts, "") != text {
+		t.Errorf("Some text was lost or added while splitting")
+	}
+}
@@ -0,0 +1,82 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+// Run with -race: the processors read the responses while they are replaced.
+func TestSetResponsesWhileProcessing(t *testing.T) {
+	t.Parallel()
+
+	const updates = 50
+
+	fake := &fakeTelegram{expected: updates, allSent: make(chan struct{})}
+	for i := 1; i <= updates; i++ {
+		fake.updates = append(fake.updates, privateMessageUpdate(i, i, "/help"))
+	}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client := telegram.NewTestClient(server, helpResponses())
+
+	reloaded := make(chan struct{})
+	stopReloading := make(chan struct{})
+
+	go func() {
+		defer close(reloaded)
+
+		for i := 0; ; i++ {
+			select {
+			case <-stopReloading:
+				return
+			default:
+			}
+
+			responses := helpResponses()
+			responses.Root.Help = strings.Repeat("help ", i%3+1)
+			client.SetResponses(responses)
+		}
+	}()
+
+	fail := client.Start(4)
+
+	select {
+	case <-fake.allSent:
+	case err := <-fail:
+		t.Fatalf("Bot crashed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for replies")
+	}
+
+	close(stopReloading)
+	<-reloaded
+	client.Stop()
+
+	responses := helpResponses()
+	responses.Root.Help = "reloaded help"
+	client.SetResponses(responses)
+
+	var sent string
+
+	client.SetDryRun(func(_ string, body []byte) { sent = string(body) })
+
+	var upd update.Update
+	if err := json.Unmarshal([]byte(privateMessageUpdate(updates+1, 1, "/help")), &upd); err != nil {
+		t.Fatalf("While decoding the update: %s", err)
+	}
+
+	client.ProcessUpdate(context.Background(), upd)
+
+	if !strings.Contains(sent, "reloaded help") {
+		t.Fatalf("The replaced responses were not used, sent %s", sent)
+	}
+}
@@ -0,0 +1,47 @@
+package telegram
+
+import "github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+
+/*
+seenUpdates remembers the last few update IDs, so that an update that was received twice (e.g. when a request was
+retried) is only processed once. The oldest ID is forgotten when a new one is added.
+
+It's not safe to use from many goroutines.
+*/
+type seenUpdates struct {
+	ids   map[update.UpdateID]struct{}
+	order []update.UpdateID // A ring buffer, `next` is the oldest ID
+	next  int
+}
+
+// newSeenUpdates remembers up to `size` IDs. 0 turns off the check.
+func newSeenUpdates(size uint) *seenUpdates {
+	return &seenUpdates{
+		ids:   make(map[update.UpdateID]struct{}, size),
+		order: make([]update.UpdateID, 0, size),
+		next:  0,
+	}
+}
+
+// Seen returns true if the ID was seen recently. Otherwise remembers the ID and returns false.
+func (s *seenUpdates) Seen(id update.UpdateID) bool {
+	if cap(s.order) == 0 {
+		return false
+	}
+
+	if _, isSeen := s.ids[id]; isSeen {
+		return true
+	}
+
+	if len(s.order) < cap(s.order) {
+		s.order = append(s.order, id)
+	} else {
+		delete(s.ids, s.order[s.next])
+		s.order[s.next] = id
+		s.next = (s.next + 1) % len(s.order)
+	}
+
+	s.ids[id] = struct{}{}
+
+	return false
+}
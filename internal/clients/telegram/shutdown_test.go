@@ -0,0 +1,247 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// countingStore is a state.Store that counts the saved states, one for each processed update.
+type countingStore struct {
+	savedStates atomic.Int64
+}
+
+func (s *countingStore) LoadUserData(update.UserID) (state.UserSharedData, bool, error) {
+	return state.NewUserSharedData(), false, nil
+}
+
+func (s *countingStore) SaveUserData(update.UserID, state.UserSharedData) error {
+	return nil
+}
+
+func (s *countingStore) LoadState(string) (state.State, bool, error) {
+	return state.NewRootState(), false, nil
+}
+
+func (s *countingStore) SaveState(string, state.State) error {
+	s.savedStates.Add(1)
+
+	return nil
+}
+
+func (s *countingStore) DeleteStates(update.UserID) error {
+	return nil
+}
+
+func TestStopDuringProcessingDoesNotLoseQueuedUpdates(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	var (
+		mu         sync.Mutex
+		stopped    bool
+		sentAfter  int
+		sentBefore = make(chan struct{}, 100)
+	)
+
+	store := &countingStore{savedStates: atomic.Int64{}}
+
+	client := telegram.NewTestClient(server, helpResponses())
+	client.SetStore(store)
+	// Actions are recorded instead of sent, a canceled request could still reach a fake server after Stop()
+	client.SetDryRun(func(string, []byte) {
+		mu.Lock()
+		if stopped {
+			sentAfter++
+		}
+		mu.Unlock()
+
+		select {
+		case sentBefore <- struct{}{}:
+		default:
+		}
+	})
+
+	// queued is how many updates the client has taken from fetch. Each of them must be processed.
+	var queued atomic.Int64
+
+	fail := client.StartFetching(context.Background(), 4, func(ctx context.Context, updateCh chan<- update.Update) {
+		for id := 1; ; id++ {
+			var upd update.Update
+			if err := json.Unmarshal([]byte(privateMessageUpdate(id, id, "/help")), &upd); err != nil {
+				t.Errorf("While decoding an update: %s", err)
+
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case updateCh <- upd:
+				queued.Add(1)
+			}
+		}
+	})
+
+	for i := 0; i < 5; i++ {
+		select {
+		case <-sentBefore:
+		case err := <-fail:
+			t.Fatalf("Bot crashed: %s", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for replies")
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		client.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() didn't return while updates were being processed")
+	}
+
+	mu.Lock()
+	stopped = true
+	mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond) // Anything that is still running would send by now
+
+	select {
+	case err := <-fail:
+		t.Errorf("Bot crashed while stopping: %s", err)
+	default:
+	}
+
+	mu.Lock()
+	if sentAfter != 0 {
+		t.Errorf("%d messages were sent after Stop() returned", sentAfter)
+	}
+	mu.Unlock()
+
+	if saved, queued := store.savedStates.Load(), queued.Load(); saved != queued {
+		t.Errorf("%d updates were queued, but only %d were processed", queued, saved)
+	}
+}
+
+// dailyStatusStore is a state.Store where every conversation is in /dailyStatus. It keeps the last saved state.
+type dailyStatusStore struct {
+	mu    sync.Mutex
+	saved state.State
+}
+
+func (s *dailyStatusStore) LoadUserData(update.UserID) (state.UserSharedData, bool, error) {
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	return userData, true, nil
+}
+
+func (s *dailyStatusStore) SaveUserData(update.UserID, state.UserSharedData) error {
+	return nil
+}
+
+func (s *dailyStatusStore) LoadState(string) (state.State, bool, error) {
+	return state.NewDailyStatusState(state.NewRootState(), option.None[string](), nil), true, nil
+}
+
+func (s *dailyStatusStore) SaveState(_ string, conversation state.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saved = conversation
+
+	return nil
+}
+
+func (s *dailyStatusStore) DeleteStates(update.UserID) error {
+	return nil
+}
+
+func TestStopKeepsDailyStatusWithAStore(t *testing.T) {
+	t.Parallel()
+
+	replayFile := filepath.Join(t.TempDir(), "replay.jsonl")
+	if err := os.WriteFile(replayFile, []byte(`{"update": `+privateMessageUpdate(1, 7, "Learned a lot")+"}\n"),
+		0o600); err != nil {
+		t.Fatalf("While writing the replay file: %s", err)
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	var responses state.Responses
+	responses.DailyStatus.QuestionsAndBlockers = "blockers?"
+	responses.DailyStatus.Restarting = "restarting"
+
+	store := &dailyStatusStore{mu: sync.Mutex{}, saved: nil}
+	actions := make(chan dryRunAction, 10)
+
+	client := telegram.NewTestClient(server, responses)
+	client.SetInlineProcessing(true)
+	client.SetReplayFile(replayFile)
+	client.SetStore(store)
+	client.SetDryRun(func(endpoint string, body []byte) {
+		actions <- dryRunAction{endpoint: endpoint, body: body}
+	})
+
+	fail := client.Start(1)
+
+	select {
+	case action := <-actions:
+		var message struct {
+			ChatID string `json:"chat_id"`
+			Text   string `json:"text"`
+		}
+
+		if err := json.Unmarshal(action.body, &message); err != nil {
+			t.Fatalf("While decoding /%s: %s", action.endpoint, err)
+		}
+
+		if message.Text != "blockers?" || message.ChatID != "7" {
+			t.Fatalf("Expected %q in (ChatID 7), got %q in (ChatID %s)", "blockers?", message.Text, message.ChatID)
+		}
+	case err := <-fail:
+		t.Fatalf("Bot crashed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the next question")
+	}
+
+	client.Stop()
+
+	// The user can answer the next question after the restart, so they are not told that the report was canceled
+	select {
+	case action := <-actions:
+		t.Fatalf("Stop() has sent /%s %s", action.endpoint, action.body)
+	default:
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	status, is := store.saved.(state.DailyStatusState)
+	if !is || status.DiscoveryOfTheDay.UnwrapOr("") != "Learned a lot" {
+		t.Fatalf("Expected /dailyStatus with the answer to be saved after Stop(), got %#v", store.saved)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
 	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
@@ -16,6 +15,7 @@ import (
 type AddAPIKeyHandler struct {
 	responses *addAPIKeyResponses
 	userData  UserSharedData
+	deps      *Deps
 	AddAPIKeyState
 }
 
@@ -30,6 +30,7 @@ func (s *AddAPIKeyHandler) PrivateTextMessage(ctx context.Context, message updat
 
 		case noneCommand:
 			s.userData.GithubAPIKey = option.None[string]()
+			s.userData.LockedAPIKey = ""
 
 			logging.Infof("%s API key deleted", message.From.Log())
 			logging.Tracef("%s Return to RootState", message.UpdateID.Log())
@@ -38,23 +39,29 @@ func (s *AddAPIKeyHandler) PrivateTextMessage(ctx context.Context, message updat
 		}
 	}
 
-	client := github.NewClient(message.Text)
+	s.deps.DispatchEarly(ctx, response.Typing(message.Chat.ID))
+
+	client := s.deps.githubClient(message.Text)
 
 	login, err := client.Login(ctx)
 	if err != nil {
 		logging.Errorf("%s %s While saving GitHub API key: %s", message.UpdateID.Log(), message.From.Log(), err)
 
-		return s.sameStateWithMessage(message.Chat.ID, s.responses.BadAPIKey)
+		// Only a rejected key is bad, other errors (e.g. GitHub is down) say nothing about the key
+		return s.sameStateWithMessage(message.Chat.ID,
+			githubErrorMessage(s.deps, err, s.responses.BadAPIKey, s.responses.GithubErrorGeneric))
 	}
 
 	s.userData.GithubAPIKey = option.Some(message.Text)
+	s.userData.LockedAPIKey = ""
 
 	logging.Infof("%s %s API key saved", message.UpdateID.Log(), message.From.Log())
 	logging.Tracef("%s Return to RootState", message.UpdateID.Log())
 
-	return NewTransition(s.RootState, s.userData, []response.BotAction{
-		response.NewSendMessage(message.Chat.ID, fmt.Sprintf(s.responses.Success, login, login)).EnableWebPreview(),
-	})
+	return Transit(s.RootState, s.userData).
+		Action(response.NewSendMessage(message.Chat.ID, fmt.Sprintf(s.responses.Success, login, login)).
+			EnableWebPreview()).
+		Build()
 }
 
 func (s *AddAPIKeyHandler) GroupTextMessage(_ context.Context, message update.GroupTextMessage) Transition {
@@ -65,19 +72,23 @@ func (s *AddAPIKeyHandler) GroupTextMessage(_ context.Context, message update.Gr
 }
 
 func (s *AddAPIKeyHandler) Ignore(_ context.Context) Transition {
-	return NewTransition(s.AddAPIKeyState, s.userData, response.Nothing())
+	return Transit(s.AddAPIKeyState, s.userData).Build()
+}
+
+func (s *AddAPIKeyHandler) Unwind(_ context.Context, _ update.ChatID) Transition {
+	return Transit(s.AddAPIKeyState, s.userData).Build()
 }
 
 func (s *AddAPIKeyHandler) CallbackQuery(_ context.Context, cq update.CallbackQuery) Transition {
 	logging.Infof("%s Ignoring callback query in AddApiKeyState", cq.Log())
 
-	return NewTransition(s.AddAPIKeyState, s.userData, []response.BotAction{
-		response.AnswerCallbackQuery{
+	return Transit(s.AddAPIKeyState, s.userData).
+		Action(response.AnswerCallbackQuery{
 			ID:        string(cq.ID),
 			Text:      option.Some("This button doesnt work."),
 			ShowAlert: false,
-		},
-	})
+		}).
+		Build()
 }
 
 /*
@@ -85,9 +96,7 @@ returnToRootStateWithMessage returns to RootState with current userdata and send
 `message` text
 */
 func (s AddAPIKeyHandler) returnToRootStateWithMessage(chatID update.ChatID, message string) Transition {
-	return NewTransition(s.RootState, s.userData, []response.BotAction{
-		response.NewSendMessage(chatID, message),
-	})
+	return Transit(s.RootState, s.userData).Reply(chatID, message).Build()
 }
 
 /*
@@ -95,19 +104,18 @@ sameStateWithMessage keeps the current state with current userdata and sends one
 `message` text
 */
 func (s AddAPIKeyHandler) sameStateWithMessage(chatID update.ChatID, message string) Transition {
-	return NewTransition(s.AddAPIKeyState, s.userData, []response.BotAction{
-		response.NewSendMessage(chatID, message),
-	})
+	return Transit(s.AddAPIKeyState, s.userData).Reply(chatID, message).Build()
 }
 
 type AddAPIKeyState struct {
 	RootState
 }
 
-func (s AddAPIKeyState) Handler(userData UserSharedData, responses *Responses) Handler {
+func (s AddAPIKeyState) Handler(userData UserSharedData, responses *Responses, deps *Deps) Handler {
 	return &AddAPIKeyHandler{
 		responses:      &responses.AddAPIKey,
 		userData:       userData,
+		deps:           deps,
 		AddAPIKeyState: s,
 	}
 }
@@ -0,0 +1,118 @@
+package state_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+/*
+fakeGithubLogin answers the Login query as "octocat" and ViewerProjectsV2 with no projects if the request has the
+"valid" token. Other tokens are rejected like GitHub does.
+*/
+func fakeGithubLogin(t *testing.T) *statetest.GithubServer {
+	t.Helper()
+
+	withValidToken := func(body string) statetest.AnswerFunc {
+		return func(w http.ResponseWriter, r *http.Request, _ statetest.GraphQLRequest) {
+			if r.Header.Get("Authorization") != "Bearer valid" {
+				http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+
+				return
+			}
+
+			fmt.Fprint(w, body)
+		}
+	}
+
+	return statetest.FakeGithubFuncs(t, map[string]statetest.AnswerFunc{
+		"Login":            withValidToken(`{"data": {"viewer": {"login": "octocat"}}}`),
+		"ViewerProjectsV2": withValidToken(`{"data": {"viewer": {"projectsV2": {"edges": []}}}}`),
+	})
+}
+
+func TestAddAPIKeyInlineDeletesTheMessage(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubLogin(t).URL)
+	ctx := context.Background()
+
+	message := privateText("/addApiKey valid")
+	message.ID = 42
+
+	transition := rootHandlerWith(deps, state.NewUserSharedData()).PrivateTextMessage(ctx, message)
+
+	if key, _ := transition.UserData.GithubAPIKey.Unwrap(); key != "valid" {
+		t.Fatalf("Expected the key to be saved, got %q", key)
+	}
+
+	actions := statetest.DecodeActions(t, transition)
+	if len(actions) != 2 || actions[0].Endpoint != "deleteMessage" || actions[1].Endpoint != "sendMessage" {
+		t.Fatalf("Expected /deleteMessage and /sendMessage, got %+v", actions)
+	}
+
+	var deleted struct {
+		MessageID int64 `json:"message_id"`
+	}
+
+	if err := json.Unmarshal(actions[0].Body, &deleted); err != nil || deleted.MessageID != 42 {
+		t.Errorf("Expected message 42 to be deleted, got %s (%v)", actions[0].Body, err)
+	}
+}
+
+func TestAddAPIKeyInlineKeepsTheMessageWithABadKey(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubLogin(t).URL)
+	ctx := context.Background()
+
+	transition := rootHandlerWith(deps, state.NewUserSharedData()).
+		PrivateTextMessage(ctx, privateText("/addApiKey invalid"))
+
+	if reply := sentText(t, transition); reply != "bad key" {
+		t.Errorf("Expected the bad key reply, got %q", reply)
+	}
+}
+
+func TestAddAPIKeyWhenGithubIsDown(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "", http.StatusBadGateway)
+	}))
+	t.Cleanup(server.Close)
+
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	transition := rootHandlerWith(deps, state.NewUserSharedData()).
+		PrivateTextMessage(ctx, privateText("/addApiKey valid"))
+
+	// The key may be fine, so the user shouldn't be told that it's bad
+	if reply := sentText(t, transition); reply != "github error" {
+		t.Errorf("Expected the generic GitHub error, got %q", reply)
+	}
+}
+
+func TestRevokedKeyAsksForANewOne(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubLogin(t).URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("revoked")
+
+	transition := rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/listProjects"))
+
+	if reply := sentText(t, transition); reply != "github unauthorized" {
+		t.Errorf("Expected to be asked for a new key, got %q", reply)
+	}
+}
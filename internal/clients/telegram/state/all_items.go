@@ -0,0 +1,114 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+const (
+	allItemsCommand = "allitems"
+	// allItemsMaxProjects is how many of the user's projects /allItems reports on
+	allItemsMaxProjects = 20
+	// allItemsMaxItems is how many items /allItems shows from each project
+	allItemsMaxItems = 30
+)
+
+/*
+handleAllItems lists the items assigned to the user in all of their projects, grouped by project and then by status.
+Only the first allItemsMaxProjects projects and allItemsMaxItems items of each are shown, the reply says if there was
+more.
+*/
+func (s *RootHandler) handleAllItems(ctx context.Context, updateID update.UpdateID, chatID update.ChatID) Transition {
+	key, isSome := s.userData.GithubAPIKey.Unwrap()
+	if !isSome {
+		logging.Tracef("%s Tried to list all items without adding an API key", updateID.Log())
+
+		return s.replyWithMessage(chatID, s.responses.NoAPIKeyAdded)
+	}
+
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	client := s.deps.githubClient(key)
+
+	// One more than the limit shows if the limit was hit
+	page, err := client.ListViewerProjects(ctx, allItemsMaxProjects+1, option.None[github.ProjectCursor]())
+	if err != nil {
+		logging.Errorf("%s While getting projects for /allItems: %s", updateID.Log(), err)
+
+		return s.replyWithMessage(chatID,
+			githubErrorMessage(s.deps, err, s.responses.GithubUnauthorized, s.responses.GithubErrorGeneric))
+	}
+
+	projects := page.Projects
+
+	if len(projects) == 0 {
+		return s.replyWithMessage(chatID, s.responses.UserHasZeroProjects)
+	}
+
+	truncated := len(projects) > allItemsMaxProjects
+	if truncated {
+		projects = projects[:allItemsMaxProjects]
+	}
+
+	projectIDs := make([]github.ProjectID, len(projects))
+	for i, project := range projects {
+		projectIDs[i] = project.ID
+	}
+
+	items, err := client.ViewerItemsByProject(ctx, projectIDs, dailyStatusPageSize, allItemsMaxItems,
+		s.deps.ReportConcurrency)
+	if err != nil {
+		logging.Errorf("%s While getting items for /allItems: %s", updateID.Log(), err)
+
+		return s.replyWithMessage(chatID,
+			githubErrorMessage(s.deps, err, s.responses.GithubUnauthorized, s.responses.GithubErrorGeneric))
+	}
+
+	logging.Tracef("%s Listing all items from %d projects", updateID.Log(), len(projects))
+
+	return s.replyWithMessage(chatID, s.formatAllItems(projects, items, truncated))
+}
+
+// formatAllItems lists the items of each project by status. Projects without items are left out.
+func (s *RootHandler) formatAllItems(projects []github.ProjectV2, items []github.ProjectItems, truncated bool) string {
+	report := ""
+
+	for i, project := range projects {
+		if len(items[i].Items) == 0 {
+			continue
+		}
+
+		report += boldMarkup(linkMarkup(escapeMarkup(project.Title), project.URL)) + "\n"
+
+		statuses := make([]string, 0, len(items[i].Items))
+		for status := range items[i].Items {
+			statuses = append(statuses, status)
+		}
+
+		sort.Strings(statuses)
+
+		for _, status := range statuses {
+			report += underlineMarkup(escapeMarkup(status)) + formatItems(items[i].Items[status], false) + "\n"
+		}
+
+		truncated = truncated || items[i].Truncated
+		report += "\n"
+	}
+
+	if report == "" {
+		report = s.responses.AllItemsEmpty + "\n\n"
+	}
+
+	if truncated {
+		report += fmt.Sprintf(s.responses.AllItemsTruncated, allItemsMaxProjects, allItemsMaxItems)
+	}
+
+	return report
+}
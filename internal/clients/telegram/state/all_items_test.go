@@ -0,0 +1,115 @@
+package state_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// fakeGithubItems answers ViewerProjectsV2 with two projects and GetProjectItems with `items` of the requested project.
+func fakeGithubItems(t *testing.T, items map[string][]string) *statetest.GithubServer {
+	t.Helper()
+
+	return statetest.FakeGithubFuncs(t, map[string]statetest.AnswerFunc{
+		"ViewerProjectsV2": func(w http.ResponseWriter, _ *http.Request, _ statetest.GraphQLRequest) {
+			fmt.Fprint(w, `{"data": {"viewer": {"projectsV2": {"edges": [
+{"cursor": "MQ", "node": {"id": "PVT_1", "title": "Backend", "number": 1, "url": "https://github.com/p/1",
+	"creator": {"__typename": "User", "login": "octocat", "url": ""}}},
+{"cursor": "Mg", "node": {"id": "PVT_2", "title": "Frontend", "number": 2, "url": "https://github.com/p/2",
+	"creator": {"__typename": "User", "login": "octocat", "url": ""}}}
+]}}}}`)
+		},
+		"GetProjectItems": func(w http.ResponseWriter, _ *http.Request, request statetest.GraphQLRequest) {
+			var variables struct {
+				ID string `json:"id"`
+			}
+
+			if err := request.DecodeVariables(&variables); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+
+			nodes := make([]string, 0, len(items[variables.ID]))
+			for _, item := range items[variables.ID] {
+				status, title, _ := strings.Cut(item, ":")
+				nodes = append(nodes, fmt.Sprintf(`{
+"status": {"__typename": "ProjectV2ItemFieldSingleSelectValue", "name": %q},
+"assignedTo": {"__typename": "ProjectV2ItemFieldUserValue", "users": {"nodes": [{"isViewer": true}]}},
+"content": {"__typename": "DraftIssue", "title": %q}}`, status, title))
+			}
+
+			fmt.Fprintf(w, `{"data": {"node": {"__typename": "ProjectV2", "items": {"nodes": [%s],
+"pageInfo": {"endCursor": "", "hasNextPage": false}}}}}`, strings.Join(nodes, ","))
+		},
+	})
+}
+
+func TestAllItemsGroupsByProjectAndStatus(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubItems(t, map[string][]string{
+		"PVT_1": {"Todo:Write tests", "Done:Fix bug", "Todo:Review PR"},
+		"PVT_2": {"Done:Update styles"},
+	}).URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	report := sentText(t, rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/allItems")))
+
+	expected := `<b><a href="https://github.com/p/1">Backend</a></b>
+<u>Done</u>
+• Fix bug
+<u>Todo</u>
+• Write tests
+• Review PR
+
+<b><a href="https://github.com/p/2">Frontend</a></b>
+<u>Done</u>
+• Update styles
+
+`
+	if report != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, report)
+	}
+}
+
+func TestAllItemsWithoutItems(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubItems(t, map[string][]string{}).URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	report := sentText(t, rootHandlerWith(deps, userData).GroupTextMessage(ctx, groupText("/allItems")))
+	if strings.TrimSpace(report) != "nothing assigned" {
+		t.Fatalf("Expected the empty message, got %q", report)
+	}
+}
+
+func TestAllItemsEscapesTitles(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubItems(t, map[string][]string{
+		"PVT_1": {"Todo:A < B & <script>"},
+	}).URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	report := sentText(t, rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/allItems")))
+	if !strings.Contains(report, "• A &lt; B &amp; &lt;script&gt;\n") {
+		t.Fatalf("Expected the title to be escaped, got\n%s", report)
+	}
+}
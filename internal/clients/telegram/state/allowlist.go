@@ -0,0 +1,89 @@
+package state
+
+import (
+	"context"
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+)
+
+/*
+Allowlist limits who the bot serves, e.g. to one team. An update is served if its user is in Users or its chat is in
+Chats, so allowing a group chat allows everyone in it. If both are empty everyone is served.
+*/
+type Allowlist struct {
+	Users []update.UserID
+	Chats []update.ChatID
+}
+
+// allows is true if the update comes from an allowed user or chat.
+func (a Allowlist) allows(upd update.Update) bool {
+	if len(a.Users) == 0 && len(a.Chats) == 0 {
+		return true
+	}
+
+	if message, isSome := upd.Message.Unwrap(); isSome {
+		from, hasFrom := message.From.Unwrap()
+
+		return (hasFrom && a.allowsUser(from.ID)) || a.allowsChat(message.Chat.ID)
+	}
+
+	if callback, isSome := upd.CallbackQuery.Unwrap(); isSome {
+		message, hasMessage := callback.Message.Unwrap()
+
+		return a.allowsUser(callback.From.ID) || (hasMessage && a.allowsChat(message.Chat.ID))
+	}
+
+	return false
+}
+
+func (a Allowlist) allowsUser(id update.UserID) bool {
+	for _, allowed := range a.Users {
+		if allowed == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a Allowlist) allowsChat(id update.ChatID) bool {
+	for _, allowed := range a.Chats {
+		if allowed == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+denyNotAllowed replies with the NotAllowed response if the update is not from a user or chat in `allowlist`. In
+groups only commands get a reply, so that the bot doesn't answer every message of a chat it isn't meant for. Returns
+false if the update is allowed and should be handled.
+*/
+func denyNotAllowed(ctx context.Context, allowlist Allowlist, upd update.Update, state Handler, responses *Responses,
+) (Transition, bool) {
+	if allowlist.allows(upd) {
+		return Transition{}, false
+	}
+
+	logging.Infof("%s Not handled, the user or chat is not in the allowlist", upd.ID.Log())
+
+	transition := state.Ignore(ctx)
+
+	if message, isSome := upd.Message.Unwrap(); isSome && (message.Chat.Type == update.ChatTypePrivate ||
+		strings.HasPrefix(message.Text.UnwrapOr(""), "/")) {
+		transition.Actions = append(transition.Actions, response.NewSendMessage(message.Chat.ID,
+			responses.Root.NotAllowed))
+	}
+
+	if callback, isSome := upd.CallbackQuery.Unwrap(); isSome {
+		transition.Actions = append(transition.Actions, response.CallbackQueryAnswerNotification(callback.ID,
+			responses.Root.NotAllowed))
+	}
+
+	return transition, true
+}
@@ -0,0 +1,80 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// messageUpdate is `text` sent by testUserID in the chat `chat`.
+func messageUpdate(chat update.Chat, text string) update.Update {
+	return update.Update{ID: 1, CallbackQuery: option.None[update.CallbackQuery](), Message: option.Some(update.Message{
+		ID:         1,
+		From:       option.Some(update.User{ID: testUserID, FirstName: "Test"}),
+		SenderChat: option.None[update.Chat](),
+		Chat:       chat,
+		Text:       option.Some(text),
+	})}
+}
+
+func TestAllowlistServesAllowedUsersAndChats(t *testing.T) {
+	t.Parallel()
+
+	for name, allowlist := range map[string]state.Allowlist{
+		"empty": {Users: nil, Chats: nil},
+		"user":  {Users: []update.UserID{testUserID}, Chats: nil},
+		"chat":  {Users: nil, Chats: []update.ChatID{testChatID}},
+	} {
+		server := fakeGithubProjectPages(t, func(string, string) (bool, bool) { return false, false })
+		deps := githubDeps(server.URL)
+		deps.Allowlist = allowlist
+
+		userData := state.NewUserSharedData()
+		userData.GithubAPIKey = option.Some("key")
+
+		transition := state.Handle(context.Background(), *deps,
+			messageUpdate(update.Chat{ID: testChatID, Type: update.ChatTypePrivate}, "/listProjects"),
+			state.NewRootState(), userData, testResponses())
+
+		if len(server.Requests()) == 0 || sentText(t, transition) == "not allowed" {
+			t.Errorf("%s: /listProjects was not handled for an allowed user", name)
+		}
+	}
+}
+
+func TestAllowlistDeniesOthers(t *testing.T) {
+	t.Parallel()
+
+	server := fakeGithubProjectPages(t, func(string, string) (bool, bool) { return false, false })
+	deps := githubDeps(server.URL)
+	deps.Allowlist = state.Allowlist{
+		Users: []update.UserID{testUserID + 1},
+		Chats: []update.ChatID{testChatID + 1},
+	}
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := state.Handle(context.Background(), *deps,
+		messageUpdate(update.Chat{ID: testChatID, Type: update.ChatTypePrivate}, "/listProjects"), state.NewRootState(),
+		userData, testResponses())
+
+	if text := sentText(t, transition); text != "not allowed" {
+		t.Fatalf("Expected the denial, got %q", text)
+	}
+
+	if requests := server.Requests(); len(requests) != 0 {
+		t.Fatalf("GitHub was queried for a user that is not allowed: %q", requests)
+	}
+
+	// Not every message in a group is for the bot, only commands get the denial
+	chatter := messageUpdate(update.Chat{ID: testChatID, Type: update.ChatTypeGroup}, "hello")
+
+	transition = state.Handle(context.Background(), *deps, chatter, state.NewRootState(), userData, testResponses())
+	if len(transition.Actions) != 0 {
+		t.Fatalf("A group message that is not a command got %d actions", len(transition.Actions))
+	}
+}
@@ -0,0 +1,60 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/cache"
+)
+
+/*
+CallbackDedup remembers recently pressed buttons. Users often double tap buttons, and the second callback query would
+run the handler again on a state that the first one has already changed. Instead it is answered with `answer`.
+*/
+type CallbackDedup struct {
+	taps   *cache.Cache[string, struct{}]
+	ttl    time.Duration
+	answer string
+}
+
+// NewCallbackDedup creates a dedup where a tap on the same button within `ttl` counts as a repeated tap.
+func NewCallbackDedup(ttl time.Duration, answer string) *CallbackDedup {
+	return &CallbackDedup{taps: cache.New[string, struct{}](), ttl: ttl, answer: answer}
+}
+
+// PruneEvery forgets old taps every `interval` until the context is done. Run it in a goroutine.
+func (d *CallbackDedup) PruneEvery(ctx context.Context, interval time.Duration) {
+	d.taps.PruneEvery(ctx, interval)
+}
+
+/*
+isRepeated returns true if the same user has pressed the same button on the same message recently, or if the callback
+query itself was already received. The tap is remembered.
+*/
+func (d *CallbackDedup) isRepeated(cq update.CallbackQuery) bool {
+	tap := fmt.Sprintf("id:%s", cq.ID)
+	if message, isSome := cq.Message.Unwrap(); isSome {
+		tap = fmt.Sprintf("tap:%d:%d:%d:%s", cq.From.ID, message.Chat.ID, message.ID, cq.Data.UnwrapOr(""))
+	}
+
+	return !d.taps.Add(tap, struct{}{}, d.ttl)
+}
+
+/*
+answerRepeatedTap returns the answer to a repeated tap and true, or false if the callback query should be handled. The
+handler's state is kept as is.
+*/
+func answerRepeatedTap(ctx context.Context, dedup *CallbackDedup, cq update.CallbackQuery, state Handler,
+) (Transition, bool) {
+	if dedup == nil || !dedup.isRepeated(cq) {
+		return Transition{}, false
+	}
+
+	transition := state.Ignore(ctx)
+	transition.Actions = append(transition.Actions, response.CallbackQueryAnswerNotification(cq.ID, dedup.answer))
+
+	return transition, true
+}
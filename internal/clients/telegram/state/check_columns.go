@@ -0,0 +1,123 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
+)
+
+const (
+	checkColumnsCommand = "checkcolumns"
+	// statusFieldName is the field whose options are the columns of a project board. Items are sorted by it.
+	statusFieldName = "Status"
+)
+
+/*
+handleCheckColumns compares the columns of /reportConfig to the options of the project's Status field, because a
+column that doesn't exist (e.g. a typo) leaves its section of /dailyStatus empty without any error. Without a project ID
+the first default project of the chat is used, like in /fields.
+*/
+func (s *RootHandler) handleCheckColumns(ctx context.Context, updateID update.UpdateID, cmd slashcmd.Command,
+	chatID update.ChatID,
+) Transition {
+	var args struct {
+		ProjectID string `pos:"0"`
+	}
+
+	if err := slashcmd.Bind(cmd, &args); err != nil {
+		return s.replyWithMessage(chatID, s.responses.CheckColumnsUsage)
+	}
+
+	projectID := github.ProjectID(args.ProjectID)
+	if projectID == "" {
+		if len(s.DefaultProjects) == 0 {
+			return s.replyWithMessage(chatID, s.responses.CheckColumnsUsage)
+		}
+
+		projectID = s.DefaultProjects[0]
+	}
+
+	token, isSome := s.userData.GithubAPIKey.Unwrap()
+	if !isSome {
+		logging.Tracef("%s Tried to check the columns without adding an API key", updateID.Log())
+
+		return s.replyWithMessage(chatID, s.responses.NoAPIKeyAdded)
+	}
+
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	fields, err := s.deps.githubClient(token).ProjectFields(ctx, projectID)
+	if err != nil {
+		logging.Errorf("%s While getting fields for /checkColumns: %s", updateID.Log(), err)
+
+		return s.replyWithMessage(chatID,
+			projectErrorMessage(s.deps, err, s.responses.NotAProject, s.responses.GithubUnauthorized,
+				s.responses.GithubErrorGeneric))
+	}
+
+	statuses, hasStatus := statusOptions(fields)
+	if !hasStatus {
+		return s.replyWithMessage(chatID,
+			fmt.Sprintf(s.responses.CheckColumnsNoStatus, escapeMarkup(string(projectID))))
+	}
+
+	columns := s.ReportColumns.Or(s.deps.DailyStatusConfig.Columns)
+
+	return s.replyWithMessage(chatID, s.formatColumnCheck(projectID, columns, statuses))
+}
+
+// statusOptions returns the options of the single select Status field. False if the project has no such field.
+func statusOptions(fields []github.ProjectField) ([]string, bool) {
+	for _, field := range fields {
+		if field.Name == statusFieldName && field.DataType == "SINGLE_SELECT" {
+			return field.Options, true
+		}
+	}
+
+	return nil, false
+}
+
+/*
+formatColumnCheck lists each column of `columns` as found or missing in `statuses`. If any is missing the real columns
+are listed too, so the user can copy the right name into /reportConfig.
+*/
+func (s *RootHandler) formatColumnCheck(projectID github.ProjectID, columns ReportColumns, statuses []string) string {
+	isStatus := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		isStatus[status] = true
+	}
+
+	text := fmt.Sprintf(s.responses.CheckColumnsHeader, escapeMarkup(string(projectID)))
+	allFound := true
+
+	// The keys are the ones of /reportConfig
+	for _, mapping := range []struct{ key, column string }{
+		{"today", columns.Today},
+		{"tomorrow", columns.Tomorrow},
+		{"review", columns.InReview},
+	} {
+		if isStatus[mapping.column] {
+			text += "\n" + fmt.Sprintf(s.responses.CheckColumnsFound, mapping.key, escapeMarkup(mapping.column))
+		} else {
+			text += "\n" + fmt.Sprintf(s.responses.CheckColumnsMissing, mapping.key, escapeMarkup(mapping.column))
+			allFound = false
+		}
+	}
+
+	if allFound {
+		return text
+	}
+
+	options := make([]string, len(statuses))
+	for i, status := range statuses {
+		options[i] = response.Code(status)
+	}
+
+	return text + "\n\n" + fmt.Sprintf(s.responses.CheckColumnsOptions, strings.Join(options, ", "))
+}
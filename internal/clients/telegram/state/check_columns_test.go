@@ -0,0 +1,93 @@
+package state_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// fakeGithubFields answers ProjectFields with `fields`, a JSON array of field nodes.
+func fakeGithubFields(t *testing.T, fields string) *statetest.GithubServer {
+	t.Helper()
+
+	return statetest.FakeGithub(t, map[string]string{
+		"ProjectFields": fmt.Sprintf(`{"data": {"node": {"__typename": "ProjectV2", "fields": {"nodes": %s}}}}`,
+			fields),
+	})
+}
+
+func TestCheckColumnsListsMissingColumns(t *testing.T) {
+	t.Parallel()
+
+	server := fakeGithubFields(t, `[
+	{"__typename": "ProjectV2Field", "name": "Title", "dataType": "TITLE"},
+	{"__typename": "ProjectV2SingleSelectField", "name": "Status", "dataType": "SINGLE_SELECT",
+		"options": [{"name": "Done"}, {"name": "In progress"}, {"name": "In Review"}]}
+]`)
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	// The default columns have "In Progress" with a capital P
+	text := sentText(t, rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/checkColumns PVT_1")))
+
+	expected := `columns of PVT_1:
+found today=Done
+missing tomorrow=In Progress
+found review=In Review
+
+options: <code>Done</code>, <code>In progress</code>, <code>In Review</code>`
+	if text != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, text)
+	}
+}
+
+func TestCheckColumnsUsesChatConfig(t *testing.T) {
+	t.Parallel()
+
+	server := fakeGithubFields(t, `[
+	{"__typename": "ProjectV2SingleSelectField", "name": "Status", "dataType": "SINGLE_SELECT",
+		"options": [{"name": "Shipped"}, {"name": "In Progress"}, {"name": "In Review"}]}
+]`)
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+	root.ReportColumns.Today = "Shipped"
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	text := sentText(t, root.Handler(userData, testResponses(), deps).GroupTextMessage(ctx, groupText("/checkColumns")))
+
+	expected := `columns of PVT_1:
+found today=Shipped
+found tomorrow=In Progress
+found review=In Review`
+	if text != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, text)
+	}
+}
+
+func TestCheckColumnsWithoutStatus(t *testing.T) {
+	t.Parallel()
+
+	server := fakeGithubFields(t, `[{"__typename": "ProjectV2Field", "name": "Title", "dataType": "TITLE"}]`)
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	text := sentText(t, rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/checkColumns PVT_1")))
+	if text != "PVT_1 has no status" {
+		t.Fatalf("Expected that there is no Status field, got %q", text)
+	}
+}
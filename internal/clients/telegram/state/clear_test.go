@@ -0,0 +1,86 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// clearTestData is a user with an API key and a chat with a default project.
+func clearTestData() (state.RootState, state.UserSharedData) {
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+
+	return root, userData
+}
+
+func TestClearAsksToConfirm(t *testing.T) {
+	t.Parallel()
+
+	root, userData := clearTestData()
+
+	transition := root.Handler(userData, testResponses(), testDeps()).PrivateTextMessage(context.Background(), privateText("/clear"))
+
+	message := statetest.AssertSendsMessage(t, transition, testChatID, "are you sure")
+	if len(message.Buttons) != 1 || len(message.Buttons[0]) != 2 {
+		t.Fatalf("Expected confirm and cancel buttons, got %v", message.Buttons)
+	}
+
+	if transition.UserData.GithubAPIKey.IsNone() {
+		t.Fatal("/clear deleted the data before it was confirmed")
+	}
+}
+
+func TestClearConfirmed(t *testing.T) {
+	t.Parallel()
+
+	root, userData := clearTestData()
+	ctx := context.Background()
+
+	confirm := root.Handler(userData, testResponses(), testDeps()).PrivateTextMessage(ctx, privateText("/clear"))
+	button := statetest.DecodeActions(t, confirm)[0].Buttons[0][0]
+
+	transition := root.Handler(userData, testResponses(), testDeps()).CallbackQuery(ctx, callbackQuery(button))
+
+	statetest.AssertSendsMessage(t, transition, testChatID, "cleared")
+
+	if transition.UserData.GithubAPIKey.IsSome() {
+		t.Error("API key was not deleted")
+	}
+
+	if newRoot, is := transition.NewState.(state.RootState); !is || len(newRoot.DefaultProjects) != 0 {
+		t.Errorf("Chat state was not reset: %#v", transition.NewState)
+	}
+}
+
+func TestClearCanceled(t *testing.T) {
+	t.Parallel()
+
+	root, userData := clearTestData()
+	ctx := context.Background()
+
+	confirm := root.Handler(userData, testResponses(), testDeps()).PrivateTextMessage(ctx, privateText("/clear"))
+	button := statetest.DecodeActions(t, confirm)[0].Buttons[0][1]
+
+	transition := root.Handler(userData, testResponses(), testDeps()).CallbackQuery(ctx, callbackQuery(button))
+
+	statetest.AssertSendsMessage(t, transition, testChatID, "clear canceled")
+
+	if transition.UserData.GithubAPIKey.IsNone() {
+		t.Error("API key was deleted after cancel")
+	}
+}
+
+func TestClearInGroup(t *testing.T) {
+	t.Parallel()
+
+	transition := rootHandler(state.NewUserSharedData()).GroupTextMessage(context.Background(), groupText("/clear"))
+
+	statetest.AssertSendsMessage(t, transition, testChatID, "private only")
+}
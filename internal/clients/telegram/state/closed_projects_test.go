@@ -0,0 +1,87 @@
+package state_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// fakeGithubProjectList answers ViewerProjectsV2 with a project for each title. " (closed)" at the end closes it.
+func fakeGithubProjectList(t *testing.T, titles ...string) *statetest.GithubServer {
+	t.Helper()
+
+	edges := make([]string, len(titles))
+
+	for i, title := range titles {
+		title, isClosed := strings.CutSuffix(title, " (closed)")
+		edges[i] = fmt.Sprintf(`{"cursor": "c%d", "node": {"id": "PVT_%d", "title": %q, "number": %d, "url": "",
+"closed": %t, "creator": {"__typename": "User", "login": "octocat", "url": ""}}}`, i, i+1, title, i+1, isClosed)
+	}
+
+	return statetest.FakeGithub(t, map[string]string{
+		"ViewerProjectsV2": fmt.Sprintf(`{"data": {"viewer": {"projectsV2": {"edges": [%s]}}}}`,
+			strings.Join(edges, ",")),
+	})
+}
+
+func TestDailyStatusWithOnlyProjectClosed(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubProjectList(t, "Old <stuff> (closed)").URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/dailyStatus"))
+
+	if text := sentText(t, transition); text != "only project Old &lt;stuff&gt; is closed" {
+		t.Errorf("Expected the closed project message, got %q", text)
+	}
+
+	if root, is := transition.NewState.(state.RootState); !is || len(root.DefaultProjects) != 0 {
+		t.Errorf("Expected to stay in root without a default project, got %#v", transition.NewState)
+	}
+}
+
+func TestDailyStatusPicksTheOnlyOpenProject(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubProjectList(t, "Old (closed)", "Current", "Older (closed)").URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/dailyStatus"))
+
+	dailyStatus, is := transition.NewState.(state.DailyStatusState)
+	if !is {
+		t.Fatalf("Expected to start /dailyStatus, got %#v", transition.NewState)
+	}
+
+	if len(dailyStatus.DefaultProjects) != 1 || dailyStatus.DefaultProjects[0] != "PVT_2" {
+		t.Errorf("Expected the open project PVT_2 to be the default, got %v", dailyStatus.DefaultProjects)
+	}
+}
+
+func TestDailyStatusWithManyClosedProjectsAsksForDefault(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubProjectList(t, "Old (closed)", "Older (closed)").URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/dailyStatus"))
+
+	if _, is := transition.NewState.(state.RootState); !is {
+		t.Errorf("Expected to stay in root, got %#v", transition.NewState)
+	}
+}
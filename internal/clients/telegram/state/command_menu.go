@@ -0,0 +1,71 @@
+package state
+
+import (
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/template"
+)
+
+// commandMenuGroup is the template group with the descriptions of the commands in the Telegram command menu.
+const commandMenuGroup = "commandMenu"
+
+// CommandDescriptions are the descriptions of commands by their name in the registry. See LoadCommandDescriptions.
+type CommandDescriptions map[string]string
+
+/*
+LoadCommandDescriptions reads the descriptions for the command menu from the "commandMenu" group of the template. The
+keys are the names of the commands (e.g. dailyStatus), commands without a description are not in the menu. A template
+without the group has no menu.
+*/
+func (r *Responses) LoadCommandDescriptions(templ template.Template) {
+	r.CommandMenu = make(CommandDescriptions)
+
+	group, err := templ.Get(commandMenuGroup)
+	if err != nil {
+		return
+	}
+
+	for _, cmd := range commands() {
+		if description, err := group.Get(cmd.Name); err == nil {
+			r.CommandMenu[cmd.Name] = description
+		}
+	}
+}
+
+/*
+Menus returns the command menus to register with setMyCommands in the order of the registry. Every chat gets the menu
+with the commands that work anywhere, private chats get all commands. Returns nothing if there are no descriptions.
+*/
+func (d CommandDescriptions) Menus() []response.SetMyCommands {
+	if len(d) == 0 {
+		return nil
+	}
+
+	anywhere := response.SetMyCommands{
+		Commands: []response.BotCommand{},
+		Scope:    response.BotCommandScope{Type: response.CommandScopeDefault},
+	}
+	private := response.SetMyCommands{
+		Commands: []response.BotCommand{},
+		Scope:    response.BotCommandScope{Type: response.CommandScopeAllPrivateChats},
+	}
+
+	for _, cmd := range commands() {
+		description, hasDescription := d[cmd.Name]
+		if !hasDescription {
+			continue
+		}
+
+		// Telegram rejects uppercase names, commands are matched case insensitive anyway
+		menuCommand := response.BotCommand{Command: strings.ToLower(cmd.Name), Description: description}
+
+		private.Commands = append(private.Commands, menuCommand)
+
+		if cmd.Scope == anyChat {
+			anywhere.Commands = append(anywhere.Commands, menuCommand)
+		}
+	}
+
+	return []response.SetMyCommands{anywhere, private}
+}
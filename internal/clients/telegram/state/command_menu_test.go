@@ -0,0 +1,81 @@
+package state_test
+
+import (
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/template"
+)
+
+func TestCommandMenusByScope(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+templates:
+  commandMenu:
+    help: ["What I can do"]
+    dailyStatus: ["Write today's report"]
+    clear: ["Delete your data"]
+    notACommand: ["Ignored"]
+...
+`
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing yaml template: %s", err)
+	}
+
+	var responses state.Responses
+	responses.LoadCommandDescriptions(templ)
+
+	menus := responses.CommandMenu.Menus()
+	if len(menus) != 2 {
+		t.Fatalf("Expected 2 menus, got %+v", menus)
+	}
+
+	expected := map[string][]response.BotCommand{
+		response.CommandScopeDefault: {
+			{Command: "help", Description: "What I can do"},
+			{Command: "dailystatus", Description: "Write today's report"},
+		},
+		response.CommandScopeAllPrivateChats: {
+			{Command: "help", Description: "What I can do"},
+			{Command: "dailystatus", Description: "Write today's report"},
+			{Command: "clear", Description: "Delete your data"},
+		},
+	}
+
+	for _, menu := range menus {
+		commands := expected[menu.Scope.Type]
+		if len(commands) != len(menu.Commands) {
+			t.Errorf("Expected %+v in %s chats, got %+v", commands, menu.Scope.Type, menu.Commands)
+
+			continue
+		}
+
+		for i := range commands {
+			if commands[i] != menu.Commands[i] {
+				t.Errorf("Expected %+v in %s chats, got %+v", commands, menu.Scope.Type, menu.Commands)
+
+				break
+			}
+		}
+	}
+}
+
+func TestNoCommandMenuWithoutDescriptions(t *testing.T) {
+	t.Parallel()
+
+	templ, err := template.NewTemplate([]byte("---\ntemplates:\n  root:\n    help: [\"help\"]\n...\n"))
+	if err != nil {
+		t.Fatalf("While parsing yaml template: %s", err)
+	}
+
+	var responses state.Responses
+	responses.LoadCommandDescriptions(templ)
+
+	if menus := responses.CommandMenu.Menus(); menus != nil {
+		t.Errorf("Expected no menus, got %+v", menus)
+	}
+}
@@ -0,0 +1,230 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/m-kuzmin/daily-reporter/internal/util/fuzzy"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
+)
+
+// chatScope is where a command can be used
+type chatScope int
+
+const (
+	// anyChat commands work in private messages and groups
+	anyChat chatScope = iota
+	// privateOnly commands are answered with PrivateCommandUsed in groups
+	privateOnly
+)
+
+// command describes a slash command that RootHandler understands.
+type command struct {
+	// Name is how the command is shown to users. Commands are matched case insensitive.
+	Name string
+	// Scope is where the command can be used
+	Scope chatScope
+	// SecretArgs is true if the arguments must not be sent in groups (e.g. API keys)
+	SecretArgs bool
+	// StartPayload is set for privateOnly commands that a group reply can link to. "/start StartPayload" opens them.
+	StartPayload string
+	// Aliases are other names of the command. More can be added in the config, see NewCommandAliases.
+	Aliases []string
+}
+
+// commands is the registry of commands that can be used in RootHandler.
+func commands() []command {
+	return []command{
+		{Name: "start", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "help", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{
+			Name: "dailyStatus", Scope: anyChat, SecretArgs: false, StartPayload: "",
+			Aliases: []string{"status"},
+		},
+		{Name: "addApiKey", Scope: privateOnly, SecretArgs: true, StartPayload: addAPIKeyStartPayload, Aliases: nil},
+		{Name: "removeApiKey", Scope: privateOnly, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{
+			Name: "listProjects", Scope: privateOnly, SecretArgs: false, StartPayload: "",
+			Aliases: []string{"projects"},
+		},
+		{Name: "setDefaultProject", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "addDefaultProject", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "pickDefaultProject", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "allItems", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "fields", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "checkColumns", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "createDraft", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "reviewers", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "reportConfig", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "reportTemplate", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "settings", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "retry", Scope: anyChat, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "clear", Scope: privateOnly, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "errors", Scope: privateOnly, SecretArgs: false, StartPayload: "", Aliases: nil},
+		{Name: "debug", Scope: privateOnly, SecretArgs: false, StartPayload: "", Aliases: nil},
+	}
+}
+
+/*
+lookupStartPayload finds the command that "/start `payload`" opens. Payloads are matched exactly, because Telegram only
+sends what was in the link.
+*/
+func lookupStartPayload(payload string) (command, bool) {
+	for _, cmd := range commands() {
+		if cmd.StartPayload != "" && cmd.StartPayload == payload {
+			return cmd, true
+		}
+	}
+
+	return command{}, false //nolint:exhaustruct // Not found
+}
+
+// lookupCommand finds a command in the registry by its name or one of its aliases, ignoring the case of `method`.
+func lookupCommand(method string) (command, bool) {
+	for _, cmd := range commands() {
+		if strings.EqualFold(cmd.Name, method) {
+			return cmd, true
+		}
+
+		for _, alias := range cmd.Aliases {
+			if strings.EqualFold(alias, method) {
+				return cmd, true
+			}
+		}
+	}
+
+	return command{}, false //nolint:exhaustruct // Not found
+}
+
+// CommandAliases are aliases added in the config. Keys are lowercase aliases, values are names of the commands.
+type CommandAliases map[string]string
+
+/*
+NewCommandAliases checks the aliases from the config, which map an alias to the command it stands for, e.g.
+{"ds": "dailyStatus"}. An alias can't have the name of another command or alias. Commands with SecretArgs can't get new
+aliases, so that their messages are always recognized by HasSecret.
+*/
+func NewCommandAliases(aliases map[string]string) (CommandAliases, error) {
+	checked := make(CommandAliases, len(aliases))
+
+	for alias, target := range aliases {
+		if taken, isTaken := lookupCommand(alias); isTaken {
+			return nil, AliasTakenError{Alias: alias, Command: taken.Name}
+		}
+
+		if _, isDuplicate := checked[strings.ToLower(alias)]; isDuplicate {
+			return nil, AliasTakenError{Alias: alias, Command: checked[strings.ToLower(alias)]}
+		}
+
+		cmd, isKnown := lookupCommand(target)
+		if !isKnown {
+			return nil, UnknownAliasTargetError{Alias: alias, Command: target}
+		}
+
+		if cmd.SecretArgs {
+			return nil, SecretAliasError{Alias: alias, Command: cmd.Name}
+		}
+
+		checked[strings.ToLower(alias)] = cmd.Name
+	}
+
+	return checked, nil
+}
+
+// resolveAlias replaces an alias in `cmd` with the name of the command, so it goes to the same handler.
+func resolveAlias(aliases CommandAliases, cmd slashcmd.Command) slashcmd.Command {
+	name, isAlias := aliases[strings.ToLower(cmd.Method)]
+	if !isAlias {
+		known, isKnown := lookupCommand(cmd.Method)
+		if !isKnown || strings.EqualFold(known.Name, cmd.Method) {
+			return cmd
+		}
+
+		name = known.Name
+	}
+
+	logging.Tracef("/%s is an alias of /%s", cmd.Method, name)
+
+	return slashcmd.Command{Method: name, Args: cmd.Args}
+}
+
+/*
+suggestCommand finds a known command that `method` is a typo of. Short commands can have 1 typo and longer ones 2, so
+that unrelated words are not suggested.
+*/
+func suggestCommand(method string) (command, bool) {
+	const (
+		longCommand  = 6
+		typosInShort = 1
+		typosInLong  = 2
+	)
+
+	maxTypos := typosInShort
+	if utf8.RuneCountInString(method) >= longCommand {
+		maxTypos = typosInLong
+	}
+
+	var (
+		closest  command
+		distance = maxTypos + 1
+	)
+
+	for _, cmd := range commands() {
+		if d := fuzzy.Levenshtein(strings.ToLower(method), strings.ToLower(cmd.Name)); d < distance {
+			closest, distance = cmd, d
+		}
+	}
+
+	return closest, distance <= maxTypos
+}
+
+/*
+HasSecret returns true if a message with `text` sent in the `conversation` contains a secret (e.g. an API key), so it
+must not be logged or stored anywhere.
+*/
+func HasSecret(conversation State, text string) bool {
+	if _, isAddingKey := conversation.(AddAPIKeyState); isAddingKey {
+		return true
+	}
+
+	cmd, isCmd := slashcmd.Parse(text)
+	if !isCmd {
+		return false
+	}
+
+	known, isKnown := lookupCommand(cmd.Method)
+
+	return isKnown && known.SecretArgs && len(cmd.Args) != 0
+}
+
+// AliasTakenError is returned by NewCommandAliases if an alias is already the name or an alias of a command.
+type AliasTakenError struct {
+	Alias   string
+	Command string
+}
+
+func (e AliasTakenError) Error() string {
+	return fmt.Sprintf("alias %q is already taken by /%s", e.Alias, e.Command)
+}
+
+// UnknownAliasTargetError is returned by NewCommandAliases if an alias is for a command that doesn't exist.
+type UnknownAliasTargetError struct {
+	Alias   string
+	Command string
+}
+
+func (e UnknownAliasTargetError) Error() string {
+	return fmt.Sprintf("alias %q is for an unknown command /%s", e.Alias, e.Command)
+}
+
+// SecretAliasError is returned by NewCommandAliases if an alias is for a command with SecretArgs.
+type SecretAliasError struct {
+	Alias   string
+	Command string
+}
+
+func (e SecretAliasError) Error() string {
+	return fmt.Sprintf("alias %q can't be added: /%s has secret arguments", e.Alias, e.Command)
+}
@@ -0,0 +1,144 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestUnknownCommandSuggestsClosest(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"/dailstatus":   "did you mean /dailyStatus",
+		"/DialyStatus":  "did you mean /dailyStatus",
+		"/listproject":  "did you mean /listProjects",
+		"/hlp":          "did you mean /help",
+		"/addapikye":    "did you mean /addApiKey",
+		"/reportconfg":  "did you mean /reportConfig",
+		"/weather":      "unknown",
+		"/hi":           "unknown",
+		"/projectslist": "unknown",
+	}
+
+	for text, expected := range cases {
+		transition := rootHandler(state.NewUserSharedData()).PrivateTextMessage(context.Background(), privateText(text))
+
+		if reply := sentText(t, transition); reply != expected {
+			t.Errorf("%s: expected %q, got %q", text, expected, reply)
+		}
+	}
+}
+
+func TestPrivateOnlyCommandsInGroup(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"/addApiKey":            "private only",
+		"/ADDAPIKEY":            "private only",
+		"/addApiKey ghp_12345":  "key leaked",
+		"/listProjects":         "private only",
+		"/listProjects after X": "private only",
+		"/clear":                "private only",
+	}
+
+	for text, expected := range cases {
+		userData := state.NewUserSharedData()
+		userData.GithubAPIKey = option.Some("key")
+
+		transition := rootHandler(userData).GroupTextMessage(context.Background(), groupText(text))
+
+		if reply := sentText(t, transition); reply != expected {
+			t.Errorf("%s: expected %q, got %q", text, expected, reply)
+		}
+
+		if key, _ := transition.UserData.GithubAPIKey.Unwrap(); key != "key" {
+			t.Errorf("%s: handler has changed the API key to %q", text, key)
+		}
+
+		if _, isRoot := transition.NewState.(state.RootState); !isRoot {
+			t.Errorf("%s: handler has changed the state to %T", text, transition.NewState)
+		}
+	}
+}
+
+func TestHasSecret(t *testing.T) {
+	t.Parallel()
+
+	root := state.NewRootState()
+	cases := []struct {
+		conversation state.State
+		text         string
+		expected     bool
+	}{
+		{root, "/addApiKey ghp_secret", true},
+		{root, "/ADDAPIKEY ghp_secret", true},
+		{root, "/addApiKey", false},
+		{root, "/help ghp_secret", false},
+		{root, "hello", false},
+		{state.AddAPIKeyState{RootState: root}, "ghp_secret", true},
+	}
+
+	for _, c := range cases {
+		if actual := state.HasSecret(c.conversation, c.text); actual != c.expected {
+			t.Errorf("HasSecret(%T, %q) is %t", c.conversation, c.text, actual)
+		}
+	}
+}
+
+func TestAliasesReachTheCommand(t *testing.T) {
+	t.Parallel()
+
+	aliases, err := state.NewCommandAliases(map[string]string{"DS": "dailystatus"})
+	if err != nil {
+		t.Fatalf("Aliases were not accepted: %s", err)
+	}
+
+	ctx := context.Background()
+	deps := testDeps()
+	deps.CommandAliases = aliases
+
+	for _, text := range []string{"/dailyStatus date today", "/status date today", "/ds date today"} {
+		transition := rootHandlerWith(deps, state.NewUserSharedData()).PrivateTextMessage(ctx, privateText(text))
+
+		if reply := sentText(t, transition); reply != "no api key" {
+			t.Errorf("%s: expected the /dailyStatus reply, got %q", text, reply)
+		}
+	}
+
+	transition := rootHandlerWith(deps, state.NewUserSharedData()).GroupTextMessage(ctx, groupText("/projects"))
+	if reply := sentText(t, transition); reply != "private only" {
+		t.Errorf("/projects in a group: expected the /listProjects reply, got %q", reply)
+	}
+}
+
+func TestNewCommandAliasesErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		aliases  map[string]string
+		expected error
+	}{
+		"command name": {map[string]string{"Help": "dailyStatus"}, state.AliasTakenError{Alias: "Help", Command: "help"}},
+		"builtin alias": {
+			map[string]string{"status": "help"},
+			state.AliasTakenError{Alias: "status", Command: "dailyStatus"},
+		},
+		"unknown command": {
+			map[string]string{"w": "weather"},
+			state.UnknownAliasTargetError{Alias: "w", Command: "weather"},
+		},
+		"secret args": {
+			map[string]string{"key": "addApiKey"},
+			state.SecretAliasError{Alias: "key", Command: "addApiKey"},
+		},
+	}
+
+	for name, c := range cases {
+		if _, err := state.NewCommandAliases(c.aliases); err != c.expected { //nolint:errorlint // Comparing values
+			t.Errorf("%s: expected %v, got %v", name, c.expected, err)
+		}
+	}
+}
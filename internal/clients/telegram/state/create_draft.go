@@ -0,0 +1,176 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
+)
+
+const createDraftCommand = "createdraft"
+
+/*
+handleCreateDraft asks for the title of a draft issue and transitions into CreateDraftState. The draft is added to the
+first default project of the chat.
+*/
+func (s *RootHandler) handleCreateDraft(updateID update.UpdateID, user update.User, chatID update.ChatID) Transition {
+	if s.userData.GithubAPIKey.IsNone() {
+		logging.Debugf("%s %s /createDraft used without GitHub API key", updateID.Log(), user.Log())
+
+		return s.replyWithMessage(chatID, s.responses.NoAPIKeyAdded)
+	}
+
+	if len(s.DefaultProjects) == 0 {
+		return s.replyWithMessage(chatID, s.responses.NoDefaultProject)
+	}
+
+	logging.Tracef("%s Transition into CreateDraftState", updateID.Log())
+
+	return Transit(NewCreateDraftState(s.RootState), s.userData).Reply(chatID, s.responses.CreateDraft).Build()
+}
+
+type CreateDraftHandler struct {
+	responses *CreateDraftResponses
+	userData  UserSharedData
+	deps      *Deps
+	CreateDraftState
+}
+
+func (s *CreateDraftHandler) GroupTextMessage(ctx context.Context, message update.GroupTextMessage) Transition {
+	return s.handleCreateDraft(ctx, message.UpdateID, message.Chat.ID, message.Text)
+}
+
+func (s *CreateDraftHandler) PrivateTextMessage(ctx context.Context, message update.PrivateTextMessage) Transition {
+	return s.handleCreateDraft(ctx, message.UpdateID, message.Chat.ID, message.Text)
+}
+
+func (s *CreateDraftHandler) CallbackQuery(_ context.Context, callback update.CallbackQuery) Transition {
+	return Transit(s.CreateDraftState, s.userData).
+		Action(response.CallbackQueryAnswerNotification(callback.ID,
+			"This button doesnt work. Use /cancel to quit /createDraft.")).
+		Build()
+}
+
+func (s *CreateDraftHandler) Ignore(_ context.Context) Transition {
+	return Transit(s.CreateDraftState, s.userData).Build()
+}
+
+func (s *CreateDraftHandler) Unwind(_ context.Context, _ update.ChatID) Transition {
+	return Transit(s.CreateDraftState, s.userData).Build()
+}
+
+// handleCreateDraft records the title, then the body, and creates the draft once both are known.
+func (s *CreateDraftHandler) handleCreateDraft(ctx context.Context, updateID update.UpdateID, chatID update.ChatID,
+	text string,
+) Transition {
+	cmd, isCmd := slashcmd.Parse(text)
+
+	if isCmd && strings.ToLower(cmd.Method) == cancelCommand {
+		return Transit(s.RootState, s.userData).Reply(chatID, "Canceled.").Build()
+	}
+
+	switch s.Stage {
+	case titleCreateDraftStage:
+		if strings.TrimSpace(text) == "" || isCmd {
+			return Transit(s.CreateDraftState, s.userData).Reply(chatID, s.responses.Title).Build()
+		}
+
+		s.Title = text
+		s.Stage = bodyCreateDraftStage
+
+		return Transit(s.CreateDraftState, s.userData).Reply(chatID, s.responses.Body).Build()
+
+	case bodyCreateDraftStage:
+		body := text
+		if isCmd && strings.ToLower(cmd.Method) == noneCommand {
+			body = ""
+		}
+
+		return s.createDraft(ctx, updateID, chatID, body)
+	}
+
+	return s.Ignore(ctx)
+}
+
+// createDraft adds the draft to the first default project and returns to RootState.
+func (s *CreateDraftHandler) createDraft(ctx context.Context, updateID update.UpdateID, chatID update.ChatID,
+	body string,
+) Transition {
+	apiKey, isSome := s.userData.GithubAPIKey.Unwrap()
+	if !isSome {
+		return Transit(s.RootState, s.userData).Reply(chatID, s.responses.NoAPIKeyAdded).Build()
+	}
+
+	if len(s.DefaultProjects) == 0 {
+		return Transit(s.RootState, s.userData).Reply(chatID, s.responses.NoDefaultProject).Build()
+	}
+
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	item, err := s.deps.githubClient(apiKey).CreateDraftIssue(ctx, s.DefaultProjects[0], s.Title, body)
+	if err != nil {
+		logging.Errorf("%s While creating a draft issue for /createDraft: %s", updateID.Log(), err)
+
+		var abuse github.AbuseDetectionError
+		if errors.As(err, &abuse) {
+			s.deps.recordError(ErrorSourceGithub, err)
+
+			return Transit(s.RootState, s.userData).Reply(chatID, s.responses.SlowDown).Build()
+		}
+
+		message := githubErrorMessage(s.deps, err, s.responses.GithubUnauthorized, s.responses.GithubErrorGeneric)
+
+		return Transit(s.RootState, s.userData).Reply(chatID, message).Build()
+	}
+
+	return Transit(s.RootState, s.userData).
+		Reply(chatID, fmt.Sprintf(s.responses.Created, escapeMarkup(item.Content.Title))).
+		Build()
+}
+
+// CreateDraftState asks for the title and the body of a draft issue to add to the default project.
+type CreateDraftState struct {
+	Stage createDraftStage
+	Title string
+	RootState
+}
+
+func NewCreateDraftState(root RootState) CreateDraftState {
+	return CreateDraftState{Stage: titleCreateDraftStage, Title: "", RootState: root}
+}
+
+// createDraftStage is saved as a number by EncodeState, new stages must be added at the end.
+type createDraftStage int
+
+const (
+	titleCreateDraftStage createDraftStage = iota
+	bodyCreateDraftStage
+)
+
+func (s CreateDraftState) Handler(userData UserSharedData, responses *Responses, deps *Deps) Handler {
+	return &CreateDraftHandler{
+		responses:        &responses.CreateDraft,
+		userData:         userData,
+		deps:             deps,
+		CreateDraftState: s,
+	}
+}
+
+type CreateDraftResponses struct {
+	Title   string `template:"title"`
+	Body    string `template:"body"`
+	Created string `template:"created"`
+
+	NoAPIKeyAdded      string `template:"noApiKeyAdded"`
+	NoDefaultProject   string `template:"noDefaultProject"`
+	GithubErrorGeneric string `template:"githubErrorGeneric"`
+	GithubUnauthorized string `template:"githubUnauthorized"`
+	// SlowDown is sent when GitHub's abuse detection still rejects the draft after waiting
+	SlowDown string `template:"slowDown"`
+}
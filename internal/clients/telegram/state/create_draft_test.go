@@ -0,0 +1,185 @@
+package state_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// draftRequest is what the fake GitHub got in AddProjectV2DraftIssue.
+type draftRequest struct {
+	ProjectID string `json:"projectId"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+}
+
+// fakeGithubDrafts answers AddProjectV2DraftIssue with the requested draft and sends the request to the channel.
+func fakeGithubDrafts(t *testing.T) (*statetest.GithubServer, <-chan draftRequest) {
+	t.Helper()
+
+	requests := make(chan draftRequest, 1)
+
+	server := statetest.FakeGithubFuncs(t, map[string]statetest.AnswerFunc{
+		"AddProjectV2DraftIssue": func(w http.ResponseWriter, _ *http.Request, request statetest.GraphQLRequest) {
+			var draft draftRequest
+
+			if err := request.DecodeVariables(&draft); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+
+			requests <- draft
+
+			fmt.Fprintf(w, `{"data": {"addProjectV2DraftIssue": {"projectItem": {"content": {"__typename": "DraftIssue",
+"title": %q}}}}}`, draft.Title)
+		},
+	})
+
+	return server, requests
+}
+
+// createDraftUser is user data with an API key and a root state with a default project.
+func createDraftUser() (state.RootState, state.UserSharedData) {
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	return root, userData
+}
+
+func TestCreateDraft(t *testing.T) {
+	t.Parallel()
+
+	server, requests := fakeGithubDrafts(t)
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	root, userData := createDraftUser()
+
+	transition := root.Handler(userData, testResponses(), deps).GroupTextMessage(ctx, groupText("/createDraft"))
+	if text := sentText(t, transition); text != "title?" {
+		t.Fatalf("Expected to be asked for the title, got %q", text)
+	}
+
+	// Blank titles are asked for again
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		GroupTextMessage(ctx, groupText("  "))
+	if text := sentText(t, transition); text != "title?" {
+		t.Fatalf("Expected to be asked for the title again, got %q", text)
+	}
+
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		GroupTextMessage(ctx, groupText("Fix <the> bug"))
+	if text := sentText(t, transition); text != "body?" {
+		t.Fatalf("Expected to be asked for the body, got %q", text)
+	}
+
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		GroupTextMessage(ctx, groupText("It crashes"))
+	if text := sentText(t, transition); text != "created Fix &lt;the&gt; bug" {
+		t.Errorf("Expected the created draft, got %q", text)
+	}
+
+	if request := <-requests; request != (draftRequest{ProjectID: "PVT_1", Title: "Fix <the> bug", Body: "It crashes"}) {
+		t.Errorf("Wrong draft was created: %+v", request)
+	}
+
+	if _, isRoot := transition.NewState.(state.RootState); !isRoot {
+		t.Errorf("Expected to return to RootState, got %T", transition.NewState)
+	}
+}
+
+func TestCreateDraftWithoutBody(t *testing.T) {
+	t.Parallel()
+
+	server, requests := fakeGithubDrafts(t)
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	root, userData := createDraftUser()
+
+	transition := state.NewCreateDraftState(root).Handler(userData, testResponses(), deps).
+		PrivateTextMessage(ctx, privateText("Write docs"))
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		PrivateTextMessage(ctx, privateText("/none"))
+
+	if text := sentText(t, transition); text != "created Write docs" {
+		t.Errorf("Expected the created draft, got %q", text)
+	}
+
+	if request := <-requests; request.Body != "" {
+		t.Errorf("Expected no body, got %q", request.Body)
+	}
+}
+
+func TestCreateDraftCanceled(t *testing.T) {
+	t.Parallel()
+
+	root, userData := createDraftUser()
+
+	transition := state.NewCreateDraftState(root).Handler(userData, testResponses(), testDeps()).
+		PrivateTextMessage(context.Background(), privateText("/cancel"))
+
+	if text := sentText(t, transition); text != "Canceled." {
+		t.Errorf("Expected the cancel message, got %q", text)
+	}
+
+	if _, isRoot := transition.NewState.(state.RootState); !isRoot {
+		t.Errorf("Expected to return to RootState, got %T", transition.NewState)
+	}
+}
+
+func TestCreateDraftNeedsKeyAndDefaultProject(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	if text := sentText(t, rootHandler(state.NewUserSharedData()).PrivateTextMessage(ctx,
+		privateText("/createDraft"))); text != "no api key" {
+		t.Errorf("Expected the no API key message, got %q", text)
+	}
+
+	_, userData := createDraftUser()
+
+	transition := rootHandler(userData).PrivateTextMessage(ctx, privateText("/createDraft"))
+	if text := sentText(t, transition); text != "no default project" {
+		t.Errorf("Expected the no default project message, got %q", text)
+	}
+
+	if _, isRoot := transition.NewState.(state.RootState); !isRoot {
+		t.Errorf("Expected to stay in RootState, got %T", transition.NewState)
+	}
+}
+
+func TestCreateDraftWhenGithubAsksToSlowDown(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "You have exceeded a secondary rate limit. Content was submitted too quickly."}`)
+	}))
+	t.Cleanup(server.Close)
+
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+	root, userData := createDraftUser()
+
+	transition := state.NewCreateDraftState(root).Handler(userData, testResponses(), deps).
+		PrivateTextMessage(ctx, privateText("Write docs"))
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		PrivateTextMessage(ctx, privateText("/none"))
+
+	if text := sentText(t, transition); text != "slow down" {
+		t.Errorf("Expected to be told to slow down, got %q", text)
+	}
+}
@@ -3,22 +3,32 @@ package state
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
 	"github.com/m-kuzmin/daily-reporter/internal/util/option"
 	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
 	"github.com/pkg/errors"
 )
 
-const dailyStatusItemLimit = 100
+const (
+	// dailyStatusPageSize is how many project items are requested at once when making a report.
+	dailyStatusPageSize = 100
+	// reportFileName is the name of the file that is sent instead of a report that doesn't fit into a message
+	reportFileName = "daily-report.html"
+	// reportMarkdownFileName is reportFileName when the bot uses MarkdownV2, the file has the markup as it is
+	reportMarkdownFileName = "daily-report.md"
+)
 
 type DailyStatusHandler struct {
 	responses *DailyStatusResponses
 	userData  UserSharedData
+	deps      *Deps
 	DailyStatusState
 }
 
@@ -31,13 +41,26 @@ func (s *DailyStatusHandler) PrivateTextMessage(ctx context.Context, message upd
 }
 
 func (s *DailyStatusHandler) CallbackQuery(_ context.Context, callback update.CallbackQuery) Transition {
-	return NewTransition(s.DailyStatusState, s.userData, []response.BotAction{
-		response.CallbackQueryAnswerNotification(callback.ID, "This button doesnt work. Use /cancel to quit /dailyStatus."),
-	})
+	return Transit(s.DailyStatusState, s.userData).
+		Action(response.CallbackQueryAnswerNotification(callback.ID,
+			"This button doesnt work. Use /cancel to quit /dailyStatus.")).
+		Build()
 }
 
 func (s *DailyStatusHandler) Ignore(_ context.Context) Transition {
-	return NewTransition(s.DailyStatusState, s.userData, response.Nothing())
+	return Transit(s.DailyStatusState, s.userData).Build()
+}
+
+/*
+Unwind cancels the report, because the answers would be lost in the restart. If the states are kept in a store (see
+Deps.KeepsStates) the report is left as it is, the user can answer the next question after the restart.
+*/
+func (s *DailyStatusHandler) Unwind(_ context.Context, chatID update.ChatID) Transition {
+	if s.deps.KeepsStates {
+		return Transit(s.DailyStatusState, s.userData).Build()
+	}
+
+	return Transit(s.RootState, s.userData).Reply(chatID, s.responses.Restarting).Build()
 }
 
 //nolint:cyclop // Splitting this into separate functions would just obscure the side-effects even more.
@@ -45,16 +68,16 @@ func (s *DailyStatusHandler) handleDailyStatus(ctx context.Context, chatID updat
 	cmd, isCmd := slashcmd.Parse(text)
 
 	if isCmd && strings.ToLower(cmd.Method) == cancelCommand {
-		return NewTransition(s.RootState, s.userData, []response.BotAction{
-			response.NewSendMessage(chatID, "Canceled."),
-		})
+		return Transit(s.RootState, s.userData).Reply(chatID, "Canceled.").Build()
 	}
 
 	apiKey, isSome := s.userData.GithubAPIKey.Unwrap()
 	if !isSome {
-		return NewTransition(s.RootState, s.userData, []response.BotAction{
-			response.NewSendMessage(chatID, s.responses.NoAPIKeyAdded),
-		})
+		return Transit(s.RootState, s.userData).Reply(chatID, s.responses.NoAPIKeyAdded).Build()
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return s.repromptStage(ctx, chatID)
 	}
 
 	switch s.Stage {
@@ -67,11 +90,7 @@ func (s *DailyStatusHandler) handleDailyStatus(ctx context.Context, chatID updat
 			s.DiscoveryOfTheDay = option.Some(text)
 		}
 
-		return NewTransition(s.DailyStatusState, s.userData, []response.BotAction{
-			response.NewSendMessage(chatID,
-				s.responses.QuestionsAndBlockers,
-			),
-		})
+		return Transit(s.DailyStatusState, s.userData).Reply(chatID, s.responses.QuestionsAndBlockers).Build()
 
 	case questionsAndBlockersDailyStatusStage:
 		if isCmd && strings.ToLower(cmd.Method) == noneCommand {
@@ -80,59 +99,178 @@ func (s *DailyStatusHandler) handleDailyStatus(ctx context.Context, chatID updat
 			s.QuestionsAndBlockers = option.Some(text)
 		}
 
-		defaultProject, isSome := s.DefaultProject.Unwrap()
-		if !isSome {
-			return NewTransition(s.RootState, s.userData, []response.BotAction{
-				response.NewSendMessage(chatID, s.responses.UseSetDefaultProject),
-			})
+		if len(s.DefaultProjects) == 0 {
+			return Transit(s.RootState, s.userData).Reply(chatID, s.responses.UseSetDefaultProject).Build()
 		}
 
-		report, err := s.generateReport(ctx, apiKey, defaultProject)
+		s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+		report, meta, err := s.generateReport(ctx, apiKey, s.DefaultProjects)
 		if err != nil {
-			report = github.GqlErrorStringOr("GitHub API error: %s", err, s.responses.GithubErrorGeneric)
+			return Transit(s.RootState, s.userData).
+				Reply(chatID, githubErrorMessage(s.deps, err, s.responses.GithubUnauthorized,
+					s.responses.GithubErrorGeneric)).
+				Build()
 		}
 
-		return NewTransition(s.RootState, s.userData, []response.BotAction{
-			response.NewSendMessage(chatID, report),
-		})
+		logging.Debugf("(ChatID %d) Report generated: %+v", chatID, meta)
+
+		s.userData.Reports = s.userData.Reports.Add(report, time.Now())
+
+		return Transit(s.RootState, s.userData).
+			Action(s.reportAction(chatID, report)).
+			Build()
+	}
+
+	return s.Ignore(ctx)
+}
+
+/*
+repromptStage asks the question of the current stage again. Blank messages are not recorded as answers, because they
+are usually sent by accident. /none is the way to leave a section out of the report.
+*/
+func (s *DailyStatusHandler) repromptStage(ctx context.Context, chatID update.ChatID) Transition {
+	switch s.Stage {
+	case discoveryOfTheDayDailyStatusStage:
+		return Transit(s.DailyStatusState, s.userData).Reply(chatID, s.responses.DiscoveryOfTheDay).Build()
+	case questionsAndBlockersDailyStatusStage:
+		return Transit(s.DailyStatusState, s.userData).Reply(chatID, s.responses.QuestionsAndBlockers).Build()
 	}
 
 	return s.Ignore(ctx)
 }
 
-func (s *DailyStatusHandler) generateReport(ctx context.Context, apiKey string, projectID github.ProjectID,
-) (string, error) {
-	items, err := github.NewClient(apiKey).ListViewerProjectV2Items(ctx, projectID, dailyStatusItemLimit,
-		option.None[github.ProjectCursor]())
+/*
+reportAction sends the report as a message, or as an HTML page if it's too long for one. The page keeps the line breaks
+and links of the report, so it can be opened in a browser and copied from there. With MarkdownV2 the file has the
+report as it is.
+*/
+func (s *DailyStatusHandler) reportAction(chatID update.ChatID, report string) response.BotAction {
+	if response.MessageLength(report) <= response.MaxMessageLength {
+		return response.NewSendMessage(chatID, report)
+	}
+
+	if response.DefaultParseMode() == response.ParseModeMarkdownV2 {
+		return response.NewSendDocument(chatID, reportMarkdownFileName, []byte(report), s.responses.ReportAsFile)
+	}
+
+	page := `<html><head><meta charset="utf-8"></head><body style="white-space: pre-wrap">` + report + "</body></html>"
+
+	return response.NewSendDocument(chatID, reportFileName, []byte(page), s.responses.ReportAsFile)
+}
+
+/*
+generateReport creates a report from items in all `projectIDs`. Items that are in many projects are listed once. The
+meta describes what is in the report, so callers don't have to parse it.
+*/
+func (s *DailyStatusHandler) generateReport(ctx context.Context, apiKey string, projectIDs []github.ProjectID,
+) (string, ReportMeta, error) {
+	items, err := s.deps.githubClient(apiKey).
+		ViewerItemsInProjects(ctx, projectIDs, dailyStatusPageSize, s.deps.ReportConcurrency)
 	if err != nil {
-		return "", errors.WithMessage(err, "while getting user's project v2 items")
+		return "", ReportMeta{}, errors.WithMessage(err, "while getting user's project v2 items")
 	}
 
-	const listSep = "\n• "
+	reportTemplate := s.responses.Templates.Pick(s.userData.ReportTemplates, projectIDs)
+
+	report, meta := s.formatReport(s.responses, reportTemplate, s.deps.DailyStatusConfig, items)
+
+	return report, meta, nil
+}
+
+// ReportMeta is a summary of what a report has in it.
+type ReportMeta struct {
+	// HasBlockers is true if the report has the questions and blockers section
+	HasBlockers bool
+	// HasDiscovery is true if the report has the discovery of the day section
+	HasDiscovery bool
+	// InReviewCount is the number of items in the review column
+	InReviewCount int
+	// DoneCount is the number of items in the "today" column
+	DoneCount int
+	// InProgressCount is the number of items in the "tomorrow" column
+	InProgressCount int
+}
+
+/*
+formatReport puts `items` into report sections (see reportSections) using the columns configured for this chat, or in
+`config` for the columns the chat hasn't changed, and renders them. The sections are titled by `reportTemplate`.
+*/
+func (s DailyStatusState) formatReport(responses *DailyStatusResponses, reportTemplate ReportTemplate,
+	config DailyStatusConfig, items github.ProjectV2ItemsByStatus,
+) (string, ReportMeta) {
+	columns := s.ReportColumns.Or(config.Columns)
+
+	meta := ReportMeta{
+		HasBlockers:     s.QuestionsAndBlockers.IsSome(),
+		HasDiscovery:    s.DiscoveryOfTheDay.IsSome(),
+		InReviewCount:   len(items[columns.InReview]),
+		DoneCount:       len(items[columns.Today]),
+		InProgressCount: len(items[columns.Tomorrow]),
+	}
 
-	report := fmt.Sprintf(`#daily report %s:
-<b><u>Today I worked on</u></b>%s
+	sections := s.reportSections(reportTemplate, columns, config.ShowOtherColumns, items)
 
-<b><u>Tomorrow I will work on</u></b>%s
+	return renderReport(s.reportHeader(responses), sections), meta
+}
 
-`,
-		s.Date,
-		listSep+strings.Join(items["Done"], listSep),
-		listSep+strings.Join(items["In Progress"], listSep))
+/*
+otherItems returns the items that are not in any of the `columns`, ordered by the name of their column. Items without a
+status are not on the board, so they are left out too.
+*/
+func otherItems(items github.ProjectV2ItemsByStatus, columns ReportColumns) []github.ProjectV2Item {
+	statuses := make([]string, 0, len(items))
 
-	if dod, isSome := s.DiscoveryOfTheDay.Unwrap(); isSome {
-		report += "<b><u>Discovery of the day</u></b>\n" + dod + "\n\n"
+	for status := range items {
+		if status != "" && status != columns.Today && status != columns.Tomorrow && status != columns.InReview {
+			statuses = append(statuses, status)
+		}
 	}
 
-	if blockers, isSome := s.QuestionsAndBlockers.Unwrap(); isSome {
-		report += "<b><u>Questions/Blockers</u></b>\n" + blockers + "\n\n"
+	sort.Strings(statuses)
+
+	other := []github.ProjectV2Item{}
+	for _, status := range statuses {
+		other = append(other, items[status]...)
 	}
 
-	if len(items["In Review"]) != 0 {
-		report += "<b><u>In review</u></b>" + listSep + strings.Join(items["In Review"], listSep)
+	return other
+}
+
+// reportHeader is the first line of the report with the date and links to the projects the report is made from.
+func (s DailyStatusState) reportHeader(responses *DailyStatusResponses) string {
+	projects := make([]string, len(s.Projects))
+
+	for i, project := range s.Projects {
+		projects[i] = fmt.Sprintf(responses.ReportProject,
+			escapeURLMarkup(project.URL), escapeMarkup(project.Title), project.Number)
+	}
+
+	return fmt.Sprintf(responses.ReportHeader, s.Date, strings.Join(projects, ", "))
+}
+
+// formatItems is formatReportItems for `items` that are not in a report, e.g. in /allItems.
+func formatItems(items []github.ProjectV2Item, withReviewers bool) string {
+	return formatReportItems(newReportItems(items, withReviewers))
+}
+
+/*
+formatItem is the title of the item with a link to its issue or PR. Items without item.Content (e.g. from a test) use
+item.Title as it is.
+*/
+func formatItem(item github.ProjectV2Item) string {
+	content := item.Content
+
+	switch content.Kind {
+	case github.ItemKindIssue, github.ItemKindPullRequest:
+		link := response.Link(fmt.Sprintf("%s #%d 🔗", content.Kind, content.Number), content.URL)
+
+		return link + " " + escapeMarkup(content.Title)
+	case github.ItemKindDraft:
+		return escapeMarkup(content.Title)
 	}
 
-	return report, nil
+	return item.Title
 }
 
 type DailyStatusState struct {
@@ -140,21 +278,25 @@ type DailyStatusState struct {
 	DiscoveryOfTheDay    option.Option[string]
 	QuestionsAndBlockers option.Option[string]
 	Date                 string
+	// Projects are the default projects at the time /dailyStatus was used. They are linked in the report header.
+	Projects []github.ProjectV2
 	RootState
 }
 
-func NewDailyStatusState(root RootState, date option.Option[string]) DailyStatusState {
+func NewDailyStatusState(root RootState, date option.Option[string], projects []github.ProjectV2) DailyStatusState {
 	return DailyStatusState{
 		Stage:                discoveryOfTheDayDailyStatusStage,
 		DiscoveryOfTheDay:    option.None[string](),
 		QuestionsAndBlockers: option.None[string](),
 		Date: date.Map(func(date string) string {
-			return fmt.Sprintf("<i>%s</i>", date)
-		}).UnwrapOr(time.Now().Format("01.02")),
+			return italicMarkup(userMarkup(date))
+		}).UnwrapOr(escapeMarkup(time.Now().Format("01.02"))),
+		Projects:  projects,
 		RootState: root,
 	}
 }
 
+// dailyStatusStage is saved as a number by EncodeState, new stages must be added at the end.
 type dailyStatusStage int
 
 const (
@@ -162,10 +304,11 @@ const (
 	questionsAndBlockersDailyStatusStage
 )
 
-func (s DailyStatusState) Handler(userData UserSharedData, responses *Responses) Handler {
+func (s DailyStatusState) Handler(userData UserSharedData, responses *Responses, deps *Deps) Handler {
 	return &DailyStatusHandler{
 		responses:        &responses.DailyStatus,
 		userData:         userData,
+		deps:             deps,
 		DailyStatusState: s,
 	}
 }
@@ -173,8 +316,15 @@ func (s DailyStatusState) Handler(userData UserSharedData, responses *Responses)
 type DailyStatusResponses struct {
 	DiscoveryOfTheDay    string `template:"discoveryOfTheDay"`
 	QuestionsAndBlockers string `template:"questionsAndBlockers"`
+	ReportHeader         string `template:"reportHeader"`
+	ReportProject        string `template:"reportProject"`
+	ReportAsFile         string `template:"reportAsFile"`
+	Restarting           string `template:"restarting,optional"`
+	// Templates are filled by Responses.LoadReportTemplates
+	Templates ReportTemplates `template:"-"`
 
 	GithubErrorGeneric   string `template:"githubErrorGeneric"`
+	GithubUnauthorized   string `template:"githubUnauthorized"`
 	NoAPIKeyAdded        string `template:"noApiKeyAdded"`
 	UseSetDefaultProject string `template:"useSetDefaultProject"`
 }
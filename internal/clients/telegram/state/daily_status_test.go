@@ -0,0 +1,268 @@
+package state_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestReportHeaderLinksProjects(t *testing.T) {
+	t.Parallel()
+
+	projects := []github.ProjectV2{
+		{ID: "PVT_1", Title: "Backend", Number: 3, URL: "https://github.com/orgs/acme/projects/3"},
+		{ID: "PVT_2", Title: "R&D", Number: 7, URL: "https://github.com/users/octocat/projects/7"},
+	}
+
+	report := state.NewDailyStatusState(state.NewRootState(), option.Some("date"), projects).
+		FormatReport(testResponses(), github.ProjectV2ItemsByStatus{})
+
+	header, _, _ := strings.Cut(report, "\n")
+
+	expected := `#daily report <i>date</i>: <a href="https://github.com/orgs/acme/projects/3">Backend</a> (#3), ` +
+		`<a href="https://github.com/users/octocat/projects/7">R&amp;D</a> (#7)`
+	if header != expected {
+		t.Fatalf("Expected header\n%s\ngot\n%s", expected, header)
+	}
+}
+
+// dailyStatusHandler is a DailyStatusHandler at the discovery of the day stage for a user with an API key.
+func dailyStatusHandler() state.Handler {
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	return state.NewDailyStatusState(state.NewRootState(), option.None[string](), nil).
+		Handler(userData, testResponses(), testDeps())
+}
+
+func TestDailyStatusBlankInputReprompts(t *testing.T) {
+	t.Parallel()
+
+	for _, text := range []string{"", "   ", "\n\t"} {
+		transition := dailyStatusHandler().PrivateTextMessage(context.Background(), privateText(text))
+
+		statetest.AssertSendsMessage(t, transition, testChatID, "discovery?")
+
+		status, is := transition.NewState.(state.DailyStatusState)
+		if !is {
+			t.Fatalf("%q: expected to stay in DailyStatusState, got %T", text, transition.NewState)
+		}
+
+		if status.DiscoveryOfTheDay.IsSome() {
+			t.Errorf("%q: blank message was recorded as the discovery of the day", text)
+		}
+	}
+}
+
+func TestDailyStatusUnwind(t *testing.T) {
+	t.Parallel()
+
+	transition := dailyStatusHandler().Unwind(context.Background(), testChatID)
+
+	statetest.AssertSendsMessage(t, transition, testChatID, "restarting")
+
+	if _, is := transition.NewState.(state.RootState); !is {
+		t.Fatalf("Expected RootState after unwinding /dailyStatus, got %T", transition.NewState)
+	}
+
+	if transition.UserData.GithubAPIKey.IsNone() {
+		t.Errorf("Unwinding has deleted the user data")
+	}
+
+	transition = rootHandler(state.NewUserSharedData()).Unwind(context.Background(), testChatID)
+	if len(transition.Actions) != 0 {
+		t.Errorf("Unwinding RootState has sent %d actions", len(transition.Actions))
+	}
+}
+
+func TestDailyStatusUnwindWithAStore(t *testing.T) {
+	t.Parallel()
+
+	deps := testDeps()
+	deps.KeepsStates = true
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	status := state.NewDailyStatusState(state.NewRootState(), option.None[string](), nil)
+	status.DiscoveryOfTheDay = option.Some("Learned a lot")
+
+	transition := status.Handler(userData, testResponses(), deps).Unwind(context.Background(), testChatID)
+	statetest.AssertNoActions(t, transition)
+
+	kept, is := transition.NewState.(state.DailyStatusState)
+	if !is || kept.DiscoveryOfTheDay.UnwrapOr("") != "Learned a lot" {
+		t.Fatalf("Expected the answers to be kept for after the restart, got %#v", transition.NewState)
+	}
+}
+
+func TestDailyStatusRecordsAnswers(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]option.Option[string]{
+		"Learned about goroutines": option.Some("Learned about goroutines"),
+		"/none":                    option.None[string](),
+	}
+
+	for text, expected := range tests {
+		transition := dailyStatusHandler().GroupTextMessage(context.Background(), groupText(text))
+
+		statetest.AssertSendsMessage(t, transition, testChatID, "blockers?")
+
+		status, is := transition.NewState.(state.DailyStatusState)
+		if !is {
+			t.Fatalf("%q: expected to stay in DailyStatusState, got %T", text, transition.NewState)
+		}
+
+		if status.DiscoveryOfTheDay != expected {
+			t.Errorf("%q: expected discovery of the day %v, got %v", text, expected, status.DiscoveryOfTheDay)
+		}
+	}
+}
+
+func TestLongReportIsSentAsFile(t *testing.T) {
+	t.Parallel()
+
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = fmt.Sprintf("Done:%d %s", i, strings.Repeat("a very long item title ", 3))
+	}
+
+	deps := githubDeps(fakeGithubItems(t, map[string][]string{"PVT_1": items}).URL)
+	ctx := context.Background()
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := state.NewDailyStatusState(root, option.None[string](), nil).
+		Handler(userData, testResponses(), deps).PrivateTextMessage(ctx, privateText("/none"))
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		PrivateTextMessage(ctx, privateText("/none"))
+
+	actions := statetest.DecodeActions(t, transition)
+	if len(actions) != 1 || actions[0].Endpoint != "sendDocument" {
+		t.Fatalf("Expected the report to be sent as a document, got %+v", actions)
+	}
+
+	if !strings.Contains(string(actions[0].Body), `"caption":"as file"`) {
+		t.Errorf("The document doesn't have the caption: %s", actions[0].Body)
+	}
+
+	if len(transition.UserData.Reports) != 1 {
+		t.Errorf("The report was not saved to the history")
+	}
+}
+
+func TestReportMetaMatchesReport(t *testing.T) {
+	t.Parallel()
+
+	items := github.ProjectV2ItemsByStatus{
+		"Done":        {{Title: "Done 1"}, {Title: "Done 2"}},
+		"In Progress": {{Title: "Doing"}},
+		"In Review":   {{Title: "Review 1"}, {Title: "Review 2"}, {Title: "Review 3"}},
+	}
+
+	status := state.NewDailyStatusState(state.NewRootState(), option.Some("today"), nil)
+	status.QuestionsAndBlockers = option.Some("Waiting for access")
+
+	report, meta := status.FormatReportWithMeta(testResponses(), items)
+
+	expected := state.ReportMeta{
+		HasBlockers:     true,
+		HasDiscovery:    false,
+		InReviewCount:   3,
+		DoneCount:       2,
+		InProgressCount: 1,
+	}
+	if meta != expected {
+		t.Fatalf("Expected meta %+v, got %+v", expected, meta)
+	}
+
+	if strings.Contains(report, "Discovery") || !strings.Contains(report, "Blockers\nWaiting for access") {
+		t.Errorf("The report doesn't match HasDiscovery or HasBlockers:\n%s", report)
+	}
+
+	if bullets := strings.Count(report, "• "); bullets != meta.DoneCount+meta.InProgressCount+meta.InReviewCount {
+		t.Errorf("The report has %d items, but meta counts %+v:\n%s", bullets, meta, report)
+	}
+}
+
+func TestReportMetaWithoutItems(t *testing.T) {
+	t.Parallel()
+
+	status := state.NewDailyStatusState(state.NewRootState(), option.Some("today"), nil)
+	status.DiscoveryOfTheDay = option.Some("Learned about goroutines")
+
+	report, meta := status.FormatReportWithMeta(testResponses(), github.ProjectV2ItemsByStatus{})
+
+	expected := state.ReportMeta{
+		HasBlockers:     false,
+		HasDiscovery:    true,
+		InReviewCount:   0,
+		DoneCount:       0,
+		InProgressCount: 0,
+	}
+	if meta != expected {
+		t.Fatalf("Expected meta %+v, got %+v", expected, meta)
+	}
+
+	if !strings.Contains(report, "Discovery\n") || strings.Contains(report, "Blockers") ||
+		strings.Contains(report, "In review") {
+		t.Errorf("The report doesn't match the meta:\n%s", report)
+	}
+}
+
+// Not parallel: the parse mode is set for the whole package, the parallel tests only run after it's changed back.
+func TestMarkdownV2Report(t *testing.T) {
+	response.SetDefaultParseMode(response.ParseModeMarkdownV2)
+	t.Cleanup(func() { response.SetDefaultParseMode(response.ParseModeHTML) })
+
+	responses := testResponses()
+	responses.DailyStatus.ReportHeader = `\#daily report %s: %s`
+	responses.DailyStatus.ReportProject = `[%[2]s](%[1]s) \(\#%[3]d\)`
+
+	projects := []github.ProjectV2{{ID: "PVT_1", Title: "R&D v1.0", Number: 3, URL: "https://example.com/p(3)"}}
+
+	status := state.NewDailyStatusState(state.NewRootState(), option.Some("10.16"), projects)
+	status.DiscoveryOfTheDay = option.Some("Go 1.20 has no min()!")
+	status.ShowReviewers = true
+
+	items := github.ProjectV2ItemsByStatus{
+		"Done": {{Title: "<a>html</a>", Content: github.ItemContent{
+			Kind: github.ItemKindIssue, Title: "Fix *bold* bug_1", Number: 12, URL: "https://github.com/o/r/issues/12",
+		}}},
+		"In Progress": {{Title: "Write docs (v2).", Content: github.ItemContent{
+			Kind: github.ItemKindDraft, Title: "Write docs (v2).",
+		}}},
+		"In Review": {{Title: "<a>html</a>", Reviewers: []string{"some-one"}, Content: github.ItemContent{
+			Kind: github.ItemKindPullRequest, Title: "[WIP] Parser", Number: 7, URL: "https://github.com/o/r/pull/7",
+		}}},
+	}
+
+	expected := `\#daily report _10\.16_: [R&D v1\.0](https://example.com/p(3\)) \(\#3\)
+Today I worked on
+• [Issue \#12 🔗](https://github.com/o/r/issues/12) Fix \*bold\* bug\_1
+
+Tomorrow I will work on
+• Write docs \(v2\)\.
+
+Discovery
+Go 1\.20 has no min\(\)\!
+
+In review
+• [PR \#7 🔗](https://github.com/o/r/pull/7) \[WIP\] Parser — @some\-one`
+
+	if report := status.FormatReport(responses, items); report != expected {
+		t.Errorf("Expected the report\n%s\ngot\n%s", expected, report)
+	}
+}
@@ -0,0 +1,157 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+/*
+Deps are the settings and services of the client that the handlers use. The client builds them once when it starts and
+Handle passes them to the handler of the conversation's state, like the responses.
+
+NewDeps returns the defaults, tests change the fields they need.
+*/
+type Deps struct {
+	// Bot is the user the bot runs as. Its username is stripped from commands and used in links to the private chat.
+	Bot update.User
+	// Dispatch performs the actions of DispatchEarly right away. Nil drops them.
+	Dispatch func(context.Context, []response.BotAction)
+	// ReportConcurrency is how many projects are requested at the same time when a report is generated
+	ReportConcurrency uint
+	// CommandAliases are the aliases from the config, on top of the ones in the command registry
+	CommandAliases CommandAliases
+	// Allowlist are the only users and chats that Handle serves. An empty allowlist serves everyone.
+	Allowlist Allowlist
+	// ShowProjectCursors shows the cursor of each project in /listProjects, for "/listProjects after <cursor>"
+	ShowProjectCursors bool
+	// DailyStatusConfig is the bot-wide config of /dailyStatus reports
+	DailyStatusConfig DailyStatusConfig
+	// KeepsStates is set if the states are saved in a Store, so a conversation goes on where it was after a restart
+	KeepsStates bool
+	/*
+		Github are the options of every GitHub client the handlers create. The endpoint is set by the client's
+		SetGithubEndpoint for a GitHub Enterprise Server, and by tests to send the queries to a fake GitHub.
+	*/
+	Github github.ClientOptions
+	// GithubClients reuses the GitHub client of an API key across commands. Nil creates a client for each command.
+	GithubClients *GithubClients
+	// CallbackDedup answers repeated taps on a button instead of handling them again. Nil handles every tap.
+	CallbackDedup *CallbackDedup
+	// PageTokens keeps the cursors behind the pagination buttons of each chat
+	PageTokens *ChatPageTokens
+
+	// errors gathers the errors of the update that is being handled. Handle sets it for each update.
+	errors *errorCollector
+}
+
+// depsTTL is how long GithubClients and PageTokens of NewDeps keep their entries
+const depsTTL = time.Hour
+
+/*
+NewDeps returns the default Deps: the bot has no username, early actions are dropped, reports request one project at a
+time with the DefaultDailyStatusConfig, everyone is served and every tap is handled.
+*/
+func NewDeps() Deps {
+	return Deps{
+		Bot:                newBot(),
+		Dispatch:           nil,
+		ReportConcurrency:  1,
+		CommandAliases:     nil,
+		Allowlist:          Allowlist{Users: nil, Chats: nil},
+		ShowProjectCursors: false,
+		DailyStatusConfig:  DefaultDailyStatusConfig(),
+		KeepsStates:        false,
+		Github:             github.ClientOptions{Endpoint: "", UserAgent: ""},
+		GithubClients:      NewGithubClients(depsTTL),
+		CallbackDedup:      nil,
+		PageTokens:         NewChatPageTokens(depsTTL),
+		errors:             nil,
+	}
+}
+
+// newBot is the bot of NewDeps, it has no username.
+func newBot() update.User {
+	return update.User{
+		ID:           0,
+		IsBot:        true,
+		FirstName:    "Bot",
+		LastName:     option.None[string](),
+		Username:     option.None[string](),
+		LanguageCode: option.None[string](),
+	}
+}
+
+/*
+DispatchEarly performs `actions` right away instead of after the handler returns. Use it before slow calls, e.g. to show
+that the bot is typing. Without Dispatch the actions are dropped, so only use it for actions that are fine to lose.
+*/
+func (d *Deps) DispatchEarly(ctx context.Context, actions ...response.BotAction) {
+	if d.Dispatch != nil {
+		d.Dispatch(ctx, actions)
+	}
+}
+
+/*
+githubClient returns the GitHub client of `token` with the options in Github. It's the only way handlers get a client,
+so that Github applies to every query they make.
+*/
+func (d *Deps) githubClient(token string) github.Client {
+	if d.GithubClients == nil {
+		return github.NewClientWithOptions(token, d.Github)
+	}
+
+	return d.GithubClients.get(token, d.Github)
+}
+
+/*
+privateChatLink returns a link that opens the private chat with the bot. When the user presses Start there the bot gets
+"/start `payload`". Returns false if the bot's username is unknown (e.g. in a replay).
+*/
+func (d *Deps) privateChatLink(payload string) (string, bool) {
+	username, isSome := d.Bot.Username.Unwrap()
+	if !isSome || username == "" {
+		return "", false
+	}
+
+	return fmt.Sprintf("https://t.me/%s?start=%s", username, url.QueryEscape(payload)), true
+}
+
+// recordError adds `err` to the RecentErrors of the user whose update is being handled.
+func (d *Deps) recordError(source ErrorSource, err error) {
+	if d.errors == nil || err == nil {
+		return
+	}
+
+	d.errors.mu.Lock()
+	defer d.errors.mu.Unlock()
+
+	d.errors.errors = d.errors.errors.Add(source, err, time.Now())
+	d.errors.transient = d.errors.transient || (source == ErrorSourceGithub && isTransient(err))
+}
+
+// hadTransientGithubError returns true if a GitHub error recorded for the update is transient, see isTransient.
+func (d *Deps) hadTransientGithubError() bool {
+	if d.errors == nil {
+		return false
+	}
+
+	d.errors.mu.Lock()
+	defer d.errors.mu.Unlock()
+
+	return d.errors.transient
+}
+
+// forUpdate returns a copy of the Deps that collects the errors of one update.
+func (d Deps) forUpdate() (*Deps, *errorCollector) {
+	d.errors = &errorCollector{mu: sync.Mutex{}, errors: RecentErrors{}, transient: false}
+
+	return &d, d.errors
+}
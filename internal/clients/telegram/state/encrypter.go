@@ -0,0 +1,85 @@
+package state
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypter protects secrets (e.g. GitHub API keys) before they are saved by a Store.
+type Encrypter interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+}
+
+// AESEncrypter encrypts with AES-256-GCM. The ciphertext is base64 and starts with a random nonce.
+type AESEncrypter struct {
+	aead cipher.AEAD
+}
+
+/*
+NewAESEncrypter creates an encrypter with a key derived from `secret`. Anything encrypted with one secret can only be
+decrypted with the same secret, so changing it makes the saved API keys unusable and users have to add them again.
+*/
+func NewAESEncrypter(secret string) (AESEncrypter, error) {
+	if secret == "" {
+		return AESEncrypter{}, EmptySecretError{}
+	}
+
+	key := sha256.Sum256([]byte(secret))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return AESEncrypter{}, fmt.Errorf("while creating the AES cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return AESEncrypter{}, fmt.Errorf("while creating the AES cipher: %w", err)
+	}
+
+	return AESEncrypter{aead: aead}, nil
+}
+
+func (e AESEncrypter) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("while generating a nonce: %w", err)
+	}
+
+	sealed := e.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (e AESEncrypter) Decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("while decoding the ciphertext: %w", err)
+	}
+
+	if len(sealed) < e.aead.NonceSize() {
+		return "", errors.New("the ciphertext is shorter than a nonce")
+	}
+
+	nonce, sealed := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+
+	plaintext, err := e.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", fmt.Errorf("while decrypting (was the secret changed?): %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// EmptySecretError is returned by NewAESEncrypter if the secret is empty.
+type EmptySecretError struct{}
+
+func (EmptySecretError) Error() string {
+	return "the secret to encrypt with is empty"
+}
@@ -0,0 +1,66 @@
+package state_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+)
+
+func TestAESEncrypterRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	encrypter, err := state.NewAESEncrypter("secret")
+	if err != nil {
+		t.Fatalf("While creating the encrypter: %s", err)
+	}
+
+	first, err := encrypter.Encrypt("ghp_key")
+	if err != nil {
+		t.Fatalf("While encrypting: %s", err)
+	}
+
+	second, err := encrypter.Encrypt("ghp_key")
+	if err != nil {
+		t.Fatalf("While encrypting: %s", err)
+	}
+
+	if first == second {
+		t.Errorf("The same plaintext was encrypted the same way twice, the nonce is not random")
+	}
+
+	for _, ciphertext := range []string{first, second} {
+		plaintext, err := encrypter.Decrypt(ciphertext)
+		if err != nil || plaintext != "ghp_key" {
+			t.Errorf("Expected ghp_key, got %q %v", plaintext, err)
+		}
+	}
+}
+
+func TestAESEncrypterWithDifferentSecret(t *testing.T) {
+	t.Parallel()
+
+	encrypter, _ := state.NewAESEncrypter("secret")
+	rotated, _ := state.NewAESEncrypter("rotated")
+
+	ciphertext, err := encrypter.Encrypt("ghp_key")
+	if err != nil {
+		t.Fatalf("While encrypting: %s", err)
+	}
+
+	if plaintext, err := rotated.Decrypt(ciphertext); err == nil {
+		t.Errorf("Decrypted with a different secret: %q", plaintext)
+	}
+
+	if _, err := encrypter.Decrypt("not base64!"); err == nil {
+		t.Errorf("Decrypted garbage")
+	}
+}
+
+func TestAESEncrypterWithoutSecret(t *testing.T) {
+	t.Parallel()
+
+	if _, err := state.NewAESEncrypter(""); !errors.As(err, &state.EmptySecretError{}) {
+		t.Errorf("Expected EmptySecretError, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package state
+
+import (
+	"os"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+)
+
+// FormatReport lets tests check the report without talking to GitHub. The report uses the default template.
+func (s DailyStatusState) FormatReport(responses *Responses, items github.ProjectV2ItemsByStatus) string {
+	report, _ := s.FormatReportWithMeta(responses, items)
+
+	return report
+}
+
+// FormatReportWithMeta is FormatReport that also returns the report's meta.
+func (s DailyStatusState) FormatReportWithMeta(responses *Responses, items github.ProjectV2ItemsByStatus,
+) (string, ReportMeta) {
+	return s.formatReport(&responses.DailyStatus, responses.DailyStatus.Templates.Pick(nil, nil),
+		DefaultDailyStatusConfig(), items)
+}
+
+// FormatReportWithConfig is FormatReport with the bot-wide config of reports.
+func (s DailyStatusState) FormatReportWithConfig(responses *Responses, config DailyStatusConfig,
+	items github.ProjectV2ItemsByStatus,
+) string {
+	report, _ := s.formatReport(&responses.DailyStatus, responses.DailyStatus.Templates.Pick(nil, nil), config, items)
+
+	return report
+}
+
+// ReportSections are the sections of FormatReportWithConfig before they are rendered.
+func (s DailyStatusState) ReportSections(responses *Responses, config DailyStatusConfig,
+	items github.ProjectV2ItemsByStatus,
+) []ReportSection {
+	return s.reportSections(responses.DailyStatus.Templates.Pick(nil, nil), s.ReportColumns.Or(config.Columns),
+		config.ShowOtherColumns, items)
+}
+
+// MaxRecentErrors is how many errors RecentErrors keeps.
+const MaxRecentErrors = maxRecentErrors
+
+// GithubClient is the client that handlers use for `token`.
+func (d *Deps) GithubClient(token string) github.Client {
+	return d.githubClient(token)
+}
+
+// SetSyncFile replaces how the FileStore flushes its temporary file, e.g. to make a save fail before the rename.
+func (s *FileStore) SetSyncFile(syncFile func(*os.File) error) {
+	s.syncFile = syncFile
+}
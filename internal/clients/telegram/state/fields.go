@@ -0,0 +1,109 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
+)
+
+const fieldsCommand = "fields"
+
+/*
+handleFields lists the fields of a project grouped by their type, with the options of single select fields. This shows
+the exact names of the columns, so that they can be used in /reportConfig. Without a project ID the first default
+project of the chat is used.
+*/
+func (s *RootHandler) handleFields(ctx context.Context, updateID update.UpdateID, cmd slashcmd.Command,
+	chatID update.ChatID,
+) Transition {
+	var args struct {
+		ProjectID string `pos:"0"`
+	}
+
+	if err := slashcmd.Bind(cmd, &args); err != nil {
+		return s.replyWithMessage(chatID, s.responses.FieldsUsage)
+	}
+
+	projectID := github.ProjectID(args.ProjectID)
+	if projectID == "" {
+		if len(s.DefaultProjects) == 0 {
+			return s.replyWithMessage(chatID, s.responses.FieldsUsage)
+		}
+
+		projectID = s.DefaultProjects[0]
+	}
+
+	token, isSome := s.userData.GithubAPIKey.Unwrap()
+	if !isSome {
+		logging.Tracef("%s Tried to list project fields without adding an API key", updateID.Log())
+
+		return s.replyWithMessage(chatID, s.responses.NoAPIKeyAdded)
+	}
+
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	fields, err := s.deps.githubClient(token).ProjectFields(ctx, projectID)
+	if err != nil {
+		logging.Errorf("%s While getting fields for /fields: %s", updateID.Log(), err)
+
+		return s.replyWithMessage(chatID, projectErrorMessage(s.deps, err, s.responses.NotAProject,
+			s.responses.GithubUnauthorized, s.responses.GithubErrorGeneric))
+	}
+
+	return s.replyWithMessage(chatID,
+		fmt.Sprintf(s.responses.FieldsHeader, escapeMarkup(string(projectID)))+formatFields(fields))
+}
+
+/*
+formatFields groups the fields by type. The groups are in the order their first field appears in the project and the
+fields keep their order within a group.
+*/
+func formatFields(fields []github.ProjectField) string {
+	types := []string{}
+	byType := make(map[string][]github.ProjectField)
+
+	for _, field := range fields {
+		if _, isSeen := byType[field.DataType]; !isSeen {
+			types = append(types, field.DataType)
+		}
+
+		byType[field.DataType] = append(byType[field.DataType], field)
+	}
+
+	list := ""
+
+	for _, dataType := range types {
+		list += "\n" + underlineMarkup(escapeMarkup(fieldTypeName(dataType)))
+
+		for _, field := range byType[dataType] {
+			list += "\n• " + response.Code(field.Name)
+
+			if len(field.Options) != 0 {
+				options := make([]string, len(field.Options))
+				for i, option := range field.Options {
+					options[i] = response.Code(option)
+				}
+
+				list += ": " + strings.Join(options, ", ")
+			}
+		}
+	}
+
+	return list
+}
+
+// fieldTypeName turns a GitHub field type like SINGLE_SELECT into "Single select".
+func fieldTypeName(dataType string) string {
+	name := strings.ToLower(strings.ReplaceAll(dataType, "_", " "))
+	if name == "" {
+		return name
+	}
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
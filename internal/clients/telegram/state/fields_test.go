@@ -0,0 +1,60 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestFieldsGroupsByType(t *testing.T) {
+	t.Parallel()
+
+	server := statetest.FakeGithub(t, map[string]string{
+		"ProjectFields": `{"data": {"node": {"__typename": "ProjectV2", "fields": {"nodes": [
+	{"__typename": "ProjectV2Field", "name": "Title", "dataType": "TITLE"},
+	{"__typename": "ProjectV2SingleSelectField", "name": "Status", "dataType": "SINGLE_SELECT",
+		"options": [{"name": "Todo"}, {"name": "In <Progress>"}]},
+	{"__typename": "ProjectV2Field", "name": "Assignees", "dataType": "ASSIGNEES"},
+	{"__typename": "ProjectV2SingleSelectField", "name": "Size", "dataType": "SINGLE_SELECT",
+		"options": [{"name": "S"}, {"name": "L"}]}
+]}}}}`,
+	})
+
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	text := sentText(t, root.Handler(userData, testResponses(), deps).GroupTextMessage(ctx, groupText("/fields")))
+
+	expected := `fields of PVT_1:
+<u>Title</u>
+• <code>Title</code>
+<u>Single select</u>
+• <code>Status</code>: <code>Todo</code>, <code>In &lt;Progress&gt;</code>
+• <code>Size</code>: <code>S</code>, <code>L</code>
+<u>Assignees</u>
+• <code>Assignees</code>`
+	if text != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, text)
+	}
+}
+
+func TestFieldsWithoutProject(t *testing.T) {
+	t.Parallel()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	text := sentText(t, rootHandler(userData).PrivateTextMessage(context.Background(), privateText("/fields")))
+	if text != "fields usage" {
+		t.Fatalf("Expected the usage, got %q", text)
+	}
+}
@@ -0,0 +1,52 @@
+package state
+
+import (
+	"context"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/util/cache"
+)
+
+/*
+GithubClients keeps a github.Client per API key, so that the commands of a user reuse its HTTP client instead of
+creating a new one every time. A client is forgotten after it wasn't used for `ttl`, or with Forget when its key is
+changed or removed.
+*/
+type GithubClients struct {
+	clients *cache.Cache[string, cachedGithubClient]
+	ttl     time.Duration
+}
+
+// cachedGithubClient remembers the options of the client, a client of the same key with other options is a new one.
+type cachedGithubClient struct {
+	client  github.Client
+	options github.ClientOptions
+}
+
+// NewGithubClients creates an empty cache where clients that weren't used for `ttl` are forgotten.
+func NewGithubClients(ttl time.Duration) *GithubClients {
+	return &GithubClients{clients: cache.New[string, cachedGithubClient](), ttl: ttl}
+}
+
+// PruneEvery forgets the clients that weren't used every `interval` until the context is done. Run it in a goroutine.
+func (g *GithubClients) PruneEvery(ctx context.Context, interval time.Duration) {
+	g.clients.PruneEvery(ctx, interval)
+}
+
+// Forget removes the client of `token`, e.g. because the user has replaced the key.
+func (g *GithubClients) Forget(token string) {
+	g.clients.Delete(token)
+}
+
+// get returns the client of `token`, creating it if there isn't one with the same options. Its TTL starts over.
+func (g *GithubClients) get(token string, options github.ClientOptions) github.Client {
+	cached, isCached := g.clients.Get(token)
+	if !isCached || cached.options != options {
+		cached = cachedGithubClient{client: github.NewClientWithOptions(token, options), options: options}
+	}
+
+	g.clients.Set(token, cached, g.ttl)
+
+	return cached.client
+}
@@ -0,0 +1,72 @@
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+)
+
+func TestGithubClientsReuseClientOfKey(t *testing.T) {
+	t.Parallel()
+
+	clients := state.NewGithubClients(time.Hour)
+	deps := state.NewDeps()
+	deps.GithubClients = clients
+
+	first := deps.GithubClient("key")
+	if deps.GithubClient("key") != first {
+		t.Fatal("The client of a key was created again")
+	}
+
+	if deps.GithubClient("other key") == first {
+		t.Fatal("Another key got the same client")
+	}
+
+	otherEndpoint := deps
+	otherEndpoint.Github.Endpoint = "http://localhost"
+
+	if otherEndpoint.GithubClient("key") == first {
+		t.Fatal("The client of another endpoint was reused")
+	}
+
+	clients.Forget("key")
+
+	if deps.GithubClient("key") == first {
+		t.Fatal("The client of a forgotten key was reused")
+	}
+}
+
+func TestGithubClientsWithoutCache(t *testing.T) {
+	t.Parallel()
+
+	deps := state.NewDeps()
+	deps.GithubClients = nil
+
+	if deps.GithubClient("key") == deps.GithubClient("key") {
+		t.Fatal("A client was reused without GithubClients")
+	}
+}
+
+func BenchmarkGithubClient(b *testing.B) {
+	b.Run("new", func(b *testing.B) {
+		deps := state.NewDeps()
+		deps.GithubClients = nil
+
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			deps.GithubClient("key")
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		deps := state.NewDeps()
+
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			deps.GithubClient("key")
+		}
+	})
+}
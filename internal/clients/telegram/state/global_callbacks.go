@@ -0,0 +1,59 @@
+package state
+
+import (
+	"context"
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+)
+
+/*
+globalCallbackPrefixes are the buttons of RootState commands that work in any state, e.g. the pages of /listProjects
+while the user is in the middle of /dailyStatus. Their data must not depend on the conversation state, use
+ChatPageTokens for anything that doesn't fit into the data of a button.
+*/
+func globalCallbackPrefixes() []string {
+	return []string{listProjectsCallbackPrefix, listProjectsBackCallbackPrefix}
+}
+
+// isGlobalCallback is true if `data` is the data of a button in globalCallbackPrefixes.
+func isGlobalCallback(data string) bool {
+	for _, prefix := range globalCallbackPrefixes() {
+		if strings.HasPrefix(data, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+handleGlobalCallback lets RootHandler handle the global buttons (see globalCallbackPrefixes) of conversations that are
+in another state. The conversation stays in its state, only the user data and the actions are taken from RootHandler.
+Returns false if the button is not global or the conversation is already in RootState.
+*/
+func handleGlobalCallback(ctx context.Context, cq update.CallbackQuery, conversation State, userData UserSharedData,
+	responses *Responses, deps *Deps,
+) (Transition, bool) {
+	if _, isRoot := conversation.(RootState); isRoot || !isGlobalCallback(cq.Data.UnwrapOr("")) {
+		return Transition{}, false
+	}
+
+	withRoot, hasRoot := conversation.(interface{ rootState() RootState })
+	if !hasRoot {
+		return Transition{}, false
+	}
+
+	logging.Tracef("%s Global button pressed in %T", cq.Log(), conversation)
+
+	transition := withRoot.rootState().Handler(userData, responses, deps).CallbackQuery(ctx, cq)
+	transition.NewState = conversation
+
+	return transition, true
+}
+
+// rootState is the RootState of the conversation. It's promoted to every state that embeds RootState.
+func (s RootState) rootState() RootState {
+	return s
+}
@@ -0,0 +1,59 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestGlobalButtonWorksInAnotherState(t *testing.T) {
+	t.Parallel()
+
+	server := fakeGithubProjectPages(t, func(string, string) (bool, bool) { return false, true })
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	userData = rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/listProjects")).UserData
+
+	// The user has started /dailyStatus after /listProjects, the button of the list must still work
+	status := state.NewDailyStatusState(state.NewRootState(), option.None[string](), nil)
+	tap := update.Update{ID: 2, Message: option.None[update.Message](), CallbackQuery: option.Some(callbackQuery(
+		"listprojects:0"))}
+
+	transition := state.Handle(ctx, *deps, tap, status, userData, testResponses())
+
+	actions := statetest.DecodeActions(t, transition)
+	if len(actions) != 2 || actions[0].Endpoint != "editMessageText" || actions[1].Endpoint != "answerCallbackQuery" {
+		t.Fatalf("Expected the next page to be edited in, got %+v", actions)
+	}
+
+	if _, is := transition.NewState.(state.DailyStatusState); !is {
+		t.Fatalf("A global button has changed the state to %T", transition.NewState)
+	}
+}
+
+func TestStateButtonIsNotGlobal(t *testing.T) {
+	t.Parallel()
+
+	status := state.NewDailyStatusState(state.NewRootState(), option.None[string](), nil)
+	tap := update.Update{ID: 2, Message: option.None[update.Message](), CallbackQuery: option.Some(callbackQuery(
+		"clear:yes"))}
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := state.Handle(context.Background(), state.NewDeps(), tap, status, userData, testResponses())
+
+	statetest.AssertAnswersCallback(t, transition, "This button doesnt work. Use /cancel to quit /dailyStatus.", false)
+
+	if transition.UserData.GithubAPIKey.IsNone() {
+		t.Fatal("A button of RootState was handled in DailyStatusState")
+	}
+}
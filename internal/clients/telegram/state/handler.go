@@ -4,10 +4,12 @@ import (
 	"context"
 	"strings"
 
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
 	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
 	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
 )
 
 type Handler interface {
@@ -18,22 +20,42 @@ type Handler interface {
 	Ignore(context.Context) Transition
 	/*
 		Unwind is called before the bot is shutdown and can be used to return a conversation to a "default" state. Use it to
-		cancel or clean up any commands.
+		cancel or clean up any commands. `chatID` is the chat of the conversation, e.g. to tell the user what was
+		canceled.
 	*/
-	// Unwind(context.Context) Transition
+	Unwind(context.Context, update.ChatID) Transition
 }
 
 type State interface {
-	Handler(UserSharedData, *Responses) Handler
+	Handler(UserSharedData, *Responses, *Deps) Handler
 }
 
 type UserSharedData struct {
 	GithubAPIKey option.Option[string]
+	// LockedAPIKey is the saved key that the store couldn't decrypt. It's kept until the user adds or removes a key.
+	LockedAPIKey string `json:"-"`
+	// LastCommand is the last command that failed with a transient GitHub error. It is repeated by /retry.
+	LastCommand option.Option[slashcmd.Command]
+	// Reports are the last /dailyStatus reports, pruned by the client's ReportRetention.
+	Reports ReportHistory
+	// ReportTemplates are the names of report templates chosen for projects with /reportTemplate
+	ReportTemplates map[github.ProjectID]string
+	// RecentErrors are the last errors the user ran into, shown by /errors
+	RecentErrors RecentErrors
+	// Debug shows the details of RecentErrors, set with /debug
+	Debug bool
 }
 
 func NewUserSharedData() UserSharedData {
 	return UserSharedData{
 		GithubAPIKey: option.None[string](),
+		LockedAPIKey: "",
+		LastCommand:  option.None[slashcmd.Command](),
+		Reports:      ReportHistory{},
+
+		ReportTemplates: map[github.ProjectID]string{},
+		RecentErrors:    RecentErrors{},
+		Debug:           false,
 	}
 }
 
@@ -45,26 +67,131 @@ type Transition struct {
 	UserData UserSharedData
 	// Actions is the list of actions the bot should do in response to the current message
 	Actions []response.BotAction
+	// ForgetConversations resets the conversations of the user in every other chat too, see ForgetConversations()
+	ForgetConversations bool
 }
 
+// NewTransition creates a Transition from all its parts at once. Transit() is usually easier to read.
 func NewTransition(
 	newState State, userData UserSharedData, resp []response.BotAction,
 ) Transition {
 	return Transition{
-		NewState: newState,
-		UserData: userData,
-		Actions:  resp,
+		NewState:            newState,
+		UserData:            userData,
+		Actions:             resp,
+		ForgetConversations: false,
 	}
 }
 
-func Handle(ctx context.Context, bot update.User, upd update.Update, state Handler) Transition {
+/*
+TransitionBuilder creates a Transition one piece at a time:
+
+	return Transit(s.RootState, s.userData).Reply(chatID, "Hello!").Build()
+
+The user data is an argument of Transit, because a Transition without it would silently erase the user's data.
+*/
+type TransitionBuilder struct {
+	transition Transition
+}
+
+// Transit starts building a Transition into `newState`, `userData` is used for the next update.
+func Transit(newState State, userData UserSharedData) TransitionBuilder {
+	return TransitionBuilder{
+		transition: Transition{
+			NewState:            newState,
+			UserData:            userData,
+			Actions:             response.Nothing(),
+			ForgetConversations: false,
+		},
+	}
+}
+
+/*
+Reply sends a message with the default settings of response.NewSendMessage. Text that is too long for one message is
+sent as several, see response.SplitSendMessage. Empty text (e.g. an optional response that is not in the template) is
+not sent, Telegram would reject it anyway.
+*/
+func (b TransitionBuilder) Reply(chatID update.ChatID, text string) TransitionBuilder {
+	if strings.TrimSpace(text) == "" {
+		logging.Debugf("Not sending an empty reply to (ChatID %d)", chatID)
+
+		return b
+	}
+
+	for _, action := range response.SplitSendMessage(chatID, text) {
+		b = b.Action(action)
+	}
+
+	return b
+}
+
+// Action adds any action after the ones that were added before.
+func (b TransitionBuilder) Action(action response.BotAction) TransitionBuilder {
+	// Full slice expression makes append copy, so builders that share a prefix dont overwrite each other's actions.
+	actions := b.transition.Actions
+	b.transition.Actions = append(actions[:len(actions):len(actions)], action)
+
+	return b
+}
+
+/*
+ForgetConversations resets the conversations of the user in every chat to RootState once the update is handled, e.g.
+because /clear deletes the default projects of all chats. Without it only the state of this conversation changes.
+*/
+func (b TransitionBuilder) ForgetConversations() TransitionBuilder {
+	b.transition.ForgetConversations = true
+
+	return b
+}
+
+// Build returns the Transition.
+func (b TransitionBuilder) Build() Transition {
+	return b.transition
+}
+
+/*
+Handle passes the update to the handler of the conversation's state, to the method for the type of the update. Users
+and chats that are not in the Allowlist of `deps` only get a denial. Global buttons are handled the same way in every
+state, see globalCallbackPrefixes. The errors that the handler has run into are added to the RecentErrors of the user,
+see Deps.recordError.
+*/
+func Handle(ctx context.Context, deps Deps, upd update.Update, conversation State, userData UserSharedData,
+	responses *Responses,
+) Transition {
+	updateDeps, collector := deps.forUpdate()
+
+	transition := handleUpdate(ctx, updateDeps, upd, conversation, userData, responses)
+	transition.UserData.RecentErrors = collector.addTo(transition.UserData.RecentErrors)
+
+	return transition
+}
+
+func handleUpdate(ctx context.Context, deps *Deps, upd update.Update, conversation State,
+	userData UserSharedData, responses *Responses,
+) Transition {
+	state := conversation.Handler(userData, responses, deps)
+
+	if transition, isDenied := denyNotAllowed(ctx, deps.Allowlist, upd, state, responses); isDenied {
+		return transition
+	}
+
 	if message, isSome := upd.Message.Unwrap(); isSome {
-		if transition, ok := handleMessage(ctx, bot, message, upd.ID, state); ok {
+		if transition, ok := handleMessage(ctx, deps.Bot, message, upd.ID, state); ok {
 			return transition
 		}
 	}
 
 	if cq, isSome := upd.CallbackQuery.Unwrap(); isSome {
+		if transition, isRepeated := answerRepeatedTap(ctx, deps.CallbackDedup, cq, state); isRepeated {
+			logging.Debugf("%s Repeated tap on a button, not handling it again", cq.Log())
+
+			return transition
+		}
+
+		if transition, isGlobal := handleGlobalCallback(ctx, cq, conversation, userData, responses, deps); isGlobal {
+			return transition
+		}
+
 		return state.CallbackQuery(ctx, cq)
 	}
 
@@ -111,6 +238,14 @@ func handleMessage(ctx context.Context, bot update.User, message update.Message,
 
 		from, isSome := message.From.Unwrap()
 		if !isSome {
+			if message.SenderChat.IsSome() {
+				// Without a user there is no API key or user data to run a command with
+				logging.Infof("%s %s Ignored because it was sent on behalf of a chat, not a user", updateID.Log(),
+					message.Log())
+
+				return state.Ignore(ctx), true
+			}
+
 			return Transition{}, false
 		}
 
@@ -0,0 +1,135 @@
+package state_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestTransitBuildsTheSameAsNewTransition(t *testing.T) {
+	t.Parallel()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	ack := response.CallbackQueryAnswerNotification("id", "ok")
+
+	built := state.Transit(state.NewRootState(), userData).Reply(testChatID, "Hello").Action(ack).Build()
+	expected := state.NewTransition(state.NewRootState(), userData, []response.BotAction{
+		response.NewSendMessage(testChatID, "Hello"),
+		ack,
+	})
+
+	if !reflect.DeepEqual(built, expected) {
+		t.Fatalf("Builder created %#v, expected %#v", built, expected)
+	}
+}
+
+func TestTransitBranchesDontShareActions(t *testing.T) {
+	t.Parallel()
+
+	base := state.Transit(state.NewRootState(), state.NewUserSharedData()).Reply(testChatID, "First")
+
+	one := base.Reply(testChatID, "One").Build()
+	two := base.Reply(testChatID, "Two").Build()
+
+	if sentTextAt(t, one, 1) != "One" || sentTextAt(t, two, 1) != "Two" {
+		t.Fatal("Builders with a common prefix overwrote each other's actions")
+	}
+}
+
+func TestDispatchEarly(t *testing.T) {
+	t.Parallel()
+
+	var dispatched []response.BotAction
+
+	deps := testDeps()
+	deps.Dispatch = func(_ context.Context, actions []response.BotAction) {
+		dispatched = append(dispatched, actions...)
+	}
+
+	deps.DispatchEarly(context.Background(), response.Typing(testChatID))
+
+	if !reflect.DeepEqual(dispatched, []response.BotAction{response.Typing(testChatID)}) {
+		t.Fatalf("Expected the typing action to be dispatched, got %#v", dispatched)
+	}
+
+	// Without a dispatcher nothing happens
+	testDeps().DispatchEarly(context.Background(), response.Typing(testChatID))
+}
+
+func TestMessageOnBehalfOfChatIsIgnored(t *testing.T) {
+	t.Parallel()
+
+	const senderChatUpdate = `{"update_id": 1, "message": {"message_id": 1, "date": 0, "text": "/help",
+"sender_chat": {"id": -100, "type": "channel"}, "chat": {"id": 42, "type": "group"}}}`
+
+	var upd update.Update
+	if err := json.Unmarshal([]byte(senderChatUpdate), &upd); err != nil {
+		t.Fatalf("While decoding the update: %s", err)
+	}
+
+	message, _ := upd.Message.Unwrap()
+	if senderChat, isSome := message.SenderChat.Unwrap(); !isSome || senderChat.ID != -100 {
+		t.Fatalf("sender_chat was not decoded: %#v", message)
+	}
+
+	responses := testResponses()
+	responses.Root.Help = "help"
+
+	transition := state.Handle(context.Background(), state.NewDeps(), upd, state.NewRootState(),
+		state.NewUserSharedData(), responses)
+
+	statetest.AssertNoActions(t, transition)
+}
+
+func TestRepeatedTapIsAnsweredOnce(t *testing.T) {
+	t.Parallel()
+
+	var (
+		deps     = state.NewDeps()
+		userData = state.NewUserSharedData()
+		tap      = update.Update{
+			ID:            1,
+			Message:       option.None[update.Message](),
+			CallbackQuery: option.Some(callbackQuery("clear:yes")),
+		}
+	)
+
+	deps.CallbackDedup = state.NewCallbackDedup(time.Minute, "already")
+	userData.GithubAPIKey = option.Some("key")
+
+	first := state.Handle(context.Background(), deps, tap, state.NewRootState(), userData, testResponses())
+	statetest.AssertSendsMessage(t, first, testChatID, "cleared")
+
+	second := state.Handle(context.Background(), deps, tap, state.NewRootState(), userData, testResponses())
+	statetest.AssertAnswersCallback(t, second, "already", false)
+
+	if second.UserData.GithubAPIKey.IsNone() {
+		t.Fatal("The repeated tap has run /clear again")
+	}
+
+	if actions := statetest.DecodeActions(t, second); len(actions) != 1 {
+		t.Fatalf("Expected only the answer to the repeated tap, got %d actions", len(actions))
+	}
+}
+
+func TestEmptyReplyIsNotSent(t *testing.T) {
+	t.Parallel()
+
+	responses := testResponses()
+	responses.Root.Help = "" // E.g. an optional key that is missing from the template
+
+	transition := state.NewRootState().Handler(state.NewUserSharedData(), responses, testDeps()).
+		PrivateTextMessage(context.Background(), privateText("/help"))
+
+	statetest.AssertNoActions(t, transition)
+}
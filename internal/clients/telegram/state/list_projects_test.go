@@ -0,0 +1,308 @@
+package state_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+/*
+fakeGithubProjectPages answers with a full page of projects from "start" to "end" cursors. `hasPages` decides if there
+are projects before and after the page, it gets the operation name and the cursor the page was requested with.
+*/
+func fakeGithubProjectPages(t *testing.T, hasPages func(operation, cursor string) (previous, next bool),
+) *statetest.GithubServer {
+	t.Helper()
+
+	page := func(w http.ResponseWriter, _ *http.Request, request statetest.GraphQLRequest) {
+		edges := make([]string, 10)
+		for i := range edges {
+			edges[i] = fmt.Sprintf(`{"cursor": "c%d", "node": {"id": "PVT_%d", "title": "Project %d", "number": %d,
+"url": "", "creator": {"__typename": "User", "login": "octocat", "url": ""}}}`, i, i, i, i)
+		}
+
+		previous, next := hasPages(request.OperationName, pageCursor(t, request))
+
+		fmt.Fprintf(w, `{"data": {"viewer": {"projectsV2": {"edges": [%s], "pageInfo": {"startCursor": "start",
+"endCursor": "end", "hasPreviousPage": %t, "hasNextPage": %t}}}}}`, strings.Join(edges, ","), previous, next)
+	}
+
+	return statetest.FakeGithubFuncs(t, map[string]statetest.AnswerFunc{
+		"ViewerProjectsV2":       page,
+		"ViewerProjectsV2Before": page,
+	})
+}
+
+// pageCursor is the cursor a page of projects was requested with, the page after or before it.
+func pageCursor(t *testing.T, request statetest.GraphQLRequest) string {
+	t.Helper()
+
+	var variables struct {
+		After  string `json:"after"`
+		Before string `json:"before"`
+	}
+
+	if err := request.DecodeVariables(&variables); err != nil {
+		t.Errorf("Bad project list request: %s", err)
+	}
+
+	return variables.After + variables.Before
+}
+
+func TestListProjectsHidesCursorsByDefault(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubItems(t, map[string][]string{}).URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	text := sentText(t, rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/listProjects")))
+
+	if strings.Contains(text, "<code>MQ</code>") || strings.Contains(text, "<code>Mg</code>") {
+		t.Errorf("Cursors are shown:\n%s", text)
+	}
+
+	if !strings.Contains(text, `<a href="https://github.com/p/1"><b>Backend</b></a>`) ||
+		!strings.Contains(text, "ID: <code>PVT_2</code>") {
+		t.Errorf("Projects are missing:\n%s", text)
+	}
+}
+
+func TestListProjectsShowsCursors(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubItems(t, map[string][]string{}).URL)
+	ctx := context.Background()
+	deps.ShowProjectCursors = true
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	text := sentText(t, rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/listProjects")))
+
+	if !strings.Contains(text, `<code>MQ</code> <a href="https://github.com/p/1"><b>Backend</b></a>`) ||
+		!strings.Contains(text, "<code>Mg</code> ") {
+		t.Errorf("Cursors are not shown:\n%s", text)
+	}
+}
+
+func TestListProjectsFullLastPageHasNoNextButton(t *testing.T) {
+	t.Parallel()
+
+	server := fakeGithubProjectPages(t, func(string, string) (bool, bool) { return false, false })
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	actions := statetest.DecodeActions(t,
+		rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/listProjects")))
+
+	if len(actions) != 1 || strings.Count(actions[0].Text, "ID: <code>") != 10 {
+		t.Fatalf("Expected a page with 10 projects, got %+v", actions)
+	}
+
+	if len(actions[0].Buttons) != 0 {
+		t.Errorf("The last page has pagination buttons: %v", actions[0].Buttons)
+	}
+}
+
+func TestListProjectsPreviousPage(t *testing.T) {
+	t.Parallel()
+
+	server := fakeGithubProjectPages(t, func(operation, cursor string) (bool, bool) {
+		// There are two pages: the first one and the one after its end
+		if operation == "ViewerProjectsV2" && cursor == "end" {
+			return true, false
+		}
+
+		return false, true
+	})
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/listProjects"))
+	if buttons := statetest.DecodeActions(t, transition)[0].Buttons; !reflect.DeepEqual(buttons,
+		[][]string{{"listprojects:0"}}) {
+		t.Fatalf("Expected only the next page button on the first page, got %v", buttons)
+	}
+
+	transition = state.NewRootState().Handler(transition.UserData, testResponses(), deps).
+		CallbackQuery(ctx, callbackQuery("listprojects:0"))
+	if buttons := statetest.DecodeActions(t, transition)[0].Buttons; !reflect.DeepEqual(buttons,
+		[][]string{{"listprojectsback:1"}}) {
+		t.Fatalf("Expected only the previous page button on the last page, got %v", buttons)
+	}
+
+	transition = state.NewRootState().Handler(transition.UserData, testResponses(), deps).
+		CallbackQuery(ctx, callbackQuery("listprojectsback:1"))
+	if buttons := statetest.DecodeActions(t, transition)[0].Buttons; !reflect.DeepEqual(buttons,
+		[][]string{{"listprojects:2"}}) {
+		t.Errorf("Expected only the next page button after going back, got %v", buttons)
+	}
+
+	requests := make([]string, 0, 3)
+	for _, request := range server.Requests() {
+		requests = append(requests, request.OperationName+" "+pageCursor(t, request))
+	}
+
+	expected := []string{"ViewerProjectsV2 ", "ViewerProjectsV2 end", "ViewerProjectsV2Before start"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("Expected requests %q, got %q", expected, requests)
+	}
+}
+
+// fakeGithubOrgProjects answers with one project of any organization except "missing", which doesn't exist.
+func fakeGithubOrgProjects(t *testing.T) *statetest.GithubServer {
+	t.Helper()
+
+	return statetest.FakeGithubFuncs(t, map[string]statetest.AnswerFunc{
+		"OrganizationProjectsV2": func(w http.ResponseWriter, _ *http.Request, request statetest.GraphQLRequest) {
+			var variables struct {
+				Org   string `json:"org"`
+				After string `json:"after"`
+			}
+
+			if err := request.DecodeVariables(&variables); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+
+			if variables.Org == "missing" {
+				fmt.Fprint(w, `{"data": {"organization": null}}`)
+
+				return
+			}
+
+			fmt.Fprintf(w, `{"data": {"organization": {"projectsV2": {"edges": [{"cursor": "c1", "node": {
+"id": "PVT_org", "title": "Roadmap after [%s]", "number": 1, "url": "",
+"creator": {"__typename": "User", "login": "octocat", "url": ""}}}],
+"pageInfo": {"startCursor": "c1", "endCursor": "c1", "hasPreviousPage": false, "hasNextPage": true}}}}}`,
+				variables.After)
+		},
+	})
+}
+
+func TestListOrganizationProjects(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubOrgProjects(t).URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/listProjects org octo-org"))
+
+	actions := statetest.DecodeActions(t, transition)
+	if len(actions) != 1 || !strings.Contains(actions[0].Text, "Projects of octo-org") ||
+		!strings.Contains(actions[0].Text, "ID: <code>PVT_org</code>") {
+		t.Fatalf("Expected the projects of the organization, got %+v", actions)
+	}
+
+	if !reflect.DeepEqual(actions[0].Buttons, [][]string{{"listprojects:0:octo-org"}}) {
+		t.Fatalf("Expected a next page button for the organization, got %v", actions[0].Buttons)
+	}
+
+	transition = state.NewRootState().Handler(transition.UserData, testResponses(), deps).
+		CallbackQuery(ctx, callbackQuery("listprojects:0:octo-org"))
+
+	// The next page of the organization has no previous page button
+	actions = statetest.DecodeActions(t, transition)
+	if !strings.Contains(actions[0].Text, "Roadmap after [c1]") ||
+		!reflect.DeepEqual(actions[0].Buttons, [][]string{{"listprojects:1:octo-org"}}) {
+		t.Errorf("Expected the next page of the organization, got %+v", actions[0])
+	}
+}
+
+func TestListProjectsOfMissingOrganization(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubOrgProjects(t).URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	text := sentText(t,
+		rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/listProjects org missing")))
+	if text != "no organization missing" {
+		t.Errorf("Expected the organization not to be found, got %q", text)
+	}
+}
+
+func TestListProjectsShowsTypingFirst(t *testing.T) {
+	t.Parallel()
+
+	var dispatched []response.BotAction
+
+	deps := githubDeps(fakeGithubItems(t, map[string][]string{}).URL)
+	ctx := context.Background()
+	deps.Dispatch = func(_ context.Context, actions []response.BotAction) {
+		dispatched = append(dispatched, actions...)
+	}
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	message := privateText("/listProjects")
+	rootHandlerWith(deps, userData).PrivateTextMessage(ctx, message)
+
+	if !reflect.DeepEqual(dispatched, []response.BotAction{response.Typing(message.Chat.ID)}) {
+		t.Errorf("Expected typing before the GitHub request, got %#v", dispatched)
+	}
+}
+
+func TestListProjectsNextPageEditsTheMessage(t *testing.T) {
+	t.Parallel()
+
+	server := fakeGithubProjectPages(t, func(string, string) (bool, bool) { return false, true })
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/listProjects"))
+
+	press := callbackQuery("listprojects:0")
+	message, _ := press.Message.Unwrap()
+	message.ID = 99
+	press.Message = option.Some(message)
+
+	transition = state.NewRootState().Handler(transition.UserData, testResponses(), deps).CallbackQuery(ctx, press)
+
+	actions := statetest.DecodeActions(t, transition)
+	if len(actions) != 2 || actions[0].Endpoint != "editMessageText" || actions[1].Endpoint != "answerCallbackQuery" {
+		t.Fatalf("Expected the page to be edited in and the button answered, got %+v", actions)
+	}
+
+	var edited struct {
+		MessageID int64 `json:"message_id"`
+	}
+
+	if err := json.Unmarshal(actions[0].Body, &edited); err != nil || edited.MessageID != 99 {
+		t.Errorf("Expected the message of the button to be edited, got %s (%v)", actions[0].Body, err)
+	}
+
+	if !strings.Contains(actions[0].Text, "Project 9") || !reflect.DeepEqual(actions[0].Buttons,
+		[][]string{{"listprojectsback:1", "listprojects:2"}}) {
+		t.Errorf("Expected the next page with its own buttons, got %+v", actions[0])
+	}
+}
@@ -0,0 +1,99 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+)
+
+/*
+The functions below format the parts of messages that are built by the handlers (e.g. reports and project lists) in
+the parse mode of the bot, see response.SetDefaultParseMode. Text that comes from GitHub or the user must be escaped
+with escapeMarkup first, the other functions expect escaped text, so that they can be nested. Plain text that isn't
+nested is formatted with response.Code, response.Bold and response.Link, which escape it themselves.
+*/
+
+// escapeMarkup escapes `text`, so it's shown as it is.
+func escapeMarkup(text string) string {
+	if response.DefaultParseMode() == response.ParseModeMarkdownV2 {
+		return response.EscapeMarkdownV2(text)
+	}
+
+	return response.EscapeHTML(text)
+}
+
+func boldMarkup(text string) string {
+	if response.DefaultParseMode() == response.ParseModeMarkdownV2 {
+		return "*" + text + "*"
+	}
+
+	return "<b>" + text + "</b>"
+}
+
+func italicMarkup(text string) string {
+	if response.DefaultParseMode() == response.ParseModeMarkdownV2 {
+		return "_" + text + "_"
+	}
+
+	return "<i>" + text + "</i>"
+}
+
+func underlineMarkup(text string) string {
+	if response.DefaultParseMode() == response.ParseModeMarkdownV2 {
+		return "__" + text + "__"
+	}
+
+	return "<u>" + text + "</u>"
+}
+
+// linkMarkup links `text` to `url`. Unlike `text`, the URL is escaped by linkMarkup.
+func linkMarkup(text, url string) string {
+	if response.DefaultParseMode() == response.ParseModeMarkdownV2 {
+		return "[" + text + "](" + escapeURLMarkup(url) + ")"
+	}
+
+	return fmt.Sprintf("<a href=%q>%s</a>", escapeURLMarkup(url), text)
+}
+
+// escapeURLMarkup escapes `url` for the href of a link, e.g. in a template.
+func escapeURLMarkup(url string) string {
+	if response.DefaultParseMode() == response.ParseModeMarkdownV2 {
+		return response.EscapeMarkdownV2URL(url)
+	}
+
+	return response.EscapeHTML(url)
+}
+
+/*
+userMarkup is text typed by the user, e.g. the answers of /dailyStatus. HTML is kept, so that users can format their
+answers. MarkdownV2 is escaped, because plain text often has "." or "-" that would make the message invalid.
+*/
+func userMarkup(text string) string {
+	if response.DefaultParseMode() == response.ParseModeMarkdownV2 {
+		return response.EscapeMarkdownV2(text)
+	}
+
+	return text
+}
+
+/*
+githubErrorMessage is the escaped message of a GraphQL error from GitHub, or `generic` (which isn't escaped) for other
+errors. The message can have anything in it, e.g. the project ID that the user typed. If GitHub has rejected the key
+the message is `unauthorized`, so that the user knows to add it again. The error is recorded for /errors.
+*/
+func githubErrorMessage(deps *Deps, err error, unauthorized, generic string) string {
+	deps.recordError(ErrorSourceGithub, err)
+
+	var unauthorizedErr github.UnauthorizedError
+	if errors.As(err, &unauthorizedErr) {
+		return unauthorized
+	}
+
+	if message, isGqlError := github.GqlErrorString(err); isGqlError {
+		return "GitHub API error: " + escapeMarkup(message)
+	}
+
+	return generic
+}
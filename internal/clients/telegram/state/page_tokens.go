@@ -0,0 +1,100 @@
+package state
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/cache"
+)
+
+// maxPageTokens is how many pagination buttons of a chat keep working. Buttons with older tokens expire.
+const maxPageTokens = 20
+
+/*
+PageTokens keeps GitHub cursors under short tokens. Cursors can be long and mean nothing to the user, so pagination
+buttons only carry the token in their callback data and the cursor is looked up when the button is pressed.
+*/
+type PageTokens struct {
+	// Next is used to create the next token
+	Next    uint64
+	Entries []PageToken
+}
+
+type PageToken struct {
+	Token  string
+	Cursor github.ProjectCursor
+}
+
+// Add saves the cursor and returns a token for it. If there are too many tokens the oldest one expires.
+func (p *PageTokens) Add(cursor github.ProjectCursor) string {
+	const base = 36
+
+	token := strconv.FormatUint(p.Next, base)
+	p.Next++
+
+	entries := p.Entries
+	if len(entries) >= maxPageTokens {
+		entries = entries[len(entries)-maxPageTokens+1:]
+	}
+
+	// Always copy, so that a Resolve of the previous PageTokens never reads this entry while it is written
+	p.Entries = append(entries[:len(entries):len(entries)], PageToken{Token: token, Cursor: cursor})
+
+	return token
+}
+
+// Resolve returns the cursor that was saved under `token`. Returns false if the token has expired or never existed.
+func (p PageTokens) Resolve(token string) (github.ProjectCursor, bool) {
+	for _, entry := range p.Entries {
+		if entry.Token == token {
+			return entry.Cursor, true
+		}
+	}
+
+	return "", false
+}
+
+/*
+ChatPageTokens keeps the PageTokens of each chat. The tokens belong to the chat and not to the user who ran the command,
+so that everyone who can see a pagination button can press it. The tokens of a chat are forgotten `ttl` after the last
+one was added.
+*/
+type ChatPageTokens struct {
+	// mu makes Add a single step, the cache itself only locks each Get and Set
+	mu    sync.Mutex
+	chats *cache.Cache[update.ChatID, PageTokens]
+	ttl   time.Duration
+}
+
+// NewChatPageTokens creates an empty store where the tokens of a chat expire `ttl` after the last one was added.
+func NewChatPageTokens(ttl time.Duration) *ChatPageTokens {
+	return &ChatPageTokens{mu: sync.Mutex{}, chats: cache.New[update.ChatID, PageTokens](), ttl: ttl}
+}
+
+// PruneEvery forgets expired tokens every `interval` until the context is done. Run it in a goroutine.
+func (c *ChatPageTokens) PruneEvery(ctx context.Context, interval time.Duration) {
+	c.chats.PruneEvery(ctx, interval)
+}
+
+// Add saves the cursor of a button in `chatID` and returns a token for it.
+func (c *ChatPageTokens) Add(chatID update.ChatID, cursor github.ProjectCursor) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tokens, _ := c.chats.Get(chatID)
+	token := tokens.Add(cursor)
+	c.chats.Set(chatID, tokens, c.ttl)
+
+	return token
+}
+
+// Resolve returns the cursor of a button in `chatID`. Returns false if the token has expired or never existed.
+func (c *ChatPageTokens) Resolve(chatID update.ChatID, token string) (github.ProjectCursor, bool) {
+	tokens, _ := c.chats.Get(chatID)
+
+	return tokens.Resolve(token)
+}
@@ -0,0 +1,66 @@
+package state_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+)
+
+func TestPageTokensResolve(t *testing.T) {
+	t.Parallel()
+
+	var tokens state.PageTokens
+
+	first := tokens.Add("Y3Vyc29yOnYyOpHOAAAAAQ==")
+	second := tokens.Add("Y3Vyc29yOnYyOpHOAAAAAg==")
+
+	if first == second {
+		t.Fatalf("Two cursors got the same token %q", first)
+	}
+
+	if cursor, isSome := tokens.Resolve(second); !isSome || cursor != "Y3Vyc29yOnYyOpHOAAAAAg==" {
+		t.Fatalf("Token %q resolved to %q, %t", second, cursor, isSome)
+	}
+
+	if _, isSome := tokens.Resolve("unknown"); isSome {
+		t.Fatal("Unknown token was resolved")
+	}
+}
+
+func TestPageTokensExpire(t *testing.T) {
+	t.Parallel()
+
+	var tokens state.PageTokens
+
+	oldest := tokens.Add("cursor0")
+	older := tokens
+
+	for i := 1; i <= 100; i++ {
+		tokens.Add(github.ProjectCursor(fmt.Sprintf("cursor%d", i)))
+	}
+
+	if _, isSome := tokens.Resolve(oldest); isSome {
+		t.Fatal("The oldest token did not expire")
+	}
+
+	if cursor, isSome := tokens.Resolve(tokens.Entries[len(tokens.Entries)-1].Token); !isSome || cursor != "cursor100" {
+		t.Fatalf("The newest token resolved to %q, %t", cursor, isSome)
+	}
+
+	if len(older.Entries) != 1 {
+		t.Fatalf("Adding tokens has changed a copy of the store: %v", older.Entries)
+	}
+}
+
+func TestExpiredPageButton(t *testing.T) {
+	t.Parallel()
+
+	transition := rootHandler(state.NewUserSharedData()).CallbackQuery(context.Background(),
+		callbackQuery("listprojects:abc"))
+
+	statetest.AssertAnswersCallback(t, transition, "page expired", true)
+}
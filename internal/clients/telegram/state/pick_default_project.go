@@ -0,0 +1,284 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
+)
+
+const (
+	pickDefaultProjectCommand = "pickdefaultproject"
+	// projectsOnPickerPage is how many project buttons /pickDefaultProject shows at once
+	projectsOnPickerPage = 10
+
+	// pickProjectCallbackPrefix is followed by a ProjectChoice token in the project buttons of /pickDefaultProject
+	pickProjectCallbackPrefix = "pickproject:"
+	// pickPageCallbackPrefix is followed by a PageTokens token in the "Next page" button of /pickDefaultProject
+	pickPageCallbackPrefix = "pickpage:"
+)
+
+// PickDefaultProjectHandler lets the user set the default project by pressing a button instead of sending its ID.
+type PickDefaultProjectHandler struct {
+	responses     *pickDefaultProjectResponses
+	rootResponses *rootResponses
+	userData      UserSharedData
+	deps          *Deps
+	PickDefaultProjectState
+}
+
+func (s *PickDefaultProjectHandler) PrivateTextMessage(_ context.Context, message update.PrivateTextMessage,
+) Transition {
+	if cmd, isCmd := slashcmd.Parse(message.Text); isCmd && strings.ToLower(cmd.Method) == cancelCommand {
+		logging.Tracef("%s %s Cancel /pickDefaultProject ; Return to RootState", message.UpdateID.Log(),
+			message.From.Log())
+
+		return Transit(s.RootState, s.userData).Reply(message.Chat.ID, s.responses.Canceled).Build()
+	}
+
+	return Transit(s.PickDefaultProjectState, s.userData).
+		Reply(message.Chat.ID, s.responses.UseButtons).
+		Build()
+}
+
+// GroupTextMessage only reacts to /cancel, because other people in the group keep talking while the buttons are shown.
+func (s *PickDefaultProjectHandler) GroupTextMessage(ctx context.Context, message update.GroupTextMessage,
+) Transition {
+	if cmd, isCmd := slashcmd.Parse(message.Text); isCmd && strings.ToLower(cmd.Method) == cancelCommand {
+		logging.Tracef("%s %s Cancel /pickDefaultProject ; Return to RootState", message.UpdateID.Log(),
+			message.From.Log())
+
+		return Transit(s.RootState, s.userData).Reply(message.Chat.ID, s.responses.Canceled).Build()
+	}
+
+	return s.Ignore(ctx)
+}
+
+func (s *PickDefaultProjectHandler) CallbackQuery(ctx context.Context, cq update.CallbackQuery) Transition {
+	message, isSome := cq.Message.Unwrap()
+	if !isSome {
+		return s.answerAlert(cq, s.responses.ButtonExpired)
+	}
+
+	data := cq.Data.UnwrapOr("")
+
+	if token, isPage := strings.CutPrefix(data, pickPageCallbackPrefix); isPage {
+		return s.handleNextPage(ctx, cq, message, token)
+	}
+
+	if token, isProject := strings.CutPrefix(data, pickProjectCallbackPrefix); isProject {
+		return s.handlePick(ctx, cq, message, token)
+	}
+
+	return s.answerAlert(cq, s.responses.UseButtons)
+}
+
+func (s *PickDefaultProjectHandler) Ignore(_ context.Context) Transition {
+	return Transit(s.PickDefaultProjectState, s.userData).Build()
+}
+
+func (s *PickDefaultProjectHandler) Unwind(_ context.Context, _ update.ChatID) Transition {
+	return Transit(s.PickDefaultProjectState, s.userData).Build()
+}
+
+// handlePick saves the project behind the pressed button as the default, the same way /setDefaultProject does.
+func (s *PickDefaultProjectHandler) handlePick(ctx context.Context, cq update.CallbackQuery, message update.Message,
+	token string,
+) Transition {
+	projectID, isSome := s.Resolve(token)
+	if !isSome {
+		logging.Tracef("%s Project token %q has expired", cq.Log(), token)
+
+		return s.answerAlert(cq, s.responses.ButtonExpired)
+	}
+
+	logging.Tracef("%s Picked (ProjectID %s) as the default project", cq.Log(), projectID)
+
+	root := RootHandler{
+		responses: s.rootResponses, reportTemplates: nil, userData: s.userData, deps: s.deps, RootState: s.RootState,
+	}
+
+	transition := root.saveDefaultProject(ctx, string(projectID), message.Chat.ID)
+	transition.Actions = append(transition.Actions, response.CallbackQueryAck(cq.ID))
+
+	return transition
+}
+
+// handleNextPage shows the next page of project buttons. Buttons of the previous pages stop working.
+func (s *PickDefaultProjectHandler) handleNextPage(ctx context.Context, cq update.CallbackQuery,
+	message update.Message, token string,
+) Transition {
+	cursor, isSome := s.deps.PageTokens.Resolve(message.Chat.ID, token)
+	if !isSome {
+		logging.Tracef("%s Page token %q has expired", cq.Log(), token)
+
+		return s.answerAlert(cq, s.responses.ButtonExpired)
+	}
+
+	key, isSome := s.userData.GithubAPIKey.Unwrap()
+	if !isSome {
+		return Transit(s.RootState, s.userData).Reply(message.Chat.ID, s.responses.NoAPIKeyAdded).Build()
+	}
+
+	projectsPage, err := s.deps.githubClient(key).ListViewerProjects(ctx, projectsOnPickerPage, option.Some(cursor))
+	if err != nil {
+		logging.Errorf("%s While getting projects for /pickDefaultProject: %s", cq.Log(), err)
+		s.deps.recordError(ErrorSourceGithub, err)
+
+		var unauthorized github.UnauthorizedError
+		if errors.As(err, &unauthorized) {
+			return s.answerAlert(cq, s.responses.GithubUnauthorized)
+		}
+
+		// Alerts are plain text, so the message isn't escaped
+		return s.answerAlert(cq, github.GqlErrorStringOr("GitHub API error: %s", err, s.responses.GithubErrorGeneric))
+	}
+
+	projects := projectsPage.Projects
+
+	if len(projects) == 0 {
+		return s.answerAlert(cq, s.responses.LastProjectsPage)
+	}
+
+	page := s.Page(message.Chat.ID, s.responses.PickDefaultProject, s.responses.NextPageButton, projects,
+		s.deps.PageTokens)
+
+	return Transit(s.PickDefaultProjectState, s.userData).
+		Action(page).
+		Action(response.CallbackQueryAck(cq.ID)).
+		Build()
+}
+
+// answerAlert keeps the current state and answers the callback query with an alert.
+func (s *PickDefaultProjectHandler) answerAlert(cq update.CallbackQuery, text string) Transition {
+	return Transit(s.PickDefaultProjectState, s.userData).
+		Action(response.CallbackQueryAnswerAlert(cq.ID, text)).
+		Build()
+}
+
+/*
+handlePickDefaultProject shows the first page of the user's projects as buttons and transitions into
+PickDefaultProjectState, where pressing a button saves the project as the default for this chat.
+*/
+func (s *RootHandler) handlePickDefaultProject(ctx context.Context, updateID update.UpdateID, chatID update.ChatID,
+) Transition {
+	key, isSome := s.userData.GithubAPIKey.Unwrap()
+	if !isSome {
+		logging.Tracef("%s Tried to pick a default project without adding an API key", updateID.Log())
+
+		return s.replyWithMessage(chatID, s.responses.NoAPIKeyAdded)
+	}
+
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	projectsPage, err := s.deps.githubClient(key).ListViewerProjects(ctx, projectsOnPickerPage,
+		option.None[github.ProjectCursor]())
+	if err != nil {
+		logging.Errorf("%s While getting projects for /pickDefaultProject: %s", updateID.Log(), err)
+
+		return s.replyWithMessage(chatID, githubErrorMessage(s.deps, err, s.responses.GithubUnauthorized,
+			s.responses.GithubErrorGeneric))
+	}
+
+	projects := projectsPage.Projects
+
+	if len(projects) == 0 {
+		return s.replyWithMessage(chatID, s.responses.UserHasZeroProjects)
+	}
+
+	logging.Tracef("%s Transition into PickDefaultProjectState", updateID.Log())
+
+	picker := PickDefaultProjectState{RootState: s.RootState, Choices: []ProjectChoice{}, NextToken: 0}
+	page := picker.Page(chatID, s.responses.PickDefaultProject, s.responses.PickNextPageButton, projects,
+		s.deps.PageTokens)
+
+	return Transit(picker, s.userData).Action(page).Build()
+}
+
+type PickDefaultProjectState struct {
+	RootState
+	// Choices are the projects on the buttons of the last page. Buttons of older pages expire.
+	Choices []ProjectChoice
+	// NextToken is used to create the token of the next button
+	NextToken uint64
+}
+
+// ProjectChoice is a project button. Only the token is sent in the callback data, because project IDs are long.
+type ProjectChoice struct {
+	Token string
+	ID    github.ProjectID
+}
+
+/*
+Page creates a message with a button for each project and replaces the choices with them. If the page is full a
+"Next page" button is added, its cursor is kept in `pageTokens`.
+*/
+func (s *PickDefaultProjectState) Page(chatID update.ChatID, text, nextPageButton string,
+	projects []github.ProjectV2, pageTokens *ChatPageTokens,
+) response.SendMessage {
+	const base = 36
+
+	choices := make([]ProjectChoice, 0, len(projects))
+	buttons := make([][]response.InlineKeyboardButton, 0, len(projects)+1)
+
+	for _, project := range projects {
+		token := strconv.FormatUint(s.NextToken, base)
+		s.NextToken++
+
+		choices = append(choices, ProjectChoice{Token: token, ID: project.ID})
+		buttons = append(buttons, []response.InlineKeyboardButton{
+			response.InlineButtonCallback(project.Title, pickProjectCallbackPrefix+token),
+		})
+	}
+
+	if len(projects) == projectsOnPickerPage {
+		buttons = append(buttons, []response.InlineKeyboardButton{
+			response.InlineButtonCallback(nextPageButton,
+				pickPageCallbackPrefix+pageTokens.Add(chatID, projects[len(projects)-1].Cursor)),
+		})
+	}
+
+	s.Choices = choices
+
+	return response.NewSendMessage(chatID, text).SetReplyMarkup(buttons)
+}
+
+// Resolve returns the project of the button with `token`. Returns false if the button is from an older page.
+func (s PickDefaultProjectState) Resolve(token string) (github.ProjectID, bool) {
+	for _, choice := range s.Choices {
+		if choice.Token == token {
+			return choice.ID, true
+		}
+	}
+
+	return "", false
+}
+
+func (s PickDefaultProjectState) Handler(userData UserSharedData, resp *Responses, deps *Deps) Handler {
+	return &PickDefaultProjectHandler{
+		responses:               &resp.PickDefaultProject,
+		rootResponses:           &resp.Root,
+		userData:                userData,
+		deps:                    deps,
+		PickDefaultProjectState: s,
+	}
+}
+
+type pickDefaultProjectResponses struct {
+	PickDefaultProject string `template:"pickDefaultProject"`
+	NextPageButton     string `template:"nextPageButton"`
+	UseButtons         string `template:"useButtons"`
+	Canceled           string `template:"canceled"`
+	ButtonExpired      string `template:"buttonExpired"`
+	LastProjectsPage   string `template:"lastProjectsPage"`
+	NoAPIKeyAdded      string `template:"noApiKeyAdded"`
+	GithubErrorGeneric string `template:"githubErrorGeneric"`
+	GithubUnauthorized string `template:"githubUnauthorized"`
+}
@@ -0,0 +1,109 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// fakeGithubProjects answers ViewerProjectsV2 with two projects and ProjectV2ByID with the second one.
+func fakeGithubProjects(t *testing.T) *statetest.GithubServer {
+	t.Helper()
+
+	return statetest.FakeGithub(t, map[string]string{
+		"ViewerProjectsV2": `{"data": {"viewer": {"projectsV2": {"edges": [
+{"cursor": "MQ", "node": {"id": "PVT_1", "title": "First", "number": 1, "url": "",
+	"creator": {"__typename": "User", "login": "octocat", "url": ""}}},
+{"cursor": "Mg", "node": {"id": "PVT_2", "title": "Second", "number": 2, "url": "",
+	"creator": {"__typename": "User", "login": "octocat", "url": ""}}}
+]}}}}`,
+		"ProjectV2ByID": `{"data": {"node": {"__typename": "ProjectV2", "id": "PVT_2", "title": "Second", "number": 2,
+"url": "", "creator": {"__typename": "User", "login": "octocat", "url": ""}}}}`,
+	})
+}
+
+// startPicker uses /pickDefaultProject and returns the transition into PickDefaultProjectState.
+func startPicker(ctx context.Context, t *testing.T, deps *state.Deps) state.Transition {
+	t.Helper()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText("/pickDefaultProject"))
+
+	buttons := statetest.AssertSendsMessage(t, transition, testChatID, "pick a project").Buttons
+	if len(buttons) != 2 || buttons[0][0] != "pickproject:0" || buttons[1][0] != "pickproject:1" {
+		t.Fatalf("Expected a button for each project, got %v", buttons)
+	}
+
+	if _, is := transition.NewState.(state.PickDefaultProjectState); !is {
+		t.Fatalf("Expected PickDefaultProjectState, got %T", transition.NewState)
+	}
+
+	return transition
+}
+
+func TestPickDefaultProject(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubProjects(t).URL)
+	ctx := context.Background()
+	transition := startPicker(ctx, t, deps)
+
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		CallbackQuery(ctx, callbackQuery("pickproject:1"))
+
+	statetest.AssertSendsMessage(t, transition, testChatID, `saved "Second"`)
+	statetest.AssertAnswersCallback(t, transition, "", false)
+
+	root, is := transition.NewState.(state.RootState)
+	if !is {
+		t.Fatalf("Expected RootState after picking a project, got %T", transition.NewState)
+	}
+
+	if len(root.DefaultProjects) != 1 || root.DefaultProjects[0] != "PVT_2" {
+		t.Fatalf("Expected PVT_2 to be the default project, got %v", root.DefaultProjects)
+	}
+}
+
+func TestPickDefaultProjectExpiredButton(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubProjects(t).URL)
+	ctx := context.Background()
+	transition := startPicker(ctx, t, deps)
+
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		CallbackQuery(ctx, callbackQuery("pickproject:9"))
+
+	statetest.AssertAnswersCallback(t, transition, "button expired", true)
+
+	if _, is := transition.NewState.(state.PickDefaultProjectState); !is {
+		t.Fatalf("An expired button has left PickDefaultProjectState: %T", transition.NewState)
+	}
+}
+
+func TestPickDefaultProjectCancel(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubProjects(t).URL)
+	ctx := context.Background()
+	transition := startPicker(ctx, t, deps)
+
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		PrivateTextMessage(ctx, privateText("/cancel"))
+
+	statetest.AssertSendsMessage(t, transition, testChatID, "canceled")
+
+	root, is := transition.NewState.(state.RootState)
+	if !is {
+		t.Fatalf("Expected RootState after /cancel, got %T", transition.NewState)
+	}
+
+	if len(root.DefaultProjects) != 0 {
+		t.Fatalf("/cancel has changed the default projects: %v", root.DefaultProjects)
+	}
+}
@@ -0,0 +1,206 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
+)
+
+const (
+	// maxRecentErrors is how many errors of a user are kept for /errors. Older errors are forgotten.
+	maxRecentErrors = 10
+	// maxErrorDetailLength is how many characters of RecentError.Detail are kept, so that all errors fit in a message
+	maxErrorDetailLength = 300
+)
+
+// ErrorSource is the API that an error came from.
+type ErrorSource string
+
+const (
+	ErrorSourceGithub   ErrorSource = "GitHub"
+	ErrorSourceTelegram ErrorSource = "Telegram"
+)
+
+// RecentError is an error that the user ran into. See RecentErrors.
+type RecentError struct {
+	Source ErrorSource
+	// Summary says what kind of error it was without any details, e.g. "network error"
+	Summary string
+	// Detail is the whole error without URLs (they can have the token of the bot). Only shown with /debug on.
+	Detail string
+	At     time.Time
+}
+
+// RecentErrors are the last errors of a user from oldest to newest, shown by /errors.
+type RecentErrors []RecentError
+
+// Add returns a copy of the errors with `err` added. If there are too many errors the oldest one is forgotten.
+func (e RecentErrors) Add(source ErrorSource, err error, at time.Time) RecentErrors {
+	kept := e
+	if len(kept) >= maxRecentErrors {
+		kept = kept[len(kept)-maxRecentErrors+1:]
+	}
+
+	return append(kept[:len(kept):len(kept)], RecentError{
+		Source:  source,
+		Summary: summarizeError(err),
+		Detail:  redactErrorURL(err),
+		At:      at,
+	})
+}
+
+// summarizeError names the kind of `err` in a way that is safe to show to anyone.
+func summarizeError(err error) string {
+	var (
+		abuse  github.AbuseDetectionError
+		apiErr response.APIError
+		urlErr *url.Error
+	)
+
+	switch {
+	case errors.As(err, &abuse):
+		return "asked to slow down"
+	case errors.As(err, &apiErr):
+		return fmt.Sprintf("API error %d", apiErr.ErrorCode)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timed out"
+	case errors.As(err, &urlErr):
+		return "network error"
+	}
+
+	if _, isGqlError := github.GqlErrorString(err); isGqlError {
+		return "API error"
+	}
+
+	return "request failed"
+}
+
+/*
+redactErrorURL is the text of `err` with the URL of a failed request replaced, because Telegram's has the bot token.
+Long errors are cut at maxErrorDetailLength.
+*/
+func redactErrorURL(err error) string {
+	text := err.Error()
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.URL != "" {
+		text = strings.ReplaceAll(text, urlErr.URL, "[url]")
+	}
+
+	if runes := []rune(text); len(runes) > maxErrorDetailLength {
+		text = string(runes[:maxErrorDetailLength-1]) + "…"
+	}
+
+	return text
+}
+
+/*
+isTransient returns true for errors that can go away on their own, so that the same request may work later: timeouts,
+network errors, server errors of GitHub and its abuse detection.
+*/
+func isTransient(err error) bool {
+	var (
+		unauthorized github.UnauthorizedError
+		abuse        github.AbuseDetectionError
+		unavailable  github.UnavailableError
+		urlErr       *url.Error
+	)
+
+	switch {
+	case errors.As(err, &unauthorized):
+		return false
+	case errors.As(err, &abuse), errors.As(err, &unavailable), errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+
+	return errors.As(err, &urlErr)
+}
+
+// errorCollector gathers the errors of one update, Handle adds them to the user's RecentErrors.
+type errorCollector struct {
+	mu     sync.Mutex
+	errors RecentErrors
+	// transient is set if a GitHub error of the update is transient, see isTransient
+	transient bool
+}
+
+// addTo returns `recent` with the collected errors added.
+func (c *errorCollector) addTo(recent RecentErrors) RecentErrors {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, collected := range c.errors {
+		recent = append(recent[:len(recent):len(recent)], collected)
+	}
+
+	if len(recent) > maxRecentErrors {
+		recent = recent[len(recent)-maxRecentErrors:]
+	}
+
+	return recent
+}
+
+const (
+	errorsCommand = "errors"
+	debugCommand  = "debug"
+)
+
+/*
+handleErrors lists the user's RecentErrors, newest first. Only the kind of each error is shown unless the user has
+turned on /debug, because the details can have IDs and names from GitHub in them.
+*/
+func (s *RootHandler) handleErrors(chatID update.ChatID) Transition {
+	recent := s.userData.RecentErrors
+	if len(recent) == 0 {
+		return s.replyWithMessage(chatID, s.responses.ErrorsEmpty)
+	}
+
+	text := s.responses.ErrorsHeader
+
+	for i := len(recent) - 1; i >= 0; i-- {
+		recentErr := recent[i]
+
+		text += fmt.Sprintf("\n• %s %s",
+			response.Code(recentErr.At.UTC().Format("2006-01-02 15:04:05 MST")),
+			escapeMarkup(fmt.Sprintf("%s: %s", recentErr.Source, recentErr.Summary)))
+
+		if s.userData.Debug {
+			text += "\n" + response.Code(recentErr.Detail)
+		}
+	}
+
+	if !s.userData.Debug && s.responses.ErrorsDetailsHidden != "" {
+		text += "\n\n" + s.responses.ErrorsDetailsHidden
+	}
+
+	return s.replyWithMessage(chatID, text)
+}
+
+// handleDebug turns the details of /errors on or off.
+func (s *RootHandler) handleDebug(cmd slashcmd.Command, chatID update.ChatID) Transition {
+	if len(cmd.Args) != 1 {
+		return s.replyWithMessage(chatID, s.responses.DebugUsage)
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "on":
+		s.userData.Debug = true
+
+		return s.replyWithMessage(chatID, s.responses.DebugOn)
+	case "off":
+		s.userData.Debug = false
+
+		return s.replyWithMessage(chatID, s.responses.DebugOff)
+	}
+
+	return s.replyWithMessage(chatID, s.responses.DebugUsage)
+}
@@ -0,0 +1,117 @@
+package state_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestRecentErrorsAreCapped(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	recent := state.RecentErrors{}
+
+	for i := 0; i < state.MaxRecentErrors+3; i++ {
+		recent = recent.Add(state.ErrorSourceGithub, fmt.Errorf("error %d", i), start.Add(time.Duration(i)*time.Minute))
+	}
+
+	if len(recent) != state.MaxRecentErrors {
+		t.Fatalf("Expected %d errors, got %d", state.MaxRecentErrors, len(recent))
+	}
+
+	newest := recent[len(recent)-1]
+	if recent[0].Detail != "error 3" || newest.Detail != fmt.Sprintf("error %d", state.MaxRecentErrors+2) {
+		t.Errorf("Expected the oldest errors to be forgotten, got %q ... %q", recent[0].Detail, newest.Detail)
+	}
+}
+
+func TestRecentErrorsRedactURLs(t *testing.T) {
+	t.Parallel()
+
+	err := fmt.Errorf("network error: %w", &url.Error{
+		Op: "Post", URL: "https://api.telegram.org/bot123:secret/sendMessage", Err: errors.New("connection reset"),
+	})
+
+	recent := state.RecentErrors{}.Add(state.ErrorSourceTelegram, err, time.Now())
+	if strings.Contains(recent[0].Detail, "secret") || recent[0].Summary != "network error" {
+		t.Errorf("Expected the URL to be redacted, got %+v", recent[0])
+	}
+
+	apiErr := response.APIError{ErrorCode: 400, Description: "Bad Request: can't parse entities"}
+
+	recent = recent.Add(state.ErrorSourceTelegram, apiErr, time.Now())
+	if recent[1].Summary != "API error 400" || !strings.Contains(recent[1].Detail, "can't parse entities") {
+		t.Errorf("Wrong summary or details of a Telegram error: %+v", recent[1])
+	}
+}
+
+// fakeGithubGraphQLError answers ViewerProjectsV2 with a GraphQL error.
+func fakeGithubGraphQLError(t *testing.T) *statetest.GithubServer {
+	t.Helper()
+
+	return statetest.FakeGithub(t, map[string]string{
+		"ViewerProjectsV2": `{"errors": [{"message": "Could not resolve to a ProjectV2 with the number 7."}]}`,
+	})
+}
+
+func TestErrorsShowsRecordedGithubErrors(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubGraphQLError(t).URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	allItems := update.Update{
+		ID: 1,
+		Message: option.Some(update.Message{
+			ID: 1, From: option.Some(update.User{ID: testUserID, FirstName: "Test"}),
+			SenderChat: option.None[update.Chat](), Date: 0,
+			Chat: update.Chat{ID: testChatID, Type: update.ChatTypePrivate}, Text: option.Some("/allItems"),
+		}),
+		CallbackQuery: option.None[update.CallbackQuery](),
+	}
+
+	transition := state.Handle(ctx, *deps, allItems, state.NewRootState(), userData, testResponses())
+	if len(transition.UserData.RecentErrors) != 1 {
+		t.Fatalf("Expected the GitHub error to be recorded, got %+v", transition.UserData.RecentErrors)
+	}
+
+	errorsList := sentText(t,
+		rootHandlerWith(deps, transition.UserData).PrivateTextMessage(ctx, privateText("/errors")))
+	if !strings.Contains(errorsList, "GitHub: API error") || strings.Contains(errorsList, "ProjectV2 with the number") {
+		t.Errorf("Expected only the kind of the error without /debug, got %q", errorsList)
+	}
+
+	transition = rootHandlerWith(deps, transition.UserData).PrivateTextMessage(ctx, privateText("/debug on"))
+	if !transition.UserData.Debug {
+		t.Fatal("/debug on didn't turn on the details")
+	}
+
+	errorsList = sentText(t, rootHandlerWith(deps, transition.UserData).PrivateTextMessage(ctx, privateText("/errors")))
+	if !strings.Contains(errorsList, "Could not resolve to a ProjectV2 with the number 7.") {
+		t.Errorf("Expected the details with /debug on, got %q", errorsList)
+	}
+}
+
+func TestErrorsWithoutErrors(t *testing.T) {
+	t.Parallel()
+
+	text := sentText(t, rootHandler(state.NewUserSharedData()).PrivateTextMessage(context.Background(),
+		privateText("/errors")))
+	if text != "no errors" {
+		t.Errorf("Expected the empty reply, got %q", text)
+	}
+}
@@ -0,0 +1,111 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
+)
+
+const reportConfigCommand = "reportconfig"
+
+/*
+ReportColumns are the names of the project columns (statuses) that fill each section of /dailyStatus. Empty columns
+are taken from DailyStatusConfig.
+*/
+type ReportColumns struct {
+	// Today is the "Today I worked on" section
+	Today string
+	// Tomorrow is the "Tomorrow I will work on" section
+	Tomorrow string
+	// InReview is the "In review" section
+	InReview string
+}
+
+// DefaultReportColumns are the columns a new GitHub project board has.
+func DefaultReportColumns() ReportColumns {
+	return ReportColumns{
+		Today:    "Done",
+		Tomorrow: "In Progress",
+		InReview: "In Review",
+	}
+}
+
+// Or fills the empty columns of `c` from `defaults`.
+func (c ReportColumns) Or(defaults ReportColumns) ReportColumns {
+	if c.Today == "" {
+		c.Today = defaults.Today
+	}
+
+	if c.Tomorrow == "" {
+		c.Tomorrow = defaults.Tomorrow
+	}
+
+	if c.InReview == "" {
+		c.InReview = defaults.InReview
+	}
+
+	return c
+}
+
+// DailyStatusConfig is the bot-wide config of /dailyStatus reports.
+type DailyStatusConfig struct {
+	// Columns are used in chats that haven't changed them with /reportConfig
+	Columns ReportColumns
+	// ShowOtherColumns lists items from columns that are not in any section in the "Other" section of the report
+	ShowOtherColumns bool
+}
+
+// DefaultDailyStatusConfig uses the DefaultReportColumns and leaves the other columns out of the report.
+func DefaultDailyStatusConfig() DailyStatusConfig {
+	return DailyStatusConfig{Columns: DefaultReportColumns(), ShowOtherColumns: false}
+}
+
+/*
+Set changes the columns from `key=Column` pairs. Keys are `today`, `tomorrow` and `review`. If any pair is invalid
+the columns are left as they were and false is returned.
+*/
+func (c *ReportColumns) Set(pairs []string) bool {
+	updated := *c
+
+	for _, pair := range pairs {
+		key, column, isPair := strings.Cut(pair, "=")
+		if !isPair || column == "" {
+			return false
+		}
+
+		switch strings.ToLower(key) {
+		case "today":
+			updated.Today = column
+		case "tomorrow":
+			updated.Tomorrow = column
+		case "review":
+			updated.InReview = column
+		default:
+			return false
+		}
+	}
+
+	*c = updated
+
+	return true
+}
+
+/*
+handleReportConfig changes which columns fill the sections of /dailyStatus in this chat. Without arguments replies with
+the current columns.
+*/
+func (s *RootHandler) handleReportConfig(ctx context.Context, cmd slashcmd.Command, chatID update.ChatID) Transition {
+	if !s.ReportColumns.Set(cmd.Args) {
+		return s.replyWithMessage(chatID, s.responses.ReportConfigUsage)
+	}
+
+	columns := s.ReportColumns.Or(s.deps.DailyStatusConfig.Columns)
+
+	return s.replyWithMessage(chatID, fmt.Sprintf(s.responses.ReportConfig,
+		escapeMarkup(columns.Today),
+		escapeMarkup(columns.Tomorrow),
+		escapeMarkup(columns.InReview)))
+}
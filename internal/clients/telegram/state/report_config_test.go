@@ -0,0 +1,154 @@
+package state_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestReportConfigSetAndGet(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	userData := state.NewUserSharedData()
+
+	transition := rootHandler(userData).PrivateTextMessage(ctx,
+		privateText(`/reportConfig today=Shipped tomorrow="Doing now"`))
+
+	root, is := transition.NewState.(state.RootState)
+	if !is {
+		t.Fatalf("Expected RootState, got %T", transition.NewState)
+	}
+
+	// The review column wasn't changed, so it still comes from the bot's config
+	expected := state.ReportColumns{Today: "Shipped", Tomorrow: "Doing now", InReview: ""}
+	if root.ReportColumns != expected {
+		t.Fatalf("Expected %#v, got %#v", expected, root.ReportColumns)
+	}
+
+	// No arguments shows the config without changing it
+	transition = root.Handler(userData, testResponses(), testDeps()).
+		PrivateTextMessage(ctx, privateText("/reportConfig"))
+	if text := sentText(t, transition); text != "Shipped|Doing now|In Review" {
+		t.Fatalf("Expected the current config, got %q", text)
+	}
+}
+
+func TestReportConfigInvalidKeepsColumns(t *testing.T) {
+	t.Parallel()
+
+	transition := rootHandler(state.NewUserSharedData()).PrivateTextMessage(context.Background(),
+		privateText("/reportConfig today=Shipped yesterday=Done"))
+
+	if text := sentText(t, transition); text != "report config usage" {
+		t.Fatalf("Expected the usage message, got %q", text)
+	}
+
+	if root, is := transition.NewState.(state.RootState); !is || root.ReportColumns != state.NewRootState().ReportColumns {
+		t.Fatalf("Invalid config has changed the columns to %#v", root.ReportColumns)
+	}
+}
+
+func TestReportUsesConfiguredColumns(t *testing.T) {
+	t.Parallel()
+
+	root := state.NewRootState()
+	root.ReportColumns.Set([]string{"today=Shipped Today", "tomorrow=Doing"})
+
+	report := state.NewDailyStatusState(root, option.Some("today"), nil).FormatReport(testResponses(),
+		github.ProjectV2ItemsByStatus{
+			"Shipped Today": {{Title: "Shipped item"}},
+			"Done":          {{Title: "Done item"}},
+			"Doing":         {{Title: "Doing item"}},
+			"In Review":     {{Title: "Reviewed item"}},
+		})
+
+	// Each header is followed by the items of its column, in the order of the report
+	position := 0
+
+	for _, section := range []string{
+		"Today I worked on\n• Shipped item\n",
+		"Tomorrow I will work on\n• Doing item\n",
+		"In review\n• Reviewed item",
+	} {
+		index := strings.Index(report[position:], section)
+		if index < 0 {
+			t.Fatalf("The report has no section %q after the previous one:\n%s", section, report)
+		}
+
+		position += index + len(section)
+	}
+
+	// Done is the default today column, it's replaced by Shipped Today and isn't listed anywhere else
+	for _, unexpected := range []string{"Done item", "Other"} {
+		if strings.Contains(report, unexpected) {
+			t.Errorf("The report contains %q:\n%s", unexpected, report)
+		}
+	}
+}
+
+func TestReportUsesBotColumnsAndOtherSection(t *testing.T) {
+	t.Parallel()
+
+	config := state.DailyStatusConfig{
+		Columns:          state.ReportColumns{Today: "Shipped", Tomorrow: "Doing", InReview: "Review"},
+		ShowOtherColumns: true,
+	}
+
+	root := state.NewRootState()
+	root.ReportColumns.Set([]string{"tomorrow=Next"})
+
+	report := state.NewDailyStatusState(root, option.Some("today"), nil).FormatReportWithConfig(testResponses(), config,
+		github.ProjectV2ItemsByStatus{
+			"Shipped": {{Title: "Shipped item"}},
+			"Doing":   {{Title: "Doing item"}},
+			"Next":    {{Title: "Next item"}},
+			"Review":  {{Title: "Reviewed item"}},
+			"Todo":    {{Title: "Todo item"}},
+			"Backlog": {{Title: "Backlog item"}},
+			"":        {{Title: "Item without a status"}},
+		})
+
+	for _, section := range []string{
+		"Today I worked on\n• Shipped item\n",
+		"Tomorrow I will work on\n• Next item\n",
+		"In review\n• Reviewed item\n\n",
+		"Other\n• Backlog item\n• Doing item\n• Todo item",
+	} {
+		if !strings.Contains(report, section) {
+			t.Errorf("The report has no section %q:\n%s", section, report)
+		}
+	}
+
+	if strings.Contains(report, "Item without a status") {
+		t.Errorf("Items without a status are listed:\n%s", report)
+	}
+
+	config.ShowOtherColumns = false
+
+	report = state.NewDailyStatusState(root, option.Some("today"), nil).FormatReportWithConfig(testResponses(), config,
+		github.ProjectV2ItemsByStatus{"Todo": {{Title: "Todo item"}}})
+	if strings.Contains(report, "Other") || strings.Contains(report, "Todo item") {
+		t.Errorf("The other columns are listed when they are turned off:\n%s", report)
+	}
+}
+
+func TestReportConfigShowsBotColumns(t *testing.T) {
+	t.Parallel()
+
+	deps := testDeps()
+	deps.DailyStatusConfig = state.DailyStatusConfig{
+		Columns:          state.ReportColumns{Today: "Shipped", Tomorrow: "Doing", InReview: "Review"},
+		ShowOtherColumns: false,
+	}
+
+	transition := rootHandlerWith(deps, state.NewUserSharedData()).PrivateTextMessage(context.Background(),
+		privateText("/reportConfig"))
+	if text := sentText(t, transition); text != "Shipped|Doing|Review" {
+		t.Fatalf("Expected the bot's columns, got %q", text)
+	}
+}
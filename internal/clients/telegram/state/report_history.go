@@ -0,0 +1,42 @@
+package state
+
+import "time"
+
+// StoredReport is a /dailyStatus report that was sent to a user.
+type StoredReport struct {
+	Text      string
+	CreatedAt time.Time
+}
+
+// ReportHistory are the user's last reports from oldest to newest.
+type ReportHistory []StoredReport
+
+// ReportRetention limits how many reports are kept per user. Zero values mean there is no limit.
+type ReportRetention struct {
+	// Keep is how many of the newest reports are kept
+	Keep uint
+	// MaxAge is how old a report can be before it is deleted
+	MaxAge time.Duration
+}
+
+// Add returns a copy of the history with the report added.
+func (h ReportHistory) Add(text string, createdAt time.Time) ReportHistory {
+	return append(h[:len(h):len(h)], StoredReport{Text: text, CreatedAt: createdAt})
+}
+
+// Prune returns the reports that are allowed by the `retention` at time `now`. The history itself is not changed.
+func (h ReportHistory) Prune(retention ReportRetention, now time.Time) ReportHistory {
+	kept := h
+
+	if retention.MaxAge != 0 {
+		for len(kept) != 0 && now.Sub(kept[0].CreatedAt) > retention.MaxAge {
+			kept = kept[1:]
+		}
+	}
+
+	if retention.Keep != 0 && uint(len(kept)) > retention.Keep {
+		kept = kept[uint(len(kept))-retention.Keep:]
+	}
+
+	return kept[:len(kept):len(kept)]
+}
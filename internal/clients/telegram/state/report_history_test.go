@@ -0,0 +1,78 @@
+package state_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+)
+
+func historyTexts(history state.ReportHistory) []string {
+	texts := make([]string, len(history))
+	for i, report := range history {
+		texts[i] = report.Text
+	}
+
+	return texts
+}
+
+func testHistory(now time.Time) state.ReportHistory {
+	const day = 24 * time.Hour
+
+	return state.ReportHistory{}.
+		Add("40 days ago", now.Add(-40*day)).
+		Add("10 days ago", now.Add(-10*day)).
+		Add("2 days ago", now.Add(-2*day)).
+		Add("today", now)
+}
+
+func TestReportHistoryKeepsNewest(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	pruned := testHistory(now).Prune(state.ReportRetention{Keep: 2, MaxAge: 0}, now)
+	if texts := historyTexts(pruned); len(texts) != 2 || texts[0] != "2 days ago" || texts[1] != "today" {
+		t.Fatalf("Expected the 2 newest reports, got %v", texts)
+	}
+}
+
+func TestReportHistoryPrunesOld(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	pruned := testHistory(now).Prune(state.ReportRetention{Keep: 0, MaxAge: 30 * 24 * time.Hour}, now)
+	if texts := historyTexts(pruned); len(texts) != 3 || texts[0] != "10 days ago" {
+		t.Fatalf("Expected reports newer than 30 days, got %v", texts)
+	}
+
+	pruned = testHistory(now).Prune(state.ReportRetention{Keep: 1, MaxAge: 30 * 24 * time.Hour}, now)
+	if texts := historyTexts(pruned); len(texts) != 1 || texts[0] != "today" {
+		t.Fatalf("Expected only the newest report, got %v", texts)
+	}
+}
+
+func TestReportHistoryNoLimit(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	if pruned := testHistory(now).Prune(state.ReportRetention{Keep: 0, MaxAge: 0}, now); len(pruned) != 4 {
+		t.Fatalf("Expected all reports to be kept, got %v", historyTexts(pruned))
+	}
+}
+
+func TestReportHistoryPruneDoesntChangeTheOriginal(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	history := testHistory(now)
+
+	pruned := history.Prune(state.ReportRetention{Keep: 1, MaxAge: 0}, now)
+	_ = pruned.Add("new", now)
+
+	if texts := historyTexts(history); len(texts) != 4 || texts[3] != "today" {
+		t.Fatalf("Original history was changed: %v", texts)
+	}
+}
@@ -0,0 +1,149 @@
+package state
+
+import (
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// ReportSection is a titled part of a /dailyStatus report, as data. renderReport turns the sections into text.
+type ReportSection struct {
+	// Title is the title from the ReportTemplate, it's already in markup
+	Title string
+	Items []ReportItem
+	// Text is what the user has written for the section (e.g. the discovery of the day), such sections have no items
+	Text option.Option[string]
+	// Optional sections are left out of the report when they have no items, the others show an empty bullet
+	Optional bool
+}
+
+// ReportItem is an issue, PR or draft in a ReportSection.
+type ReportItem struct {
+	Item github.ProjectV2Item
+	// Reviewers are listed after the item. Empty if the reviewers of the section are not shown.
+	Reviewers []string
+}
+
+// newReportItems makes ReportItems of `items`, with their reviewers if `withReviewers` is true.
+func newReportItems(items []github.ProjectV2Item, withReviewers bool) []ReportItem {
+	reportItems := make([]ReportItem, len(items))
+
+	for i, item := range items {
+		reportItems[i] = ReportItem{Item: item, Reviewers: nil}
+
+		if withReviewers {
+			reportItems[i].Reviewers = item.Reviewers
+		}
+	}
+
+	return reportItems
+}
+
+/*
+reportSections puts `items` into the sections of the report in the order they are shown. `columns` decide which items go
+to which section, the other items are only listed if `showOtherColumns` is true. The sections are titled by
+`reportTemplate`.
+*/
+func (s DailyStatusState) reportSections(reportTemplate ReportTemplate, columns ReportColumns, showOtherColumns bool,
+	items github.ProjectV2ItemsByStatus,
+) []ReportSection {
+	sections := []ReportSection{
+		{
+			Title:    reportTemplate.Today,
+			Items:    newReportItems(items[columns.Today], false),
+			Text:     option.None[string](),
+			Optional: false,
+		},
+		{
+			Title:    reportTemplate.Tomorrow,
+			Items:    newReportItems(items[columns.Tomorrow], false),
+			Text:     option.None[string](),
+			Optional: false,
+		},
+	}
+
+	if dod, isSome := s.DiscoveryOfTheDay.Unwrap(); isSome {
+		sections = append(sections, ReportSection{
+			Title: reportTemplate.Discovery, Items: nil, Text: option.Some(dod), Optional: false,
+		})
+	}
+
+	if blockers, isSome := s.QuestionsAndBlockers.Unwrap(); isSome {
+		sections = append(sections, ReportSection{
+			Title: reportTemplate.Blockers, Items: nil, Text: option.Some(blockers), Optional: false,
+		})
+	}
+
+	sections = append(sections, ReportSection{
+		Title:    reportTemplate.InReview,
+		Items:    newReportItems(items[columns.InReview], s.ShowReviewers),
+		Text:     option.None[string](),
+		Optional: true,
+	})
+
+	if showOtherColumns {
+		sections = append(sections, ReportSection{
+			Title:    reportTemplate.Other,
+			Items:    newReportItems(otherItems(items, columns), false),
+			Text:     option.None[string](),
+			Optional: true,
+		})
+	}
+
+	return sections
+}
+
+/*
+renderReport is the text of the report with the `header` line followed by the `sections`, separated by empty lines.
+Empty optional sections are left out. If the last section is not optional the report ends with an empty line too.
+*/
+func renderReport(header string, sections []ReportSection) string {
+	rendered := make([]string, 0, len(sections))
+	endsWithOptional := false
+
+	for _, section := range sections {
+		if section.Optional && len(section.Items) == 0 && section.Text.IsNone() {
+			continue
+		}
+
+		if text, isSome := section.Text.Unwrap(); isSome {
+			rendered = append(rendered, section.Title+"\n"+userMarkup(text))
+		} else {
+			rendered = append(rendered, section.Title+formatReportItems(section.Items))
+		}
+
+		endsWithOptional = section.Optional
+	}
+
+	report := header + "\n" + strings.Join(rendered, "\n\n")
+	if !endsWithOptional {
+		report += "\n\n"
+	}
+
+	return report
+}
+
+/*
+formatReportItems creates a bullet list where each item is on a new line, including the first one. Items are followed
+by their reviewers.
+*/
+func formatReportItems(items []ReportItem) string {
+	const listSep = "\n• "
+
+	if len(items) == 0 {
+		return listSep // An empty bullet shows that the section is empty
+	}
+
+	list := ""
+
+	for _, item := range items {
+		list += listSep + formatItem(item.Item)
+
+		if len(item.Reviewers) != 0 {
+			list += " — @" + escapeMarkup(strings.Join(item.Reviewers, ", @"))
+		}
+	}
+
+	return list
+}
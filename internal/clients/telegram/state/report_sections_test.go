@@ -0,0 +1,143 @@
+package state_test
+
+import (
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// reportItems has an item in each of the default columns and one in a column that is not in the report.
+func reportItems() github.ProjectV2ItemsByStatus {
+	return github.ProjectV2ItemsByStatus{
+		"Done": {{Title: "x", Content: github.ItemContent{
+			Kind: github.ItemKindIssue, Title: "Fix <b> bug", Number: 12, URL: "https://github.com/o/r/issues/12",
+		}}},
+		"In Progress": {{Title: "raw <i>title</i>"}},
+		"In Review": {{Title: "x", Reviewers: []string{"octocat"}, Content: github.ItemContent{
+			Kind: github.ItemKindPullRequest, Title: "Parser", Number: 7, URL: "https://github.com/o/r/pull/7",
+		}}},
+		"Backlog": {{Title: "x", Content: github.ItemContent{Kind: github.ItemKindDraft, Title: "Someday"}}},
+	}
+}
+
+// sectionTitles are the titles of `sections` in order.
+func sectionTitles(sections []state.ReportSection) []string {
+	titles := make([]string, len(sections))
+	for i, section := range sections {
+		titles[i] = section.Title
+	}
+
+	return titles
+}
+
+func TestReportSectionsOrder(t *testing.T) {
+	t.Parallel()
+
+	status := state.NewDailyStatusState(state.NewRootState(), option.Some("today"), nil)
+	status.DiscoveryOfTheDay = option.Some("Learned about goroutines")
+	status.QuestionsAndBlockers = option.Some("Waiting for access")
+
+	config := state.DefaultDailyStatusConfig()
+	config.ShowOtherColumns = true
+
+	sections := status.ReportSections(testResponses(), config, github.ProjectV2ItemsByStatus{})
+
+	titles := sectionTitles(sections)
+	expected := []string{"Today I worked on", "Tomorrow I will work on", "Discovery", "Blockers", "In review", "Other"}
+
+	if len(titles) != len(expected) {
+		t.Fatalf("Expected sections %q, got %q", expected, titles)
+	}
+
+	for i := range expected {
+		if titles[i] != expected[i] {
+			t.Fatalf("Expected sections %q, got %q", expected, titles)
+		}
+	}
+
+	if text := sections[2].Text.UnwrapOr(""); text != "Learned about goroutines" || len(sections[2].Items) != 0 {
+		t.Errorf("The discovery section has %q and %d items", text, len(sections[2].Items))
+	}
+
+	if sections[0].Optional || sections[1].Optional || !sections[4].Optional || !sections[5].Optional {
+		t.Errorf("Only the review and other sections should be optional: %+v", sections)
+	}
+}
+
+func TestReportSectionsItems(t *testing.T) {
+	t.Parallel()
+
+	status := state.NewDailyStatusState(state.NewRootState(), option.Some("today"), nil)
+	status.ShowReviewers = true
+
+	sections := status.ReportSections(testResponses(), state.DefaultDailyStatusConfig(), reportItems())
+
+	if titles := sectionTitles(sections); len(titles) != 3 {
+		t.Fatalf("Expected today, tomorrow and review sections without other columns, got %q", titles)
+	}
+
+	for i, expected := range []string{"Fix <b> bug", "", "Parser"} {
+		if items := sections[i].Items; len(items) != 1 || items[0].Item.Content.Title != expected {
+			t.Errorf("Expected %q in section %q, got %+v", expected, sections[i].Title, items)
+		}
+	}
+
+	if reviewers := sections[2].Items[0].Reviewers; len(reviewers) != 1 || reviewers[0] != "octocat" {
+		t.Errorf("The reviewers are missing from the review section: %q", reviewers)
+	}
+
+	status.ShowReviewers = false
+
+	if reviewers := status.ReportSections(testResponses(), state.DefaultDailyStatusConfig(), reportItems())[2].
+		Items[0].Reviewers; len(reviewers) != 0 {
+		t.Errorf("The reviewers are listed after /reviewers off: %q", reviewers)
+	}
+}
+
+func TestReportSectionsUseChatColumns(t *testing.T) {
+	t.Parallel()
+
+	status := state.NewDailyStatusState(state.NewRootState(), option.Some("today"), nil)
+	status.ReportColumns.Tomorrow = "Backlog"
+
+	sections := status.ReportSections(testResponses(), state.DefaultDailyStatusConfig(), reportItems())
+
+	if items := sections[1].Items; len(items) != 1 || items[0].Item.Content.Title != "Someday" {
+		t.Errorf("Expected the Backlog column in the tomorrow section, got %+v", items)
+	}
+}
+
+func TestRenderedReportIsUnchanged(t *testing.T) {
+	t.Parallel()
+
+	status := state.NewDailyStatusState(state.NewRootState(), option.Some("today"), nil)
+
+	// Ends with an empty line when the last section is always shown
+	noReview := github.ProjectV2ItemsByStatus{"Done": reportItems()["Done"]}
+	expected := "#daily report <i>today</i>: \nToday I worked on\n" +
+		"• <a href=\"https://github.com/o/r/issues/12\">Issue #12 🔗</a> Fix &lt;b&gt; bug\n\n" +
+		"Tomorrow I will work on\n• \n\n"
+
+	if report := status.FormatReport(testResponses(), noReview); report != expected {
+		t.Errorf("Expected the report\n%q\ngot\n%q", expected, report)
+	}
+
+	status.QuestionsAndBlockers = option.Some("Waiting for access")
+	status.ShowReviewers = true
+
+	config := state.DefaultDailyStatusConfig()
+	config.ShowOtherColumns = true
+
+	expected = "#daily report <i>today</i>: \nToday I worked on\n" +
+		"• <a href=\"https://github.com/o/r/issues/12\">Issue #12 🔗</a> Fix &lt;b&gt; bug\n\n" +
+		"Tomorrow I will work on\n• raw <i>title</i>\n\n" +
+		"Blockers\nWaiting for access\n\n" +
+		"In review\n• <a href=\"https://github.com/o/r/pull/7\">PR #7 🔗</a> Parser — @octocat\n\n" +
+		"Other\n• Someday"
+
+	if report := status.FormatReportWithConfig(testResponses(), config, reportItems()); report != expected {
+		t.Errorf("Expected the report\n%q\ngot\n%q", expected, report)
+	}
+}
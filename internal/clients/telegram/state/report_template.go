@@ -0,0 +1,148 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/template"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
+)
+
+const (
+	reportTemplateCommand = "reporttemplate"
+
+	// reportTemplateGroupPrefix is followed by the name of the report template in the template groups
+	reportTemplateGroupPrefix = "report."
+	// defaultReportTemplate is used for projects without a template of their own
+	defaultReportTemplate = "default"
+)
+
+// ReportTemplate is how the sections of a /dailyStatus report are titled.
+type ReportTemplate struct {
+	Today     string `template:"today"`
+	Tomorrow  string `template:"tomorrow"`
+	Discovery string `template:"discovery"`
+	Blockers  string `template:"blockers"`
+	InReview  string `template:"inReview"`
+	// Other is the section with items from the other columns, see DailyStatusConfig.ShowOtherColumns
+	Other string `template:"other"`
+}
+
+// ReportTemplates are report templates by name.
+type ReportTemplates map[string]ReportTemplate
+
+/*
+LoadReportTemplates fills responses.DailyStatus.Templates from the template groups named "report.<name>". There must
+be a "report.default" group, it is used by all projects that don't have a template chosen with /reportTemplate.
+*/
+func (r *Responses) LoadReportTemplates(templ template.Template) error {
+	templates := make(ReportTemplates)
+
+	for groupName := range templ.Templates {
+		name, isReport := strings.CutPrefix(groupName, reportTemplateGroupPrefix)
+		if !isReport {
+			continue
+		}
+
+		group, err := templ.Get(groupName)
+		if err != nil {
+			return fmt.Errorf("while loading report template %q: %w", name, err)
+		}
+
+		var report ReportTemplate
+		if err = group.Populate(&report); err != nil {
+			return fmt.Errorf("while loading report template %q: %w", name, err)
+		}
+
+		templates[strings.ToLower(name)] = report
+	}
+
+	if _, hasDefault := templates[defaultReportTemplate]; !hasDefault {
+		return template.GroupNotFoundError{Name: reportTemplateGroupPrefix + defaultReportTemplate}
+	}
+
+	r.DailyStatus.Templates = templates
+
+	return nil
+}
+
+/*
+Pick returns the template chosen for the first of `projects` that has one in `choices`. If none of them do, the default
+template is returned.
+*/
+func (t ReportTemplates) Pick(choices map[github.ProjectID]string, projects []github.ProjectID) ReportTemplate {
+	for _, project := range projects {
+		if report, isKnown := t[choices[project]]; isKnown {
+			return report
+		}
+	}
+
+	return t[defaultReportTemplate]
+}
+
+// Names returns the names of all templates sorted alphabetically.
+func (t ReportTemplates) Names() []string {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// handleReportTemplate sets which report template /dailyStatus uses for a project. Without a name shows the current.
+func (s *RootHandler) handleReportTemplate(cmd slashcmd.Command, chatID update.ChatID) Transition {
+	var args struct {
+		ProjectID string `pos:"0,required"`
+		Name      string `pos:"1"`
+	}
+
+	available := strings.Join(s.reportTemplates.Names(), ", ")
+
+	if err := slashcmd.Bind(cmd, &args); err != nil {
+		return s.replyWithMessage(chatID, fmt.Sprintf(s.responses.ReportTemplateUsage, available))
+	}
+
+	projectID := github.ProjectID(args.ProjectID)
+	if !projectID.IsValid() {
+		return s.replyWithMessage(chatID,
+			fmt.Sprintf(s.responses.ReportTemplateInvalidID, escapeMarkup(args.ProjectID)))
+	}
+
+	if args.Name == "" {
+		current, isSet := s.userData.ReportTemplates[projectID]
+		if !isSet {
+			current = defaultReportTemplate
+		}
+
+		return s.replyWithMessage(chatID, fmt.Sprintf(s.responses.ReportTemplateCurrent,
+			escapeMarkup(string(projectID)), current, available))
+	}
+
+	name := strings.ToLower(args.Name)
+	if _, isKnown := s.reportTemplates[name]; !isKnown {
+		return s.replyWithMessage(chatID,
+			fmt.Sprintf(s.responses.ReportTemplateUnknown, escapeMarkup(args.Name), available))
+	}
+
+	// A new map, because the old one can still be used by the previous UserSharedData
+	choices := make(map[github.ProjectID]string, len(s.userData.ReportTemplates)+1)
+	for project, choice := range s.userData.ReportTemplates {
+		choices[project] = choice
+	}
+
+	if name == defaultReportTemplate {
+		delete(choices, projectID)
+	} else {
+		choices[projectID] = name
+	}
+
+	s.userData.ReportTemplates = choices
+
+	return s.replyWithMessage(chatID, fmt.Sprintf(s.responses.ReportTemplateSet, escapeMarkup(string(projectID)), name))
+}
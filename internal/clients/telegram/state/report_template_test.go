@@ -0,0 +1,162 @@
+package state_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/template"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestReportTemplatePick(t *testing.T) {
+	t.Parallel()
+
+	templates := testResponses().DailyStatus.Templates
+	projects := []github.ProjectID{"PVT_1", "PVT_2"}
+
+	tests := map[string]struct {
+		choices  map[github.ProjectID]string
+		expected string
+	}{
+		"no choices":           {choices: nil, expected: "Today I worked on"},
+		"second project":       {choices: map[github.ProjectID]string{"PVT_2": "standup"}, expected: "Yesterday"},
+		"other project":        {choices: map[github.ProjectID]string{"PVT_3": "standup"}, expected: "Today I worked on"},
+		"template was removed": {choices: map[github.ProjectID]string{"PVT_1": "gone"}, expected: "Today I worked on"},
+		"first project wins": {
+			choices:  map[github.ProjectID]string{"PVT_1": "default", "PVT_2": "standup"},
+			expected: "Today I worked on",
+		},
+		"first project standup": {
+			choices:  map[github.ProjectID]string{"PVT_1": "standup", "PVT_2": "default"},
+			expected: "Yesterday",
+		},
+	}
+
+	for name, test := range tests {
+		if today := templates.Pick(test.choices, projects).Today; today != test.expected {
+			t.Errorf("%s: expected the %q template, got %q", name, test.expected, today)
+		}
+	}
+}
+
+func TestDailyStatusReportUsesTemplateHeaders(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubItems(t, map[string][]string{
+		"PVT_1": {"Done:Fix bug", "In Progress:Write tests", "In Review:Open PR"},
+	}).URL)
+	ctx := context.Background()
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+	userData.ReportTemplates["PVT_1"] = "standup"
+
+	transition := state.NewDailyStatusState(root, option.Some("today"), nil).Handler(userData, testResponses(), deps).
+		PrivateTextMessage(ctx, privateText("Learned Go"))
+	transition = transition.NewState.Handler(transition.UserData, testResponses(), deps).
+		PrivateTextMessage(ctx, privateText("Need access"))
+
+	report := sentText(t, transition)
+
+	for _, section := range []string{
+		"Yesterday\n• Fix bug", "Today\n• Write tests", "Learned\nLearned Go", "Stuck\nNeed access", "Review\n• Open PR",
+	} {
+		if !strings.Contains(report, section) {
+			t.Errorf("The report has no %q section:\n%s", section, report)
+		}
+	}
+
+	if strings.Contains(report, "Today I worked on") {
+		t.Errorf("The report uses the default headers:\n%s", report)
+	}
+}
+
+func TestReportTemplateCommand(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	transition := rootHandler(state.NewUserSharedData()).PrivateTextMessage(ctx,
+		privateText("/reportTemplate PVT_1 Standup"))
+	if text := sentText(t, transition); text != "PVT_1 uses standup" {
+		t.Fatalf("Expected the template to be set, got %q", text)
+	}
+
+	if choice := transition.UserData.ReportTemplates["PVT_1"]; choice != "standup" {
+		t.Fatalf("Expected standup to be saved for PVT_1, got %q", choice)
+	}
+
+	transition = rootHandler(transition.UserData).GroupTextMessage(ctx, groupText("/reportTemplate PVT_1"))
+	if text := sentText(t, transition); text != "PVT_1 uses standup of default, standup" {
+		t.Fatalf("Expected the current template, got %q", text)
+	}
+
+	transition = rootHandler(transition.UserData).PrivateTextMessage(ctx, privateText("/reportTemplate PVT_1 fancy"))
+	if text := sentText(t, transition); text != `unknown "fancy" of default, standup` {
+		t.Fatalf("Expected an unknown template error, got %q", text)
+	}
+
+	transition = rootHandler(transition.UserData).PrivateTextMessage(ctx, privateText("/reportTemplate PVT_1 <i>"))
+	if text := sentText(t, transition); text != `unknown "&lt;i&gt;" of default, standup` {
+		t.Fatalf("Expected the unknown name to be escaped, got %q", text)
+	}
+
+	transition = rootHandler(transition.UserData).PrivateTextMessage(ctx,
+		privateText("/reportTemplate <b>1</b> standup"))
+	if text := sentText(t, transition); text != "not a project ID: &lt;b&gt;1&lt;/b&gt;" {
+		t.Fatalf("Expected an invalid project ID error, got %q", text)
+	}
+
+	if len(transition.UserData.ReportTemplates) != 1 {
+		t.Fatalf("A template was saved for an invalid project ID: %v", transition.UserData.ReportTemplates)
+	}
+
+	transition = rootHandler(transition.UserData).PrivateTextMessage(ctx, privateText("/reportTemplate PVT_1 default"))
+	if _, isSet := transition.UserData.ReportTemplates["PVT_1"]; isSet {
+		t.Fatal("Choosing the default template should remove the choice")
+	}
+
+	transition = rootHandler(transition.UserData).PrivateTextMessage(ctx, privateText("/reportTemplate"))
+	if text := sentText(t, transition); text != "report template usage: default, standup" {
+		t.Fatalf("Expected the usage, got %q", text)
+	}
+}
+
+func TestLoadReportTemplatesNeedsDefault(t *testing.T) {
+	t.Parallel()
+
+	templ, err := template.NewTemplate([]byte(`---
+templates:
+  report.standup:
+    today: [Yesterday]
+    tomorrow: [Today]
+    discovery: [Learned]
+    blockers: [Stuck]
+    inReview: [Review]
+    other: [Rest]
+...`))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	var responses state.Responses
+	if err = responses.LoadReportTemplates(templ); err == nil {
+		t.Fatal("Expected an error without report.default")
+	}
+
+	templ.Templates["report.Default"] = templ.Templates["report.standup"]
+
+	if err = responses.LoadReportTemplates(templ); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if names := responses.DailyStatus.Templates.Names(); len(names) != 2 || names[0] != "default" {
+		t.Fatalf("Expected [default standup], got %v", names)
+	}
+}
@@ -5,8 +5,12 @@ Responses holds parsed and ready to use responses for all states. You can be sur
 struct because of `ConversationState` interface.
 */
 type Responses struct {
-	Root              rootResponses              `template:"root"`
-	AddAPIKey         addAPIKeyResponses         `template:"addApiKey"`
-	DailyStatus       DailyStatusResponses       `template:"dailyStatus"`
-	SetDefaultProject SetDefaultProjectResponses `template:"setDefaultProject"`
+	Root               rootResponses               `template:"root"`
+	AddAPIKey          addAPIKeyResponses          `template:"addApiKey"`
+	DailyStatus        DailyStatusResponses        `template:"dailyStatus"`
+	SetDefaultProject  SetDefaultProjectResponses  `template:"setDefaultProject"`
+	PickDefaultProject pickDefaultProjectResponses `template:"pickDefaultProject"`
+	CreateDraft        CreateDraftResponses        `template:"createDraft"`
+	// CommandMenu is filled by LoadCommandDescriptions
+	CommandMenu CommandDescriptions `template:"-"`
 }
@@ -2,12 +2,14 @@ package state
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/template"
 	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
 	"github.com/m-kuzmin/daily-reporter/internal/util/option"
 	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
@@ -17,16 +19,44 @@ const (
 	listProjectsCommand = "listprojects"
 	noneCommand         = "none"
 	cancelCommand       = "cancel"
+	retryCommand        = "retry"
+
+	addDefaultProjectCommand = "adddefaultproject"
+	reviewersCommand         = "reviewers"
+
+	clearCommand        = "clear"
+	removeAPIKeyCommand = "removeapikey"
+
+	// addAPIKeyStartPayload is sent with /start from the link in the group reply to /addApiKey
+	addAPIKeyStartPayload = "addkey"
+	// clearCallbackPrefix is followed by clearConfirmed or clearCanceled in the buttons of /clear
+	clearCallbackPrefix = "clear:"
+	clearConfirmed      = "yes"
+	clearCanceled       = "no"
+
+	// dailyStatusProjectsToCount is how many projects /dailyStatus lists to find out if there is only one open project,
+	// which is then used without asking the user to choose
+	dailyStatusProjectsToCount = 20
+
+	/*
+		listProjectsCallbackPrefix is followed by a PageTokens token in the "Next page" button of /listProjects. For the
+		projects of an organization the token is followed by ":" and the organization's login.
+	*/
+	listProjectsCallbackPrefix = "listprojects:"
+	// listProjectsBackCallbackPrefix is followed by a PageTokens token in the "Previous page" button of /listProjects
+	listProjectsBackCallbackPrefix = "listprojectsback:"
 )
 
 // RootHandler is the default state
 type RootHandler struct {
 	responses *rootResponses
-	userData  UserSharedData
+	// reportTemplates are the names that /reportTemplate accepts
+	reportTemplates ReportTemplates
+	userData        UserSharedData
+	deps            *Deps
 	RootState
 }
 
-//nolint:cyclop,funlen // Unsplittable switch
 func (s *RootHandler) PrivateTextMessage(ctx context.Context, message update.PrivateTextMessage) Transition {
 	cmd, isCmd := slashcmd.Parse(message.Text)
 	if !isCmd {
@@ -37,6 +67,21 @@ func (s *RootHandler) PrivateTextMessage(ctx context.Context, message update.Pri
 
 	logging.Tracef("%s %s Used /%s", message.UpdateID.Log(), message.From.Log(), cmd.Method)
 
+	cmd = resolveAlias(s.deps.CommandAliases, openStartPayload(cmd))
+
+	cmd, isSome := s.retry(cmd)
+	if !isSome {
+		return s.replyWithMessage(message.Chat.ID, s.responses.NothingToRetry)
+	}
+
+	return s.rememberForRetry(cmd, s.privateCommand(ctx, message, cmd))
+}
+
+// privateCommand runs `cmd` from a message in the private chat.
+//
+//nolint:cyclop,funlen // Unsplittable switch
+func (s *RootHandler) privateCommand(ctx context.Context, message update.PrivateTextMessage, cmd slashcmd.Command,
+) Transition {
 	switch strings.ToLower(cmd.Method) {
 	case "start":
 		return s.replyWithMessage(message.Chat.ID, s.responses.Start)
@@ -57,23 +102,27 @@ func (s *RootHandler) PrivateTextMessage(ctx context.Context, message update.Pri
 		if len(cmd.Args) == 1 {
 			logging.Tracef("%s /addApiKey inline mode", message.UpdateID.Log())
 
-			return s.handleAddAPIKeyInline(ctx, message.UpdateID, message.From, message.Chat.ID, cmd.Args[0])
+			return s.handleAddAPIKeyInline(ctx, message, cmd.Args[0])
 		}
 
 		logging.Tracef("%s %s Transition into AddApiKeyState", message.UpdateID.Log(), message.From.Log())
 
-		return NewTransition(AddAPIKeyState{RootState: s.RootState}, s.userData, []response.BotAction{
-			response.NewSendMessage(message.Chat.ID, s.responses.AddAPIKey),
-		})
+		return Transit(AddAPIKeyState{RootState: s.RootState}, s.userData).
+			Reply(message.Chat.ID, s.responses.AddAPIKey).
+			Build()
 
 	case listProjectsCommand:
+		org, _ := cmd.NextAfter("org")
+
 		if after, isSome := cmd.NextAfter("after"); isSome && after != "" {
 			logging.Tracef("%s after cursor: %s", message.UpdateID.Log(), after)
 
-			return s.handleListProjects(ctx, message.From, message.Chat.ID, option.Some(github.ProjectCursor(after)))
+			return s.handleListProjects(ctx, message.From, message.Chat.ID, option.Some(github.ProjectCursor(after)),
+				false, org, option.None[update.MessageID]())
 		}
 
-		return s.handleListProjects(ctx, message.From, message.Chat.ID, option.None[github.ProjectCursor]())
+		return s.handleListProjects(ctx, message.From, message.Chat.ID, option.None[github.ProjectCursor](), false, org,
+			option.None[update.MessageID]())
 
 	case "setdefaultproject":
 		if s.userData.GithubAPIKey.IsNone() {
@@ -90,9 +139,63 @@ func (s *RootHandler) PrivateTextMessage(ctx context.Context, message update.Pri
 
 		logging.Tracef("%s %s Transition into SetDefaultProjectState", message.UpdateID.Log(), message.From.Log())
 
-		return NewTransition(SetDefaultProjectState{RootState: s.RootState}, s.userData, []response.BotAction{
-			response.NewSendMessage(message.Chat.ID, s.responses.SetDefaultProject),
-		})
+		return Transit(SetDefaultProjectState{RootState: s.RootState}, s.userData).
+			Reply(message.Chat.ID, s.responses.SetDefaultProject).
+			Build()
+
+	case addDefaultProjectCommand:
+		return s.handleAddDefaultProject(ctx, message.UpdateID, cmd, message.Chat.ID)
+
+	case pickDefaultProjectCommand:
+		return s.handlePickDefaultProject(ctx, message.UpdateID, message.Chat.ID)
+
+	case allItemsCommand:
+		return s.handleAllItems(ctx, message.UpdateID, message.Chat.ID)
+
+	case fieldsCommand:
+		return s.handleFields(ctx, message.UpdateID, cmd, message.Chat.ID)
+
+	case checkColumnsCommand:
+		return s.handleCheckColumns(ctx, message.UpdateID, cmd, message.Chat.ID)
+
+	case createDraftCommand:
+		return s.handleCreateDraft(message.UpdateID, message.From, message.Chat.ID)
+
+	case reportTemplateCommand:
+		return s.handleReportTemplate(cmd, message.Chat.ID)
+
+	case reviewersCommand:
+		return s.handleReviewers(cmd, message.Chat.ID)
+
+	case reportConfigCommand:
+		return s.handleReportConfig(ctx, cmd, message.Chat.ID)
+
+	case settingsCommand:
+		return s.handleSettings(ctx, message.Chat.ID)
+
+	case removeAPIKeyCommand:
+		return s.handleRemoveAPIKey(message.UpdateID, message.From, message.Chat.ID)
+
+	case errorsCommand:
+		return s.handleErrors(message.Chat.ID)
+
+	case debugCommand:
+		return s.handleDebug(cmd, message.Chat.ID)
+
+	case clearCommand:
+		return Transit(s.RootState, s.userData).
+			Action(response.NewSendMessage(message.Chat.ID, s.responses.ClearConfirm).
+				SetReplyMarkup([][]response.InlineKeyboardButton{{
+					response.InlineButtonCallback(s.responses.ClearConfirmButton, clearCallbackPrefix+clearConfirmed),
+					response.InlineButtonCallback(s.responses.ClearCancelButton, clearCallbackPrefix+clearCanceled),
+				}})).
+			Build()
+	}
+
+	if suggestion, isClose := suggestCommand(cmd.Method); isClose {
+		logging.Tracef("%s Unknown command, suggesting /%s", message.Log(), suggestion.Name)
+
+		return s.replyWithMessage(message.Chat.ID, fmt.Sprintf(s.responses.DidYouMean, suggestion.Name))
 	}
 
 	logging.Tracef("%s Command ignored", message.Log())
@@ -100,7 +203,6 @@ func (s *RootHandler) PrivateTextMessage(ctx context.Context, message update.Pri
 	return s.replyWithMessage(message.Chat.ID, s.responses.UnknownMessage)
 }
 
-//nolint:cyclop // Unsplittable switch
 func (s *RootHandler) GroupTextMessage(ctx context.Context, message update.GroupTextMessage) Transition {
 	cmd, isCmd := slashcmd.Parse(message.Text)
 	if !isCmd {
@@ -111,6 +213,25 @@ func (s *RootHandler) GroupTextMessage(ctx context.Context, message update.Group
 
 	logging.Tracef("%s %s %s Used /%s", message.UpdateID.Log(), message.Chat.Log(), message.From.Log(), cmd.Method)
 
+	cmd, isSome := s.retry(resolveAlias(s.deps.CommandAliases, cmd))
+	if !isSome {
+		return s.replyWithMessage(message.Chat.ID, s.responses.NothingToRetry)
+	}
+
+	if known, isKnown := lookupCommand(cmd.Method); isKnown && known.Scope == privateOnly {
+		logging.Tracef("%s Private command /%s used in a group", message.UpdateID.Log(), known.Name)
+
+		return Transit(s.RootState, s.userData).Action(s.privateOnlyReply(ctx, message.Chat.ID, known, cmd)).Build()
+	}
+
+	return s.rememberForRetry(cmd, s.groupCommand(ctx, message, cmd))
+}
+
+// groupCommand runs `cmd` from a message in a group, except for the privateOnly commands.
+//
+//nolint:cyclop // Unsplittable switch
+func (s *RootHandler) groupCommand(ctx context.Context, message update.GroupTextMessage, cmd slashcmd.Command,
+) Transition {
 	switch strings.ToLower(cmd.Method) {
 	case "start":
 		return s.replyWithMessage(message.Chat.ID, s.responses.Start)
@@ -127,18 +248,6 @@ func (s *RootHandler) GroupTextMessage(ctx context.Context, message update.Group
 
 		return s.handleDailyStatus(ctx, message.UpdateID, message.From, message.Chat.ID, option.None[string]())
 
-	case "addapikey":
-		if len(cmd.Args) != 0 {
-			logging.Tracef("%s %s /addApiKey inline mode", message.UpdateID.Log(), message.From.Log())
-
-			return s.replyWithMessage(message.Chat.ID, s.responses.APIKeySentInPublicChat)
-		}
-
-		return s.replyWithMessage(message.Chat.ID, s.responses.PrivateCommandUsed)
-
-	case listProjectsCommand:
-		return s.replyWithMessage(message.Chat.ID, s.responses.PrivateCommandUsed)
-
 	case "setdefaultproject":
 		if s.userData.GithubAPIKey.IsNone() {
 			logging.Tracef("%s Tried to set default project without adding an API key", message.UpdateID.Log())
@@ -154,9 +263,39 @@ func (s *RootHandler) GroupTextMessage(ctx context.Context, message update.Group
 
 		logging.Tracef("%s Transition into SetDefaultProjectState", message.UpdateID.Log())
 
-		return NewTransition(SetDefaultProjectState{RootState: s.RootState}, s.userData, []response.BotAction{
-			response.NewSendMessage(message.Chat.ID, s.responses.SetDefaultProject),
-		})
+		return Transit(SetDefaultProjectState{RootState: s.RootState}, s.userData).
+			Reply(message.Chat.ID, s.responses.SetDefaultProject).
+			Build()
+
+	case addDefaultProjectCommand:
+		return s.handleAddDefaultProject(ctx, message.UpdateID, cmd, message.Chat.ID)
+
+	case pickDefaultProjectCommand:
+		return s.handlePickDefaultProject(ctx, message.UpdateID, message.Chat.ID)
+
+	case allItemsCommand:
+		return s.handleAllItems(ctx, message.UpdateID, message.Chat.ID)
+
+	case fieldsCommand:
+		return s.handleFields(ctx, message.UpdateID, cmd, message.Chat.ID)
+
+	case checkColumnsCommand:
+		return s.handleCheckColumns(ctx, message.UpdateID, cmd, message.Chat.ID)
+
+	case createDraftCommand:
+		return s.handleCreateDraft(message.UpdateID, message.From, message.Chat.ID)
+
+	case reportTemplateCommand:
+		return s.handleReportTemplate(cmd, message.Chat.ID)
+
+	case reviewersCommand:
+		return s.handleReviewers(cmd, message.Chat.ID)
+
+	case reportConfigCommand:
+		return s.handleReportConfig(ctx, cmd, message.Chat.ID)
+
+	case settingsCommand:
+		return s.handleSettings(ctx, message.Chat.ID)
 	}
 
 	logging.Tracef("%s Command ignored", message.Log())
@@ -164,43 +303,210 @@ func (s *RootHandler) GroupTextMessage(ctx context.Context, message update.Group
 	return s.Ignore(ctx)
 }
 
-func (s *RootHandler) CallbackQuery(_ context.Context, cq update.CallbackQuery) Transition {
-	return NewTransition(s.RootState, s.userData, []response.BotAction{
-		response.AnswerCallbackQuery{
+/*
+privateOnlyReply explains why a private command can't be used in a group. If the command can be started from a link, the
+reply has a button that opens it in the private chat.
+*/
+func (s *RootHandler) privateOnlyReply(ctx context.Context, chatID update.ChatID, known command, cmd slashcmd.Command,
+) response.SendMessage {
+	text := s.responses.PrivateCommandUsed
+	if known.SecretArgs && len(cmd.Args) != 0 {
+		text = s.responses.APIKeySentInPublicChat
+	}
+
+	reply := response.NewSendMessage(chatID, text)
+
+	if known.StartPayload == "" {
+		return reply
+	}
+
+	link, isSome := s.deps.privateChatLink(known.StartPayload)
+	if !isSome {
+		return reply
+	}
+
+	return reply.SetReplyMarkup([][]response.InlineKeyboardButton{{
+		response.InlineButtonURL(s.responses.OpenPrivateChatButton, link),
+	}})
+}
+
+// openStartPayload replaces "/start <payload>" from a private chat link with the command the link is for.
+func openStartPayload(cmd slashcmd.Command) slashcmd.Command {
+	if !strings.EqualFold(cmd.Method, "start") || len(cmd.Args) != 1 {
+		return cmd
+	}
+
+	known, isKnown := lookupStartPayload(cmd.Args[0])
+	if !isKnown {
+		return cmd
+	}
+
+	logging.Tracef("/start with payload %q opens /%s", cmd.Args[0], known.Name)
+
+	return slashcmd.Command{Method: known.Name, Args: []string{}}
+}
+
+/*
+retry replaces /retry with the last command that failed with a transient GitHub error, see rememberForRetry. Returns
+false if /retry was used, but there is nothing to retry.
+*/
+func (s *RootHandler) retry(cmd slashcmd.Command) (slashcmd.Command, bool) {
+	if strings.ToLower(cmd.Method) == retryCommand {
+		last, isSome := s.userData.LastCommand.Unwrap()
+		if !isSome {
+			return cmd, false
+		}
+
+		logging.Tracef("Retrying /%s", last.Method)
+
+		cmd = last
+	}
+
+	return cmd, true
+}
+
+/*
+rememberForRetry saves `cmd` for /retry if it calls GitHub and GitHub failed in a way that can go away on its own, e.g.
+a timeout. If the command didn't fail like that there is nothing worth retrying, so the saved command is forgotten.
+*/
+func (s *RootHandler) rememberForRetry(cmd slashcmd.Command, transition Transition) Transition {
+	if !isRetriable(cmd.Method) {
+		return transition
+	}
+
+	if s.deps.hadTransientGithubError() {
+		transition.UserData.LastCommand = option.Some(cmd)
+	} else {
+		transition.UserData.LastCommand = option.None[slashcmd.Command]()
+	}
+
+	return transition
+}
+
+// isRetriable returns true for commands that call GitHub and can be repeated with /retry.
+func isRetriable(method string) bool {
+	switch strings.ToLower(method) {
+	case "dailystatus", listProjectsCommand, "setdefaultproject", addDefaultProjectCommand, allItemsCommand,
+		fieldsCommand, checkColumnsCommand:
+		return true
+	}
+
+	return false
+}
+
+/*
+CallbackQuery handles buttons of RootState commands. Callback queries from old messages come without the message, and
+without it there is no conversation state, so they always end up here. The user is asked to use the command again.
+*/
+func (s *RootHandler) CallbackQuery(ctx context.Context, cq update.CallbackQuery) Transition {
+	message, isSome := cq.Message.Unwrap()
+	if !isSome {
+		logging.Debugf("%s Callback query without a message", cq.Log())
+
+		return Transit(s.RootState, s.userData).
+			Action(response.CallbackQueryAnswerAlert(cq.ID, s.responses.ButtonMessageTooOld)).
+			Build()
+	}
+
+	if data, isPage := strings.CutPrefix(cq.Data.UnwrapOr(""), listProjectsCallbackPrefix); isPage {
+		token, org, _ := strings.Cut(data, ":")
+
+		return s.handleListProjectsPage(ctx, cq, message, token, false, org)
+	}
+
+	if token, isPage := strings.CutPrefix(cq.Data.UnwrapOr(""), listProjectsBackCallbackPrefix); isPage {
+		return s.handleListProjectsPage(ctx, cq, message, token, true, "")
+	}
+
+	if answer, isClear := strings.CutPrefix(cq.Data.UnwrapOr(""), clearCallbackPrefix); isClear {
+		return s.handleClear(ctx, cq, message, answer == clearConfirmed)
+	}
+
+	// The picker has ended (picked, canceled or replaced by another command), so its buttons are of an old message
+	if data := cq.Data.UnwrapOr(""); strings.HasPrefix(data, pickProjectCallbackPrefix) ||
+		strings.HasPrefix(data, pickPageCallbackPrefix) {
+		return Transit(s.RootState, s.userData).
+			Action(response.CallbackQueryAnswerAlert(cq.ID, s.responses.ButtonMessageTooOld)).
+			Build()
+	}
+
+	return Transit(s.RootState, s.userData).
+		Action(response.AnswerCallbackQuery{
 			ID:        string(cq.ID),
 			Text:      option.Some("This button doesnt work."),
 			ShowAlert: false,
-		},
-	})
+		}).
+		Build()
 }
 
 func (s *RootHandler) Ignore(_ context.Context) Transition {
-	return NewTransition(s.RootState, s.userData, response.Nothing())
+	return Transit(s.RootState, s.userData).Build()
+}
+
+func (s *RootHandler) Unwind(_ context.Context, _ update.ChatID) Transition {
+	return Transit(s.RootState, s.userData).Build()
 }
 
-func (s *RootHandler) handleAddAPIKeyInline(ctx context.Context, upd update.UpdateID, user update.User,
-	chatID update.ChatID, key string,
+func (s *RootHandler) handleAddAPIKeyInline(ctx context.Context, message update.PrivateTextMessage, key string,
 ) Transition {
-	client := github.NewClient(key)
+	chatID := message.Chat.ID
+
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	client := s.deps.githubClient(key)
 
 	login, err := client.Login(ctx)
 	if err != nil {
-		logging.Errorf("%s While requesting user's GitHub username: %s", upd.Log(), err)
+		logging.Errorf("%s While requesting user's GitHub username: %s", message.UpdateID.Log(), err)
 
-		return s.replyWithMessage(chatID, s.responses.BadAPIKey)
+		return s.replyWithMessage(chatID,
+			githubErrorMessage(s.deps, err, s.responses.BadAPIKey, s.responses.GithubErrorGeneric))
 	}
 
 	s.userData.GithubAPIKey = option.Some(key)
+	s.userData.LockedAPIKey = ""
+
+	logging.Infof("%s %s Saved GitHub API Key", message.UpdateID.Log(), message.From.Log())
+
+	// The key is valid, so the message with it shouldn't stay in the chat history
+	return Transit(s.RootState, s.userData).
+		Action(response.NewDeleteMessage(chatID, message.ID)).
+		Action(response.NewSendMessage(chatID, fmt.Sprintf(s.responses.APIKeyAdded, login, login)).
+			EnableWebPreview()).
+		Build()
+}
+
+/*
+handleRemoveAPIKey deletes the user's API key. The default projects are kept: they belong to chats (not to the user),
+a project ID is not a secret, and a group can keep using them with the API key of someone else, or of the same user
+once they add a new key.
+*/
+func (s *RootHandler) handleRemoveAPIKey(upd update.UpdateID, user update.User, chatID update.ChatID) Transition {
+	if s.userData.GithubAPIKey.IsNone() && s.userData.LockedAPIKey == "" {
+		return s.replyWithMessage(chatID, s.responses.NoAPIKeyToRemove)
+	}
+
+	s.userData.GithubAPIKey = option.None[string]()
+	s.userData.LockedAPIKey = ""
 
-	logging.Infof("%s %s Saved GitHub API Key", upd.Log(), user.Log())
+	logging.Infof("%s %s API key deleted with /removeApiKey", upd.Log(), user.Log())
 
-	return NewTransition(s.RootState, s.userData, []response.BotAction{
-		response.NewSendMessage(chatID, fmt.Sprintf(s.responses.APIKeyAdded, login, login)).EnableWebPreview(),
-	})
+	return s.replyWithMessage(chatID, s.responses.APIKeyRemoved)
 }
 
-func (s *RootHandler) handleListProjects(
-	ctx context.Context, user update.User, chatID update.ChatID, afterCursor option.Option[github.ProjectCursor],
+/*
+handleListProjects shows a page of the user's projects. The page starts after the cursor, or if `before` is true ends
+before it. Without a cursor it's the first page.
+
+If `org` is not empty the projects of that organization are listed instead. Those pages only have a "Next page"
+button, `before` is ignored for them.
+
+If `edit` is some the page replaces the text of that message (the one with the pressed button) instead of being sent as
+a new message. Errors are still sent as new messages, so the list the user was looking at stays.
+*/
+//nolint:funlen,cyclop // Most of it is building the message
+func (s *RootHandler) handleListProjects(ctx context.Context, user update.User, chatID update.ChatID,
+	cursor option.Option[github.ProjectCursor], before bool, org string, edit option.Option[update.MessageID],
 ) Transition {
 	const projectsOnPage = 10
 
@@ -211,43 +517,156 @@ func (s *RootHandler) handleListProjects(
 	}
 
 	// Get the user's projects
-	projects, err := github.NewClient(key).ListViewerProjects(ctx, projectsOnPage, afterCursor)
+	var (
+		page github.ProjectsPage
+		err  error
+	)
+
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	beforeCursor, isBefore := cursor.Unwrap()
+
+	switch {
+	case org != "":
+		page, err = s.deps.githubClient(key).ListOrganizationProjects(ctx, org, projectsOnPage, cursor)
+	case isBefore && before:
+		page, err = s.deps.githubClient(key).ListViewerProjectsBefore(ctx, projectsOnPage, beforeCursor)
+	default:
+		page, err = s.deps.githubClient(key).ListViewerProjects(ctx, projectsOnPage, cursor)
+	}
+
+	var notFound github.OrganizationNotFoundError
+	if errors.As(err, &notFound) {
+		return s.replyWithMessage(chatID, fmt.Sprintf(s.responses.OrganizationNotFound, escapeMarkup(org)))
+	}
+
 	if err != nil {
 		logging.Errorf("%s While getting projects for /listProjects %s", user.Log(), err)
 
 		return s.replyWithMessage(chatID,
-			github.GqlErrorStringOr("Github API error: %s", err, s.responses.GithubErrorGeneric))
+			githubErrorMessage(s.deps, err, s.responses.GithubUnauthorized, s.responses.GithubErrorGeneric))
 	}
 
+	projects := page.Projects
+
 	if len(projects) == 0 {
-		if afterCursor.IsNone() {
+		switch {
+		case cursor.IsSome():
+			return s.replyWithMessage(chatID, s.responses.LastProjectsPage)
+		case org != "":
+			return s.replyWithMessage(chatID,
+				fmt.Sprintf(s.responses.OrganizationHasZeroProjects, escapeMarkup(org)))
+		default:
 			return s.replyWithMessage(chatID, s.responses.UserHasZeroProjects)
 		}
-
-		return s.replyWithMessage(chatID, s.responses.LastProjectsPage)
 	}
 
 	// Print the projects
-	projectList := fmt.Sprintf("Your projects (%d/page)", projectsOnPage)
+	projectList := escapeMarkup(fmt.Sprintf("Your projects (%d/page)", projectsOnPage))
+	if org != "" {
+		projectList = escapeMarkup(fmt.Sprintf("Projects of %s (%d/page)", org, projectsOnPage))
+	}
+
+	showCursors := s.deps.ShowProjectCursors
 
 	for _, project := range projects {
-		projectList += fmt.Sprintf(
-			"\n\n<code>%s</code> <a href=%q><b>%s</b></a> (<a href=%q>%s</a>/%d)\nID: <code>%s</code>",
-			project.Cursor, project.URL, project.Title,
-			project.CreatorURL, project.CreatorLogin, project.Number,
-			project.ID)
+		projectList += "\n\n"
+
+		if showCursors {
+			projectList += response.Code(string(project.Cursor)) + " "
+		}
+
+		projectList += fmt.Sprintf("%s %s%s%s%s\nID: %s",
+			linkMarkup(boldMarkup(escapeMarkup(project.Title)), project.URL),
+			escapeMarkup("("), linkMarkup(escapeMarkup(project.CreatorLogin), project.CreatorURL),
+			escapeMarkup(fmt.Sprintf("/%d", project.Number)), escapeMarkup(")"),
+			response.Code(string(project.ID)))
+	}
+
+	pagination := []response.InlineKeyboardButton{}
+
+	if page.HasPreviousPage && org == "" {
+		pagination = append(pagination, response.InlineButtonCallback("Previous page",
+			listProjectsBackCallbackPrefix+s.deps.PageTokens.Add(chatID, page.StartCursor)))
+	}
+
+	if page.HasNextPage {
+		next := listProjectsCallbackPrefix + s.deps.PageTokens.Add(chatID, page.EndCursor)
+		if org != "" {
+			next += ":" + org
+		}
+
+		pagination = append(pagination, response.InlineButtonCallback("Next page", next))
+	}
+
+	if messageID, isEdit := edit.Unwrap(); isEdit {
+		editedPage := response.NewEditMessageText(chatID, messageID, projectList)
+		if len(pagination) != 0 {
+			editedPage = editedPage.SetReplyMarkup([][]response.InlineKeyboardButton{pagination})
+		}
+
+		return Transit(s.RootState, s.userData).Action(editedPage).Build()
 	}
 
 	projectListWithPagination := response.NewSendMessage(chatID, projectList)
+	if len(pagination) != 0 {
+		projectListWithPagination = projectListWithPagination.SetReplyMarkup(
+			[][]response.InlineKeyboardButton{pagination})
+	}
+
+	return Transit(s.RootState, s.userData).Action(projectListWithPagination).Build()
+}
+
+/*
+handleListProjectsPage shows the page of /listProjects that the pressed "Next page" or "Previous page" (if `before` is
+true) button points to in the message of the button. `org` is the organization whose projects are listed, or empty for
+the user's projects.
+*/
+func (s *RootHandler) handleListProjectsPage(ctx context.Context, cq update.CallbackQuery, message update.Message,
+	token string, before bool, org string,
+) Transition {
+	cursor, isSome := s.deps.PageTokens.Resolve(message.Chat.ID, token)
+	if !isSome {
+		logging.Tracef("%s Page token %q has expired", cq.Log(), token)
 
-	if len(projects) == projectsOnPage {
-		projectListWithPagination = projectListWithPagination.SetReplyMarkup([][]response.InlineKeyboardButton{{
-			response.InlineButtonSwitchQueryCurrentChat("Next page",
-				fmt.Sprintf("/%s after %s", listProjectsCommand, projects[len(projects)-1].Cursor)),
-		}})
+		return Transit(s.RootState, s.userData).
+			Action(response.CallbackQueryAnswerAlert(cq.ID, s.responses.PageExpired)).
+			Build()
 	}
 
-	return NewTransition(s.RootState, s.userData, []response.BotAction{projectListWithPagination})
+	transition := s.handleListProjects(ctx, cq.From, message.Chat.ID, option.Some(cursor), before, org,
+		option.Some(message.ID))
+	transition.Actions = append(transition.Actions, response.CallbackQueryAck(cq.ID))
+
+	return transition
+}
+
+/*
+handleClear deletes everything the bot knows about the user if they pressed the confirm button of /clear. The
+conversations of the user in this and every other chat go back to a new RootState.
+*/
+func (s *RootHandler) handleClear(ctx context.Context, cq update.CallbackQuery, message update.Message,
+	isConfirmed bool,
+) Transition {
+	reply := s.responses.ClearCanceled
+	newState, userData := s.RootState, s.userData
+
+	if isConfirmed {
+		logging.Infof("%s Deleting all user data", cq.From.Log())
+
+		reply = s.responses.Cleared
+		newState, userData = NewRootState(), NewUserSharedData()
+	}
+
+	transition := Transit(newState, userData).
+		Reply(message.Chat.ID, reply).
+		Action(response.CallbackQueryAck(cq.ID))
+
+	if isConfirmed {
+		transition = transition.ForgetConversations()
+	}
+
+	return transition.Build()
 }
 
 func (s *RootHandler) handleDailyStatus(ctx context.Context, updateID update.UpdateID, user update.User,
@@ -258,74 +677,101 @@ func (s *RootHandler) handleDailyStatus(ctx context.Context, updateID update.Upd
 	if !isSome {
 		logging.Debugf("%s %s /dailyStatus used without GitHub API key", updateID.Log(), user.Log())
 
-		return NewTransition(s.RootState, s.userData, []response.BotAction{
-			response.NewSendMessage(chatID, s.responses.NoAPIKeyAdded),
-		})
+		return Transit(s.RootState, s.userData).Reply(chatID, s.responses.NoAPIKeyAdded).Build()
 	}
 
-	const moreThanOne = 2
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
 
-	projects, err := github.NewClient(key).ListViewerProjects(ctx, moreThanOne, option.None[github.ProjectCursor]())
+	page, err := s.deps.githubClient(key).ListViewerProjects(ctx, dailyStatusProjectsToCount,
+		option.None[github.ProjectCursor]())
 	if err != nil {
 		logging.Errorf("%s %s While collecting project list for /dailyStatus, GitHub error occurred: %s",
 			updateID.Log(), user.Log(), err)
 
 		return s.replyWithMessage(chatID,
-			github.GqlErrorStringOr("GitHub API error: %s", err, s.responses.GithubErrorGeneric))
+			githubErrorMessage(s.deps, err, s.responses.GithubUnauthorized, s.responses.GithubErrorGeneric))
 	}
 
+	projects := page.Projects
+
 	return s.maybeTransitionIntoDailyStatus(ctx, updateID, user, key, projects, chatID, dateOverride)
 }
 
 func (s *RootHandler) maybeTransitionIntoDailyStatus(ctx context.Context, updateID update.UpdateID, user update.User,
 	apiKey string, projects []github.ProjectV2, chatID update.ChatID, dateOverride option.Option[string],
 ) Transition {
-	switch len(projects) {
-	case 0:
+	open := openProjects(projects)
+	// With a full page there could be more open projects on the next one
+	allListed := len(projects) < dailyStatusProjectsToCount
+
+	switch {
+	case len(projects) == 0:
 		logging.Debugf("%s %s Project list len is0 (according to genqlient), aborting /dailyStatus",
 			updateID.Log(), user.Log())
 
-		return NewTransition(s.RootState, s.userData, []response.BotAction{
-			response.NewSendMessage(
-				chatID, s.responses.UserHasZeroProjects,
-			),
-		})
-	case 1:
-		s.DefaultProject = option.Some(projects[0].ID)
+		return Transit(s.RootState, s.userData).Reply(chatID, s.responses.UserHasZeroProjects).Build()
+	case len(projects) == 1 && projects[0].Closed:
+		logging.Debugf("%s %s Aborting /dailyStatus because the only project is closed", updateID.Log(), user.Log())
 
-		logging.Infof("%s Saved %q as the default project because the user only has 1 project", user.Log(), projects[0].Title)
+		return Transit(s.RootState, s.userData).
+			Reply(chatID, fmt.Sprintf(s.responses.OnlyProjectClosed, escapeMarkup(projects[0].Title))).
+			Build()
+	case len(open) == 1 && allListed && (len(projects) == 1 || len(s.DefaultProjects) == 0):
+		s.DefaultProjects = []github.ProjectID{open[0].ID}
+
+		logging.Infof("%s Saved %q as the default project because the user only has 1 open project",
+			user.Log(), open[0].Title)
 		logging.Debugf("%s %s Transition into DailyStatusState", updateID.Log(), user.Log())
 
-		return NewTransition(NewDailyStatusState(s.RootState, dateOverride), s.userData, []response.BotAction{
-			response.NewSendMessage(chatID, fmt.Sprintf(s.responses.DailyStatus, projects[0].Title)),
-		})
+		return Transit(NewDailyStatusState(s.RootState, dateOverride, open), s.userData).
+			Reply(chatID, fmt.Sprintf(s.responses.DailyStatus, escapeMarkup(open[0].Title))).
+			Build()
 	default:
-		projectID, isSome := s.DefaultProject.Unwrap()
-		if !isSome {
+		if len(s.DefaultProjects) == 0 {
 			logging.Debugf("%s %s Aborting /dailyStatus because user has many projects, but no default is set",
 				updateID.Log(), user.Log())
 
-			return NewTransition(s.RootState, s.userData, []response.BotAction{
-				response.NewSendMessage(chatID, s.responses.UseSetDefaultProject),
-			})
+			return Transit(s.RootState, s.userData).Reply(chatID, s.responses.UseSetDefaultProject).Build()
 		}
 
-		defaultProject, err := github.NewClient(apiKey).ProjectV2ByID(ctx, projectID)
-		if err != nil {
-			logging.Errorf("%s While getting GitHub Project by ID for /dailyStatus: %s", user.Log(), err)
+		client := s.deps.githubClient(apiKey)
+		defaultProjects := make([]github.ProjectV2, len(s.DefaultProjects))
+		titles := make([]string, len(s.DefaultProjects))
+
+		for i, projectID := range s.DefaultProjects {
+			defaultProject, err := client.ProjectV2ByID(ctx, projectID)
+			if err != nil {
+				logging.Errorf("%s While getting GitHub Project by ID for /dailyStatus: %s", user.Log(), err)
+
+				return Transit(s.RootState, s.userData).
+					Reply(chatID, githubErrorMessage(s.deps, err, s.responses.GithubUnauthorized,
+						s.responses.GithubErrorGeneric)).
+					Build()
+			}
 
-			return NewTransition(s.RootState, s.userData, []response.BotAction{
-				response.NewSendMessage(chatID,
-					github.GqlErrorStringOr("GitHub API error: %s", err, s.responses.GithubErrorGeneric)),
-			})
+			defaultProjects[i] = defaultProject
+			titles[i] = escapeMarkup(defaultProject.Title)
 		}
 
 		logging.Debugf("%s %s Transition into DailyStatusState", updateID.Log(), user.Log())
 
-		return NewTransition(NewDailyStatusState(s.RootState, dateOverride), s.userData, []response.BotAction{
-			response.NewSendMessage(chatID, fmt.Sprintf(s.responses.DailyStatus, defaultProject.Title)),
-		})
+		return Transit(NewDailyStatusState(s.RootState, dateOverride, defaultProjects), s.userData).
+			Reply(chatID, fmt.Sprintf(s.responses.DailyStatus, strings.Join(titles, ", "))).
+			Build()
+	}
+}
+
+// openProjects returns the projects that are not closed.
+func openProjects(projects []github.ProjectV2) []github.ProjectV2 {
+	open := make([]github.ProjectV2, 0, len(projects))
+
+	for _, project := range projects {
+		if !project.Closed {
+			open = append(open, project)
+		}
 	}
+
+	return open
 }
 
 func (s *RootHandler) saveDefaultProject(ctx context.Context, id string, chatID update.ChatID) Transition {
@@ -334,58 +780,216 @@ func (s *RootHandler) saveDefaultProject(ctx context.Context, id string, chatID
 		return s.replyWithMessage(chatID, s.responses.NoAPIKeyAdded)
 	}
 
-	proj, err := github.NewClient(token).ProjectV2ByID(ctx, github.ProjectID(id))
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	proj, err := s.deps.githubClient(token).ProjectV2ByID(ctx, github.ProjectID(id))
 	if err != nil {
-		return s.replyWithMessage(chatID,
-			github.GqlErrorStringOr("Github API error: %s", err, s.responses.GithubErrorGeneric))
+		return s.replyWithMessage(chatID, projectErrorMessage(s.deps, err, s.responses.NotAProject,
+			s.responses.GithubUnauthorized, s.responses.GithubErrorGeneric))
 	}
 
-	s.DefaultProject = option.Some[github.ProjectID](github.ProjectID(id))
+	s.DefaultProjects = []github.ProjectID{github.ProjectID(id)}
 
-	return s.replyWithMessage(chatID, fmt.Sprintf("Saved %q as default project", proj.Title))
+	return s.replyWithMessage(chatID, fmt.Sprintf(s.responses.SavedDefaultProject.Random(), escapeMarkup(proj.Title)))
+}
+
+/*
+projectErrorMessage explains why a project couldn't be fetched by its ID. If the ID is of something else (e.g. an issue)
+`notAProject` is formatted with the ID and the type of the node, otherwise it's the same as githubErrorMessage.
+*/
+func projectErrorMessage(deps *Deps, err error, notAProject, unauthorized, generic string) string {
+	var notAProjectErr github.NotAProjectError
+	if errors.As(err, &notAProjectErr) {
+		return fmt.Sprintf(notAProject, escapeMarkup(string(notAProjectErr.ID)), escapeMarkup(notAProjectErr.GotType))
+	}
+
+	return githubErrorMessage(deps, err, unauthorized, generic)
+}
+
+// handleAddDefaultProject adds a project to the chat's default projects, so that /dailyStatus reports on all of them.
+func (s *RootHandler) handleAddDefaultProject(ctx context.Context, updateID update.UpdateID, cmd slashcmd.Command,
+	chatID update.ChatID,
+) Transition {
+	token, isSome := s.userData.GithubAPIKey.Unwrap()
+	if !isSome {
+		logging.Tracef("%s Tried to add a default project without adding an API key", updateID.Log())
+
+		return s.replyWithMessage(chatID, s.responses.NoAPIKeyAdded)
+	}
+
+	var args struct {
+		ProjectID string `pos:"0,required"`
+	}
+
+	if err := slashcmd.Bind(cmd, &args); err != nil {
+		return s.replyWithMessage(chatID, s.responses.AddDefaultProjectUsage)
+	}
+
+	id := github.ProjectID(args.ProjectID)
+
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	proj, err := s.deps.githubClient(token).ProjectV2ByID(ctx, id)
+	if err != nil {
+		return s.replyWithMessage(chatID, projectErrorMessage(s.deps, err, s.responses.NotAProject,
+			s.responses.GithubUnauthorized, s.responses.GithubErrorGeneric))
+	}
+
+	s.AddDefaultProject(id)
+
+	logging.Tracef("%s Added a default project, this chat has %d now", updateID.Log(), len(s.DefaultProjects))
+
+	return s.replyWithMessage(chatID, fmt.Sprintf(s.responses.AddedDefaultProject, escapeMarkup(proj.Title)))
+}
+
+// handleReviewers turns on or off the list of requested reviewers in the "In review" section of /dailyStatus.
+func (s *RootHandler) handleReviewers(cmd slashcmd.Command, chatID update.ChatID) Transition {
+	if len(cmd.Args) != 1 {
+		return s.replyWithMessage(chatID, s.responses.ReviewersUsage)
+	}
+
+	switch strings.ToLower(cmd.Args[0]) {
+	case "on":
+		s.ShowReviewers = true
+
+		return s.replyWithMessage(chatID, s.responses.ReviewersShown)
+	case "off":
+		s.ShowReviewers = false
+
+		return s.replyWithMessage(chatID, s.responses.ReviewersHidden)
+	}
+
+	return s.replyWithMessage(chatID, s.responses.ReviewersUsage)
 }
 
 // replyWithMessage keeps the current state and user data but reponds with a single message into chat with text
 func (s RootHandler) replyWithMessage(chatID update.ChatID, message string) Transition {
-	return NewTransition(s.RootState, s.userData,
-		[]response.BotAction{response.NewSendMessage(chatID, message)})
+	return Transit(s.RootState, s.userData).Reply(chatID, message).Build()
 }
 
 type RootState struct {
-	DefaultProject option.Option[github.ProjectID]
+	// DefaultProjects are used by /dailyStatus in this chat. The report has items from all of them.
+	DefaultProjects []github.ProjectID
+	// ShowReviewers adds requested reviewers to PRs in the "In review" section of the report. Off by default for privacy.
+	ShowReviewers bool
+	// ReportColumns are the project columns that fill each section of the report in this chat.
+	ReportColumns ReportColumns
+}
+
+// NewRootState creates a RootState with no default projects and the default report columns.
+func NewRootState() RootState {
+	return RootState{
+		DefaultProjects: []github.ProjectID{},
+		ShowReviewers:   false,
+		ReportColumns:   ReportColumns{Today: "", Tomorrow: "", InReview: ""},
+	}
+}
+
+// AddDefaultProject adds `id` to the set of default projects. If it's already in the set nothing happens.
+func (s *RootState) AddDefaultProject(id github.ProjectID) {
+	for _, project := range s.DefaultProjects {
+		if project == id {
+			return
+		}
+	}
+
+	s.DefaultProjects = append(s.DefaultProjects, id)
 }
 
-func (s RootState) Handler(userData UserSharedData, responses *Responses) Handler {
+func (s RootState) Handler(userData UserSharedData, responses *Responses, deps *Deps) Handler {
 	return &RootHandler{
-		responses: &responses.Root,
-		userData:  userData,
-		RootState: s,
+		responses:       &responses.Root,
+		reportTemplates: responses.DailyStatus.Templates,
+		userData:        userData,
+		deps:            deps,
+		RootState:       s,
 	}
 }
 
 type rootResponses struct {
 	// command output
 
-	Start               string `template:"start"`
-	Help                string `template:"help"`
-	AddAPIKey           string `template:"addApiKey"`
-	APIKeyAdded         string `template:"apiKeyAdded"`
-	DailyStatus         string `template:"dailyStatus"`
-	SavedDefaultProject string `template:"savedDefaultProject"`
-	SetDefaultProject   string `template:"setDefaultProject"`
+	Start               string            `template:"start"`
+	Help                string            `template:"help"`
+	AddAPIKey           string            `template:"addApiKey"`
+	APIKeyAdded         string            `template:"apiKeyAdded"`
+	APIKeyRemoved       string            `template:"apiKeyRemoved"`
+	DailyStatus         string            `template:"dailyStatus"`
+	SavedDefaultProject template.Variants `template:"savedDefaultProject,variants"`
+	SetDefaultProject   string            `template:"setDefaultProject"`
+	AddedDefaultProject string            `template:"addedDefaultProject"`
+	PickDefaultProject  string            `template:"pickDefaultProject"`
+	PickNextPageButton  string            `template:"pickNextPageButton"`
+	ReviewersShown      string            `template:"reviewersShown"`
+	ReviewersHidden     string            `template:"reviewersHidden"`
+	ReportConfig        string            `template:"reportConfig"`
+	ClearConfirm        string            `template:"clearConfirm"`
+	ClearConfirmButton  string            `template:"clearConfirmButton"`
+	ClearCancelButton   string            `template:"clearCancelButton"`
+	Cleared             string            `template:"cleared"`
+	ClearCanceled       string            `template:"clearCanceled"`
+	ErrorsHeader        string            `template:"errorsHeader"`
+	ErrorsEmpty         string            `template:"errorsEmpty"`
+	ErrorsDetailsHidden string            `template:"errorsDetailsHidden,optional"`
+	DebugOn             string            `template:"debugOn"`
+	DebugOff            string            `template:"debugOff"`
+
+	Settings              string `template:"settings"`
+	SettingsDefault       string `template:"settingsDefault"`
+	SettingsOn            string `template:"settingsOn"`
+	SettingsOff           string `template:"settingsOff"`
+	SettingsNone          string `template:"settingsNone"`
+	SettingsAPIKeyAdded   string `template:"settingsApiKeyAdded"`
+	SettingsAPIKeyMissing string `template:"settingsApiKeyMissing"`
 
 	// warnings
 
-	UserHasZeroProjects  string `template:"userHasZeroProjects"`
-	LastProjectsPage     string `template:"lastProjectsPage"`
-	UseSetDefaultProject string `template:"useSetDefaultProject"`
+	ReportTemplateSet       string `template:"reportTemplateSet"`
+	ReportTemplateCurrent   string `template:"reportTemplateCurrent"`
+	ReportTemplateUsage     string `template:"reportTemplateUsage"`
+	ReportTemplateUnknown   string `template:"reportTemplateUnknown"`
+	ReportTemplateInvalidID string `template:"reportTemplateInvalidId"`
+
+	AllItemsEmpty               string `template:"allItemsEmpty"`
+	AllItemsTruncated           string `template:"allItemsTruncated"`
+	FieldsHeader                string `template:"fieldsHeader"`
+	CheckColumnsHeader          string `template:"checkColumnsHeader"`
+	CheckColumnsFound           string `template:"checkColumnsFound"`
+	CheckColumnsMissing         string `template:"checkColumnsMissing"`
+	CheckColumnsOptions         string `template:"checkColumnsOptions"`
+	CreateDraft                 string `template:"createDraft"`
+	UserHasZeroProjects         string `template:"userHasZeroProjects"`
+	OrganizationHasZeroProjects string `template:"organizationHasZeroProjects"`
+	OnlyProjectClosed           string `template:"onlyProjectClosed"`
+	LastProjectsPage            string `template:"lastProjectsPage"`
+	UseSetDefaultProject        string `template:"useSetDefaultProject"`
+	NoDefaultProject            string `template:"noDefaultProject"`
 
 	// errors
 
 	PrivateCommandUsed     string `template:"privateCommandUsed"`
+	OpenPrivateChatButton  string `template:"openPrivateChatButton"`
 	UnknownMessage         string `template:"unknownMessage"`
+	DidYouMean             string `template:"didYouMean"`
 	NoAPIKeyAdded          string `template:"noApiKeyAdded"`
+	NoAPIKeyToRemove       string `template:"noApiKeyToRemove"`
 	BadAPIKey              string `template:"badApiKey"`
 	APIKeySentInPublicChat string `template:"apiKeySentInPublicChat"`
 	GithubErrorGeneric     string `template:"githubErrorGeneric"`
+	GithubUnauthorized     string `template:"githubUnauthorized"`
+	NotAProject            string `template:"notAProject"`
+	OrganizationNotFound   string `template:"organizationNotFound"`
+	NothingToRetry         string `template:"nothingToRetry"`
+	AddDefaultProjectUsage string `template:"addDefaultProjectUsage"`
+	ReviewersUsage         string `template:"reviewersUsage"`
+	DebugUsage             string `template:"debugUsage"`
+	ReportConfigUsage      string `template:"reportConfigUsage"`
+	FieldsUsage            string `template:"fieldsUsage"`
+	CheckColumnsUsage      string `template:"checkColumnsUsage"`
+	CheckColumnsNoStatus   string `template:"checkColumnsNoStatus"`
+	PageExpired            string `template:"pageExpired"`
+	ButtonMessageTooOld    string `template:"buttonMessageTooOld"`
+	AlreadyProcessing      string `template:"alreadyProcessing"`
+	Busy                   string `template:"busy"`
+	NotAllowed             string `template:"notAllowed"`
 }
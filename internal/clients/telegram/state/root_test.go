@@ -0,0 +1,512 @@
+package state_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state/statetest"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/template"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
+)
+
+const (
+	testChatID = update.ChatID(42)
+	testUserID = update.UserID(7)
+)
+
+func testResponses() *state.Responses {
+	var responses state.Responses
+
+	responses.Root.NoAPIKeyAdded = "no api key"
+	responses.Root.NoAPIKeyToRemove = "no api key to remove"
+	responses.Root.APIKeyRemoved = "api key removed"
+	responses.Root.NothingToRetry = "nothing to retry"
+	responses.Root.UnknownMessage = "unknown"
+	responses.Root.PrivateCommandUsed = "private only"
+	responses.Root.OpenPrivateChatButton = "open private chat"
+	responses.Root.AddAPIKey = "send me the key"
+	responses.Root.APIKeySentInPublicChat = "key leaked"
+	responses.Root.BadAPIKey = "bad key"
+	responses.Root.APIKeyAdded = "added %s %s"
+	responses.Root.ClearConfirm = "are you sure"
+	responses.Root.Settings = "key=%s projects=%s reviewers=%s today=%s tomorrow=%s review=%s"
+	responses.Root.SettingsDefault = "*"
+	responses.Root.SettingsOn = "on"
+	responses.Root.SettingsOff = "off"
+	responses.Root.SettingsNone = "none"
+	responses.Root.SettingsAPIKeyAdded = "added"
+	responses.Root.SettingsAPIKeyMissing = "missing"
+	responses.Root.Cleared = "cleared"
+	responses.Root.ClearCanceled = "clear canceled"
+	responses.Root.ReviewersShown = "reviewers shown"
+	responses.Root.ReviewersUsage = "reviewers usage"
+	responses.Root.ErrorsHeader = "errors:"
+	responses.Root.ErrorsEmpty = "no errors"
+	responses.Root.ErrorsDetailsHidden = "details hidden"
+	responses.Root.DebugOn = "debug on"
+	responses.Root.DebugOff = "debug off"
+	responses.Root.DebugUsage = "debug usage"
+	responses.Root.DidYouMean = "did you mean /%s"
+	responses.Root.ReportConfig = "%s|%s|%s"
+	responses.Root.ReportConfigUsage = "report config usage"
+	responses.Root.PageExpired = "page expired"
+	responses.Root.ButtonMessageTooOld = "button too old"
+	responses.Root.NotAllowed = "not allowed"
+	responses.Root.SavedDefaultProject = template.Variants{"saved %q"}
+	responses.Root.PickDefaultProject = "pick a project"
+	responses.Root.AllItemsEmpty = "nothing assigned"
+	responses.Root.OnlyProjectClosed = "only project %s is closed"
+	responses.Root.AllItemsTruncated = "only %d projects and %d items"
+	responses.Root.GithubErrorGeneric = "github error"
+	responses.Root.GithubUnauthorized = "github unauthorized"
+	responses.Root.NotAProject = "%s is a %s"
+	responses.Root.OrganizationNotFound = "no organization %s"
+	responses.Root.OrganizationHasZeroProjects = "%s has no projects"
+	responses.Root.FieldsUsage = "fields usage"
+	responses.Root.FieldsHeader = "fields of %s:"
+	responses.Root.CheckColumnsUsage = "check columns usage"
+	responses.Root.CheckColumnsHeader = "columns of %s:"
+	responses.Root.CheckColumnsFound = "found %s=%s"
+	responses.Root.CheckColumnsMissing = "missing %s=%s"
+	responses.Root.CheckColumnsOptions = "options: %s"
+	responses.Root.CheckColumnsNoStatus = "%s has no status"
+	responses.Root.CreateDraft = "title?"
+	responses.Root.NoDefaultProject = "no default project"
+	responses.CreateDraft.Title = "title?"
+	responses.CreateDraft.Body = "body?"
+	responses.CreateDraft.Created = "created %s"
+	responses.CreateDraft.NoAPIKeyAdded = "no api key"
+	responses.CreateDraft.NoDefaultProject = "no default project"
+	responses.CreateDraft.GithubErrorGeneric = "github error"
+	responses.CreateDraft.GithubUnauthorized = "github unauthorized"
+	responses.CreateDraft.SlowDown = "slow down"
+	responses.PickDefaultProject.PickDefaultProject = "pick a project"
+	responses.DailyStatus.DiscoveryOfTheDay = "discovery?"
+	responses.DailyStatus.QuestionsAndBlockers = "blockers?"
+	responses.DailyStatus.Templates = state.ReportTemplates{
+		"default": {Today: "Today I worked on", Tomorrow: "Tomorrow I will work on", Discovery: "Discovery",
+			Blockers: "Blockers", InReview: "In review", Other: "Other"},
+		"standup": {Today: "Yesterday", Tomorrow: "Today", Discovery: "Learned", Blockers: "Stuck", InReview: "Review",
+			Other: "Rest"},
+	}
+	responses.Root.ReportTemplateSet = "%s uses %s"
+	responses.Root.ReportTemplateCurrent = "%s uses %s of %s"
+	responses.Root.ReportTemplateUsage = "report template usage: %s"
+	responses.Root.ReportTemplateUnknown = "unknown %q of %s"
+	responses.Root.ReportTemplateInvalidID = "not a project ID: %s"
+	responses.DailyStatus.ReportHeader = "#daily report %s: %s"
+	responses.DailyStatus.ReportProject = `<a href="%s">%s</a> (#%d)`
+	responses.DailyStatus.ReportAsFile = "as file"
+	responses.DailyStatus.Restarting = "restarting"
+	responses.PickDefaultProject.Canceled = "canceled"
+	responses.PickDefaultProject.ButtonExpired = "button expired"
+	responses.PickDefaultProject.UseButtons = "use the buttons"
+	responses.PickDefaultProject.GithubUnauthorized = "github unauthorized"
+	responses.DailyStatus.GithubUnauthorized = "github unauthorized"
+	responses.SetDefaultProject.GithubUnauthorized = "github unauthorized"
+
+	return &responses
+}
+
+// testDeps are the dependencies of handlers with the defaults of NewDeps.
+func testDeps() *state.Deps {
+	deps := state.NewDeps()
+
+	return &deps
+}
+
+// githubDeps are testDeps with the GitHub clients talking to `endpoint`, e.g. a fake GitHub server.
+func githubDeps(endpoint string) *state.Deps {
+	deps := testDeps()
+	deps.Github.Endpoint = endpoint
+
+	return deps
+}
+
+func privateText(text string) update.PrivateTextMessage {
+	return update.PrivateTextMessage{
+		UpdateID: 1,
+		ID:       1,
+		Text:     text,
+		Chat:     update.Chat{ID: testChatID, Type: update.ChatTypePrivate},
+		From:     update.User{ID: testUserID, FirstName: "Test"},
+	}
+}
+
+func groupText(text string) update.GroupTextMessage {
+	return update.GroupTextMessage{
+		UpdateID: 1,
+		ID:       1,
+		Text:     text,
+		Chat:     update.Chat{ID: testChatID, Type: update.ChatTypeGroup},
+		From:     update.User{ID: testUserID, FirstName: "Test"},
+	}
+}
+
+func callbackQuery(data string) update.CallbackQuery {
+	return update.CallbackQuery{
+		UpdateID: 1,
+		ID:       "cq",
+		From:     update.User{ID: testUserID, FirstName: "Test"},
+		Message: option.Some(update.Message{
+			ID:   1,
+			Chat: update.Chat{ID: testChatID, Type: update.ChatTypePrivate},
+		}),
+		Data: option.Some(data),
+	}
+}
+
+func rootHandler(userData state.UserSharedData) state.Handler {
+	return rootHandlerWith(testDeps(), userData)
+}
+
+func rootHandlerWith(deps *state.Deps, userData state.UserSharedData) state.Handler {
+	return state.NewRootState().Handler(userData, testResponses(), deps)
+}
+
+// sentText decodes the only action of a transition as a SendMessage and returns its text.
+func sentText(t *testing.T, transition state.Transition) string {
+	t.Helper()
+
+	if len(transition.Actions) != 1 {
+		t.Fatalf("Expected 1 action, got %d", len(transition.Actions))
+	}
+
+	return sentTextAt(t, transition, 0)
+}
+
+// sentTextAt decodes the action at index `i` as a SendMessage and returns its text.
+func sentTextAt(t *testing.T, transition state.Transition, i int) string {
+	t.Helper()
+
+	actions := statetest.DecodeActions(t, transition)
+	if len(actions) <= i {
+		t.Fatalf("Expected at least %d actions, got %d", i+1, len(actions))
+	}
+
+	if actions[i].Endpoint != "sendMessage" {
+		t.Fatalf("Expected sendMessage, got /%s", actions[i].Endpoint)
+	}
+
+	return actions[i].Text
+}
+
+func TestRetryWithNothingToRetry(t *testing.T) {
+	t.Parallel()
+
+	transition := rootHandler(state.NewUserSharedData()).PrivateTextMessage(context.Background(),
+		privateText("/retry"))
+
+	if text := sentText(t, transition); text != "nothing to retry" {
+		t.Fatalf("Expected the nothing to retry message, got %q", text)
+	}
+}
+
+// failingOnce serves the first request with 502 Bad Gateway, like an overloaded GitHub, and the rest with `handler`.
+func failingOnce(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+
+	var failed atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failed.CompareAndSwap(false, true) {
+			http.Error(w, "", http.StatusBadGateway)
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestRetryRepeatsCommandThatFailed(t *testing.T) {
+	t.Parallel()
+
+	aliases, err := state.NewCommandAliases(map[string]string{"items": "allitems"})
+	if err != nil {
+		t.Fatalf("Aliases were not accepted: %s", err)
+	}
+
+	items := fakeGithubItems(t, map[string][]string{"PVT_1": {"Done:Fix bug"}})
+	deps := githubDeps(failingOnce(t, items.Config.Handler).URL)
+	deps.CommandAliases = aliases
+	chat := update.Chat{ID: testChatID, Type: update.ChatTypePrivate}
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := state.Handle(context.Background(), *deps, messageUpdate(chat, "/items"), state.NewRootState(),
+		userData, testResponses())
+
+	// /retry repeats the command, not the alias
+	last, isSome := transition.UserData.LastCommand.Unwrap()
+	if !isSome || last.Method != "allItems" {
+		t.Fatalf("Expected /allItems to be saved after GitHub failed, got %#v", transition.UserData.LastCommand)
+	}
+
+	// Commands that dont talk to GitHub dont overwrite the last command
+	transition = state.Handle(context.Background(), *deps, messageUpdate(chat, "/help"), transition.NewState,
+		transition.UserData, testResponses())
+	if transition.UserData.LastCommand.IsNone() {
+		t.Fatal("/help erased the last command")
+	}
+
+	transition = state.Handle(context.Background(), *deps, messageUpdate(chat, "/retry"), transition.NewState,
+		transition.UserData, testResponses())
+	if text := sentText(t, transition); !strings.Contains(text, "Fix bug") {
+		t.Fatalf("/retry did not repeat /allItems, replied with %q", text)
+	}
+
+	// It has worked, there is nothing to retry anymore
+	if transition.UserData.LastCommand.IsSome() {
+		t.Fatalf("%#v is still saved after it has worked", transition.UserData.LastCommand)
+	}
+}
+
+func TestRetryDoesntSaveCommandsThatFailedForGood(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "", http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := state.Handle(context.Background(), *githubDeps(server.URL),
+		messageUpdate(update.Chat{ID: testChatID, Type: update.ChatTypePrivate}, "/allItems"), state.NewRootState(),
+		userData, testResponses())
+	if transition.UserData.LastCommand.IsSome() {
+		t.Fatalf("A revoked key can't work on /retry, but %#v was saved", transition.UserData.LastCommand)
+	}
+}
+
+func TestRetryDoesntSavePrivateCommandsInGroups(t *testing.T) {
+	t.Parallel()
+
+	server := failingOnce(t, http.NotFoundHandler())
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+	userData.LastCommand = option.Some(slashcmd.Command{Method: "allItems", Args: []string{}})
+
+	transition := state.Handle(context.Background(), *githubDeps(server.URL),
+		messageUpdate(update.Chat{ID: testChatID, Type: update.ChatTypeGroup}, "/listProjects"), state.NewRootState(),
+		userData, testResponses())
+	statetest.AssertSendsMessage(t, transition, testChatID, "private only")
+
+	if last, _ := transition.UserData.LastCommand.Unwrap(); last.Method != "allItems" {
+		t.Fatalf("/listProjects can't run in a group, but it has replaced the last command with %#v", last)
+	}
+}
+
+func TestAddDefaultProjectIsASet(t *testing.T) {
+	t.Parallel()
+
+	root := state.NewRootState()
+
+	root.AddDefaultProject("PVT_1")
+	root.AddDefaultProject("PVT_2")
+	root.AddDefaultProject("PVT_1")
+
+	if len(root.DefaultProjects) != 2 || root.DefaultProjects[0] != "PVT_1" || root.DefaultProjects[1] != "PVT_2" {
+		t.Fatalf("Expected [PVT_1 PVT_2], got %v", root.DefaultProjects)
+	}
+}
+
+func TestDefaultProjectThatIsNotAProject(t *testing.T) {
+	t.Parallel()
+
+	server := statetest.FakeGithub(t, map[string]string{"ProjectV2ByID": `{"data": {"node": {"__typename": "Issue"}}}`})
+
+	deps := githubDeps(server.URL)
+	ctx := context.Background()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	for _, command := range []string{"/setDefaultProject I_1", "/addDefaultProject I_1"} {
+		transition := rootHandlerWith(deps, userData).PrivateTextMessage(ctx, privateText(command))
+
+		if text := sentText(t, transition); text != "I_1 is a Issue" {
+			t.Fatalf("%s: expected the not a project message, got %q", command, text)
+		}
+
+		if root, isRoot := transition.NewState.(state.RootState); !isRoot || len(root.DefaultProjects) != 0 {
+			t.Fatalf("%s: the ID was saved as a default project: %#v", command, transition.NewState)
+		}
+	}
+}
+
+func TestRemoveAPIKeyKeepsDefaultProjects(t *testing.T) {
+	t.Parallel()
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := root.Handler(userData, testResponses(), testDeps()).
+		PrivateTextMessage(context.Background(), privateText("/removeApiKey"))
+
+	if text := sentText(t, transition); text != "api key removed" {
+		t.Fatalf("Expected the confirmation, got %q", text)
+	}
+
+	if transition.UserData.GithubAPIKey.IsSome() {
+		t.Error("The API key was not removed")
+	}
+
+	if newRoot, is := transition.NewState.(state.RootState); !is || len(newRoot.DefaultProjects) != 1 {
+		t.Errorf("Expected to stay in root with the default project, got %#v", transition.NewState)
+	}
+
+	transition = rootHandler(transition.UserData).PrivateTextMessage(context.Background(), privateText("/removeApiKey"))
+	if text := sentText(t, transition); text != "no api key to remove" {
+		t.Errorf("Expected a reply that there is no key, got %q", text)
+	}
+}
+
+func TestRemoveAPIKeyThatCantBeDecrypted(t *testing.T) {
+	t.Parallel()
+
+	userData := state.NewUserSharedData()
+	userData.LockedAPIKey = "encrypted"
+
+	transition := rootHandler(userData).PrivateTextMessage(context.Background(), privateText("/removeApiKey"))
+
+	if text := sentText(t, transition); text != "api key removed" {
+		t.Fatalf("Expected the confirmation, got %q", text)
+	}
+
+	if transition.UserData.LockedAPIKey != "" {
+		t.Error("The key that can't be decrypted was kept after /removeApiKey")
+	}
+}
+
+func TestRemoveAPIKeyInGroup(t *testing.T) {
+	t.Parallel()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := rootHandler(userData).GroupTextMessage(context.Background(), groupText("/removeApiKey"))
+
+	if text := sentText(t, transition); text != "private only" {
+		t.Errorf("Expected PrivateCommandUsed, got %q", text)
+	}
+
+	if transition.UserData.GithubAPIKey.IsNone() {
+		t.Error("The API key was removed from a group")
+	}
+}
+
+func TestPrivateCommandInGroup(t *testing.T) {
+	t.Parallel()
+
+	transition := rootHandler(state.NewUserSharedData()).GroupTextMessage(context.Background(), groupText("/listProjects"))
+
+	statetest.AssertSendsMessage(t, transition, testChatID, "private only")
+}
+
+func TestPrivateCommandInGroupLinksToPrivateChat(t *testing.T) {
+	t.Parallel()
+
+	bot := update.User{ID: 1, IsBot: true, FirstName: "Bot", Username: option.Some("reporter_bot")}
+	deps := testDeps()
+	deps.Bot = bot
+
+	transition := rootHandlerWith(deps, state.NewUserSharedData()).GroupTextMessage(context.Background(),
+		groupText("/addApiKey"))
+	statetest.AssertSendsMessage(t, transition, testChatID, "private only")
+
+	var reply struct {
+		ReplyMarkup struct {
+			Keyboard [][]struct {
+				Text string `json:"text"`
+				URL  string `json:"url"`
+			} `json:"inline_keyboard"`
+		} `json:"reply_markup"`
+	}
+
+	if err := json.Unmarshal(statetest.DecodeActions(t, transition)[0].Body, &reply); err != nil {
+		t.Fatalf("While decoding the reply: %s", err)
+	}
+
+	keyboard := reply.ReplyMarkup.Keyboard
+	if len(keyboard) != 1 || len(keyboard[0]) != 1 || keyboard[0][0].URL != "https://t.me/reporter_bot?start=addkey" {
+		t.Fatalf("Expected a button with the deep link, got %+v", keyboard)
+	}
+}
+
+func TestStartPayloadOpensAddAPIKey(t *testing.T) {
+	t.Parallel()
+
+	transition := rootHandler(state.NewUserSharedData()).PrivateTextMessage(context.Background(),
+		privateText("/start addkey"))
+
+	if _, isAdding := transition.NewState.(state.AddAPIKeyState); !isAdding {
+		t.Fatalf("Expected AddAPIKeyState, got %T", transition.NewState)
+	}
+}
+
+func TestReviewersOn(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	transition := rootHandler(state.NewUserSharedData()).GroupTextMessage(ctx, groupText("/reviewers on"))
+	statetest.AssertSendsMessage(t, transition, testChatID, "reviewers shown")
+
+	if root, is := transition.NewState.(state.RootState); !is || !root.ShowReviewers {
+		t.Fatalf("Reviewers were not turned on: %#v", transition.NewState)
+	}
+
+	transition = rootHandler(state.NewUserSharedData()).GroupTextMessage(ctx, groupText("/reviewers maybe"))
+	statetest.AssertSendsMessage(t, transition, testChatID, "reviewers usage")
+}
+
+func TestCallbackQueryWithoutMessage(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{"listprojects:0", "clear:yes", "unknown"} {
+		cq := callbackQuery(data)
+		cq.Message = option.None[update.Message]()
+
+		userData := state.NewUserSharedData()
+		userData.GithubAPIKey = option.Some("key")
+
+		transition := rootHandler(userData).CallbackQuery(context.Background(), cq)
+
+		statetest.AssertAnswersCallback(t, transition, "button too old", true)
+
+		if transition.UserData.GithubAPIKey.IsNone() {
+			t.Errorf("%s: button from an old message has deleted user data", data)
+		}
+	}
+}
+
+func TestPickerButtonAfterPickerEnded(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{"pickproject:0", "pickpage:1"} {
+		transition := rootHandler(state.NewUserSharedData()).CallbackQuery(context.Background(), callbackQuery(data))
+		statetest.AssertAnswersCallback(t, transition, "button too old", true)
+	}
+
+	transition := rootHandler(state.NewUserSharedData()).CallbackQuery(context.Background(), callbackQuery("unknown"))
+	statetest.AssertAnswersCallback(t, transition, "This button doesnt work.", false)
+}
@@ -0,0 +1,98 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// stateDecoders decode the conversation states by the name of their type in the JSON made by EncodeState.
+var stateDecoders = map[string]func(json.RawMessage) (State, error){
+	"root":               decodeOnto(NewRootState()),
+	"addApiKey":          decodeOnto(AddAPIKeyState{RootState: NewRootState()}),
+	"dailyStatus":        decodeOnto(DailyStatusState{RootState: NewRootState()}), //nolint:exhaustruct // From JSON
+	"setDefaultProject":  decodeOnto(SetDefaultProjectState{RootState: NewRootState()}),
+	"pickDefaultProject": decodeOnto(PickDefaultProjectState{RootState: NewRootState()}), //nolint:exhaustruct // Same
+	"createDraft":        decodeOnto(NewCreateDraftState(NewRootState())),
+}
+
+// decodeOnto decodes JSON on top of a copy of `defaults`, so the fields that are not in the JSON keep their defaults.
+func decodeOnto[T State](defaults T) func(json.RawMessage) (State, error) {
+	return func(data json.RawMessage) (State, error) {
+		decoded := defaults
+		err := json.Unmarshal(data, &decoded)
+
+		return decoded, err //nolint:wrapcheck // Wrapped by DecodeState
+	}
+}
+
+// encodedState is the JSON of a conversation state with the name of its type.
+type encodedState struct {
+	Type  string          `json:"type"`
+	State json.RawMessage `json:"state"`
+}
+
+/*
+EncodeState encodes a conversation state to JSON, so that it can be saved and restored with DecodeState after a restart.
+A user in the middle of /dailyStatus can then answer the next question as if nothing happened.
+*/
+func EncodeState(conversation State) ([]byte, error) {
+	var name string
+
+	switch conversation.(type) {
+	case RootState:
+		name = "root"
+	case AddAPIKeyState:
+		name = "addApiKey"
+	case DailyStatusState:
+		name = "dailyStatus"
+	case SetDefaultProjectState:
+		name = "setDefaultProject"
+	case PickDefaultProjectState:
+		name = "pickDefaultProject"
+	case CreateDraftState:
+		name = "createDraft"
+	default:
+		return nil, UnknownStateTypeError{Type: fmt.Sprintf("%T", conversation)}
+	}
+
+	encoded, err := json.Marshal(conversation)
+	if err != nil {
+		return nil, fmt.Errorf("while encoding %s state: %w", name, err)
+	}
+
+	data, err := json.Marshal(encodedState{Type: name, State: encoded})
+	if err != nil {
+		return nil, fmt.Errorf("while encoding %s state: %w", name, err)
+	}
+
+	return data, nil
+}
+
+// DecodeState decodes a conversation state encoded by EncodeState.
+func DecodeState(data []byte) (State, error) {
+	var encoded encodedState
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, fmt.Errorf("while decoding a state: %w", err)
+	}
+
+	decode, isKnown := stateDecoders[encoded.Type]
+	if !isKnown {
+		return nil, UnknownStateTypeError{Type: encoded.Type}
+	}
+
+	conversation, err := decode(encoded.State)
+	if err != nil {
+		return nil, fmt.Errorf("while decoding %s state: %w", encoded.Type, err)
+	}
+
+	return conversation, nil
+}
+
+// UnknownStateTypeError is returned when a state can't be encoded or decoded because its type is not in stateDecoders.
+type UnknownStateTypeError struct {
+	Type string
+}
+
+func (e UnknownStateTypeError) Error() string {
+	return fmt.Sprintf("state type %s can't be saved", e.Type)
+}
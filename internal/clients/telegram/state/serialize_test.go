@@ -0,0 +1,97 @@
+package state_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestEncodeStateRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+	root.ShowReviewers = true
+
+	states := []state.State{
+		root,
+		state.AddAPIKeyState{RootState: root},
+		state.SetDefaultProjectState{RootState: root},
+		state.PickDefaultProjectState{
+			RootState: root, Choices: []state.ProjectChoice{{Token: "1", ID: "PVT_2"}}, NextToken: 2,
+		},
+		state.NewDailyStatusState(root, option.Some("today"), []github.ProjectV2{{ID: "PVT_1", Title: "Backend"}}),
+		state.NewCreateDraftState(root),
+	}
+
+	for _, conversation := range states {
+		data, err := state.EncodeState(conversation)
+		if err != nil {
+			t.Fatalf("While encoding %T: %s", conversation, err)
+		}
+
+		decoded, err := state.DecodeState(data)
+		if err != nil {
+			t.Fatalf("While decoding %T from %s: %s", conversation, data, err)
+		}
+
+		if !reflect.DeepEqual(decoded, conversation) {
+			t.Errorf("%T changed after decoding:\n%#v\n%#v", conversation, conversation, decoded)
+		}
+	}
+}
+
+func TestDecodeUnknownState(t *testing.T) {
+	t.Parallel()
+
+	var unknown state.UnknownStateTypeError
+	if _, err := state.DecodeState([]byte(`{"type": "removed", "state": {}}`)); !errors.As(err, &unknown) {
+		t.Fatalf("Expected UnknownStateTypeError, got %v", err)
+	}
+}
+
+func TestDailyStatusResumesAfterRestart(t *testing.T) {
+	t.Parallel()
+
+	deps := githubDeps(fakeGithubItems(t, map[string][]string{"PVT_1": {"Done:Fix bug"}}).URL)
+	ctx := context.Background()
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	transition := state.NewDailyStatusState(root, option.Some("today"), nil).Handler(userData, testResponses(), deps).
+		PrivateTextMessage(ctx, privateText("Learned about JSON"))
+
+	saved, err := state.EncodeState(transition.NewState)
+	if err != nil {
+		t.Fatalf("While saving the state: %s", err)
+	}
+
+	// The bot restarts here, nothing but the saved state is left
+	restored, err := state.DecodeState(saved)
+	if err != nil {
+		t.Fatalf("While restoring the state: %s", err)
+	}
+
+	transition = restored.Handler(userData, testResponses(), deps).PrivateTextMessage(ctx, privateText("/none"))
+
+	report := sentText(t, transition)
+	for _, expected := range []string{"<i>today</i>", "Learned about JSON", "Fix bug"} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("The report after the restart doesn't have %q:\n%s", expected, report)
+		}
+	}
+
+	if newRoot, isRoot := transition.NewState.(state.RootState); !isRoot || len(newRoot.DefaultProjects) != 1 {
+		t.Errorf("Expected to return to the root state with the default project, got %#v", transition.NewState)
+	}
+}
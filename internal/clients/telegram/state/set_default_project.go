@@ -8,13 +8,14 @@ import (
 	"github.com/m-kuzmin/daily-reporter/internal/clients/github"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
 	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
-	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+	"github.com/m-kuzmin/daily-reporter/internal/template"
 	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
 )
 
 type SetDefaultProjectHandler struct {
 	responses *SetDefaultProjectResponses
 	userData  UserSharedData
+	deps      *Deps
 	SetDefaultProjectState
 }
 
@@ -32,7 +33,11 @@ func (s *SetDefaultProjectHandler) CallbackQuery(ctx context.Context, _ update.C
 }
 
 func (s *SetDefaultProjectHandler) Ignore(_ context.Context) Transition {
-	return NewTransition(s.SetDefaultProjectState, s.userData, response.Nothing())
+	return Transit(s.SetDefaultProjectState, s.userData).Build()
+}
+
+func (s *SetDefaultProjectHandler) Unwind(_ context.Context, _ update.ChatID) Transition {
+	return Transit(s.SetDefaultProjectState, s.userData).Build()
 }
 
 func (s *SetDefaultProjectHandler) saveDefaultProject(ctx context.Context, chatID update.ChatID, text string,
@@ -40,15 +45,11 @@ func (s *SetDefaultProjectHandler) saveDefaultProject(ctx context.Context, chatI
 	if cmd, is := slashcmd.Parse(text); is {
 		switch strings.ToLower(cmd.Method) {
 		case noneCommand:
-			s.DefaultProject = option.None[github.ProjectID]()
+			s.DefaultProjects = []github.ProjectID{}
 
-			return NewTransition(s.RootState, s.userData, []response.BotAction{
-				response.NewSendMessage(chatID, "Default project reset for this chat."),
-			})
+			return Transit(s.RootState, s.userData).Reply(chatID, "Default projects reset for this chat.").Build()
 		case cancelCommand:
-			return NewTransition(s.RootState, s.userData, []response.BotAction{
-				response.NewSendMessage(chatID, "Canceled."),
-			})
+			return Transit(s.RootState, s.userData).Reply(chatID, "Canceled.").Build()
 		}
 	}
 
@@ -57,39 +58,42 @@ func (s *SetDefaultProjectHandler) saveDefaultProject(ctx context.Context, chatI
 		return s.replyWithMessage(chatID, s.responses.NoAPIKeyAdded)
 	}
 
-	project, err := github.NewClient(token).ProjectV2ByID(ctx, github.ProjectID(text))
+	s.deps.DispatchEarly(ctx, response.Typing(chatID))
+
+	project, err := s.deps.githubClient(token).ProjectV2ByID(ctx, github.ProjectID(text))
 	if err != nil {
-		return s.replyWithMessage(chatID,
-			github.GqlErrorStringOr("Github API error: %s", err, s.responses.GithubErrorGeneric))
+		return s.replyWithMessage(chatID, projectErrorMessage(s.deps, err, s.responses.NotAProject,
+			s.responses.GithubUnauthorized, s.responses.GithubErrorGeneric))
 	}
 
-	s.DefaultProject = option.Some[github.ProjectID](github.ProjectID(text))
+	s.DefaultProjects = []github.ProjectID{github.ProjectID(text)}
 
-	return NewTransition(s.RootState, s.userData, []response.BotAction{
-		response.NewSendMessage(chatID, fmt.Sprintf(s.responses.Success, project.Title)),
-	})
+	return Transit(s.RootState, s.userData).
+		Reply(chatID, fmt.Sprintf(s.responses.Success.Random(), escapeMarkup(project.Title))).
+		Build()
 }
 
 func (s SetDefaultProjectHandler) replyWithMessage(chatID update.ChatID, message string) Transition {
-	return NewTransition(s.SetDefaultProjectState, s.userData, []response.BotAction{
-		response.NewSendMessage(chatID, message),
-	})
+	return Transit(s.SetDefaultProjectState, s.userData).Reply(chatID, message).Build()
 }
 
 type SetDefaultProjectState struct {
 	RootState
 }
 
-func (s SetDefaultProjectState) Handler(userData UserSharedData, resp *Responses) Handler {
+func (s SetDefaultProjectState) Handler(userData UserSharedData, resp *Responses, deps *Deps) Handler {
 	return &SetDefaultProjectHandler{
 		responses:              &resp.SetDefaultProject,
 		userData:               userData,
+		deps:                   deps,
 		SetDefaultProjectState: s,
 	}
 }
 
 type SetDefaultProjectResponses struct {
-	Success            string `template:"success"`
-	GithubErrorGeneric string `template:"githubErrorGeneric"`
-	NoAPIKeyAdded      string `template:"noApiKeyAdded"`
+	Success            template.Variants `template:"success,variants"`
+	GithubErrorGeneric string            `template:"githubErrorGeneric"`
+	GithubUnauthorized string            `template:"githubUnauthorized"`
+	NotAProject        string            `template:"notAProject"`
+	NoAPIKeyAdded      string            `template:"noApiKeyAdded"`
 }
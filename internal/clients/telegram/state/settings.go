@@ -0,0 +1,60 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+const settingsCommand = "settings"
+
+// handleSettings replies with all settings of the user and this chat. Settings that were not changed are marked.
+func (s *RootHandler) handleSettings(ctx context.Context, chatID update.ChatID) Transition {
+	markDefault := func(value string, isDefault bool) string {
+		if isDefault {
+			return value + s.responses.SettingsDefault
+		}
+
+		return value
+	}
+
+	onOff := func(isOn bool) string {
+		if isOn {
+			return s.responses.SettingsOn
+		}
+
+		return s.responses.SettingsOff
+	}
+
+	apiKey := markDefault(s.responses.SettingsAPIKeyMissing, true)
+	if s.userData.GithubAPIKey.IsSome() {
+		apiKey = s.responses.SettingsAPIKeyAdded
+	}
+
+	projects := markDefault(s.responses.SettingsNone, true)
+	if len(s.DefaultProjects) != 0 {
+		ids := make([]string, len(s.DefaultProjects))
+		for i, id := range s.DefaultProjects {
+			ids[i] = response.Code(string(id))
+		}
+
+		projects = strings.Join(ids, ", ")
+	}
+
+	defaults := s.deps.DailyStatusConfig.Columns
+	columns := s.ReportColumns.Or(defaults)
+	column := func(name, defaultName string) string {
+		return markDefault(response.Bold(name), name == defaultName)
+	}
+
+	return s.replyWithMessage(chatID, fmt.Sprintf(s.responses.Settings,
+		apiKey,
+		projects,
+		markDefault(onOff(s.ShowReviewers), !s.ShowReviewers),
+		column(columns.Today, defaults.Today),
+		column(columns.Tomorrow, defaults.Tomorrow),
+		column(columns.InReview, defaults.InReview)))
+}
@@ -0,0 +1,43 @@
+package state_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+func TestSettingsDefaults(t *testing.T) {
+	t.Parallel()
+
+	transition := rootHandler(state.NewUserSharedData()).GroupTextMessage(context.Background(), groupText("/settings"))
+
+	expected := "key=missing* projects=none* reviewers=off* " +
+		"today=<b>Done</b>* tomorrow=<b>In Progress</b>* review=<b>In Review</b>*"
+	if text := sentText(t, transition); text != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, text)
+	}
+}
+
+func TestSettingsOverrides(t *testing.T) {
+	t.Parallel()
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("key")
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+	root.AddDefaultProject("PVT_2")
+	root.ShowReviewers = true
+	root.ReportColumns.Set([]string{"today=Shipped", "review=<QA>"})
+
+	transition := root.Handler(userData, testResponses(), testDeps()).PrivateTextMessage(context.Background(),
+		privateText("/settings"))
+
+	expected := "key=added projects=<code>PVT_1</code>, <code>PVT_2</code> reviewers=on " +
+		"today=<b>Shipped</b> tomorrow=<b>In Progress</b>* review=<b>&lt;QA&gt;</b>"
+	if text := sentText(t, transition); text != expected {
+		t.Fatalf("Expected\n%s\ngot\n%s", expected, text)
+	}
+}
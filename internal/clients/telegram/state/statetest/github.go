@@ -0,0 +1,100 @@
+package statetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// GraphQLRequest is a query or mutation that the fake GitHub received.
+type GraphQLRequest struct {
+	// OperationName is the name of the query, e.g. "ViewerProjectsV2"
+	OperationName string `json:"operationName"`
+	// Variables are the JSON encoded variables of the query
+	Variables json.RawMessage `json:"variables"`
+}
+
+// DecodeVariables decodes the variables of the query into `into`.
+func (r GraphQLRequest) DecodeVariables(into any) error {
+	if err := json.Unmarshal(r.Variables, into); err != nil {
+		return fmt.Errorf("while decoding the variables of %s: %w", r.OperationName, err)
+	}
+
+	return nil
+}
+
+/*
+AnswerFunc answers a GraphQL operation. The Content-Type is already set to JSON, so usually it only writes the body.
+The request is fully read, `r` is only useful for the headers.
+*/
+type AnswerFunc func(w http.ResponseWriter, r *http.Request, request GraphQLRequest)
+
+// GithubServer is a fake GitHub GraphQL API. It remembers the requests it received.
+type GithubServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []GraphQLRequest
+}
+
+// FakeGithub answers each GraphQL operation with its JSON body from `bodies`.
+func FakeGithub(t *testing.T, bodies map[string]string) *GithubServer {
+	t.Helper()
+
+	answers := make(map[string]AnswerFunc, len(bodies))
+
+	for operation, body := range bodies {
+		body := body
+		answers[operation] = func(w http.ResponseWriter, _ *http.Request, _ GraphQLRequest) { fmt.Fprint(w, body) }
+	}
+
+	return FakeGithubFuncs(t, answers)
+}
+
+/*
+FakeGithubFuncs answers each GraphQL operation with its func from `answers`. Operations that are not in `answers` are
+answered with 400 Bad Request, so the client fails if a handler sends a query that the test didn't expect. The server
+is closed when the test ends.
+*/
+func FakeGithubFuncs(t *testing.T, answers map[string]AnswerFunc) *GithubServer {
+	t.Helper()
+
+	server := &GithubServer{Server: nil, mu: sync.Mutex{}, requests: []GraphQLRequest{}}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request GraphQLRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		server.mu.Lock()
+		server.requests = append(server.requests, request)
+		server.mu.Unlock()
+
+		answer, found := answers[request.OperationName]
+		if !found {
+			http.Error(w, "unexpected operation "+request.OperationName, http.StatusBadRequest)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		answer(w, r, request)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// Requests returns the requests the server received so far, in order.
+func (s *GithubServer) Requests() []GraphQLRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]GraphQLRequest{}, s.requests...)
+}
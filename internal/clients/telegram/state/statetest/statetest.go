@@ -0,0 +1,139 @@
+/*
+statetest has helpers for testing handlers in package state. Actions in a state.Transition can only be inspected by
+encoding them to JSON, these helpers do that and decode the fields tests usually care about.
+*/
+package statetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/response"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+// Action is a decoded response.BotAction. Fields that the action doesn't have are empty.
+type Action struct {
+	// Endpoint is the Telegram API method, e.g. "sendMessage"
+	Endpoint string
+	// ChatID is `chat_id`
+	ChatID string
+	// Text is `text` of messages and callback query answers
+	Text string
+	// ShowAlert is `show_alert` of callback query answers
+	ShowAlert bool
+	// Buttons are the callback data of inline keyboard buttons, row by row
+	Buttons [][]string
+	// Body is the whole JSON body
+	Body json.RawMessage
+}
+
+/*
+DecodeActions decodes all actions of the transition, batches are expanded into their actions. The test fails if any
+action can't be encoded.
+*/
+func DecodeActions(t *testing.T, transition state.Transition) []Action {
+	t.Helper()
+
+	flat := response.Flatten(transition.Actions)
+	actions := make([]Action, len(flat))
+
+	for i, action := range flat {
+		endpoint, body, err := action.JSONEncode()
+		if err != nil {
+			t.Fatalf("While encoding action %d (%T): %s", i, action, err)
+		}
+
+		var fields struct {
+			ChatID      string `json:"chat_id"`
+			Text        string `json:"text"`
+			ShowAlert   bool   `json:"show_alert"`
+			ReplyMarkup struct {
+				Keyboard [][]struct {
+					CallbackData string `json:"callback_data"`
+				} `json:"inline_keyboard"`
+			} `json:"reply_markup"`
+		}
+
+		if err = json.Unmarshal(body, &fields); err != nil {
+			t.Fatalf("While decoding /%s: %s", endpoint, err)
+		}
+
+		buttons := make([][]string, len(fields.ReplyMarkup.Keyboard))
+		for row, keyboardRow := range fields.ReplyMarkup.Keyboard {
+			for _, button := range keyboardRow {
+				buttons[row] = append(buttons[row], button.CallbackData)
+			}
+		}
+
+		actions[i] = Action{
+			Endpoint:  endpoint,
+			ChatID:    fields.ChatID,
+			Text:      fields.Text,
+			ShowAlert: fields.ShowAlert,
+			Buttons:   buttons,
+			Body:      body,
+		}
+	}
+
+	return actions
+}
+
+// AssertSendsMessage checks that the transition sends a message that contains `text` into the chat.
+func AssertSendsMessage(t *testing.T, transition state.Transition, chatID update.ChatID, text string) Action {
+	t.Helper()
+
+	actions := DecodeActions(t, transition)
+
+	for _, action := range actions {
+		if action.Endpoint == "sendMessage" && action.ChatID == string(response.NewChatID(chatID)) && strings.Contains(action.Text, text) {
+			return action
+		}
+	}
+
+	t.Fatalf("Expected a message containing %q to (ChatID %d), got:\n%s", text, chatID, describe(actions))
+
+	return Action{} //nolint:exhaustruct // Unreachable
+}
+
+// AssertAnswersCallback checks that the transition answers a callback query with `text` (as an alert or not).
+func AssertAnswersCallback(t *testing.T, transition state.Transition, text string, showAlert bool) Action {
+	t.Helper()
+
+	actions := DecodeActions(t, transition)
+
+	for _, action := range actions {
+		if action.Endpoint == "answerCallbackQuery" && action.Text == text && action.ShowAlert == showAlert {
+			return action
+		}
+	}
+
+	t.Fatalf("Expected a callback query answer %q (alert %t), got:\n%s", text, showAlert, describe(actions))
+
+	return Action{} //nolint:exhaustruct // Unreachable
+}
+
+// AssertNoActions checks that the transition doesn't do anything.
+func AssertNoActions(t *testing.T, transition state.Transition) {
+	t.Helper()
+
+	if actions := DecodeActions(t, transition); len(actions) != 0 {
+		t.Fatalf("Expected no actions, got:\n%s", describe(actions))
+	}
+}
+
+func describe(actions []Action) string {
+	if len(actions) == 0 {
+		return "  (no actions)"
+	}
+
+	lines := make([]string, len(actions))
+	for i, action := range actions {
+		lines[i] = fmt.Sprintf("  /%s %s", action.Endpoint, action.Body)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,283 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+/*
+Store keeps conversation states and user data across restarts. The Load methods return false if nothing was saved for
+the key yet.
+
+The client loads from the store when a chat or a user is not in memory and saves after each update, so a store doesn't
+need to cache anything.
+*/
+type Store interface {
+	LoadUserData(id update.UserID) (UserSharedData, bool, error)
+	SaveUserData(id update.UserID, userData UserSharedData) error
+	LoadState(handle string) (State, bool, error)
+	SaveState(handle string, conversation State) error
+	// DeleteStates deletes the conversations of the user in every chat
+	DeleteStates(id update.UserID) error
+}
+
+/*
+FileStore is a Store that keeps everything in one JSON file. The whole file is rewritten on each save (to a temporary
+file that then replaces the old one), so it is only meant for a small number of users.
+
+GitHub API keys are only saved encrypted, see SetEncrypter. The file is still created readable only by the owner.
+*/
+type FileStore struct {
+	path string
+	// encrypter encrypts the API keys. Without it the keys are not saved.
+	encrypter Encrypter
+
+	mu   sync.Mutex
+	data fileStoreData
+	// closed is set by Close, saving after that fails
+	closed bool
+	// syncFile flushes the temporary file to the disk. Tests replace it to fail a write halfway.
+	syncFile func(*os.File) error
+}
+
+// fileStoreData is the content of the FileStore's file. States are encoded with EncodeState.
+type fileStoreData struct {
+	Users  map[update.UserID]storedUserData `json:"users"`
+	States map[string]json.RawMessage       `json:"states"`
+}
+
+// storedUserData is UserSharedData the way it is saved: GithubAPIKey is always None and the key is encrypted instead.
+type storedUserData struct {
+	UserSharedData
+	EncryptedAPIKey string `json:"encryptedApiKey,omitempty"`
+}
+
+// OpenFileStore reads the file at `path`. If there is no file it is created with the first save.
+func OpenFileStore(path string) (*FileStore, error) {
+	store := &FileStore{
+		path:      path,
+		encrypter: nil,
+		mu:        sync.Mutex{},
+		data: fileStoreData{
+			Users:  map[update.UserID]storedUserData{},
+			States: map[string]json.RawMessage{},
+		},
+		closed:   false,
+		syncFile: (*os.File).Sync,
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("while reading the store file: %w", err)
+	}
+
+	if err = json.Unmarshal(content, &store.data); err != nil {
+		return nil, fmt.Errorf("while decoding the store file %s: %w", path, err)
+	}
+
+	return store, nil
+}
+
+/*
+SetEncrypter makes the store save GitHub API keys encrypted with `encrypter`. Without an encrypter the keys are not saved
+at all, and users have to add them again after a restart. Call it before the store is used.
+*/
+func (s *FileStore) SetEncrypter(encrypter Encrypter) {
+	s.encrypter = encrypter
+}
+
+/*
+LoadUserData returns the saved user data. If the API key can't be decrypted (e.g. because the secret has changed or there
+is no encrypter anymore) the user data is returned without it, as if the user has never added one. The encrypted key is
+kept in LockedAPIKey, so that saving the user data doesn't erase it.
+*/
+func (s *FileStore) LoadUserData(id update.UserID) (UserSharedData, bool, error) {
+	s.mu.Lock()
+	stored, isSaved := s.data.Users[id]
+	s.mu.Unlock()
+
+	if !isSaved {
+		return NewUserSharedData(), false, nil
+	}
+
+	userData := stored.UserSharedData
+	userData.GithubAPIKey = option.None[string]()
+	userData.LockedAPIKey = ""
+
+	if stored.EncryptedAPIKey == "" {
+		return userData, true, nil
+	}
+
+	if s.encrypter == nil {
+		logging.Errorf("The API key of (UserID %d) is encrypted, but there is no secret to decrypt it", id)
+
+		userData.LockedAPIKey = stored.EncryptedAPIKey
+
+		return userData, true, nil
+	}
+
+	key, err := s.encrypter.Decrypt(stored.EncryptedAPIKey)
+	if err != nil {
+		logging.Errorf("The API key of (UserID %d) can't be decrypted, it's kept for the right secret: %s", id, err)
+
+		userData.LockedAPIKey = stored.EncryptedAPIKey
+
+		return userData, true, nil
+	}
+
+	userData.GithubAPIKey = option.Some(key)
+
+	return userData, true, nil
+}
+
+/*
+SaveUserData saves the user data with the API key encrypted. Without a key the LockedAPIKey is saved again, it's only
+removed when the user removes or replaces the key. A new key can't be saved without an encrypter and replaces the locked
+one anyway.
+*/
+func (s *FileStore) SaveUserData(id update.UserID, userData UserSharedData) error {
+	stored := storedUserData{UserSharedData: userData, EncryptedAPIKey: userData.LockedAPIKey}
+	stored.GithubAPIKey = option.None[string]()
+
+	if key, hasKey := userData.GithubAPIKey.Unwrap(); hasKey {
+		stored.EncryptedAPIKey = ""
+
+		if s.encrypter != nil {
+			encrypted, err := s.encrypter.Encrypt(key)
+			if err != nil {
+				return fmt.Errorf("while encrypting the API key of (UserID %d): %w", id, err)
+			}
+
+			stored.EncryptedAPIKey = encrypted
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Users[id] = stored
+
+	return s.write()
+}
+
+func (s *FileStore) LoadState(handle string) (State, bool, error) {
+	s.mu.Lock()
+	encoded, isSaved := s.data.States[handle]
+	s.mu.Unlock()
+
+	if !isSaved {
+		return NewRootState(), false, nil
+	}
+
+	conversation, err := DecodeState(encoded)
+	if err != nil {
+		return NewRootState(), false, fmt.Errorf("while loading the state of %s: %w", handle, err)
+	}
+
+	return conversation, true, nil
+}
+
+func (s *FileStore) SaveState(handle string, conversation State) error {
+	encoded, err := EncodeState(conversation)
+	if err != nil {
+		return fmt.Errorf("while saving the state of %s: %w", handle, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.States[handle] = encoded
+
+	return s.write()
+}
+
+func (s *FileStore) DeleteStates(id update.UserID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for handle := range s.data.States {
+		if _, userID, isValid := update.ParseStateID(handle); isValid && userID == id {
+			delete(s.data.States, handle)
+		}
+	}
+
+	return s.write()
+}
+
+/*
+Close waits for a save that is in progress and makes the saves after it fail. Call it after the client has stopped, so
+that the last state is in the file when the bot exits.
+*/
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	return nil
+}
+
+// write replaces the file with the current data. Must be called with the lock held.
+func (s *FileStore) write() error {
+	const ownerOnly = 0o600
+
+	if s.closed {
+		return StoreClosedError{Path: s.path}
+	}
+
+	content, err := json.Marshal(s.data)
+	if err != nil {
+		return fmt.Errorf("while encoding the store file: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("while writing the store file: %w", err)
+	}
+
+	defer os.Remove(temp.Name()) //nolint:errcheck // Fails after the rename, which is fine
+
+	if err = temp.Chmod(ownerOnly); err == nil {
+		_, err = temp.Write(content)
+	}
+
+	if err == nil {
+		err = s.syncFile(temp) // The file must be on the disk before it replaces the old one
+	}
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), s.path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("while writing the store file: %w", err)
+	}
+
+	return nil
+}
+
+// StoreClosedError is returned when saving to a FileStore after Close.
+type StoreClosedError struct {
+	Path string
+}
+
+func (e StoreClosedError) Error() string {
+	return fmt.Sprintf("the store %s is closed", e.Path)
+}
@@ -0,0 +1,297 @@
+package state_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// openEncryptedStore opens a FileStore that encrypts API keys with `secret`.
+func openEncryptedStore(t *testing.T, path, secret string) *state.FileStore {
+	t.Helper()
+
+	store, err := state.OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("While opening the store: %s", err)
+	}
+
+	encrypter, err := state.NewAESEncrypter(secret)
+	if err != nil {
+		t.Fatalf("While creating the encrypter: %s", err)
+	}
+
+	store.SetEncrypter(encrypter)
+
+	return store
+}
+
+func TestFileStoreKeepsDataAfterReopening(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	store := openEncryptedStore(t, path, "secret")
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("ghp_key")
+
+	if err := store.SaveUserData(7, userData); err != nil {
+		t.Fatalf("While saving user data: %s", err)
+	}
+
+	root := state.NewRootState()
+	root.AddDefaultProject("PVT_1")
+
+	if err := store.SaveState("1:7", state.NewDailyStatusState(root, option.Some("today"), nil)); err != nil {
+		t.Fatalf("While saving the state: %s", err)
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("The store file should only be readable by its owner: %v %v", info, err)
+	}
+
+	reopened := openEncryptedStore(t, path, "secret")
+
+	loaded, isSaved, err := reopened.LoadUserData(7)
+	if err != nil || !isSaved {
+		t.Fatalf("User data was not loaded: %v %v", isSaved, err)
+	}
+
+	if key, _ := loaded.GithubAPIKey.Unwrap(); key != "ghp_key" {
+		t.Errorf("Expected the API key to be kept, got %+v", loaded.GithubAPIKey)
+	}
+
+	conversation, isSaved, err := reopened.LoadState("1:7")
+	if err != nil || !isSaved {
+		t.Fatalf("The state was not loaded: %v %v", isSaved, err)
+	}
+
+	dailyStatus, is := conversation.(state.DailyStatusState)
+	if !is || len(dailyStatus.DefaultProjects) != 1 || dailyStatus.DefaultProjects[0] != "PVT_1" {
+		t.Errorf("Expected the /dailyStatus state with its default project, got %#v", conversation)
+	}
+}
+
+func TestFileStoreDeletesTheStatesOfAUser(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	store, err := state.OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("While opening the store: %s", err)
+	}
+
+	for _, handle := range []string{"7:7", "-100:7", "-100:8"} {
+		if err = store.SaveState(handle, state.NewRootState()); err != nil {
+			t.Fatalf("While saving the state of %s: %s", handle, err)
+		}
+	}
+
+	if err = store.DeleteStates(7); err != nil {
+		t.Fatalf("While deleting the states: %s", err)
+	}
+
+	reopened, err := state.OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("While reopening the store: %s", err)
+	}
+
+	for handle, shouldBeSaved := range map[string]bool{"7:7": false, "-100:7": false, "-100:8": true} {
+		if _, isSaved, _ := reopened.LoadState(handle); isSaved != shouldBeSaved {
+			t.Errorf("Expected the state of %s to be saved: %t, got %t", handle, shouldBeSaved, isSaved)
+		}
+	}
+}
+
+func TestFileStoreKeepsTheOldFileWhenAWriteFails(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.json")
+
+	store, err := state.OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("While opening the store: %s", err)
+	}
+
+	if err = store.SaveState("7:7", state.NewRootState()); err != nil {
+		t.Fatalf("While saving the state: %s", err)
+	}
+
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("While reading the store file: %s", err)
+	}
+
+	errDiskFull := errors.New("disk full")
+
+	store.SetSyncFile(func(*os.File) error { return errDiskFull })
+
+	if err = store.SaveState("-100:7", state.NewRootState()); !errors.Is(err, errDiskFull) {
+		t.Fatalf("Expected the write to fail, got %v", err)
+	}
+
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("The failed write has changed the file:\nbefore: %s\nafter:  %s", before, after)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the store file to be left, got %v", entries)
+	}
+
+	reopened, err := state.OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("The store can't be opened after a failed write: %s", err)
+	}
+
+	if _, isSaved, _ := reopened.LoadState("7:7"); !isSaved {
+		t.Errorf("The state saved before the failed write is lost")
+	}
+}
+
+func TestFileStoreWithoutSavedData(t *testing.T) {
+	t.Parallel()
+
+	store, err := state.OpenFileStore(filepath.Join(t.TempDir(), "store.json"))
+	if err != nil {
+		t.Fatalf("While opening a new store: %s", err)
+	}
+
+	if _, isSaved, err := store.LoadUserData(7); isSaved || err != nil {
+		t.Errorf("Expected no user data, got %v %v", isSaved, err)
+	}
+
+	if _, isSaved, err := store.LoadState("1:7"); isSaved || err != nil {
+		t.Errorf("Expected no state, got %v %v", isSaved, err)
+	}
+}
+
+func TestFileStoreRejectsSavesAfterClose(t *testing.T) {
+	t.Parallel()
+
+	store, err := state.OpenFileStore(filepath.Join(t.TempDir(), "store.json"))
+	if err != nil {
+		t.Fatalf("While opening a new store: %s", err)
+	}
+
+	if err = store.Close(); err != nil {
+		t.Fatalf("While closing the store: %s", err)
+	}
+
+	var closed state.StoreClosedError
+	if err = store.SaveUserData(7, state.NewUserSharedData()); !errors.As(err, &closed) {
+		t.Errorf("Expected StoreClosedError, got %v", err)
+	}
+}
+
+func TestFileStoreEncryptsAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("ghp_plaintext")
+	userData.ReportTemplates["PVT_1"] = "standup"
+
+	if err := openEncryptedStore(t, path, "secret").SaveUserData(7, userData); err != nil {
+		t.Fatalf("While saving user data: %s", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("While reading the store file: %s", err)
+	}
+
+	if strings.Contains(string(content), "ghp_plaintext") {
+		t.Fatalf("The API key is saved in plaintext: %s", content)
+	}
+
+	// A changed secret can't decrypt the key, but the rest of the user data is still there
+	loaded, isSaved, err := openEncryptedStore(t, path, "rotated").LoadUserData(7)
+	if err != nil || !isSaved {
+		t.Fatalf("User data was not loaded: %v %v", isSaved, err)
+	}
+
+	if loaded.GithubAPIKey.IsSome() {
+		t.Errorf("Expected no API key after changing the secret, got %+v", loaded.GithubAPIKey)
+	}
+
+	if loaded.ReportTemplates["PVT_1"] != "standup" {
+		t.Errorf("The rest of the user data was lost: %+v", loaded)
+	}
+}
+
+func TestFileStoreKeepsAPIKeysThatCantBeDecrypted(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("ghp_key")
+
+	if err := openEncryptedStore(t, path, "secret").SaveUserData(7, userData); err != nil {
+		t.Fatalf("While saving user data: %s", err)
+	}
+
+	// A start with a mistyped secret, where the user data is saved after an update
+	mistyped := openEncryptedStore(t, path, "mistyped")
+
+	loaded, _, err := mistyped.LoadUserData(7)
+	if err != nil || loaded.GithubAPIKey.IsSome() {
+		t.Fatalf("Expected no API key with the wrong secret, got %+v %v", loaded.GithubAPIKey, err)
+	}
+
+	if err = mistyped.SaveUserData(7, loaded); err != nil {
+		t.Fatalf("While saving user data: %s", err)
+	}
+
+	loaded, _, err = openEncryptedStore(t, path, "secret").LoadUserData(7)
+	if key, _ := loaded.GithubAPIKey.Unwrap(); err != nil || key != "ghp_key" {
+		t.Fatalf("The API key was lost after a start with the wrong secret: %+v %v", loaded.GithubAPIKey, err)
+	}
+
+	// Removing the key that can't be decrypted removes it for good
+	loaded, _, _ = openEncryptedStore(t, path, "mistyped").LoadUserData(7)
+	loaded.LockedAPIKey = ""
+
+	if err = mistyped.SaveUserData(7, loaded); err != nil {
+		t.Fatalf("While saving user data: %s", err)
+	}
+
+	if loaded, _, _ = openEncryptedStore(t, path, "secret").LoadUserData(7); loaded.GithubAPIKey.IsSome() {
+		t.Errorf("The removed API key is still saved: %+v", loaded.GithubAPIKey)
+	}
+}
+
+func TestFileStoreWithoutEncrypterDoesNotSaveAPIKeys(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	store, err := state.OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("While opening a new store: %s", err)
+	}
+
+	userData := state.NewUserSharedData()
+	userData.GithubAPIKey = option.Some("ghp_plaintext")
+
+	if err = store.SaveUserData(7, userData); err != nil {
+		t.Fatalf("While saving user data: %s", err)
+	}
+
+	if content, _ := os.ReadFile(path); strings.Contains(string(content), "ghp_plaintext") {
+		t.Fatalf("The API key is saved in plaintext: %s", content)
+	}
+
+	loaded, _, err := store.LoadUserData(7)
+	if err != nil || loaded.GithubAPIKey.IsSome() {
+		t.Errorf("Expected no API key without an encrypter, got %+v %v", loaded.GithubAPIKey, err)
+	}
+}
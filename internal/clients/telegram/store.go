@@ -0,0 +1,77 @@
+package telegram
+
+import (
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+)
+
+/*
+SetStore makes the client keep conversation states and user data (e.g. GitHub API keys) in `store`, so they are not lost
+when the bot restarts. Without a store everything is kept in memory only.
+*/
+func (c *Client) SetStore(store state.Store) {
+	c.store = store
+}
+
+// loadState loads the state of a chat from the store. If there is no store or nothing was saved returns Root.
+func (c *Client) loadState(handle string) state.State {
+	if c.store == nil {
+		return state.NewRootState()
+	}
+
+	conversation, isSaved, err := c.store.LoadState(handle)
+	if err != nil {
+		logging.Errorf("While loading a saved state, starting over from Root: %s", err)
+
+		return state.NewRootState()
+	}
+
+	if !isSaved {
+		return state.NewRootState()
+	}
+
+	return conversation
+}
+
+// loadUserData loads the user data from the store. If there is no store or nothing was saved returns new user data.
+func (c *Client) loadUserData(id update.UserID) state.UserSharedData {
+	if c.store == nil {
+		return state.NewUserSharedData()
+	}
+
+	userData, isSaved, err := c.store.LoadUserData(id)
+	if err != nil {
+		logging.Errorf("While loading the saved data of (UserID %d), starting with new data: %s", id, err)
+
+		return state.NewUserSharedData()
+	}
+
+	if !isSaved {
+		return state.NewUserSharedData()
+	}
+
+	return userData
+}
+
+// saveState saves the state to the store if there is one. Errors are logged, the state is still kept in memory.
+func (c *Client) saveState(updateID update.UpdateID, handle string, conversation state.State) {
+	if c.store == nil {
+		return
+	}
+
+	if err := c.store.SaveState(handle, conversation); err != nil {
+		logging.Errorf("%s While saving the state: %s", updateID.Log(), err)
+	}
+}
+
+// saveUserData saves the user data to the store if there is one. Errors are logged like in saveState.
+func (c *Client) saveUserData(updateID update.UpdateID, id update.UserID, userData state.UserSharedData) {
+	if c.store == nil {
+		return
+	}
+
+	if err := c.store.SaveUserData(id, userData); err != nil {
+		logging.Errorf("%s While saving user data: %s", updateID.Log(), err)
+	}
+}
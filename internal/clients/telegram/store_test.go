@@ -0,0 +1,114 @@
+package telegram_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/state"
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+// savingStore is a state.Store that already has user data and sends each saved user data to a channel.
+type savingStore struct {
+	userData map[update.UserID]state.UserSharedData
+	saved    chan state.UserSharedData
+}
+
+func (s savingStore) LoadUserData(id update.UserID) (state.UserSharedData, bool, error) {
+	userData, isSaved := s.userData[id]
+
+	return userData, isSaved, nil
+}
+
+func (s savingStore) SaveUserData(_ update.UserID, userData state.UserSharedData) error {
+	s.saved <- userData
+
+	return nil
+}
+
+func (s savingStore) LoadState(string) (state.State, bool, error) {
+	return state.NewRootState(), false, nil
+}
+
+func (s savingStore) SaveState(string, state.State) error {
+	return nil
+}
+
+func (s savingStore) DeleteStates(update.UserID) error {
+	return nil
+}
+
+func TestUserDataIsLoadedFromStore(t *testing.T) {
+	t.Parallel()
+
+	replayFile := filepath.Join(t.TempDir(), "replay.jsonl")
+	if err := os.WriteFile(replayFile, []byte(`{"update": `+privateMessageUpdate(1, 7, "/settings")+"}\n"),
+		0o600); err != nil {
+		t.Fatalf("While writing the replay file: %s", err)
+	}
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	var responses state.Responses
+	responses.Root.Settings = "key=%s %s %s %s %s %s"
+	responses.Root.SettingsAPIKeyAdded = "added"
+	responses.Root.SettingsAPIKeyMissing = "missing"
+
+	saved := state.NewUserSharedData()
+	saved.GithubAPIKey = option.Some("ghp_saved")
+
+	store := savingStore{
+		userData: map[update.UserID]state.UserSharedData{7: saved},
+		saved:    make(chan state.UserSharedData, 1),
+	}
+
+	actions := make(chan dryRunAction, 1)
+
+	client := telegram.NewTestClient(server, responses)
+	client.SetInlineProcessing(true)
+	client.SetReplayFile(replayFile)
+	client.SetStore(store)
+	client.SetDryRun(func(endpoint string, body []byte) {
+		actions <- dryRunAction{endpoint: endpoint, body: body}
+	})
+
+	fail := client.Start(1)
+	defer client.Stop()
+
+	select {
+	case action := <-actions:
+		var message struct {
+			Text string `json:"text"`
+		}
+
+		if err := json.Unmarshal(action.body, &message); err != nil {
+			t.Fatalf("While decoding /%s: %s", action.endpoint, err)
+		}
+
+		if !strings.HasPrefix(message.Text, "key=added") {
+			t.Errorf("The API key was not loaded from the store: %s", message.Text)
+		}
+	case err := <-fail:
+		t.Fatalf("Bot crashed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the reply")
+	}
+
+	select {
+	case userData := <-store.saved:
+		if key, _ := userData.GithubAPIKey.Unwrap(); key != "ghp_saved" {
+			t.Errorf("Saved user data doesn't have the API key: %+v", userData)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the user data to be saved")
+	}
+}
@@ -35,6 +35,24 @@ func (u Update) StateID() (string, bool) {
 	return "", false
 }
 
+// ParseStateID returns the chat and the user of a conversation from the ID returned by StateID.
+func ParseStateID(stateID string) (ChatID, UserID, bool) {
+	var (
+		chatID ChatID
+		userID UserID
+	)
+
+	if _, err := fmt.Sscanf(stateID, "%d:%d", &chatID, &userID); err != nil {
+		return 0, 0, false
+	}
+
+	return chatID, userID, true
+}
+
+/*
+UserID returns the user whose UserSharedData the update is handled with: the sender of a message or the user who
+pressed a button. False if the update has no user, e.g. a message sent on behalf of a channel.
+*/
 func (u Update) UserID() (UserID, bool) {
 	if message, isSome := u.Message.Unwrap(); isSome {
 		if from, isSome := message.From.Unwrap(); isSome {
@@ -42,15 +60,21 @@ func (u Update) UserID() (UserID, bool) {
 		}
 	}
 
+	if callback, isSome := u.CallbackQuery.Unwrap(); isSome {
+		return callback.From.ID, true
+	}
+
 	return UserID(0), false
 }
 
 type Message struct {
-	ID   MessageID             `json:"message_id"`
-	From option.Option[User]   `json:"from"`
-	Date int64                 `json:"date"`
-	Chat Chat                  `json:"chat"`
-	Text option.Option[string] `json:"text"`
+	ID   MessageID           `json:"message_id"`
+	From option.Option[User] `json:"from"`
+	// SenderChat is set instead of From when the message is sent on behalf of a channel or an anonymous group admin
+	SenderChat option.Option[Chat]   `json:"sender_chat"`
+	Date       int64                 `json:"date"`
+	Chat       Chat                  `json:"chat"`
+	Text       option.Option[string] `json:"text"`
 }
 
 type MessageID int64
@@ -125,8 +149,13 @@ func (c CallbackQueryID) Log() string {
 }
 
 func (m Message) Log() string {
+	from := option.Map(m.From, func(m User) string { return m.Log() }).UnwrapOr("(From nil)")
+	if senderChat, isSome := m.SenderChat.Unwrap(); isSome {
+		from = fmt.Sprintf("(SenderChat %s)", senderChat.Log())
+	}
+
 	return fmt.Sprintf("(Message %s %s %s (Text %q))", m.ID.Log(),
-		option.Map(m.From, func(m User) string { return m.Log() }).UnwrapOr("(From nil)"),
+		from,
 		m.Chat.Log(),
 		m.Text,
 	)
@@ -0,0 +1,77 @@
+package update_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+)
+
+func TestDecodeMessageWithNullFields(t *testing.T) {
+	t.Parallel()
+
+	var upd update.Update
+	if err := json.Unmarshal([]byte(`{"update_id": 10, "callback_query": null, "message": {
+	"message_id": 5, "date": 1700000000, "text": null, "sender_chat": null,
+	"from": {"id": 7, "is_bot": false, "first_name": "User", "last_name": null, "username": "user"},
+	"chat": {"id": -100, "type": "supergroup"}
+}}`), &upd); err != nil {
+		t.Fatalf("While decoding the update: %s", err)
+	}
+
+	if upd.CallbackQuery.IsSome() {
+		t.Fatalf("A null callback query was decoded as %#v", upd.CallbackQuery)
+	}
+
+	message, isSome := upd.Message.Unwrap()
+	if !isSome {
+		t.Fatal("The message was not decoded")
+	}
+
+	if message.Text.IsSome() || message.SenderChat.IsSome() {
+		t.Fatalf("Null fields of the message were decoded as Some: %#v", message)
+	}
+
+	from, isSome := message.From.Unwrap()
+	if !isSome {
+		t.Fatal("The sender was not decoded")
+	}
+
+	if from.LastName.IsSome() || from.LanguageCode.IsSome() || from.Username.UnwrapOr("") != "user" {
+		t.Fatalf("The optional fields of the sender were decoded wrong: %#v", from)
+	}
+
+	if stateID, _ := upd.StateID(); stateID != "-100:7" {
+		t.Fatalf("Expected the state of the sender in the chat, got %q", stateID)
+	}
+}
+
+func TestDecodeCallbackQueryWithoutMessage(t *testing.T) {
+	t.Parallel()
+
+	// Telegram leaves out the message if it's too old, or sets inline_message_id instead
+	var upd update.Update
+	if err := json.Unmarshal([]byte(`{"update_id": 11, "callback_query": {
+	"id": "42", "from": {"id": 7, "is_bot": false, "first_name": "User"}, "message": null,
+	"inline_message_id": "abc", "chat_instance": "1", "data": "listprojects:0"
+}}`), &upd); err != nil {
+		t.Fatalf("While decoding the update: %s", err)
+	}
+
+	callback, isSome := upd.CallbackQuery.Unwrap()
+	if !isSome {
+		t.Fatal("The callback query was not decoded")
+	}
+
+	if callback.Message.IsSome() {
+		t.Fatalf("A null message was decoded as %#v", callback.Message)
+	}
+
+	if callback.Data.UnwrapOr("") != "listprojects:0" {
+		t.Fatalf("Expected the data of the button, got %#v", callback.Data)
+	}
+
+	if _, hasState := upd.StateID(); hasState {
+		t.Fatal("A callback query without a message has no chat, so it can't have a state")
+	}
+}
@@ -0,0 +1,275 @@
+package telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/clients/telegram/update"
+	"github.com/m-kuzmin/daily-reporter/internal/util"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
+)
+
+const (
+	// webhookSecretHeader has the secret token given to /setWebhook in every request from Telegram
+	webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	// webhookSecretBytes is the length of the random secret token
+	webhookSecretBytes = 32
+	// webhookShutdownTimeout is how long the server waits for requests that are still being handled when it stops
+	webhookShutdownTimeout = 10 * time.Second
+)
+
+// webhook is where Telegram sends the updates after StartWebhook.
+type webhook struct {
+	// addr is what the server listens on, e.g. ":8443"
+	addr string
+	// path is the path of the webhook URL that the updates are sent to
+	path string
+	// secret is compared to webhookSecretHeader, so that only Telegram can send updates
+	secret string
+	// inlineMu makes the updates be processed one by one with SetInlineProcessing
+	inlineMu sync.Mutex
+
+	// requestsMu guards closed, so that no request is added to requests once they are waited for
+	requestsMu sync.Mutex
+	closed     bool
+	// requests are the requests that are being handled, the queue is closed after they are done
+	requests sync.WaitGroup
+}
+
+// begin adds a request to the ones being handled. False if the webhook is closed, then the request must be refused.
+func (w *webhook) begin() bool {
+	w.requestsMu.Lock()
+	defer w.requestsMu.Unlock()
+
+	if w.closed {
+		return false
+	}
+
+	w.requests.Add(1)
+
+	return true
+}
+
+// closeAndWait refuses new requests and waits for the ones that are being handled to return.
+func (w *webhook) closeAndWait() {
+	w.requestsMu.Lock()
+	w.closed = true
+	w.requestsMu.Unlock()
+
+	w.requests.Wait()
+}
+
+/*
+SetWebhookURL sets the public URL that StartWebhook registers with Telegram, without the path, e.g.
+"https://bot.example.com". Telegram only sends updates to HTTPS URLs, so usually the server is behind a reverse proxy
+that forwards the requests to the address StartWebhook listens on.
+*/
+func (c *Client) SetWebhookURL(url string) {
+	c.webhookURL = url
+}
+
+/*
+StartWebhook starts the client like Start(), but Telegram sends the updates to an HTTP server on `addr` at `path`
+instead of the client asking for them with /getUpdates. The URL set with SetWebhookURL + `path` is registered with
+/setWebhook, and Stop() removes it with /deleteWebhook.
+
+The updates go through the same queue as with Start(), so they are processed the same way.
+*/
+func (c *Client) StartWebhook(addr, path string, threads uint) <-chan error {
+	return c.StartWebhookContext(context.Background(), addr, path, threads)
+}
+
+// StartWebhookContext is StartWebhook with a parent context, see StartContext.
+func (c *Client) StartWebhookContext(ctx context.Context, addr, path string, threads uint) <-chan error {
+	var secret [webhookSecretBytes]byte
+	if _, err := rand.Read(secret[:]); err != nil {
+		errCh := make(chan error, 1)
+		errCh <- fmt.Errorf("while generating the webhook secret: %w", err)
+
+		return errCh
+	}
+
+	c.webhook = &webhook{
+		addr:       addr,
+		path:       path,
+		secret:     hex.EncodeToString(secret[:]),
+		inlineMu:   sync.Mutex{},
+		requestsMu: sync.Mutex{},
+		closed:     false,
+		requests:   sync.WaitGroup{},
+	}
+
+	return c.start(ctx, threads, c.serveWebhook)
+}
+
+/*
+serveWebhook registers the webhook and serves it until the context is done. Like getUpdates it closes `updateCh` when it
+returns, but only after every request has returned, even if the server has stopped waiting for them.
+*/
+func (c *Client) serveWebhook(ctx context.Context, updateCh chan<- update.Update) {
+	shutdown := func() {
+		c.webhook.closeAndWait()
+		close(updateCh)
+		c.wg.Done()
+	}
+
+	// Cannot use normal defer here because of call to c.fail().
+	defer func() {
+		if err := recover(); err != nil {
+			shutdown()
+			c.fail(fmt.Errorf("shutting down from serveWebhook: %w", util.RecoveredPanicError{Panic: err}))
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle(c.webhook.path, c.webhookHandler(ctx, updateCh))
+
+	server := &http.Server{Addr: c.webhook.addr, Handler: mux, ReadHeaderTimeout: webhookShutdownTimeout}
+
+	serverErr := make(chan error, 1)
+
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	if err := c.setWebhook(ctx); err != nil {
+		_ = server.Close()
+		shutdown()
+		c.fail(err)
+
+		return
+	}
+
+	logging.Infof("Telegram processor started, receiving updates on %s%s", c.webhook.addr, c.webhook.path)
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logging.Errorf("While stopping the webhook server: %s", err)
+		}
+
+		shutdown()
+
+	case err := <-serverErr:
+		shutdown()
+		c.fail(fmt.Errorf("webhook server stopped: %w", err))
+	}
+}
+
+// webhookHandler decodes the updates sent by Telegram and queues them.
+func (c *Client) webhookHandler(ctx context.Context, updateCh chan<- update.Update) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.webhook.begin() {
+			// Telegram sends the update again later, after a restart it goes to the new server
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+
+			return
+		}
+		defer c.webhook.requests.Done()
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(c.webhook.secret)) != 1 {
+			logging.Infof("Webhook request from %s without the secret token was rejected", r.RemoteAddr)
+			http.Error(w, "wrong secret token", http.StatusUnauthorized)
+
+			return
+		}
+
+		var upd update.Update
+		if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+			logging.Errorf("While decoding an update from the webhook: %s", err)
+			// Telegram would keep sending the same update if the response is an error
+			w.WriteHeader(http.StatusOK)
+
+			return
+		}
+
+		if c.inlineProcessing {
+			c.webhook.inlineMu.Lock()
+			defer c.webhook.inlineMu.Unlock()
+			defer c.recoverInline(w)
+		}
+
+		if !c.feed(ctx, []update.Update{upd}, updateCh) {
+			// Telegram sends the update again, after a restart it's processed
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+/*
+recoverInline stops the client if an update processed inline by webhookHandler panics. Otherwise net/http would recover
+the panic and the bot would go on as if nothing happened, unlike with getUpdates where the panic stops the bot.
+*/
+func (c *Client) recoverInline(w http.ResponseWriter) {
+	err := recover()
+	if err == nil {
+		return
+	}
+
+	// The requests waiting for inlineMu drop their updates instead of processing them while the bot is stopping
+	c.stopProcessing()
+	// Telegram would keep sending the same update if the response is an error
+	w.WriteHeader(http.StatusOK)
+
+	// Stopping waits for the server to finish this request, so it can't be done here
+	go c.fail(fmt.Errorf("shutting down from webhookHandler: %w", util.RecoveredPanicError{Panic: err}))
+}
+
+// setWebhook tells Telegram to send the updates to the webhook.
+func (c *Client) setWebhook(ctx context.Context) error {
+	if c.webhookURL == "" {
+		return errors.New("the webhook URL is not set, see SetWebhookURL")
+	}
+
+	body, err := json.Marshal(struct {
+		URL         string `json:"url"`
+		SecretToken string `json:"secret_token"`
+	}{URL: c.webhookURL + c.webhook.path, SecretToken: c.webhook.secret})
+	if err != nil {
+		return fmt.Errorf("while encoding /setWebhook: %w", err)
+	}
+
+	if _, err = c.requester.DoJSONEncoded(ctx, "setWebhook", body); err != nil {
+		return fmt.Errorf("while registering the webhook: %w", err)
+	}
+
+	return nil
+}
+
+/*
+deleteWebhook removes the webhook, so that Telegram keeps the updates until the bot starts again. It also allows the
+next start to use /getUpdates.
+*/
+func (c *Client) deleteWebhook() {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+	defer cancel()
+
+	if _, err := c.requester.DoJSONEncoded(ctx, "deleteWebhook", json.RawMessage(`{}`)); err != nil {
+		logging.Errorf("While removing the webhook: %s", err)
+
+		return
+	}
+
+	logging.Infof("Webhook removed")
+}
@@ -24,17 +24,35 @@ This is the yaml version:
 	    whatAreThese: ["%s is not a %s", "foo", "bar"]
 
 The names "foo" and "bar" are looked up in the vars map and their values are passed into Sprintf.
+
+The fields of a group struct can be structs too, they are filled from the group in their tag. See Group.Populate.
+
+Fields tagged with `template:"-"` are skipped by Populate, e.g. to fill them from groups that are only known at runtime.
+
+A key can also hold a few alternative strings (variants) instead of a format string and its vars. One of them is picked
+at random every time the string is used. Fields that hold variants have the Variants type and are tagged with
+`template:"key,variants"`.
+
+Strings of new features can be tagged `template:"key,optional"`, so that older templates without them still work. If
+the key (or the group of a nested struct) is missing, the field is left as it is and a warning is logged.
 */
 package template
 
 import (
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"reflect"
+	"strings"
 
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
 	"gopkg.in/yaml.v3"
 )
 
+// skipTag is the value of the `template` tag of fields that Populate leaves as they are
+const skipTag = "-"
+
 // A template generated from a YAML file
 type Template struct {
 	/*
@@ -98,11 +116,23 @@ func (t Template) Get(group string) (Group, error) {
 }
 
 func (t Template) Populate(typed interface{}) error {
+	_, err := t.PopulateMissing(typed)
+
+	return err
+}
+
+/*
+PopulateMissing is Populate that also returns the optional keys that are not in the template as "group.key", e.g. to
+tell the operator that the template is older than the bot.
+*/
+func (t Template) PopulateMissing(typed interface{}) ([]string, error) {
 	rv := reflect.ValueOf(typed)
 	if rv.Kind() != reflect.Pointer || rv.IsNil() {
-		return &InvalidTypeError{Type: reflect.TypeOf(typed).Name()}
+		return nil, &InvalidTypeError{Type: reflect.TypeOf(typed).Name()}
 	}
 
+	missing := []string{}
+
 	valueOf := rv.Elem()
 	typeOf := reflect.TypeOf(typed).Elem()
 
@@ -111,30 +141,33 @@ func (t Template) Populate(typed interface{}) error {
 		fieldType := typeOf.Field(i)
 
 		groupName := fieldType.Tag.Get("template")
+		if groupName == skipTag {
+			continue
+		}
+
 		if groupName == "" {
-			return GroupNotTaggedError{
+			return missing, GroupNotTaggedError{
 				Struct: typeOf.Name(),
 				Field:  fieldType.Name,
 			}
 		}
 
-		group, err := t.Get(groupName)
-		if err != nil {
-			return err
-		}
-
-		if err = group.populateReflect(fieldValue, fieldType.Type); err != nil {
-			return err
+		// A missing group is reported by the first key looked up in it, a struct of nested groups doesn't need one
+		group := Group{name: groupName, wrapped: &t, missing: &missing}
+		if err := group.populateReflect(fieldValue, fieldType.Type); err != nil {
+			return missing, err
 		}
 	}
 
-	return nil
+	return missing, nil
 }
 
 // Group holds a name of the group name passed into Template.Get() and a pointer to the template
 type Group struct {
 	name    string
 	wrapped *Template
+	// missing collects the optional keys that were left empty by Populate, if set
+	missing *[]string
 }
 
 /*
@@ -170,9 +203,68 @@ func (g Group) Get(key string) (string, error) {
 	return fmt.Sprintf(fmtParams[0], values[0:]...), nil
 }
 
+/*
+GetVariants returns all elements of the array as alternatives to each other. Unlike Get the elements are not a format
+string and its vars.
+
+Returned error could either be a group lookup error (the group was deleted from the template) or this key doesn't exist.
+*/
+func (g Group) GetVariants(key string) (Variants, error) {
+	group, exists := g.wrapped.Templates[g.name]
+	if !exists {
+		return Variants{}, fmt.Errorf("while looking up key %s: %w", key, GroupNotFoundError{Name: g.name})
+	}
+
+	variants, found := group[key]
+	if !found {
+		return Variants{}, KeyNotFoundError{Group: g.name, Key: key}
+	}
+
+	formatted := make(Variants, len(variants))
+	for i, variant := range variants {
+		formatted[i] = fmt.Sprintf(variant) // Same as Get() with one element, so %% is still a literal %
+	}
+
+	return formatted, nil
+}
+
+// GetRandom picks one of the variants of `key` using `rng`. See GetVariants.
+func (g Group) GetRandom(key string, rng *rand.Rand) (string, error) {
+	variants, err := g.GetVariants(key)
+	if err != nil {
+		return "", err
+	}
+
+	return variants.RandomFrom(rng), nil
+}
+
+// Variants are alternative versions of the same string.
+type Variants []string
+
+// Random picks one of the variants. Returns "" if there are none. Safe for concurrent use.
+func (v Variants) Random() string {
+	if len(v) == 0 {
+		return ""
+	}
+
+	return v[rand.Intn(len(v))] //nolint:gosec // Picking a phrasing doesn't need a secure RNG
+}
+
+// RandomFrom picks one of the variants using `rng`, which makes the choice reproducible. Returns "" if there are none.
+func (v Variants) RandomFrom(rng *rand.Rand) string {
+	if len(v) == 0 {
+		return ""
+	}
+
+	return v[rng.Intn(len(v))]
+}
+
 /*
 Populate fills a struct containing only `template:""`-tagged string fields with strings from the `Group`. If the value
 of the template field tag is not in the `Group` returns an error.
+
+A field can also be a struct tagged with the name of another group. It is populated from that group the same way, so
+groups can be nested as deep as needed. A struct that only has nested groups doesn't need a group of its own.
 */
 func (g Group) Populate(typed interface{}) error {
 	rv := reflect.ValueOf(typed)
@@ -191,25 +283,94 @@ func (g Group) populateReflect(valueOf reflect.Value, typeOf reflect.Type) error
 		fieldValue := valueOf.Field(i)
 		fieldType := typeOf.Field(i)
 
-		tagValue := fieldType.Tag.Get("template")
-		if tagValue == "" {
+		key, modifiers := parseTag(fieldType.Tag.Get("template"))
+		if key == skipTag {
+			continue
+		}
+
+		if key == "" {
 			return FieldNotTaggedError{
 				Struct: typeOf.Name(),
 				Field:  fieldType.Name,
 			}
 		}
 
-		value, err := g.Get(tagValue)
+		if err := g.populateField(fieldValue, typeOf, fieldType, key, modifiers); err != nil {
+			if _, isOptional := modifiers["optional"]; isOptional && isMissing(err) {
+				logging.Warnf("Template field %s.%s is left empty: %s", typeOf.Name(), fieldType.Name, err)
+
+				if g.missing != nil {
+					*g.missing = append(*g.missing, g.name+"."+key)
+				}
+
+				continue
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// populateField fills one field of populateReflect with the string, variants or nested group of `key`.
+func (g Group) populateField(fieldValue reflect.Value, typeOf reflect.Type, fieldType reflect.StructField, key string,
+	modifiers map[string]struct{},
+) error {
+	if fieldType.Type.Kind() == reflect.Struct {
+		// The key of a struct field is the name of another group, which can have more structs in it
+		nested := Group{name: key, wrapped: g.wrapped, missing: g.missing}
+
+		return nested.populateReflect(fieldValue, fieldType.Type)
+	}
+
+	if _, isVariants := modifiers["variants"]; isVariants {
+		if fieldType.Type != reflect.TypeOf(Variants{}) {
+			return FieldTypeError{Struct: typeOf.Name(), Field: fieldType.Name, Expected: "template.Variants"}
+		}
+
+		variants, err := g.GetVariants(key)
 		if err != nil {
 			return err
 		}
 
-		fieldValue.SetString(value)
+		fieldValue.Set(reflect.ValueOf(variants))
+
+		return nil
+	}
+
+	value, err := g.Get(key)
+	if err != nil {
+		return err
 	}
 
+	fieldValue.SetString(value)
+
 	return nil
 }
 
+// isMissing is true if `err` is about a key or group that is not in the template.
+func isMissing(err error) bool {
+	var (
+		keyNotFound   KeyNotFoundError
+		groupNotFound GroupNotFoundError
+	)
+
+	return errors.As(err, &keyNotFound) || errors.As(err, &groupNotFound)
+}
+
+// parseTag splits `key,modifier1,modifier2` into the key and a set of modifiers.
+func parseTag(tag string) (string, map[string]struct{}) {
+	parts := strings.Split(tag, ",")
+	modifiers := make(map[string]struct{}, len(parts)-1)
+
+	for _, modifier := range parts[1:] {
+		modifiers[strings.TrimSpace(modifier)] = struct{}{}
+	}
+
+	return parts[0], modifiers
+}
+
 type GroupNotFoundError struct {
 	Name string
 }
@@ -244,6 +405,16 @@ func (e GroupNotTaggedError) Error() string {
 	return fmt.Sprintf("group %s in template struct %s is not tagged with \"template\".", e.Field, e.Struct)
 }
 
+type FieldTypeError struct {
+	Struct   string
+	Field    string
+	Expected string
+}
+
+func (e FieldTypeError) Error() string {
+	return fmt.Sprintf("field %s in template struct %s should have type %s", e.Field, e.Struct, e.Expected)
+}
+
 type NoTemplateStringError struct {
 	Tag    string
 	Struct string
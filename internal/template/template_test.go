@@ -1,11 +1,17 @@
 package template_test
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/m-kuzmin/daily-reporter/internal/template"
+	"github.com/m-kuzmin/daily-reporter/internal/util/logging"
 )
 
 func TestGroupGet(t *testing.T) {
@@ -168,3 +174,362 @@ templates:
 
 	t.Errorf("Expected InvalidTypeError for nil pointer, but got: %v", err)
 }
+
+func TestGetRandomReachesAllVariants(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+templates:
+  foo:
+    saved: ["Saved!", "Got it!", "100%% done"]
+...`
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	group, err := templ.Get("foo")
+	if err != nil {
+		t.Fatalf("While getting group foo: %s", err)
+	}
+
+	rng := rand.New(rand.NewSource(1)) //nolint:gosec // Deterministic on purpose
+	seen := make(map[string]bool)
+
+	for i := 0; i < 100; i++ {
+		variant, err := group.GetRandom("saved", rng)
+		if err != nil {
+			t.Fatalf("While getting a random variant: %s", err)
+		}
+
+		seen[variant] = true
+	}
+
+	for _, expected := range []string{"Saved!", "Got it!", "100% done"} {
+		if !seen[expected] {
+			t.Errorf("Variant %q was never picked, picked: %v", expected, seen)
+		}
+	}
+
+	if len(seen) != 3 {
+		t.Errorf("Expected exactly 3 variants, got %v", seen)
+	}
+}
+
+func TestPopulateVariants(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+templates:
+  foo:
+    saved: ["Saved!", "Got it!"]
+...`
+
+	var responses struct {
+		Foo struct {
+			Saved template.Variants `template:"saved,variants"`
+		} `template:"foo"`
+	}
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	if err = templ.Populate(&responses); err != nil {
+		t.Fatalf("While populating responses: %s", err)
+	}
+
+	if len(responses.Foo.Saved) != 2 || responses.Foo.Saved[0] != "Saved!" || responses.Foo.Saved[1] != "Got it!" {
+		t.Fatalf("Variants were populated incorrectly: %#v", responses.Foo.Saved)
+	}
+}
+
+func TestPopulateVariantsIntoString(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+templates:
+  foo:
+    saved: ["Saved!", "Got it!"]
+...`
+
+	var (
+		responses struct {
+			Foo struct {
+				Saved string `template:"saved,variants"`
+			} `template:"foo"`
+		}
+		errType template.FieldTypeError
+	)
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	if err = templ.Populate(&responses); !errors.As(err, &errType) {
+		t.Fatalf("Expected FieldTypeError, got %v", err)
+	}
+}
+
+func TestPopulateSkipsDashFields(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+templates:
+  foo:
+    bar: [foobar]
+...`
+
+	var responses struct {
+		Foo struct {
+			Bar     string `template:"bar"`
+			Runtime string `template:"-"`
+		} `template:"foo"`
+		Runtime map[string]string `template:"-"`
+	}
+
+	responses.Foo.Runtime = "kept"
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	if err = templ.Populate(&responses); err != nil {
+		t.Fatalf("While populating responses: %s", err)
+	}
+
+	if responses.Foo.Bar != "foobar" || responses.Foo.Runtime != "kept" || responses.Runtime != nil {
+		t.Fatalf("Skipped fields were changed or others were not filled: %#v", responses)
+	}
+}
+
+func TestPopulateNestedGroups(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+vars:
+  name: Bot
+templates:
+  settings:
+    title: ["%s settings", name]
+  reviewers:
+    shown: [shown]
+  reviewersUsage:
+    usage: [usage]
+...`
+
+	type usageResponses struct {
+		Usage string `template:"usage"`
+	}
+
+	type reviewersResponses struct {
+		Shown string         `template:"shown"`
+		Usage usageResponses `template:"reviewersUsage"`
+	}
+
+	var responses struct {
+		Settings struct {
+			Title     string             `template:"title"`
+			Reviewers reviewersResponses `template:"reviewers"`
+		} `template:"settings"`
+		// Only has nested groups, so there is no "usages" group
+		Usages struct {
+			Reviewers usageResponses `template:"reviewersUsage"`
+		} `template:"usages"`
+	}
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	if err = templ.Populate(&responses); err != nil {
+		t.Fatalf("While populating responses: %s", err)
+	}
+
+	settings := responses.Settings
+	if settings.Title != "Bot settings" || settings.Reviewers.Shown != "shown" ||
+		settings.Reviewers.Usage.Usage != "usage" {
+		t.Fatalf("Nested groups were not filled: %#v", responses)
+	}
+
+	if responses.Usages.Reviewers.Usage != "usage" {
+		t.Fatalf("A struct of groups was not filled: %#v", responses.Usages)
+	}
+}
+
+func TestPopulateMissingNestedGroup(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+templates:
+  foo:
+    bar: [foobar]
+...`
+
+	var responses struct {
+		Foo struct {
+			Bar    string `template:"bar"`
+			Nested struct {
+				Key string `template:"key"`
+			} `template:"missing"`
+		} `template:"foo"`
+	}
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	var notFound template.GroupNotFoundError
+	if err = templ.Populate(&responses); !errors.As(err, &notFound) || notFound.Name != "missing" {
+		t.Fatalf("Expected GroupNotFoundError for the nested group, got %v", err)
+	}
+}
+
+// logBuffer is the output of the logs in a test.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p) //nolint:wrapcheck // Never fails
+}
+
+func (b *logBuffer) Close() error { return nil }
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// optionalResponses has a required key and an optional string and variants.
+type optionalResponses struct {
+	Foo struct {
+		Bar      string            `template:"bar"`
+		New      string            `template:"newThing,optional"`
+		Variants template.Variants `template:"newVariants,variants,optional"`
+	} `template:"foo"`
+}
+
+func TestPopulateOptionalPresent(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+templates:
+  foo:
+    bar: [foobar]
+    newThing: [new]
+    newVariants: [a, b]
+...`
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	var responses optionalResponses
+	if err = templ.Populate(&responses); err != nil {
+		t.Fatalf("While populating responses: %s", err)
+	}
+
+	if responses.Foo.New != "new" || len(responses.Foo.Variants) != 2 {
+		t.Fatalf("Optional keys that are in the template were not filled: %#v", responses)
+	}
+}
+
+// Not parallel: the logs of the whole process are captured, the parallel tests only run after they are restored.
+func TestPopulateOptionalMissingWarns(t *testing.T) {
+	logs := &logBuffer{mu: sync.Mutex{}, buf: bytes.Buffer{}}
+	if err := logging.SetOutput(logs); err != nil {
+		t.Fatalf("While capturing the logs: %s", err)
+	}
+
+	t.Cleanup(func() { _ = logging.Close() })
+
+	const yaml = `---
+templates:
+  foo:
+    bar: [foobar]
+...`
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	var responses optionalResponses
+	if err = templ.Populate(&responses); err != nil {
+		t.Fatalf("Missing optional keys should not fail: %s", err)
+	}
+
+	if responses.Foo.Bar != "foobar" || responses.Foo.New != "" || responses.Foo.Variants != nil {
+		t.Fatalf("Missing optional keys should be left empty: %#v", responses)
+	}
+
+	if logged := logs.String(); !strings.Contains(logged, "WARN") || !strings.Contains(logged, "newThing") ||
+		!strings.Contains(logged, "newVariants") {
+		t.Errorf("Expected a warning for each missing optional key, got %q", logged)
+	}
+}
+
+func TestPopulateRequiredMissingFails(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+templates:
+  foo:
+    newThing: [new]
+...`
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	var (
+		responses optionalResponses
+		notFound  template.KeyNotFoundError
+	)
+
+	if err = templ.Populate(&responses); !errors.As(err, &notFound) || notFound.Key != "bar" {
+		t.Fatalf("Expected KeyNotFoundError for the required key, got %v", err)
+	}
+}
+
+func TestPopulateMissingListsOptionalKeys(t *testing.T) {
+	t.Parallel()
+
+	const yaml = `---
+templates:
+  foo:
+    bar: [foobar]
+    newThing: [new]
+...`
+
+	templ, err := template.NewTemplate([]byte(yaml))
+	if err != nil {
+		t.Fatalf("While parsing template YAML: %s", err)
+	}
+
+	var responses optionalResponses
+
+	missing, err := templ.PopulateMissing(&responses)
+	if err != nil {
+		t.Fatalf("Missing optional keys should not fail: %s", err)
+	}
+
+	if expected := []string{"foo.newVariants"}; !reflect.DeepEqual(missing, expected) {
+		t.Fatalf("Expected missing keys %v, got %v", expected, missing)
+	}
+}
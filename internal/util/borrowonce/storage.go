@@ -10,6 +10,7 @@ given to the person before and then wait until that person is done playing with
 package borrowonce
 
 import (
+	"context"
 	"fmt"
 	"sync"
 )
@@ -52,6 +53,19 @@ func (s *Storage[K, V]) Set(key K, value V) {
 	}
 }
 
+// Keys returns the keys in the storage in no particular order, including the ones that are borrowed right now.
+func (s *Storage[K, V]) Keys() []K {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+
+	keys := make([]K, 0, len(s.store))
+	for key := range s.store {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
 /*
 Borrow gives you a Future which is like a position in the queue to access and mutate the value. If the key doesnt exist
 in the map you will get `nil, false`.
@@ -65,20 +79,20 @@ func (s *Storage[K, V]) Borrow(key K) (*Future[V], bool) {
 		return nil, false
 	}
 
-	future := &Future[V]{
-		vMu: sync.Mutex{},
-		v:   *new(V),
-	}
-
 	if len(value.queue) == 0 && !value.borrowed {
 		value.borrowed = true
 		s.store[key] = value
-		future.v = value.value
 
-		return future, found
+		return NewImmediateFuture(value.value), true
 	}
 
-	future.vMu.Lock()
+	future := &Future[V]{
+		turn:  make(chan struct{}),
+		given: false,
+		v:     *new(V),
+		leave: nil,
+	}
+	future.leave = func() bool { return s.leaveQueue(key, future) }
 	value.queue = append(value.queue, future)
 	s.store[key] = value
 
@@ -100,36 +114,103 @@ func (s *Storage[K, V]) Return(key K, value V) {
 	if len(lockable.queue) == 0 {
 		lockable.borrowed = false
 	} else {
-		lockable.queue[0].v = value
-		lockable.queue[0].vMu.Unlock()
+		lockable.queue[0].give(value)
 		lockable.queue = lockable.queue[1:]
 	}
 
 	s.store[key] = lockable
 }
 
+/*
+leaveQueue removes a future that no longer wants the value from the queue of `key`. Returns false if it's too late
+because the value has already been given to the future.
+*/
+func (s *Storage[K, V]) leaveQueue(key K, future *Future[V]) bool {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+
+	if future.given {
+		return false
+	}
+
+	lockable := s.store[key]
+	for i, queued := range lockable.queue {
+		if queued == future {
+			lockable.queue = append(lockable.queue[:i:i], lockable.queue[i+1:]...)
+
+			break
+		}
+	}
+
+	s.store[key] = lockable
+
+	return true
+}
+
 /*
 Future allows you request a position in the borrow queue and Wait() your turn.
 */
 type Future[V any] struct {
-	vMu sync.Mutex //nolint:structcheck // Is used!
-	v   V          //nolint:structcheck // Is used!
+	turn  chan struct{} //nolint:structcheck // Closed once the value is given to this future
+	given bool          //nolint:structcheck // Same as `turn` being closed, but guarded by Storage.storeMu
+	v     V             //nolint:structcheck // Is used!
+	leave func() bool   //nolint:structcheck // Storage.leaveQueue for this future, nil if it never queued
 }
 
+// NewImmediateFuture is a Future that already has the value `v`.
 func NewImmediateFuture[V any](v V) *Future[V] {
-	return &Future[V]{v: v}
+	future := &Future[V]{
+		turn:  make(chan struct{}),
+		given: false,
+		v:     *new(V),
+		leave: nil,
+	}
+	future.give(v)
+
+	return future
 }
 
 /*
 Wait will return the value once it is your turn to have it. After you are done with it you have to call Storage.Return
 */
 func (f *Future[V]) Wait() V { //nolint:golint // Is confusing Storage and Future
-	f.vMu.Lock()
-	defer f.vMu.Unlock()
+	<-f.turn
 
 	return f.v
 }
 
+/*
+WaitContext is Wait that gives up once `ctx` is done. If it returns false the future has left the queue and the value
+will be given to the next borrower instead, so you must not call Storage.Return. If the value arrives just as `ctx` is
+done you still get it and have to return it as usual.
+*/
+func (f *Future[V]) WaitContext(ctx context.Context) (V, bool) {
+	select {
+	case <-f.turn:
+		return f.v, true
+	default:
+	}
+
+	select {
+	case <-f.turn:
+		return f.v, true
+	case <-ctx.Done():
+		if f.leave == nil || !f.leave() {
+			// Too late, it's our turn already
+			return f.Wait(), true
+		}
+
+		return *new(V), false
+	}
+}
+
+// give hands the value to the future. Storage.storeMu must be locked, unless the future was never queued.
+func (f *Future[V]) give(value V) {
+	f.v = value
+	f.given = true
+	close(f.turn)
+}
+
 /*
 borrowable stores the current version of the value as well as a list of borrowers. Once the value is returned it will be
 updated and the next borrower will get that new version.
@@ -1,6 +1,8 @@
 package borrowonce_test
 
 import (
+	"context"
+	"sort"
 	"testing"
 	"time"
 
@@ -151,3 +153,93 @@ func TestFutureAwaitReturnsUpdatedValue(t *testing.T) {
 		t.Fatalf("The value has not been updated, it's: %q", latestValue)
 	}
 }
+
+func TestKeys(t *testing.T) {
+	t.Parallel()
+
+	store := borrowonce.NewStorage[string, string]()
+
+	store.Set(key, value)
+	store.Set(value, key)
+	store.Borrow(key) // Borrowed keys are still listed
+
+	keys := store.Keys()
+	sort.Strings(keys)
+
+	if len(keys) != 2 || keys[0] != key || keys[1] != value {
+		t.Fatalf("Expected keys %q and %q, got %q", key, value, keys)
+	}
+}
+
+func TestWaitContextGivesUpAndPassesTheTurn(t *testing.T) {
+	t.Parallel()
+
+	store := borrowonce.NewStorage[string, string]()
+
+	store.Set(key, "original")
+	store.Borrow(key)
+	givingUp, _ := store.Borrow(key)
+	next, _ := store.Borrow(key)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, ok := givingUp.WaitContext(ctx); ok {
+		t.Fatal("WaitContext returned a value that was never returned to the store")
+	}
+
+	store.Return(key, "new")
+
+	if got, ok := next.WaitContext(context.Background()); !ok || got != "new" {
+		t.Fatalf("The future after the one that gave up did not get the value: %q, %t", got, ok)
+	}
+}
+
+func TestWaitContextReturnsValueThatArrivedFirst(t *testing.T) {
+	t.Parallel()
+
+	store := borrowonce.NewStorage[string, string]()
+
+	store.Set(key, "original")
+	store.Borrow(key)
+	future, _ := store.Borrow(key)
+
+	store.Return(key, "new")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Both the value and ctx are ready, the turn must not be lost
+	if got, ok := future.WaitContext(ctx); !ok || got != "new" {
+		t.Fatalf("Expected the value that was already given, got %q, %t", got, ok)
+	}
+}
+
+func TestWaitContextBlocksUntilTurn(t *testing.T) {
+	t.Parallel()
+
+	store := borrowonce.NewStorage[string, string]()
+
+	store.Set(key, value)
+	store.Borrow(key)
+	future, _ := store.Borrow(key)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, ok := future.WaitContext(ctx); ok {
+		t.Fatal("WaitContext returned before the value was returned")
+	}
+
+	store.Return(key, "new")
+
+	// The future has left the queue so the value is free again instead of being given to it
+	fresh, _ := store.Borrow(key)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if got, ok := fresh.WaitContext(ctx); !ok || got != "new" {
+		t.Fatalf("The value was not freed by the future that gave up: %q, %t", got, ok)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+cache is an in-memory key-value store where every value expires after its own TTL. Expired values are never returned:
+they are deleted lazily when they are looked up, and Prune (or PruneEvery in a goroutine) deletes the rest so that
+values that are never looked up again dont stay in memory forever.
+*/
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is safe for concurrent use. Create it with New.
+type Cache[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]entry[V]
+	// now is time.Now, replaced in tests
+	now func() time.Time
+}
+
+type entry[V any] struct {
+	value V
+	// expiresAt is zero for values that never expire
+	expiresAt time.Time
+}
+
+// New creates an empty cache.
+func New[K comparable, V any]() *Cache[K, V] {
+	return newWithClock[K, V](time.Now)
+}
+
+func newWithClock[K comparable, V any](now func() time.Time) *Cache[K, V] {
+	return &Cache[K, V]{
+		mu:      sync.Mutex{},
+		entries: make(map[K]entry[V]),
+		now:     now,
+	}
+}
+
+// Get returns the value of `key` if it is in the cache and hasn't expired.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found, exists := c.entries[key]
+	if !exists {
+		return *new(V), false
+	}
+
+	if found.isExpired(c.now()) {
+		delete(c.entries, key)
+
+		return *new(V), false
+	}
+
+	return found.value, true
+}
+
+// Set stores the value for `ttl`, replacing the old value and its TTL. A value with `ttl` <= 0 never expires.
+func (c *Cache[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = entry[V]{value: value, expiresAt: c.expiresAt(ttl)}
+}
+
+/*
+Add stores the value only if `key` isn't in the cache or has expired. Returns false if there is a value already, then
+the value and its TTL are not changed.
+*/
+func (c *Cache[K, V]) Add(key K, value V, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if found, exists := c.entries[key]; exists && !found.isExpired(c.now()) {
+		return false
+	}
+
+	c.entries[key] = entry[V]{value: value, expiresAt: c.expiresAt(ttl)}
+
+	return true
+}
+
+// Delete removes `key` from the cache. Nothing happens if it isn't there.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// Len returns how many values are stored, including the expired ones that weren't deleted yet.
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// Prune deletes all expired values.
+func (c *Cache[K, V]) Prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+
+	for key, found := range c.entries {
+		if found.isExpired(now) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// PruneEvery calls Prune every `interval` until the context is done. Run it in a goroutine.
+func (c *Cache[K, V]) PruneEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Prune()
+		}
+	}
+}
+
+// expiresAt returns when a value stored now with `ttl` expires. Zero time means never.
+func (c *Cache[K, V]) expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return c.now().Add(ttl)
+}
+
+func (e entry[V]) isExpired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
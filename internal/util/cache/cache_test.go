@@ -0,0 +1,174 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-kuzmin/daily-reporter/internal/util/cache"
+)
+
+// fakeClock is a clock that only moves when the test says so.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestExpiry(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	values := cache.NewWithClock[string, int](clock.Now)
+
+	values.Set("short", 1, time.Minute)
+	values.Set("long", 2, time.Hour)
+	values.Set("forever", 3, 0)
+
+	clock.Advance(time.Minute)
+
+	if _, found := values.Get("short"); found {
+		t.Error("Value was returned after its TTL")
+	}
+
+	if value, found := values.Get("long"); !found || value != 2 {
+		t.Errorf("Value expired too early: %d, %t", value, found)
+	}
+
+	clock.Advance(24 * time.Hour)
+
+	if value, found := values.Get("forever"); !found || value != 3 {
+		t.Errorf("Value without a TTL has expired: %d, %t", value, found)
+	}
+}
+
+func TestOverwriteReplacesTTL(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	values := cache.NewWithClock[string, string](clock.Now)
+
+	values.Set("key", "old", time.Minute)
+	values.Set("key", "new", time.Hour)
+
+	clock.Advance(2 * time.Minute)
+
+	if value, found := values.Get("key"); !found || value != "new" {
+		t.Fatalf("Expected the new value with the new TTL, got %q, %t", value, found)
+	}
+}
+
+func TestPruneDeletesExpired(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	values := cache.NewWithClock[int, int](clock.Now)
+
+	for i := 0; i < 10; i++ {
+		values.Set(i, i, time.Duration(i+1)*time.Minute)
+	}
+
+	clock.Advance(5 * time.Minute)
+	values.Prune()
+
+	if values.Len() != 5 {
+		t.Fatalf("Expected 5 values after pruning, got %d", values.Len())
+	}
+}
+
+func TestPruneEveryStopsWithContext(t *testing.T) {
+	t.Parallel()
+
+	values := cache.New[string, int]()
+	values.Set("key", 1, time.Nanosecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		values.PruneEvery(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for values.Len() != 0 {
+		select {
+		case <-deadline:
+			t.Fatal("Expired value was not pruned in the background")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-done
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	values := cache.New[string, int]()
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprint(i % 10)
+
+				values.Set(key, worker, time.Duration(i%3)*time.Millisecond)
+				values.Get(key)
+
+				if i%100 == 0 {
+					values.Prune()
+					values.Delete(key)
+				}
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+}
+
+func TestAddKeepsExistingValue(t *testing.T) {
+	t.Parallel()
+
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	values := cache.NewWithClock[string, int](clock.Now)
+
+	if !values.Add("key", 1, time.Minute) {
+		t.Fatal("Add refused a new key")
+	}
+
+	if values.Add("key", 2, time.Minute) {
+		t.Fatal("Add replaced a value that hasn't expired")
+	}
+
+	clock.Advance(time.Minute)
+
+	if !values.Add("key", 3, time.Minute) {
+		t.Fatal("Add refused to replace an expired value")
+	}
+
+	if value, _ := values.Get("key"); value != 3 {
+		t.Fatalf("Expected 3, got %d", value)
+	}
+}
@@ -0,0 +1,8 @@
+package cache
+
+import "time"
+
+// NewWithClock creates a cache that uses `now` instead of time.Now.
+func NewWithClock[K comparable, V any](now func() time.Time) *Cache[K, V] {
+	return newWithClock[K, V](now)
+}
@@ -0,0 +1,47 @@
+// fuzzy compares strings that are almost the same, e.g. a command with a typo.
+package fuzzy
+
+/*
+Levenshtein returns the number of single character insertions, deletions and substitutions needed to turn `a` into
+`b`. Characters are runes, not bytes.
+*/
+func Levenshtein(a, b string) int {
+	source, target := []rune(a), []rune(b)
+
+	// previous and current are two rows of the distance matrix
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i, sourceChar := range source {
+		current[0] = i + 1
+
+		for j, targetChar := range target {
+			substitution := previous[j]
+			if sourceChar != targetChar {
+				substitution++
+			}
+
+			current[j+1] = minOf(previous[j+1]+1, current[j]+1, substitution)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(target)]
+}
+
+func minOf(first int, others ...int) int {
+	result := first
+
+	for _, other := range others {
+		if other < result {
+			result = other
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,31 @@
+package fuzzy_test
+
+import (
+	"testing"
+
+	"github.com/m-kuzmin/daily-reporter/internal/util/fuzzy"
+)
+
+func TestLevenshtein(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"dailystatus", "dailystatus", 0},
+		{"dailstatus", "dailystatus", 1},
+		{"dialystatus", "dailystatus", 2},
+		{"kitten", "sitting", 3},
+		{"привет", "привте", 2},
+	}
+
+	for _, c := range cases {
+		if distance := fuzzy.Levenshtein(c.a, c.b); distance != c.expected {
+			t.Errorf("Levenshtein(%q, %q) = %d, expected %d", c.a, c.b, distance, c.expected)
+		}
+	}
+}
@@ -3,18 +3,29 @@ package logging
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"sync"
 )
 
 //nolint:gochecknoglobals,golint // Global log level of the application
 var LogLevel = LogLevelInfo
 
+//nolint:gochecknoglobals // The logger is global too
+var (
+	outputMu sync.Mutex
+	// output is the file set with SetOutput. It's nil while logging to stderr.
+	output io.WriteCloser
+)
+
 type logLevel int
 
 const (
 	LogLevelTrace logLevel = iota
 	LogLevelDebug
 	LogLevelInfo
+	LogLevelWarn
 	LogLevelError
 	LogLevelFatal
 )
@@ -41,6 +52,13 @@ func Infof(fmtStr string, v ...any) {
 	}
 }
 
+// Warnf is for problems that the bot works around, e.g. a missing optional string in the template.
+func Warnf(fmtStr string, v ...any) {
+	if LogLevel <= LogLevelWarn {
+		log.Printf(fmt.Sprintf("WARN    : %s\n", fmtStr), v...) //nolint:forbidigo // Allowed here only
+	}
+}
+
 func Errorf(fmtStr string, v ...any) {
 	if LogLevel <= LogLevelError {
 		log.Printf(fmt.Sprintf("ERROR   : %s\n", fmtStr), v...) //nolint:forbidigo // Allowed here only
@@ -52,3 +70,56 @@ func Fatalf(fmtStr string, v ...any) {
 		log.Fatalf(fmt.Sprintf("FATAL   : %s\n", fmtStr), v...) //nolint:forbidigo // Allowed here only
 	}
 }
+
+/*
+SetOutput writes the logs to `out` instead of stderr. The previous output is closed. Call Close before exiting, so that
+`out` is flushed and closed.
+*/
+func SetOutput(out io.WriteCloser) error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	log.SetOutput(out) //nolint:forbidigo // Allowed here only
+
+	err := closeOutput()
+	output = out
+
+	return err
+}
+
+/*
+Close flushes and closes the output set with SetOutput. The logs are written to stderr after that, so it is safe to log
+during the shutdown, even after Close.
+*/
+func Close() error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	log.SetOutput(os.Stderr) //nolint:forbidigo // Allowed here only
+
+	return closeOutput()
+}
+
+// closeOutput syncs the output to the disk if it is a file and closes it. Must be called with outputMu held.
+func closeOutput() error {
+	if output == nil {
+		return nil
+	}
+
+	out := output
+	output = nil
+
+	if file, isFile := out.(*os.File); isFile {
+		if err := file.Sync(); err != nil {
+			_ = file.Close()
+
+			return fmt.Errorf("while flushing the log file: %w", err)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("while closing the log output: %w", err)
+	}
+
+	return nil
+}
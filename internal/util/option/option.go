@@ -87,6 +87,13 @@ func (o Option[T]) UnwrapOrElse(f func() T) T {
 }
 
 func (o *Option[T]) UnmarshalJSON(data []byte) error {
+	// MarshalJSON encodes None as null, so it has to be decoded back into None instead of Some with a zero value
+	if string(data) == "null" {
+		*o = None[T]()
+
+		return nil
+	}
+
 	var parsed T
 
 	err := json.Unmarshal(data, &parsed)
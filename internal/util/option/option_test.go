@@ -0,0 +1,101 @@
+package option_test
+
+import (
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/m-kuzmin/daily-reporter/internal/util/option"
+)
+
+type inner struct {
+	Value option.Option[int] `json:"value"`
+}
+
+type outer struct {
+	Inner option.Option[inner] `json:"inner"`
+}
+
+func TestUnmarshalNullIsNone(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]func(outer) bool{
+		`{"inner": null}`: func(o outer) bool { return o.Inner.IsNone() },
+		`{}`:              func(o outer) bool { return o.Inner.IsNone() },
+		` { "inner" : { "value" : null } } `: func(o outer) bool {
+			in, isSome := o.Inner.Unwrap()
+
+			return isSome && in.Value.IsNone()
+		},
+		`{"inner": {}}`: func(o outer) bool {
+			in, isSome := o.Inner.Unwrap()
+
+			return isSome && in.Value.IsNone()
+		},
+		`{"inner": {"value": 0}}`: func(o outer) bool {
+			in, isSome := o.Inner.Unwrap()
+			value, isSet := in.Value.Unwrap()
+
+			return isSome && isSet && value == 0
+		},
+	}
+
+	for data, isExpected := range cases {
+		var decoded outer
+		if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+			t.Errorf("While decoding %s: %s", data, err)
+
+			continue
+		}
+
+		if !isExpected(decoded) {
+			t.Errorf("%s was decoded as %#v", data, decoded)
+		}
+	}
+}
+
+func TestUnmarshalOverwritesSome(t *testing.T) {
+	t.Parallel()
+
+	decoded := option.Some("old")
+	if err := json.Unmarshal([]byte("null"), &decoded); err != nil {
+		t.Fatalf("While decoding null: %s", err)
+	}
+
+	if decoded.IsSome() {
+		t.Fatalf("null should replace Some with None, got %#v", decoded)
+	}
+}
+
+func FuzzOptionJSON(f *testing.F) {
+	for _, seed := range []string{"", "null", `"null"`, "text", `{"a": null}`} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		if !utf8.ValidString(value) {
+			t.Skip("encoding/json replaces invalid UTF-8, so the string can't be decoded back")
+		}
+
+		encoded, err := json.Marshal(option.Some(value))
+		if err != nil {
+			t.Fatalf("While encoding %q: %s", value, err)
+		}
+
+		var decoded option.Option[string]
+		if err = json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatalf("While decoding %s: %s", encoded, err)
+		}
+
+		if got, isSome := decoded.Unwrap(); !isSome || got != value {
+			t.Fatalf("Some(%q) was decoded as %#v", value, decoded)
+		}
+
+		// Decoding arbitrary input as nested options must not panic
+		var nested outer
+		if json.Unmarshal([]byte(value), &nested) == nil {
+			in, _ := nested.Inner.Unwrap()
+			in.Value.Unwrap()
+		}
+	})
+}
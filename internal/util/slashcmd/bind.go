@@ -0,0 +1,237 @@
+package slashcmd
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const requiredOption = "required"
+
+/*
+Bind fills the fields of the struct `typed` points to from the command's arguments. Fields are selected with tags:
+
+	var args struct {
+		After   string `arg:"after"`          // "/cmd after Mg" sets After to "Mg"
+		Date    string `arg:"date,required"`  // Like `arg`, but Bind fails if there is no "date <value>"
+		Verbose bool   `flag:"verbose"`       // true if "verbose" is one of the arguments
+		ID      string `pos:"0,required"`     // The first argument that is not a named arg or a flag
+	}
+
+Names are matched case insensitive. `arg` and `pos` fields can be strings or integers, `flag` fields must be bools.
+Fields without tags are left as they are. Returns MissingArgError if a required argument wasn't found.
+*/
+func Bind(cmd Command, typed interface{}) error {
+	rv := reflect.ValueOf(typed)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return InvalidTypeError{Type: fmt.Sprintf("%T", typed)}
+	}
+
+	fields, err := bindFields(rv.Elem().Type())
+	if err != nil {
+		return err
+	}
+
+	values, positional := matchArgs(cmd.Args, fields)
+
+	for _, field := range fields {
+		value, found := values[field.index]
+
+		if field.kind == positionalArg {
+			found = field.position < len(positional)
+			if found {
+				value = positional[field.position]
+			}
+		}
+
+		if !found {
+			if field.required {
+				return MissingArgError{Name: field.name}
+			}
+
+			continue
+		}
+
+		if err = setField(rv.Elem().Field(field.index), field, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type argKind int
+
+const (
+	namedArg argKind = iota
+	flagArg
+	positionalArg
+)
+
+// bindField is a struct field and how it's filled from the arguments.
+type bindField struct {
+	index int
+	// structField is the name of the field in the struct
+	structField string
+	kind        argKind
+	// name is how the argument is called in the command, or its number for positional arguments
+	name     string
+	position int
+	required bool
+}
+
+// bindFields reads the tags of the struct's fields.
+func bindFields(typeOf reflect.Type) ([]bindField, error) {
+	fields := make([]bindField, 0, typeOf.NumField())
+
+	for i := 0; i < typeOf.NumField(); i++ {
+		structField := typeOf.Field(i)
+
+		for kind, tagName := range [...]string{namedArg: "arg", flagArg: "flag", positionalArg: "pos"} {
+			tag, isTagged := structField.Tag.Lookup(tagName)
+			if !isTagged {
+				continue
+			}
+
+			name, option, _ := strings.Cut(tag, ",")
+			field := bindField{
+				index:       i,
+				structField: structField.Name,
+				kind:        argKind(kind),
+				name:        name,
+				position:    0,
+				required:    option == requiredOption,
+			}
+
+			if field.kind == positionalArg {
+				position, err := strconv.Atoi(name)
+				if err != nil || position < 0 {
+					return nil, FieldTypeError{Field: structField.Name, Expected: "a position (pos:\"0\")"}
+				}
+
+				field.name = fmt.Sprintf("argument #%d", position+1)
+				field.position = position
+			}
+
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, nil
+}
+
+/*
+matchArgs finds the values of named args and flags by field index. The rest of the arguments are returned in order as
+positional arguments. A named arg without a value after it is treated as positional.
+*/
+func matchArgs(args []string, fields []bindField) (map[int]string, []string) {
+	var (
+		values     = make(map[int]string)
+		positional = []string{}
+	)
+
+	findField := func(arg string, kind argKind) (bindField, bool) {
+		for _, field := range fields {
+			if field.kind == kind && strings.EqualFold(field.name, arg) {
+				return field, true
+			}
+		}
+
+		return bindField{}, false //nolint:exhaustruct // Not found
+	}
+
+	for i := 0; i < len(args); i++ {
+		if field, isNamed := findField(args[i], namedArg); isNamed && i+1 < len(args) {
+			values[field.index] = args[i+1]
+			i++
+
+			continue
+		}
+
+		if field, isFlag := findField(args[i], flagArg); isFlag {
+			values[field.index] = "true"
+
+			continue
+		}
+
+		positional = append(positional, args[i])
+	}
+
+	return values, positional
+}
+
+// setField converts the argument to the field's type.
+func setField(fieldValue reflect.Value, field bindField, value string) error {
+	if field.kind == flagArg {
+		if fieldValue.Kind() != reflect.Bool {
+			return FieldTypeError{Field: field.structField, Expected: "bool"}
+		}
+
+		fieldValue.SetBool(value == "true")
+
+		return nil
+	}
+
+	switch fieldValue.Kind() { //nolint:exhaustive // Other kinds are errors
+	case reflect.String:
+		fieldValue.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, fieldValue.Type().Bits())
+		if err != nil {
+			return InvalidArgError{Name: field.name, Value: value, Expected: "a number"}
+		}
+
+		fieldValue.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(value, 10, fieldValue.Type().Bits())
+		if err != nil {
+			return InvalidArgError{Name: field.name, Value: value, Expected: "a positive number"}
+		}
+
+		fieldValue.SetUint(parsed)
+	default:
+		return FieldTypeError{Field: field.structField, Expected: "string or integer"}
+	}
+
+	return nil
+}
+
+// InvalidTypeError is returned when Bind gets something other than a non-nil pointer to a struct.
+type InvalidTypeError struct {
+	Type string
+}
+
+func (e InvalidTypeError) Error() string {
+	return fmt.Sprintf("slashcmd.Bind() only works with non-nil pointers to structs. A `%s` was passed in instead", e.Type)
+}
+
+// MissingArgError is returned when a required argument is not in the command.
+type MissingArgError struct {
+	Name string
+}
+
+func (e MissingArgError) Error() string {
+	return fmt.Sprintf("required argument %q is missing", e.Name)
+}
+
+// InvalidArgError is returned when an argument can't be converted to the type of its field.
+type InvalidArgError struct {
+	Name     string
+	Value    string
+	Expected string
+}
+
+func (e InvalidArgError) Error() string {
+	return fmt.Sprintf("argument %q should be %s, but it is %q", e.Name, e.Expected, e.Value)
+}
+
+// FieldTypeError is returned when a field's type or tag can't be used for arguments.
+type FieldTypeError struct {
+	Field    string
+	Expected string
+}
+
+func (e FieldTypeError) Error() string {
+	return fmt.Sprintf("field %s should be %s to bind arguments to it", e.Field, e.Expected)
+}
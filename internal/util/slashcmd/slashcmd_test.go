@@ -1,6 +1,7 @@
 package slashcmd_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/m-kuzmin/daily-reporter/internal/util/slashcmd"
@@ -157,3 +158,80 @@ func TestNamedArgBeforeEnd(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestBind(t *testing.T) {
+	t.Parallel()
+
+	cmd, _ := slashcmd.Parse(`/listProjects PVT_1 AFTER Mg verbose "second arg" limit 5`)
+
+	var args struct {
+		After   string `arg:"after"`
+		Limit   uint   `arg:"limit"`
+		Date    string `arg:"date"`
+		Verbose bool   `flag:"verbose"`
+		Quiet   bool   `flag:"quiet"`
+		ID      string `pos:"0,required"`
+		Second  string `pos:"1"`
+		Third   string `pos:"2"`
+		Ignored string
+	}
+
+	if err := slashcmd.Bind(cmd, &args); err != nil {
+		t.Fatalf("While binding: %s", err)
+	}
+
+	if args.After != "Mg" || args.Limit != 5 || args.Date != "" {
+		t.Errorf("Named args are wrong: %#v", args)
+	}
+
+	if !args.Verbose || args.Quiet {
+		t.Errorf("Flags are wrong: %#v", args)
+	}
+
+	if args.ID != "PVT_1" || args.Second != "second arg" || args.Third != "" {
+		t.Errorf("Positional args are wrong: %#v", args)
+	}
+}
+
+func TestBindMissingRequired(t *testing.T) {
+	t.Parallel()
+
+	var args struct {
+		Date string `arg:"date,required"`
+	}
+
+	// "date" without a value is not a named arg
+	for _, source := range []string{"/dailyStatus", "/dailyStatus date"} {
+		cmd, _ := slashcmd.Parse(source)
+
+		var missing slashcmd.MissingArgError
+		if err := slashcmd.Bind(cmd, &args); !errors.As(err, &missing) || missing.Name != "date" {
+			t.Errorf("%s: expected MissingArgError for date, got %v", source, err)
+		}
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	t.Parallel()
+
+	cmd, _ := slashcmd.Parse("/cmd limit many verbose")
+
+	var invalidArg slashcmd.InvalidArgError
+	if err := slashcmd.Bind(cmd, &struct {
+		Limit int `arg:"limit"`
+	}{}); !errors.As(err, &invalidArg) {
+		t.Errorf("Expected InvalidArgError for a number that isn't a number, got %v", err)
+	}
+
+	var fieldType slashcmd.FieldTypeError
+	if err := slashcmd.Bind(cmd, &struct {
+		Verbose string `flag:"verbose"`
+	}{}); !errors.As(err, &fieldType) {
+		t.Errorf("Expected FieldTypeError for a string flag, got %v", err)
+	}
+
+	var invalidType slashcmd.InvalidTypeError
+	if err := slashcmd.Bind(cmd, struct{}{}); !errors.As(err, &invalidType) {
+		t.Errorf("Expected InvalidTypeError for a struct that isn't a pointer, got %v", err)
+	}
+}